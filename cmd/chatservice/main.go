@@ -5,8 +5,10 @@ import (
     "context"
     "log/slog"
     "net"
+    "net/http"
     "os"
     "os/signal"
+    "strconv"
     "syscall"
     "time"
 
@@ -14,7 +16,13 @@ import (
     "google.golang.org/grpc/reflection"
     "github.com/joho/godotenv"
 
+    "Thoth/internal/blobstore"
     "Thoth/internal/chatservice"
+    "Thoth/internal/handlers"
+    "Thoth/internal/metrics"
+    "Thoth/internal/moderation"
+    "Thoth/internal/ratelimit"
+    "Thoth/internal/retention"
     "Thoth/internal/storage"
     "Thoth/proto/chatpb"
 )
@@ -44,12 +52,83 @@ func main() {
     defer store.Close()
     serverLogger.Info("Database connection established")
 
+    if err := store.Migrate(context.Background()); err != nil {
+        serverLogger.Error("Database migration failed", "error", err)
+        os.Exit(1)
+    }
+
     // Создаем Chat Service
     chatSvc := chatservice.NewChatService(store)
+    if os.Getenv("THOTH_MODERATION") != "off" {
+        words, err := moderation.LoadWordlist(os.Getenv("THOTH_MODERATION_WORDLIST"))
+        if err != nil {
+            serverLogger.Error("Failed to load moderation wordlist", "error", err)
+            os.Exit(1)
+        }
+        chatSvc.Filters = moderation.NewDefaultChain(store, words)
+    } else {
+        serverLogger.Warn("Message filters are disabled")
+    }
+
+    // Фоновая очистка сообщений по политикам хранения. Файлы вложений удаляются из того же
+    // хранилища, что использует cmd/server
+    blobs, err := blobstore.FromEnv()
+    if err != nil {
+        serverLogger.Error("Blob storage setup failed", "error", err)
+        os.Exit(1)
+    }
+    janitor := retention.NewJanitor(store, blobs)
+    if v := os.Getenv("THOTH_RETENTION_INTERVAL"); v != "" {
+        interval, err := time.ParseDuration(v)
+        if err != nil || interval <= 0 {
+            serverLogger.Error("Invalid THOTH_RETENTION_INTERVAL", "value", v)
+            os.Exit(1)
+        }
+        janitor.Interval = interval
+    }
+    if v := os.Getenv("THOTH_RETENTION_BATCH_SIZE"); v != "" {
+        batch, err := strconv.Atoi(v)
+        if err != nil || batch <= 0 {
+            serverLogger.Error("Invalid THOTH_RETENTION_BATCH_SIZE", "value", v)
+            os.Exit(1)
+        }
+        janitor.BatchSize = batch
+    }
+    go janitor.Run()
+
+    // Метрики для Prometheus: как и в cmd/server, только с токеном администратора
+    adminToken := os.Getenv("THOTH_ADMIN_TOKEN")
+    if adminToken == "" {
+        serverLogger.Warn("THOTH_ADMIN_TOKEN is not set, metrics are disabled")
+    }
+    metricsAddr := os.Getenv("THOTH_METRICS_ADDR")
+    if metricsAddr == "" {
+        metricsAddr = "127.0.0.1:9091"
+    }
+    metricsSrv := &http.Server{Addr: metricsAddr, Handler: handlers.RequireAdmin(adminToken, metrics.Handler().ServeHTTP)}
+    go func() {
+        serverLogger.Info("Metrics server is listening", "address", metricsAddr)
+        if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            serverLogger.Error("Metrics server failed", "error", err)
+        }
+    }()
+
+    // Лимиты частоты запросов по пользователю и IP
+    interceptors := []grpc.UnaryServerInterceptor{loggingInterceptor}
+    limiter, err := ratelimit.Configure(os.Getenv("THOTH_RATE_LIMITS"))
+    if err != nil {
+        serverLogger.Error("Invalid THOTH_RATE_LIMITS", "error", err)
+        os.Exit(1)
+    }
+    if limiter != nil {
+        interceptors = append(interceptors, limiter.UnaryServerInterceptor(chatservice.RateClass, chatservice.RateCaller))
+    } else {
+        serverLogger.Warn("Rate limiting is disabled")
+    }
 
     // Создаем gRPC сервер
     grpcServer := grpc.NewServer(
-        grpc.UnaryInterceptor(loggingInterceptor),
+        grpc.ChainUnaryInterceptor(interceptors...),
     )
 
     // Регистрируем наш сервис
@@ -102,6 +181,9 @@ func main() {
         grpcServer.Stop()
     }
 
+    janitor.Stop()
+    metricsSrv.Close()
+
     serverLogger.Info("Chat Service shutdown complete")
 }
 
@@ -1,21 +1,43 @@
 package main
 
 import (
+    "cmp"
     "context"
+    "crypto/rand"
     "crypto/tls"
+    "encoding/hex"
     "fmt"
     "net"
     "net/http"
     "os"
     "os/signal"
+    "strconv"
+    "strings"
     "syscall"
     "time"
 	"log/slog"
     "github.com/joho/godotenv"
+    "github.com/pion/webrtc/v4"
 
+    "Thoth/internal/auth"
+    "Thoth/internal/blobstore"
+    "Thoth/internal/calls"
     "Thoth/internal/handlers"
+    "Thoth/internal/ice"
+    "Thoth/internal/meetings"
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+    "Thoth/internal/moderation"
+    "Thoth/internal/notify"
+    "Thoth/internal/ratelimit"
+    "Thoth/internal/recording"
+    "Thoth/internal/sfu"
     "Thoth/internal/websocket"
     "Thoth/internal/storage"
+    "Thoth/internal/turn"
+    "Thoth/internal/unfurl"
+    "Thoth/internal/webhooks"
+    "Thoth/internal/webpush"
 )
 
 var mainLogger = slog.With("component", "main")
@@ -50,20 +72,292 @@ func main() {
     defer store.Close()
     mainLogger.Info("Connection to the database has been established")
 
+    if err := store.Migrate(context.Background()); err != nil {
+        mainLogger.Error("Database migration failed", "error", err)
+		os.Exit(1)
+    }
+
+    // Внешний адрес сервера и токен административного API
+    publicURL := os.Getenv("THOTH_PUBLIC_URL")
+    if publicURL == "" {
+        publicURL = "https://localhost:8443"
+    }
+    adminToken := os.Getenv("THOTH_ADMIN_TOKEN")
+    if adminToken == "" {
+        mainLogger.Warn("THOTH_ADMIN_TOKEN is not set, admin API is disabled")
+    }
+
+    // Ключ подписи токенов участников. Без него токены не переживают перезапуск
+    var signer *auth.Signer
+    if secret := os.Getenv("THOTH_TOKEN_SECRET"); secret != "" {
+        signer = auth.NewSigner([]byte(secret))
+    } else {
+        mainLogger.Warn("THOTH_TOKEN_SECRET is not set, using a random key")
+        if signer, err = auth.NewRandomSigner(); err != nil {
+            mainLogger.Error("Failed to generate token key", "error", err)
+            os.Exit(1)
+        }
+    }
+
+    blobs, err := blobstore.FromEnv()
+    if err != nil {
+        mainLogger.Error("Blob storage setup failed", "error", err)
+        os.Exit(1)
+    }
+    mainLogger.Info("Using blob storage", "backend", cmp.Or(os.Getenv("THOTH_BLOB_BACKEND"), "local"))
+
+    // ICE-серверы для звонков и встроенный STUN/TURN-сервер
+    iceConfig, turnServer, err := loadICEConfig()
+    if err != nil {
+        mainLogger.Error("ICE server setup failed", "error", err)
+        os.Exit(1)
+    }
+
     // Создаем хаб
     hub := websocket.NewHub()
+    hub.Calls = calls.NewManager(store)
+
+    // SFU: звонок, где участников стало больше THOTH_SFU_THRESHOLD, идет через сервер
+    if v := os.Getenv("THOTH_SFU_THRESHOLD"); v != "" && v != "off" {
+        threshold, err := strconv.Atoi(v)
+        if err != nil || threshold < 2 {
+            mainLogger.Error("Invalid THOTH_SFU_THRESHOLD, expected a number of participants >= 2", "value", v)
+            os.Exit(1)
+        }
+        if hub.SFU, err = newSFU(iceConfig); err != nil {
+            mainLogger.Error("SFU setup failed", "error", err)
+            os.Exit(1)
+        }
+        hub.Calls.SFUThreshold = threshold
+        mainLogger.Info("SFU enabled", "threshold", threshold)
+
+        // Запись звонков идет через SFU; файлы пишутся в THOTH_RECORDING_DIR, затем уходят в хранилище вложений
+        if dir := os.Getenv("THOTH_RECORDING_DIR"); dir != "off" {
+            if dir == "" {
+                dir = "data/recordings"
+            }
+            if hub.Recorder, err = recording.NewRecorder(dir, store, blobs); err != nil {
+                mainLogger.Error("Recording setup failed", "error", err)
+                os.Exit(1)
+            }
+            mainLogger.Info("Call recording enabled", "dir", dir)
+        }
+    }
+
+    // Фильтры сообщений: встроенные словари RU/EN, свои слова - файлом THOTH_MODERATION_WORDLIST
+    if os.Getenv("THOTH_MODERATION") != "off" {
+        words, err := moderation.LoadWordlist(os.Getenv("THOTH_MODERATION_WORDLIST"))
+        if err != nil {
+            mainLogger.Error("Failed to load moderation wordlist", "error", err)
+            os.Exit(1)
+        }
+        hub.Filters = moderation.NewDefaultChain(store, words)
+        mainLogger.Info("Message filters enabled", "words", words.Len())
+    } else {
+        mainLogger.Warn("Message filters are disabled")
+    }
+
+    // Диспетчер исходящих вебхуков подписывается на события хаба
+    dispatcher := webhooks.NewDispatcher(store)
+    hub.Listeners = append(hub.Listeners, dispatcher)
+    go dispatcher.Run()
+
+    // Превью ссылок: страницы загружает сам сервер, поэтому их можно выключить
+    var unfurler *unfurl.Unfurler
+    if os.Getenv("THOTH_LINK_PREVIEWS") != "off" {
+        unfurler = unfurl.NewUnfurler(store, hub)
+        hub.Listeners = append(hub.Listeners, unfurler)
+        go unfurler.Run()
+    } else {
+        mainLogger.Info("Link previews are disabled")
+    }
+
+    // Письма с пропущенными упоминаниями; без SMTP-сервера выключены.
+    // Для разработки подходит локальная заглушка, например MailHog на localhost:1025
+    var notifier *notify.Notifier
+    var mailer notify.Mailer
+    if addr := os.Getenv("THOTH_SMTP_ADDR"); addr != "" {
+        from := os.Getenv("THOTH_SMTP_FROM")
+        if from == "" {
+            from = "thoth@localhost"
+        }
+        smtpMailer := notify.NewSMTPMailer(addr, from)
+        smtpMailer.Username = os.Getenv("THOTH_SMTP_USERNAME")
+        smtpMailer.Password = os.Getenv("THOTH_SMTP_PASSWORD")
+        mailer = smtpMailer
+
+        notifier = notify.NewNotifier(store, mailer, hub, signer)
+        notifier.PublicURL = publicURL
+        if v := os.Getenv("THOTH_DIGEST_DELAY"); v != "" {
+            delay, err := time.ParseDuration(v)
+            if err != nil || delay <= 0 {
+                mainLogger.Error("Invalid THOTH_DIGEST_DELAY", "value", v)
+                os.Exit(1)
+            }
+            notifier.Delay = delay
+        }
+        go notifier.Run()
+    } else {
+        mainLogger.Info("THOTH_SMTP_ADDR is not set, email notifications are disabled")
+    }
+
+    // Web Push: VAPID-ключ из THOTH_VAPID_PRIVATE_KEY или из файла, который создается при первом запуске
+    vapidKeys, err := loadVAPIDKeys()
+    if err != nil {
+        mainLogger.Error("VAPID key setup failed", "error", err)
+        os.Exit(1)
+    }
+    vapidSubject := os.Getenv("THOTH_VAPID_SUBJECT")
+    if vapidSubject == "" {
+        vapidSubject = publicURL
+    }
+    pusher := webpush.NewPusher(store, webpush.NewSender(vapidKeys, vapidSubject), hub)
+    hub.Listeners = append(hub.Listeners, pusher)
+    go pusher.Run()
+
+    // Напоминания о запланированных встречах приходят в комнаты сообщениями от system:
+    // за THOTH_MEETING_REMINDER до начала (по умолчанию 10m) и в момент начала
+    reminder := meetings.NewReminder(store, meetings.Links{PublicURL: publicURL, Signer: signer},
+        func(ctx context.Context, msg models.Message) error {
+            _, err := hub.PostMessage(ctx, store, msg)
+            return err
+        })
+    if v := os.Getenv("THOTH_MEETING_REMINDER"); v != "" {
+        lead, err := time.ParseDuration(v)
+        if err != nil || lead < time.Minute {
+            mainLogger.Error("Invalid THOTH_MEETING_REMINDER, expected a duration of at least 1m", "value", v)
+            os.Exit(1)
+        }
+        reminder.Lead = lead
+    }
+    go reminder.Run()
     
     // Запускаем хаб в отдельной горутине
     go hub.Run()
     mainLogger.Info("WebSocket Hub launched")
     
     // Создаем обработчики HTTP запросов
-    chatHandler := handlers.NewChatHandler(hub, store)
+    chatHandler := handlers.NewChatHandler(hub, store, signer)
+    if chatHandler.Limiter, err = ratelimit.Configure(os.Getenv("THOTH_RATE_LIMITS")); err != nil {
+        mainLogger.Error("Invalid THOTH_RATE_LIMITS", "error", err)
+        os.Exit(1)
+    }
+    if chatHandler.Limiter == nil {
+        mainLogger.Warn("Rate limiting is disabled")
+    }
+    // Страницы, с которых можно подключаться к /ws, кроме самого сервера.
+    // По умолчанию - THOTH_PUBLIC_URL, для разработки THOTH_DEV_MODE=true добавляет localhost
+    origins := os.Getenv("THOTH_ALLOWED_ORIGINS")
+    if origins == "" {
+        origins = publicURL
+    }
+    if chatHandler.Origins, err = handlers.ParseOriginPolicy(origins); err != nil {
+        mainLogger.Error("Invalid THOTH_ALLOWED_ORIGINS", "error", err)
+        os.Exit(1)
+    }
+    if os.Getenv("THOTH_DEV_MODE") == "true" {
+        chatHandler.Origins.Dev = true
+        mainLogger.Warn("Dev mode: WebSocket connections from any localhost origin are allowed")
+    }
+    attachmentHandler := handlers.NewAttachmentHandler(store, blobs, signer)
+    if v := os.Getenv("THOTH_UPLOAD_MAX_BYTES"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+            attachmentHandler.MaxSize = n
+        } else {
+            mainLogger.Warn("Invalid THOTH_UPLOAD_MAX_BYTES, using default", "value", v)
+        }
+    }
+    if v := os.Getenv("THOTH_UPLOAD_ALLOWED_TYPES"); v != "" {
+        attachmentHandler.AllowedTypes = strings.Split(v, ",")
+        for i, t := range attachmentHandler.AllowedTypes {
+            attachmentHandler.AllowedTypes[i] = strings.TrimSpace(t)
+        }
+    }
+    webhookHandler := handlers.NewWebhookHandler(hub, store, publicURL)
+    searchHandler := handlers.NewSearchHandler(store, signer)
+    retentionHandler := handlers.NewRetentionHandler(store)
+    moderationHandler := handlers.NewModerationHandler(store)
+    callHandler := handlers.NewCallHandler(store, signer, hub.Calls)
+    recordingHandler := handlers.NewRecordingHandler(store, signer, hub.Recorder)
+    meetingHandler := handlers.NewMeetingHandler(store, signer, publicURL)
+    meetingHandler.Alarm = reminder.Lead
+    mentionHandler := handlers.NewMentionHandler(store, signer)
+    notificationHandler := handlers.NewNotificationHandler(store, signer)
+    notificationHandler.Mailer = mailer
+    notificationHandler.PublicURL = publicURL
+    iceHandler := handlers.NewICEHandler(signer, iceConfig)
+    pushHandler := handlers.NewPushHandler(store, signer, vapidKeys)
+    if v := os.Getenv("THOTH_PUSH_ALLOWED_HOSTS"); v != "" {
+        pushHandler.AllowedHosts = strings.Split(v, ",")
+    }
     
     // Настраиваем маршруты
     http.HandleFunc("/", serveHome)
     http.HandleFunc("/ws", chatHandler.ServeWS)
+    http.HandleFunc("POST /api/ws-token", chatHandler.UpgradeToken)
     http.HandleFunc("/health", healthCheck)
+
+    // Поиск по истории комнаты из токена участника
+    http.HandleFunc("GET /api/search", searchHandler.Search)
+
+    // Файлы: загрузка и скачивание по токену участника комнаты
+    http.HandleFunc("POST /api/rooms/{room}/attachments", attachmentHandler.Upload)
+    http.HandleFunc("GET /api/attachments/{id}", attachmentHandler.Download)
+    http.HandleFunc("GET /api/attachments/{id}/thumbnail", attachmentHandler.Thumbnail)
+
+    // Упоминания текущего пользователя (по токену участника)
+    http.HandleFunc("GET /api/mentions", mentionHandler.List)
+    http.HandleFunc("POST /api/mentions/read", mentionHandler.MarkRead)
+
+    // Текущий звонок комнаты и история звонков (по токену участника)
+    http.HandleFunc("GET /api/ice-servers", iceHandler.Servers)
+    http.HandleFunc("GET /api/rooms/{room}/calls", callHandler.List)
+    http.HandleFunc("GET /api/rooms/{room}/recordings", recordingHandler.List)
+
+    // Запланированные встречи: ссылки на подключение и события для календаря
+    http.HandleFunc("POST /api/rooms/{room}/meetings", meetingHandler.Create)
+    http.HandleFunc("GET /api/rooms/{room}/meetings", meetingHandler.List)
+    http.HandleFunc("DELETE /api/meetings/{id}", meetingHandler.Delete)
+    http.HandleFunc("GET /api/meetings/{id}/ics", meetingHandler.ICS)
+
+    // Email-уведомления: настройки по токену участника, отписка по ссылке из письма
+    http.HandleFunc("GET /api/notifications/preferences", notificationHandler.GetPreferences)
+    http.HandleFunc("PUT /api/notifications/preferences", notificationHandler.PutPreferences)
+    http.HandleFunc("GET /notifications/confirm", notificationHandler.ConfirmEmail)
+    http.HandleFunc("POST /notifications/confirm", notificationHandler.ConfirmEmail)
+    http.HandleFunc("GET /unsubscribe", notificationHandler.Unsubscribe)
+    http.HandleFunc("POST /unsubscribe", notificationHandler.Unsubscribe)
+
+    // Web Push: подписка браузера по токену участника
+    http.HandleFunc("GET /api/push/vapid-public-key", pushHandler.PublicKey)
+    http.HandleFunc("POST /api/push/subscriptions", pushHandler.Subscribe)
+    http.HandleFunc("DELETE /api/push/subscriptions", pushHandler.Unsubscribe)
+
+    // Входящие вебхуки
+    http.HandleFunc("POST /hooks/{id}/{token}", webhookHandler.Deliver)
+    http.HandleFunc("POST /api/rooms/{room}/webhooks", handlers.RequireAdmin(adminToken, webhookHandler.Create))
+    http.HandleFunc("GET /api/rooms/{room}/webhooks", handlers.RequireAdmin(adminToken, webhookHandler.List))
+    http.HandleFunc("DELETE /api/webhooks/{id}", handlers.RequireAdmin(adminToken, webhookHandler.Delete))
+
+    // Исходящие вебхуки и журнал доставок
+    http.HandleFunc("POST /api/rooms/{room}/outgoing-webhooks", handlers.RequireAdmin(adminToken, webhookHandler.CreateOutgoing))
+    http.HandleFunc("GET /api/rooms/{room}/outgoing-webhooks", handlers.RequireAdmin(adminToken, webhookHandler.ListOutgoing))
+    http.HandleFunc("DELETE /api/outgoing-webhooks/{id}", handlers.RequireAdmin(adminToken, webhookHandler.DeleteOutgoing))
+    http.HandleFunc("GET /api/outgoing-webhooks/{id}/deliveries", handlers.RequireAdmin(adminToken, webhookHandler.Deliveries))
+
+    // Политики хранения сообщений (очистку выполняет chatservice)
+    http.HandleFunc("GET /api/retention-policies", handlers.RequireAdmin(adminToken, retentionHandler.List))
+    http.HandleFunc("PUT /api/retention-policies/{room}", handlers.RequireAdmin(adminToken, retentionHandler.Put))
+    http.HandleFunc("DELETE /api/retention-policies/{room}", handlers.RequireAdmin(adminToken, retentionHandler.Delete))
+
+    // Журнал фильтров сообщений для модераторов
+    http.HandleFunc("GET /api/moderation/events", handlers.RequireAdmin(adminToken, moderationHandler.List))
+
+    // Качество соединений в звонке по отчетам клиентов
+    http.HandleFunc("GET /api/calls/{id}/stats", handlers.RequireAdmin(adminToken, callHandler.Stats))
+
+    // Метрики для Prometheus
+    http.HandleFunc("GET /metrics", handlers.RequireAdmin(adminToken, metrics.Handler().ServeHTTP))
     http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
     
     // Настраиваем сервер
@@ -132,10 +426,127 @@ func main() {
 		os.Exit(1)
     }
 
+    reminder.Stop()
     hub.Stop()
+    if hub.Recorder != nil {
+        // Дожидаемся, пока незавершенные записи сохранятся
+        hub.Recorder.Stop()
+    }
+    dispatcher.Stop()
+    if unfurler != nil {
+        unfurler.Stop()
+    }
+    if notifier != nil {
+        notifier.Stop()
+    }
+    pusher.Stop()
+    if turnServer != nil {
+        turnServer.Stop()
+    }
     mainLogger.Info("The server has stopped")
 }
 
+// loadICEConfig читает ICE-серверы для звонков: THOTH_STUN_URLS (по умолчанию публичный
+// STUN Google, "off" - без STUN), THOTH_TURN_URLS и общий с TURN-сервером THOTH_TURN_SECRET,
+// срок учетных данных TURN - THOTH_TURN_TTL.
+// THOTH_TURN_LISTEN (например, ":3478") запускает встроенный STUN/TURN-сервер на публичном
+// адресе THOTH_TURN_RELAY_IP с портами выделений THOTH_TURN_PORTS; если свои адреса
+// не заданы, клиентам раздается он. Для проверки на одной машине: THOTH_TURN_RELAY_IP=127.0.0.1
+func loadICEConfig() (*ice.Config, *turn.Server, error) {
+    listen := os.Getenv("THOTH_TURN_LISTEN")
+    stunSpec := os.Getenv("THOTH_STUN_URLS")
+    if stunSpec == "" && listen == "" {
+        stunSpec = "stun:stun.l.google.com:19302"
+    } else if stunSpec == "off" {
+        stunSpec = ""
+    }
+    stun, err := ice.ParseURLs(stunSpec, "stun", "stuns")
+    if err != nil {
+        return nil, nil, fmt.Errorf("THOTH_STUN_URLS: %w", err)
+    }
+    turnURLs, err := ice.ParseURLs(os.Getenv("THOTH_TURN_URLS"), "turn", "turns")
+    if err != nil {
+        return nil, nil, fmt.Errorf("THOTH_TURN_URLS: %w", err)
+    }
+    secret := os.Getenv("THOTH_TURN_SECRET")
+    if secret == "" && listen != "" && len(turnURLs) == 0 {
+        // Встроенный сервер проверяет пароли в этом же процессе, секрет можно не хранить
+        key := make([]byte, 32)
+        if _, err := rand.Read(key); err != nil {
+            return nil, nil, err
+        }
+        secret = hex.EncodeToString(key)
+    }
+    cfg, err := ice.NewConfig(stun, turnURLs, secret)
+    if err != nil {
+        return nil, nil, err
+    }
+    if v := os.Getenv("THOTH_TURN_TTL"); v != "" {
+        ttl, err := time.ParseDuration(v)
+        if err != nil || ttl <= 0 {
+            return nil, nil, fmt.Errorf("invalid THOTH_TURN_TTL %q", v)
+        }
+        cfg.TTL = ttl
+    }
+
+    var server *turn.Server
+    if listen != "" {
+        relayIP := net.ParseIP(os.Getenv("THOTH_TURN_RELAY_IP"))
+        if relayIP == nil {
+            return nil, nil, fmt.Errorf("THOTH_TURN_RELAY_IP must be the public IP address of this server")
+        }
+        server = turn.NewServer(listen, relayIP, cfg)
+        // Проверка звонков на одной машине: собеседники на 127.0.0.1 и в локальной сети
+        server.AllowPrivatePeers = os.Getenv("THOTH_TURN_ALLOW_PRIVATE_PEERS") == "true"
+        if v := os.Getenv("THOTH_TURN_PORTS"); v != "" {
+            if server.MinPort, server.MaxPort, err = parsePortRange(v); err != nil {
+                return nil, nil, fmt.Errorf("THOTH_TURN_PORTS: %w", err)
+            }
+        }
+        if err := server.Listen(); err != nil {
+            return nil, nil, err
+        }
+        stunURLs, relayURLs := server.URLs()
+        if os.Getenv("THOTH_STUN_URLS") == "" {
+            cfg.STUN = stunURLs
+        }
+        if len(cfg.TURN) == 0 {
+            cfg.TURN = relayURLs
+        }
+    }
+    if len(cfg.TURN) == 0 {
+        mainLogger.Warn("THOTH_TURN_URLS is not set, calls behind symmetric NAT will fail")
+    }
+    return cfg, server, nil
+}
+
+// newSFU настраивает SFU: THOTH_SFU_PUBLIC_IP - внешний IP за NAT 1:1,
+// THOTH_SFU_PORTS - диапазон UDP-портов медиа (например, 50000-50999)
+func newSFU(iceConfig *ice.Config) (*sfu.SFU, error) {
+    cfg := sfu.Config{PublicIP: os.Getenv("THOTH_SFU_PUBLIC_IP")}
+    if len(iceConfig.STUN) > 0 {
+        cfg.ICEServers = []webrtc.ICEServer{{URLs: iceConfig.STUN}}
+    }
+    if v := os.Getenv("THOTH_SFU_PORTS"); v != "" {
+        var err error
+        if cfg.MinPort, cfg.MaxPort, err = parsePortRange(v); err != nil {
+            return nil, fmt.Errorf("THOTH_SFU_PORTS: %w", err)
+        }
+    }
+    return sfu.New(cfg)
+}
+
+// parsePortRange разбирает диапазон портов вида "50000-50999"
+func parsePortRange(v string) (uint16, uint16, error) {
+    lo, hi, ok := strings.Cut(v, "-")
+    minPort, err1 := strconv.ParseUint(lo, 10, 16)
+    maxPort, err2 := strconv.ParseUint(hi, 10, 16)
+    if !ok || err1 != nil || err2 != nil || minPort == 0 || minPort > maxPort {
+        return 0, 0, fmt.Errorf("invalid port range %q, expected min-max", v)
+    }
+    return uint16(minPort), uint16(maxPort), nil
+}
+
 func checkCertificates() bool {
     certFile := "certs/server.crt"
     keyFile := "certs/server.key"
@@ -262,4 +673,17 @@ func init() {
         AddSource: true,
     })
     slog.SetDefault(slog.New(handler))
-}
\ No newline at end of file
+}
+
+// loadVAPIDKeys берет ключ из THOTH_VAPID_PRIVATE_KEY, иначе из THOTH_VAPID_KEY_FILE
+// (по умолчанию data/vapid.key), создавая файл при первом запуске
+func loadVAPIDKeys() (*webpush.VAPIDKeys, error) {
+    if key := os.Getenv("THOTH_VAPID_PRIVATE_KEY"); key != "" {
+        return webpush.ParseVAPIDKeys(key)
+    }
+    path := os.Getenv("THOTH_VAPID_KEY_FILE")
+    if path == "" {
+        path = "data/vapid.key"
+    }
+    return webpush.LoadOrCreateVAPIDKeys(path)
+}
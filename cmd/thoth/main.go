@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "os/signal"
+    "syscall"
+
+    "github.com/joho/godotenv"
+
+    "Thoth/internal/archive"
+    "Thoth/internal/storage"
+)
+
+var cliLogger = slog.With("component", "cli")
+
+const usage = `Использование:
+  thoth export -room <комната> [-format jsonl|markdown|html] [-out <файл>]
+  thoth import [-room <комната>] <файл.jsonl>
+
+Подключение к базе берется из THOTH_DB_CONN (переменная окружения или .env).
+`
+
+func main() {
+    slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+    if len(os.Args) < 2 {
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(2)
+    }
+
+    if err := godotenv.Load(); err != nil {
+        cliLogger.Debug("File .env not found, using system environment variables")
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    var err error
+    switch os.Args[1] {
+    case "export":
+        err = runExport(ctx, os.Args[2:])
+    case "import":
+        err = runImport(ctx, os.Args[2:])
+    case "-h", "-help", "--help", "help":
+        fmt.Print(usage)
+        return
+    default:
+        fmt.Fprintf(os.Stderr, "Неизвестная команда %q\n\n%s", os.Args[1], usage)
+        os.Exit(2)
+    }
+
+    if err != nil {
+        cliLogger.Error("Command failed", "command", os.Args[1], "error", err)
+        os.Exit(1)
+    }
+}
+
+func openStorage(ctx context.Context) (*storage.Storage, error) {
+    connStr := os.Getenv("THOTH_DB_CONN")
+    if connStr == "" {
+        return nil, fmt.Errorf("environment variable THOTH_DB_CONN is not set")
+    }
+    store, err := storage.NewStorage(connStr)
+    if err != nil {
+        return nil, err
+    }
+    if err := store.Migrate(ctx); err != nil {
+        store.Close()
+        return nil, fmt.Errorf("migrate database: %w", err)
+    }
+    return store, nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("export", flag.ExitOnError)
+    room := fs.String("room", "", "комната для экспорта")
+    format := fs.String("format", "jsonl", "формат: jsonl, markdown или html")
+    out := fs.String("out", "", "файл для записи (по умолчанию stdout)")
+    fs.Parse(args)
+
+    if *room == "" {
+        return fmt.Errorf("-room is required")
+    }
+
+    var write func(context.Context, archive.Source, string, io.Writer) error
+    switch *format {
+    case "jsonl":
+        write = archive.WriteJSONL
+    case "markdown", "md":
+        write = archive.WriteMarkdown
+    case "html":
+        write = archive.WriteHTML
+    default:
+        return fmt.Errorf("unknown format %q", *format)
+    }
+
+    store, err := openStorage(ctx)
+    if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    var w io.Writer = os.Stdout
+    if *out != "" {
+        f, err := os.Create(*out)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        w = f
+    }
+
+    if err := write(ctx, store, *room, w); err != nil {
+        return err
+    }
+
+    cliLogger.Info("Room exported", "room", *room, "format", *format, "out", *out)
+    return nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+    fs := flag.NewFlagSet("import", flag.ExitOnError)
+    room := fs.String("room", "", "импортировать в эту комнату вместо исходной")
+    fs.Parse(args)
+
+    if fs.NArg() != 1 {
+        return fmt.Errorf("expected exactly one archive file")
+    }
+
+    f, err := os.Open(fs.Arg(0))
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    store, err := openStorage(ctx)
+    if err != nil {
+        return err
+    }
+    defer store.Close()
+
+    stats, err := archive.ImportJSONL(ctx, store, f, *room)
+    if err != nil {
+        return err
+    }
+
+    cliLogger.Info("Room imported",
+        "room", stats.RoomID,
+        "members_added", stats.MembersAdded,
+        "members_skipped", stats.MembersSkipped,
+        "messages_added", stats.MessagesAdded,
+        "messages_skipped", stats.MessagesSkipped)
+    if stats.MessagesAdded == 0 && stats.MessagesSkipped > 0 {
+        cliLogger.Warn("No messages were added: the archive has already been imported into this room", "room", stats.RoomID)
+    }
+    return nil
+}
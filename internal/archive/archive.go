@@ -0,0 +1,206 @@
+package archive
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+
+    "github.com/google/uuid"
+
+    "Thoth/internal/markdown"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+// FormatVersion - версия формата архива. Увеличивается при несовместимых изменениях
+const FormatVersion = 1
+
+// Виды записей архива
+const (
+    KindRoom    = "room"
+    KindMember  = "member"
+    KindMessage = "message"
+)
+
+// Record - одна строка архива в формате JSON Lines. Первая запись всегда kind=room
+type Record struct {
+    Kind string `json:"kind"`
+
+    // kind=room
+    Version    int       `json:"version,omitempty"`
+    RoomID     string    `json:"room_id,omitempty"`
+    ExportedAt time.Time `json:"exported_at,omitzero"`
+
+    // kind=member
+    Role       string    `json:"role,omitempty"`
+    JoinedAt   time.Time `json:"joined_at,omitzero"`
+    LastSeenAt time.Time `json:"last_seen_at,omitzero"`
+
+    // kind=member и kind=message
+    Username string `json:"username,omitempty"`
+
+    // kind=message
+    UID       string         `json:"uid,omitempty"`
+    Content   string         `json:"content,omitempty"`
+    Format    string         `json:"format,omitempty"`
+    Embeds    []models.Embed `json:"embeds,omitempty"`
+    CreatedAt time.Time      `json:"created_at,omitzero"`
+}
+
+// Source - откуда читается комната при экспорте. Реализуется *storage.Storage
+type Source interface {
+    ListRoomMembers(ctx context.Context, roomID string) ([]storage.RoomMember, error)
+    ExportMessages(ctx context.Context, roomID string, fn func(storage.Message) error) error
+}
+
+// Sink - куда записывается комната при импорте. Реализуется *storage.Storage
+type Sink interface {
+    ImportRoomMember(ctx context.Context, m storage.RoomMember) (bool, error)
+    ImportMessage(ctx context.Context, msg storage.Message) (bool, error)
+}
+
+// Export передает в fn записи архива комнаты: заголовок, участников, затем сообщения
+func Export(ctx context.Context, src Source, roomID string, fn func(Record) error) error {
+    if err := fn(Record{Kind: KindRoom, Version: FormatVersion, RoomID: roomID, ExportedAt: time.Now().UTC()}); err != nil {
+        return err
+    }
+
+    members, err := src.ListRoomMembers(ctx, roomID)
+    if err != nil {
+        return fmt.Errorf("list members: %w", err)
+    }
+    for _, m := range members {
+        if err := fn(Record{Kind: KindMember, Username: m.Username, Role: m.Role, JoinedAt: m.JoinedAt, LastSeenAt: m.LastSeenAt}); err != nil {
+            return err
+        }
+    }
+
+    return src.ExportMessages(ctx, roomID, func(m storage.Message) error {
+        return fn(Record{Kind: KindMessage, UID: m.UID, Username: m.Username, Content: m.Content, Format: m.Format, Embeds: m.Embeds, CreatedAt: m.CreatedAt})
+    })
+}
+
+// WriteJSONL экспортирует комнату в w в формате JSON Lines
+func WriteJSONL(ctx context.Context, src Source, roomID string, w io.Writer) error {
+    enc := json.NewEncoder(w)
+    return Export(ctx, src, roomID, func(r Record) error {
+        return enc.Encode(r)
+    })
+}
+
+// ImportStats - итог импорта
+type ImportStats struct {
+    RoomID          string
+    MembersAdded    int
+    MembersSkipped  int
+    MessagesAdded   int
+    MessagesSkipped int
+}
+
+// copyNamespace - пространство имен UUID для сообщений, импортированных в другую комнату
+var copyNamespace = uuid.MustParse("119ba511-7e72-4dc1-8c7c-c4d0f0314ab0")
+
+// copyUID выводит UID копии сообщения в комнате roomID. UID глобально уникален, поэтому копия
+// с исходным UID в той же базе была бы молча пропущена как уже импортированная. Вывод
+// детерминирован, и повторный импорт копии по-прежнему ничего не меняет
+func copyUID(roomID, uid string) string {
+    return uuid.NewSHA1(copyNamespace, []byte(roomID+"\x00"+uid)).String()
+}
+
+// ImportJSONL читает архив и добавляет его в sink. Уже существующие участники и сообщения
+// (по UID) пропускаются, поэтому повторный импорт безопасен. Если targetRoom не пустой,
+// данные импортируются в эту комнату вместо исходной, а сообщения получают новые UID (см. copyUID)
+func ImportJSONL(ctx context.Context, sink Sink, r io.Reader, targetRoom string) (ImportStats, error) {
+    var stats ImportStats
+    var sourceRoom string
+
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64<<10), 4<<20)
+
+    line := 0
+    for scanner.Scan() {
+        line++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+
+        var rec Record
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            return stats, fmt.Errorf("line %d: %w", line, err)
+        }
+
+        if stats.RoomID == "" && rec.Kind != KindRoom {
+            return stats, fmt.Errorf("line %d: archive must start with a room record", line)
+        }
+
+        switch rec.Kind {
+        case KindRoom:
+            if stats.RoomID != "" {
+                return stats, fmt.Errorf("line %d: duplicate room record", line)
+            }
+            if rec.Version != FormatVersion {
+                return stats, fmt.Errorf("unsupported archive version %d", rec.Version)
+            }
+            stats.RoomID, sourceRoom = rec.RoomID, rec.RoomID
+            if targetRoom != "" {
+                stats.RoomID = targetRoom
+            }
+            if stats.RoomID == "" {
+                return stats, errors.New("archive has no room_id")
+            }
+
+        case KindMember:
+            added, err := sink.ImportRoomMember(ctx, storage.RoomMember{
+                RoomID: stats.RoomID, Username: rec.Username, Role: rec.Role,
+                JoinedAt: rec.JoinedAt, LastSeenAt: rec.LastSeenAt,
+            })
+            if err != nil {
+                return stats, fmt.Errorf("line %d: import member: %w", line, err)
+            }
+            if added {
+                stats.MembersAdded++
+            } else {
+                stats.MembersSkipped++
+            }
+
+        case KindMessage:
+            if rec.UID == "" {
+                return stats, fmt.Errorf("line %d: message without uid", line)
+            }
+            // HTML из архива не используется: его заново строит парсер
+            msg := storage.Message{
+                UID: rec.UID, Username: rec.Username, Content: rec.Content, Format: rec.Format,
+                RoomID: stats.RoomID, Embeds: rec.Embeds, CreatedAt: rec.CreatedAt,
+            }
+            if stats.RoomID != sourceRoom {
+                msg.UID = copyUID(stats.RoomID, rec.UID)
+            }
+            if msg.Format == models.FormatMarkdown {
+                msg.HTML = markdown.Render(msg.Content)
+            }
+            added, err := sink.ImportMessage(ctx, msg)
+            if err != nil {
+                return stats, fmt.Errorf("line %d: import message: %w", line, err)
+            }
+            if added {
+                stats.MessagesAdded++
+            } else {
+                stats.MessagesSkipped++
+            }
+
+        default:
+            return stats, fmt.Errorf("line %d: unknown record kind %q", line, rec.Kind)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return stats, err
+    }
+    if stats.RoomID == "" {
+        return stats, errors.New("archive is empty")
+    }
+    return stats, nil
+}
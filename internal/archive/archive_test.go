@@ -0,0 +1,154 @@
+package archive
+
+import (
+    "bytes"
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+// memoryStore - хранилище комнат в памяти, одновременно Source и Sink
+type memoryStore struct {
+    members  map[string]storage.RoomMember
+    messages []storage.Message
+}
+
+func newMemoryStore() *memoryStore {
+    return &memoryStore{members: make(map[string]storage.RoomMember)}
+}
+
+func (m *memoryStore) ListRoomMembers(ctx context.Context, roomID string) ([]storage.RoomMember, error) {
+    var members []storage.RoomMember
+    for _, member := range m.members {
+        if member.RoomID == roomID {
+            members = append(members, member)
+        }
+    }
+    return members, nil
+}
+
+func (m *memoryStore) ExportMessages(ctx context.Context, roomID string, fn func(storage.Message) error) error {
+    for _, msg := range m.messages {
+        if msg.RoomID == roomID {
+            if err := fn(msg); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (m *memoryStore) ImportRoomMember(ctx context.Context, member storage.RoomMember) (bool, error) {
+    key := member.RoomID + "/" + member.Username
+    if _, ok := m.members[key]; ok {
+        return false, nil
+    }
+    m.members[key] = member
+    return true, nil
+}
+
+func (m *memoryStore) ImportMessage(ctx context.Context, msg storage.Message) (bool, error) {
+    for _, existing := range m.messages {
+        if existing.UID == msg.UID {
+            return false, nil
+        }
+    }
+    m.messages = append(m.messages, msg)
+    return true, nil
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+    ctx := context.Background()
+    created := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+
+    src := newMemoryStore()
+    src.ImportRoomMember(ctx, storage.RoomMember{RoomID: "ops", Username: "alice", Role: storage.RoleOwner, JoinedAt: created})
+    src.ImportRoomMember(ctx, storage.RoomMember{RoomID: "ops", Username: "bob", Role: storage.RoleMember, JoinedAt: created})
+    src.ImportMessage(ctx, storage.Message{UID: "u1", RoomID: "ops", Username: "alice", Content: "привет", CreatedAt: created})
+    src.ImportMessage(ctx, storage.Message{UID: "u2", RoomID: "ops", Username: "CI", CreatedAt: created.Add(time.Minute),
+        Embeds: []models.Embed{{Title: "Build #7", Color: "good"}}})
+
+    var buf bytes.Buffer
+    if err := WriteJSONL(ctx, src, "ops", &buf); err != nil {
+        t.Fatalf("Ошибка экспорта: %v", err)
+    }
+    archived := buf.String()
+
+    dst := newMemoryStore()
+    stats, err := ImportJSONL(ctx, dst, strings.NewReader(archived), "ops-copy")
+    if err != nil {
+        t.Fatalf("Ошибка импорта: %v", err)
+    }
+    if stats.RoomID != "ops-copy" || stats.MembersAdded != 2 || stats.MessagesAdded != 2 {
+        t.Errorf("Неожиданный итог импорта: %+v", stats)
+    }
+    if got := dst.messages[1]; got.RoomID != "ops-copy" || len(got.Embeds) != 1 || !got.CreatedAt.Equal(created.Add(time.Minute)) {
+        t.Errorf("Сообщение импортировано неверно: %+v", got)
+    }
+
+    // Повторный импорт ничего не добавляет
+    stats, err = ImportJSONL(ctx, dst, strings.NewReader(archived), "ops-copy")
+    if err != nil {
+        t.Fatalf("Ошибка повторного импорта: %v", err)
+    }
+    if stats.MembersAdded != 0 || stats.MessagesAdded != 0 || stats.MessagesSkipped != 2 {
+        t.Errorf("Повторный импорт не идемпотентен: %+v", stats)
+    }
+}
+
+func TestImportIntoAnotherRoomOfSameStore(t *testing.T) {
+    ctx := context.Background()
+    store := newMemoryStore()
+    store.ImportMessage(ctx, storage.Message{UID: "u1", RoomID: "ops", Username: "alice", Content: "привет"})
+
+    var buf bytes.Buffer
+    if err := WriteJSONL(ctx, store, "ops", &buf); err != nil {
+        t.Fatalf("Ошибка экспорта: %v", err)
+    }
+    archived := buf.String()
+
+    // Копия комнаты в той же базе: исходные UID уже заняты, но сообщения должны добавиться
+    stats, err := ImportJSONL(ctx, store, strings.NewReader(archived), "ops-copy")
+    if err != nil {
+        t.Fatalf("Ошибка импорта: %v", err)
+    }
+    if stats.MessagesAdded != 1 || stats.MessagesSkipped != 0 {
+        t.Fatalf("Сообщения не скопированы: %+v", stats)
+    }
+    if got := store.messages[1]; got.RoomID != "ops-copy" || got.UID == "u1" {
+        t.Errorf("Копия сообщения: %+v", got)
+    }
+
+    // Повторный импорт копии ничего не добавляет, как и импорт в исходную комнату
+    for _, room := range []string{"ops-copy", "", "ops"} {
+        stats, err := ImportJSONL(ctx, store, strings.NewReader(archived), room)
+        if err != nil || stats.MessagesAdded != 0 || stats.MessagesSkipped != 1 {
+            t.Errorf("Повторный импорт в %q: %+v, %v", room, stats, err)
+        }
+    }
+}
+
+func TestImportRejectsArchiveWithoutHeader(t *testing.T) {
+    _, err := ImportJSONL(context.Background(), newMemoryStore(),
+        strings.NewReader(`{"kind":"message","uid":"u1","content":"x"}`+"\n"), "")
+    if err == nil {
+        t.Fatal("Архив без заголовка комнаты должен быть отклонен")
+    }
+}
+
+func TestHTMLTranscriptEscapesContent(t *testing.T) {
+    src := newMemoryStore()
+    src.ImportMessage(context.Background(), storage.Message{UID: "u1", RoomID: "r", Username: "eve", Content: "<script>alert(1)</script>"})
+
+    var buf bytes.Buffer
+    if err := WriteHTML(context.Background(), src, "r", &buf); err != nil {
+        t.Fatalf("Ошибка вывода HTML: %v", err)
+    }
+    if strings.Contains(buf.String(), "<script>") {
+        t.Error("Содержимое сообщения не экранировано в HTML")
+    }
+}
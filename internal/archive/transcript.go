@@ -0,0 +1,128 @@
+package archive
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "html/template"
+    "io"
+    "strings"
+    "time"
+)
+
+// transcript - собранные записи комнаты для человекочитаемого вывода
+type transcript struct {
+    Room       string
+    ExportedAt time.Time
+    Members    []Record
+    Messages   []Record
+}
+
+func collect(ctx context.Context, src Source, roomID string) (*transcript, error) {
+    t := &transcript{}
+    err := Export(ctx, src, roomID, func(r Record) error {
+        switch r.Kind {
+        case KindRoom:
+            t.Room, t.ExportedAt = r.RoomID, r.ExportedAt
+        case KindMember:
+            t.Members = append(t.Members, r)
+        case KindMessage:
+            t.Messages = append(t.Messages, r)
+        }
+        return nil
+    })
+    return t, err
+}
+
+// WriteMarkdown выводит историю комнаты в виде Markdown-документа
+func WriteMarkdown(ctx context.Context, src Source, roomID string, w io.Writer) error {
+    t, err := collect(ctx, src, roomID)
+    if err != nil {
+        return err
+    }
+
+    b := bufio.NewWriter(w)
+    fmt.Fprintf(b, "# Комната %s\n\n", markdownEscape(t.Room))
+    fmt.Fprintf(b, "Экспортировано %s. Участников: %d, сообщений: %d.\n\n",
+        t.ExportedAt.Format(time.RFC3339), len(t.Members), len(t.Messages))
+
+    if len(t.Members) > 0 {
+        b.WriteString("## Участники\n\n")
+        for _, m := range t.Members {
+            fmt.Fprintf(b, "- %s (%s), с %s\n", markdownEscape(m.Username), m.Role, m.JoinedAt.Format(time.DateOnly))
+        }
+        b.WriteString("\n")
+    }
+
+    b.WriteString("## Сообщения\n\n")
+    day := ""
+    for _, m := range t.Messages {
+        if d := m.CreatedAt.Format(time.DateOnly); d != day {
+            day = d
+            fmt.Fprintf(b, "### %s\n\n", day)
+        }
+        fmt.Fprintf(b, "**%s** _%s_\n", markdownEscape(m.Username), m.CreatedAt.Format(time.TimeOnly))
+        for _, line := range strings.Split(m.Content, "\n") {
+            fmt.Fprintf(b, "> %s\n", markdownEscape(line))
+        }
+        for _, e := range m.Embeds {
+            title := markdownEscape(e.Title)
+            if e.TitleLink != "" {
+                title = fmt.Sprintf("[%s](%s)", title, e.TitleLink)
+            }
+            fmt.Fprintf(b, "> 📎 %s %s\n", title, markdownEscape(e.Text))
+        }
+        b.WriteString("\n")
+    }
+    return b.Flush()
+}
+
+var markdownEscaper = strings.NewReplacer(
+    `\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, "#", `\#`,
+)
+
+func markdownEscape(s string) string {
+    return markdownEscaper.Replace(s)
+}
+
+var htmlTranscript = template.Must(template.New("transcript").Funcs(template.FuncMap{
+    "date": func(t time.Time) string { return t.Format(time.DateOnly) },
+    "time": func(t time.Time) string { return t.Format(time.TimeOnly) },
+    "full": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="UTF-8">
+<title>Комната {{.Room}}</title>
+<style>
+body { font-family: sans-serif; max-width: 860px; margin: 2em auto; color: #222; }
+.meta { color: #777; font-size: 0.9em; }
+.message { margin: 0.6em 0; }
+.author { font-weight: 600; }
+.content { white-space: pre-wrap; }
+.embed { border-left: 3px solid #999; padding-left: 0.6em; margin-top: 0.3em; }
+</style>
+</head>
+<body>
+<h1>Комната {{.Room}}</h1>
+<p class="meta">Экспортировано {{full .ExportedAt}}. Участников: {{len .Members}}, сообщений: {{len .Messages}}.</p>
+{{if .Members}}<h2>Участники</h2>
+<ul>{{range .Members}}<li>{{.Username}} ({{.Role}}), с {{date .JoinedAt}}</li>{{end}}</ul>{{end}}
+<h2>Сообщения</h2>
+{{range .Messages}}<div class="message">
+<span class="author">{{.Username}}</span> <span class="meta" title="{{full .CreatedAt}}">{{date .CreatedAt}} {{time .CreatedAt}}</span>
+<div class="content">{{.Content}}</div>
+{{range .Embeds}}<div class="embed">{{if .TitleLink}}<a href="{{.TitleLink}}">{{.Title}}</a>{{else}}{{.Title}}{{end}} {{.Text}}</div>{{end}}
+</div>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML выводит историю комнаты в виде самостоятельной HTML-страницы
+func WriteHTML(ctx context.Context, src Source, roomID string, w io.Writer) error {
+    t, err := collect(ctx, src, roomID)
+    if err != nil {
+        return err
+    }
+    return htmlTranscript.Execute(w, t)
+}
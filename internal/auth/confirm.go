@@ -0,0 +1,27 @@
+package auth
+
+import "time"
+
+// PurposeEmailConfirm - токен ссылки подтверждения адреса для писем с уведомлениями
+const PurposeEmailConfirm = "email-confirm"
+
+// EmailConfirmTTL - срок действия ссылки подтверждения
+const EmailConfirmTTL = 24 * time.Hour
+
+// EmailConfirmClaims - чей адрес и какой именно подтверждается
+type EmailConfirmClaims struct {
+    Username string `json:"u"`
+    Email    string `json:"e"`
+}
+
+// IssueEmailConfirmToken выпускает токен подтверждения адреса
+func (s *Signer) IssueEmailConfirmToken(username, email string) (string, error) {
+    return s.Sign(PurposeEmailConfirm, EmailConfirmClaims{Username: username, Email: email}, EmailConfirmTTL)
+}
+
+// VerifyEmailConfirmToken проверяет токен подтверждения адреса
+func (s *Signer) VerifyEmailConfirmToken(token string) (EmailConfirmClaims, error) {
+    var claims EmailConfirmClaims
+    err := s.Verify(PurposeEmailConfirm, token, &claims)
+    return claims, err
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "time"
+
+// PurposeMeeting - токен ссылки на запланированную встречу. С ним /ws подключает
+// к комнате встречи, а персональная ссылка приглашенного - еще и под его именем
+const PurposeMeeting = "meeting"
+
+// MeetingLinkGrace - сколько ссылка работает после окончания встречи по расписанию
+const MeetingLinkGrace = time.Hour
+
+// MeetingClaims - встреча, ее комната и приглашенный. Пустой Username - общая ссылка,
+// имя выбирает сам подключающийся
+type MeetingClaims struct {
+    MeetingID string `json:"m"`
+    RoomID    string `json:"r"`
+    Username  string `json:"u,omitempty"`
+}
+
+// IssueMeetingToken выпускает токен ссылки на встречу, который действует до ends + MeetingLinkGrace
+func (s *Signer) IssueMeetingToken(claims MeetingClaims, ends time.Time) (string, error) {
+    return s.Sign(PurposeMeeting, claims, time.Until(ends)+MeetingLinkGrace)
+}
+
+// VerifyMeetingToken проверяет токен ссылки на встречу
+func (s *Signer) VerifyMeetingToken(token string) (MeetingClaims, error) {
+    var claims MeetingClaims
+    err := s.Verify(PurposeMeeting, token, &claims)
+    return claims, err
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "time"
+
+// PurposeMember - токен участника комнаты, который клиент получает при подключении к /ws
+const PurposeMember = "member"
+
+// MemberTokenTTL - срок действия токена участника
+const MemberTokenTTL = 12 * time.Hour
+
+// MemberClaims подтверждает, что пользователь подключался к комнате, и его роль в ней.
+// Verified - имя было подтверждено ключом пользователя, а не просто набрано при входе
+type MemberClaims struct {
+    RoomID   string `json:"r"`
+    Username string `json:"u"`
+    Role     string `json:"o,omitempty"`
+    Verified bool   `json:"v,omitempty"`
+}
+
+// IssueMemberToken выпускает токен участника комнаты
+func (s *Signer) IssueMemberToken(claims MemberClaims) (string, error) {
+    return s.Sign(PurposeMember, claims, MemberTokenTTL)
+}
+
+// VerifyMemberToken проверяет токен участника
+func (s *Signer) VerifyMemberToken(token string) (MemberClaims, error) {
+    var claims MemberClaims
+    err := s.Verify(PurposeMember, token, &claims)
+    return claims, err
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "time"
+
+// PurposeOwnerKey - ключ владельца комнаты. В отличие от токена участника живет долго
+// и переносится в другие браузеры ссылкой, чтобы владелец не терял управление комнатой
+const PurposeOwnerKey = "owner-key"
+
+// OwnerKeyTTL - срок действия ключа владельца. Ключ перевыпускается при каждом подключении
+const OwnerKeyTTL = 365 * 24 * time.Hour
+
+// OwnerKeyClaims подтверждает имя пользователя в комнате. Роль в ключ не входит:
+// ее каждый раз берут из room_members, поэтому снятие роли действует сразу
+type OwnerKeyClaims struct {
+    RoomID   string `json:"r"`
+    Username string `json:"u"`
+}
+
+// IssueOwnerKey выпускает ключ владельца комнаты
+func (s *Signer) IssueOwnerKey(roomID, username string) (string, error) {
+    return s.Sign(PurposeOwnerKey, OwnerKeyClaims{RoomID: roomID, Username: username}, OwnerKeyTTL)
+}
+
+// VerifyOwnerKey проверяет ключ владельца
+func (s *Signer) VerifyOwnerKey(token string) (OwnerKeyClaims, error) {
+    var claims OwnerKeyClaims
+    err := s.Verify(PurposeOwnerKey, token, &claims)
+    return claims, err
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+    "testing"
+    "time"
+)
+
+func TestMemberTokenRoundTrip(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+
+    token, err := signer.IssueMemberToken(MemberClaims{RoomID: "general", Username: "alice", Role: "owner"})
+    if err != nil {
+        t.Fatalf("Ошибка выпуска токена: %v", err)
+    }
+    claims, err := signer.VerifyMemberToken(token)
+    if err != nil {
+        t.Fatalf("Ошибка проверки токена: %v", err)
+    }
+    if claims.RoomID != "general" || claims.Username != "alice" || claims.Role != "owner" {
+        t.Errorf("Неверные данные токена: %+v", claims)
+    }
+}
+
+func TestVerifyRejectsForeignTokens(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+    token, _ := signer.IssueMemberToken(MemberClaims{RoomID: "general", Username: "alice"})
+
+    if _, err := NewSigner([]byte("other")).VerifyMemberToken(token); err != ErrInvalidToken {
+        t.Errorf("Токен с чужим ключом: ожидалась ErrInvalidToken, получено %v", err)
+    }
+    if _, err := signer.VerifyMemberToken(token[:len(token)-2] + "xx"); err != ErrInvalidToken {
+        t.Errorf("Испорченная подпись: ожидалась ErrInvalidToken, получено %v", err)
+    }
+
+    other, _ := signer.Sign("other", MemberClaims{RoomID: "general", Username: "alice"}, time.Hour)
+    if _, err := signer.VerifyMemberToken(other); err != ErrInvalidToken {
+        t.Errorf("Токен другого назначения: ожидалась ErrInvalidToken, получено %v", err)
+    }
+
+    expired, _ := signer.Sign(PurposeMember, MemberClaims{RoomID: "general", Username: "alice"}, -time.Minute)
+    if _, err := signer.VerifyMemberToken(expired); err != ErrExpiredToken {
+        t.Errorf("Просроченный токен: ожидалась ErrExpiredToken, получено %v", err)
+    }
+}
+
+func TestOwnerKey(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+
+    key, err := signer.IssueOwnerKey("general", "alice")
+    if err != nil {
+        t.Fatalf("Ошибка выпуска ключа: %v", err)
+    }
+    claims, err := signer.VerifyOwnerKey(key)
+    if err != nil || claims.RoomID != "general" || claims.Username != "alice" {
+        t.Errorf("Неверные данные ключа: %+v, %v", claims, err)
+    }
+
+    // Токен участника не заменяет ключ владельца
+    member, _ := signer.IssueMemberToken(MemberClaims{RoomID: "general", Username: "alice", Role: "owner"})
+    if _, err := signer.VerifyOwnerKey(member); err != ErrInvalidToken {
+        t.Errorf("Токен участника вместо ключа владельца: получено %v", err)
+    }
+}
+
+func TestUserKey(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+
+    key, err := signer.IssueUserKey("alice")
+    if err != nil {
+        t.Fatalf("Ошибка выпуска ключа: %v", err)
+    }
+    if username, err := signer.VerifyUserKey(key); err != nil || username != "alice" {
+        t.Errorf("Неверные данные ключа: %q, %v", username, err)
+    }
+
+    // Ключ владельца комнаты не подтверждает имя вне комнаты
+    owner, _ := signer.IssueOwnerKey("general", "alice")
+    if _, err := signer.VerifyUserKey(owner); err != ErrInvalidToken {
+        t.Errorf("Ключ владельца вместо ключа пользователя: получено %v", err)
+    }
+}
+
+func TestEmailConfirmToken(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+
+    token, err := signer.IssueEmailConfirmToken("alice", "alice@example.com")
+    if err != nil {
+        t.Fatalf("Ошибка выпуска токена: %v", err)
+    }
+    claims, err := signer.VerifyEmailConfirmToken(token)
+    if err != nil || claims.Username != "alice" || claims.Email != "alice@example.com" {
+        t.Errorf("Неверные данные токена: %+v, %v", claims, err)
+    }
+
+    // Ссылка отписки не подтверждает адрес
+    unsubscribe, _ := signer.IssueUnsubscribeToken("alice")
+    if _, err := signer.VerifyEmailConfirmToken(unsubscribe); err != ErrInvalidToken {
+        t.Errorf("Токен отписки вместо подтверждения: получено %v", err)
+    }
+}
+
+func TestUpgradeTokenBoundToOrigin(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+    token, err := signer.IssueUpgradeToken("https://chat.example.com")
+    if err != nil {
+        t.Fatalf("Ошибка выпуска токена: %v", err)
+    }
+    if err := signer.VerifyUpgradeToken(token, "https://chat.example.com"); err != nil {
+        t.Errorf("Токен своей страницы отклонен: %v", err)
+    }
+    if err := signer.VerifyUpgradeToken(token, "https://evil.example"); err != ErrOriginMismatch {
+        t.Errorf("Токен с чужой страницы: ожидалась ErrOriginMismatch, получено %v", err)
+    }
+    member, _ := signer.IssueMemberToken(MemberClaims{RoomID: "general", Username: "alice"})
+    if err := signer.VerifyUpgradeToken(member, ""); err != ErrInvalidToken {
+        t.Errorf("Токен участника вместо токена подключения: получено %v", err)
+    }
+}
+
+func TestMeetingToken(t *testing.T) {
+    signer := NewSigner([]byte("secret"))
+    want := MeetingClaims{MeetingID: "m1", RoomID: "general", Username: "bob"}
+
+    token, err := signer.IssueMeetingToken(want, time.Now().Add(time.Hour))
+    if err != nil {
+        t.Fatalf("Ошибка выпуска токена: %v", err)
+    }
+    if claims, err := signer.VerifyMeetingToken(token); err != nil || claims != want {
+        t.Errorf("Неверные данные токена: %+v, %v", claims, err)
+    }
+
+    // Ссылка работает еще MeetingLinkGrace после окончания встречи
+    ended, _ := signer.IssueMeetingToken(want, time.Now().Add(-MeetingLinkGrace/2))
+    if _, err := signer.VerifyMeetingToken(ended); err != nil {
+        t.Errorf("Токен недавно закончившейся встречи отклонен: %v", err)
+    }
+    expired, _ := signer.IssueMeetingToken(want, time.Now().Add(-2*MeetingLinkGrace))
+    if _, err := signer.VerifyMeetingToken(expired); err != ErrExpiredToken {
+        t.Errorf("Давно закончившаяся встреча: ожидалась ErrExpiredToken, получено %v", err)
+    }
+
+    member, _ := signer.IssueMemberToken(MemberClaims{RoomID: "general", Username: "bob"})
+    if _, err := signer.VerifyMeetingToken(member); err != ErrInvalidToken {
+        t.Errorf("Токен участника вместо ссылки на встречу: получено %v", err)
+    }
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "time"
+
+// PurposeUnsubscribe - токен ссылки отписки из писем с уведомлениями
+const PurposeUnsubscribe = "unsubscribe"
+
+// UnsubscribeTokenTTL - ссылка из письма должна работать и спустя долгое время
+const UnsubscribeTokenTTL = 365 * 24 * time.Hour
+
+type unsubscribeClaims struct {
+    Username string `json:"u"`
+}
+
+// IssueUnsubscribeToken выпускает токен отписки пользователя от писем
+func (s *Signer) IssueUnsubscribeToken(username string) (string, error) {
+    return s.Sign(PurposeUnsubscribe, unsubscribeClaims{Username: username}, UnsubscribeTokenTTL)
+}
+
+// VerifyUnsubscribeToken проверяет токен отписки и возвращает имя пользователя
+func (s *Signer) VerifyUnsubscribeToken(token string) (string, error) {
+    var claims unsubscribeClaims
+    if err := s.Verify(PurposeUnsubscribe, token, &claims); err != nil {
+        return "", err
+    }
+    return claims.Username, nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+    "errors"
+    "time"
+)
+
+// PurposeUpgrade - одноразовый по смыслу токен для подключения к /ws. Чужая страница
+// не может прочитать ответ с токеном (нет CORS), поэтому не может и открыть WebSocket
+// от имени пользователя
+const PurposeUpgrade = "ws-upgrade"
+
+// UpgradeTokenTTL - токен запрашивается прямо перед подключением
+const UpgradeTokenTTL = 2 * time.Minute
+
+// ErrOriginMismatch - токен выпущен для страницы с другим Origin
+var ErrOriginMismatch = errors.New("token was issued for another origin")
+
+type upgradeClaims struct {
+    Origin string `json:"o"`
+}
+
+// IssueUpgradeToken выпускает токен подключения для страницы origin
+// (пустая строка - клиент без Origin, не браузер)
+func (s *Signer) IssueUpgradeToken(origin string) (string, error) {
+    return s.Sign(PurposeUpgrade, upgradeClaims{Origin: origin}, UpgradeTokenTTL)
+}
+
+// VerifyUpgradeToken проверяет токен и то, что подключается та же страница, что его получила
+func (s *Signer) VerifyUpgradeToken(token, origin string) error {
+    var claims upgradeClaims
+    if err := s.Verify(PurposeUpgrade, token, &claims); err != nil {
+        return err
+    }
+    if claims.Origin != origin {
+        return ErrOriginMismatch
+    }
+    return nil
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "time"
+
+// PurposeUserKey - ключ пользователя. Его получает тот, кто первым занял имя, и только
+// он подтверждает имя: без ключа имя при входе - просто набранная строка
+const PurposeUserKey = "user-key"
+
+// UserKeyTTL - срок действия ключа пользователя. Ключ перевыпускается при каждом подключении
+const UserKeyTTL = 365 * 24 * time.Hour
+
+type userKeyClaims struct {
+    Username string `json:"u"`
+}
+
+// IssueUserKey выпускает ключ пользователя
+func (s *Signer) IssueUserKey(username string) (string, error) {
+    return s.Sign(PurposeUserKey, userKeyClaims{Username: username}, UserKeyTTL)
+}
+
+// VerifyUserKey проверяет ключ пользователя и возвращает имя
+func (s *Signer) VerifyUserKey(token string) (string, error) {
+    var claims userKeyClaims
+    if err := s.Verify(PurposeUserKey, token, &claims); err != nil {
+        return "", err
+    }
+    return claims.Username, nil
+}
@@ -0,0 +1,69 @@
+package blobstore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+var (
+    ErrNotFound   = errors.New("blob not found")
+    ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store - хранилище двоичных объектов (вложений). Ключи - пути вида "attachments/<id>"
+// из латиницы, цифр, "-", "_", "." и "/"
+type Store interface {
+    // Put сохраняет объект целиком. size - точный размер содержимого r
+    Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+    // Open возвращает содержимое объекта или ErrNotFound
+    Open(ctx context.Context, key string) (io.ReadCloser, error)
+    // Delete удаляет объект. Удаление отсутствующего объекта не считается ошибкой
+    Delete(ctx context.Context, key string) error
+}
+
+// ValidateKey отсекает ключи, которые могут выйти за пределы хранилища
+func ValidateKey(key string) error {
+    if key == "" || len(key) > 512 || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+        return ErrInvalidKey
+    }
+    for _, part := range strings.Split(key, "/") {
+        if part == "" || part == "." || part == ".." {
+            return ErrInvalidKey
+        }
+    }
+    for _, c := range key {
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+        case c == '-', c == '_', c == '.', c == '/':
+        default:
+            return ErrInvalidKey
+        }
+    }
+    return nil
+}
+
+// FromEnv выбирает хранилище по THOTH_BLOB_BACKEND: local (по умолчанию, каталог THOTH_BLOB_DIR)
+// или s3 (THOTH_S3_*). Общее для сервера и chat service, чтобы оба видели одни и те же файлы
+func FromEnv() (Store, error) {
+    switch backend := os.Getenv("THOTH_BLOB_BACKEND"); backend {
+    case "", "local":
+        dir := os.Getenv("THOTH_BLOB_DIR")
+        if dir == "" {
+            dir = "data/blobs"
+        }
+        return NewLocalStore(dir)
+    case "s3":
+        endpoint, bucket := os.Getenv("THOTH_S3_ENDPOINT"), os.Getenv("THOTH_S3_BUCKET")
+        if endpoint == "" || bucket == "" {
+            return nil, fmt.Errorf("THOTH_S3_ENDPOINT and THOTH_S3_BUCKET are required for the s3 backend")
+        }
+        return NewS3Store(endpoint, bucket, os.Getenv("THOTH_S3_REGION"),
+            os.Getenv("THOTH_S3_ACCESS_KEY"), os.Getenv("THOTH_S3_SECRET_KEY")), nil
+    default:
+        return nil, fmt.Errorf("unknown THOTH_BLOB_BACKEND %q", backend)
+    }
+}
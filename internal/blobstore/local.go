@@ -0,0 +1,83 @@
+package blobstore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+)
+
+// LocalStore хранит объекты файлами в каталоге Root
+type LocalStore struct {
+    Root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+    if err := os.MkdirAll(root, 0o750); err != nil {
+        return nil, fmt.Errorf("create blob directory: %w", err)
+    }
+    return &LocalStore{Root: root}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+    if err := ValidateKey(key); err != nil {
+        return "", err
+    }
+    return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put пишет объект во временный файл и атомарно переименовывает его,
+// чтобы читатели не увидели недописанный объект
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+        return err
+    }
+
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    written, err := io.Copy(tmp, r)
+    if err == nil && written != size {
+        err = fmt.Errorf("blob size mismatch: expected %d, got %d", size, written)
+    }
+    if closeErr := tmp.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    path, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.Open(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    path, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return err
+    }
+    return nil
+}
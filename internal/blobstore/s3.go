@@ -0,0 +1,208 @@
+package blobstore
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+)
+
+// unsignedPayload - тело PUT не хешируется, чтобы не буферизовать загрузку целиком
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Store хранит объекты в S3-совместимом хранилище (AWS S3, MinIO и т.п.).
+// Используется адресация path-style: Endpoint/Bucket/key, запросы подписываются AWS Signature V4
+type S3Store struct {
+    Endpoint  string // https://s3.eu-central-1.amazonaws.com или http://minio:9000
+    Bucket    string
+    Region    string
+    AccessKey string
+    SecretKey string
+    Client    *http.Client
+}
+
+func NewS3Store(endpoint, bucket, region, accessKey, secretKey string) *S3Store {
+    if region == "" {
+        region = "us-east-1"
+    }
+    return &S3Store{
+        Endpoint:  strings.TrimSuffix(endpoint, "/"),
+        Bucket:    bucket,
+        Region:    region,
+        AccessKey: accessKey,
+        SecretKey: secretKey,
+        Client:    &http.Client{Timeout: 5 * time.Minute},
+    }
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+    req, err := s.newRequest(ctx, http.MethodPut, key, r)
+    if err != nil {
+        return err
+    }
+    req.ContentLength = size
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+
+    resp, err := s.do(req, unsignedPayload)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := s.do(req, emptyPayloadHash)
+    if err != nil {
+        return nil, err
+    }
+    return resp.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+    req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := s.do(req, emptyPayloadHash)
+    if err == ErrNotFound {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+func (s *S3Store) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+    if err := ValidateKey(key); err != nil {
+        return nil, err
+    }
+    return http.NewRequestWithContext(ctx, method, s.Endpoint+"/"+s.Bucket+"/"+key, body)
+}
+
+// do подписывает и выполняет запрос. Ответы не 2xx закрываются и превращаются в ошибку
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+    signV4(req, payloadHash, s.AccessKey, s.SecretKey, s.Region, time.Now())
+
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return resp, nil
+    }
+
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, ErrNotFound
+    }
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// emptyPayloadHash - SHA-256 пустого тела
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signV4 добавляет к запросу заголовки x-amz-date, x-amz-content-sha256 и Authorization.
+// Подписываются host и все заголовки, уже установленные в запросе
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+    amzDate := now.UTC().Format("20060102T150405Z")
+    date := amzDate[:8]
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{"host": req.URL.Host}
+    for name, values := range req.Header {
+        headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+    }
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    path := req.URL.EscapedPath()
+    if path == "" {
+        path = "/"
+    }
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        path,
+        canonicalQuery(req),
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := date + "/" + region + "/s3/aws4_request"
+    requestHash := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+    key := hmacSHA256([]byte("AWS4"+secretKey), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(req *http.Request) string {
+    query := req.URL.Query()
+    keys := make([]string, 0, len(query))
+    for k := range query {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    var parts []string
+    for _, k := range keys {
+        values := query[k]
+        sort.Strings(values)
+        for _, v := range values {
+            parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+        }
+    }
+    return strings.Join(parts, "&")
+}
+
+// awsEscape кодирует строку по правилам SigV4: не кодируются только A-Z a-z 0-9 - _ . ~
+func awsEscape(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+            b.WriteByte(c)
+        } else {
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
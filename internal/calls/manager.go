@@ -0,0 +1,595 @@
+package calls
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "log/slog"
+    "sort"
+    "sync"
+    "time"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+)
+
+var callsLogger = slog.With("component", "calls")
+
+var (
+    callsTotal = metrics.NewCounter("thoth_calls_total",
+        "Finished calls", "end_reason")
+    invitesTotal = metrics.NewCounter("thoth_call_invites_total",
+        "Call invitations by outcome", "result")
+    signalingRejected = metrics.NewCounter("thoth_call_signaling_rejected_total",
+        "WebRTC signaling messages that do not match the call state", "type")
+)
+
+// Ошибки проверки приглашений и сигнализации
+var (
+    ErrInvalidTarget  = errors.New("call target is required and cannot be yourself")
+    ErrCallInProgress = errors.New("another call is in progress in this room")
+    ErrInAnotherCall  = errors.New("you are already in a call in another room")
+    ErrBusy           = errors.New("user is busy")
+    ErrAlreadyInCall  = errors.New("you are already in a call with this user")
+    ErrNoCall         = errors.New("there is no call in this room")
+    ErrNoInvitation   = errors.New("no pending invitation")
+    ErrNotAccepted    = errors.New("call has not been accepted")
+    ErrUnexpectedAnswer = errors.New("no pending offer from this user")
+)
+
+// Store сохраняет завершенные звонки. Реализуется *storage.Storage
+type Store interface {
+    SaveCall(ctx context.Context, call models.Call) error
+}
+
+// Invitation - приглашение From позвонить To в звонок Call
+type Invitation struct {
+    From string
+    To   string
+    At   time.Time
+    Call models.Call
+}
+
+// Manager ведет звонки комнат: в комнате не больше одного звонка, в который можно
+// приглашать участников. Приглашение звонит RingTimeout; SDP и ICE-кандидаты допустимы
+// только между парами, где приглашение принято. Методы потокобезопасны
+type Manager struct {
+    RingTimeout time.Duration
+    // Звонок, в котором участников стало больше SFUThreshold, переводится на SFU
+    // и остается там до конца. 0 - всегда попарные соединения
+    SFUThreshold int
+
+    mu    sync.Mutex
+    calls map[string]*session // [roomID]
+    store Store
+    now   func() time.Time
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+// NewManager создает менеджер звонков. store может быть nil - звонки не сохраняются
+func NewManager(store Store) *Manager {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &Manager{
+        RingTimeout: 45 * time.Second,
+        calls:       make(map[string]*session),
+        store:       store,
+        now:         time.Now,
+        ctx:         ctx,
+        cancel:      cancel,
+    }
+}
+
+// session - звонок в процессе
+type session struct {
+    call         models.Call
+    participants map[string]*participant
+    pairs        map[pairKey]*pair
+}
+
+type participant struct {
+    joinedAt time.Time
+    since    time.Time // Начало текущего отрезка в звонке; нулевое, если участник вышел
+    leftAt   time.Time
+    total    time.Duration
+}
+
+// pairKey - двое пользователей, имена по порядку
+type pairKey struct{ a, b string }
+
+func keyOf(x, y string) pairKey {
+    if x > y {
+        x, y = y, x
+    }
+    return pairKey{x, y}
+}
+
+func (k pairKey) has(username string) bool {
+    return k.a == username || k.b == username
+}
+
+func (k pairKey) other(username string) string {
+    if k.a == username {
+        return k.b
+    }
+    return k.a
+}
+
+// pair - приглашение и сигнализация между двумя пользователями
+type pair struct {
+    invitedBy string // Кто пригласил, пока приглашение не принято
+    invitedAt time.Time
+    offeredBy string // Кто ждет ответа на offer
+}
+
+func (p *pair) accepted() bool {
+    return p.invitedBy == ""
+}
+
+// Invite приглашает to в звонок комнаты, начиная его, если звонка еще нет.
+// Возвращает звонок для кадра call_invite
+func (m *Manager) Invite(roomID, from, to string) (models.Call, error) {
+    if to == "" || to == from {
+        return models.Call{}, ErrInvalidTarget
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    now := m.now()
+
+    s := m.calls[roomID]
+    if s != nil && s.pairs[keyOf(from, to)] != nil {
+        return models.Call{}, ErrAlreadyInCall
+    }
+    if m.inOtherCall(roomID, from) {
+        return models.Call{}, ErrInAnotherCall
+    }
+    if m.inOtherCall(roomID, to) || m.invited(to) {
+        invitesTotal.Inc("busy")
+        return models.Call{}, ErrBusy
+    }
+
+    if s == nil {
+        s = m.start(roomID, from, now)
+    } else if !s.inCall(from) && !s.inCall(to) {
+        return models.Call{}, ErrCallInProgress
+    }
+
+    s.pairs[keyOf(from, to)] = &pair{invitedBy: from, invitedAt: now}
+    invitesTotal.Inc("sent")
+    return s.snapshot(now), nil
+}
+
+// Accept - from принимает приглашение to. Возвращает звонок, если он на этом начался
+func (m *Manager) Accept(roomID, from, to string) (*models.Call, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s, p, err := m.invitation(roomID, to, from)
+    if err != nil {
+        return nil, err
+    }
+    now := m.now()
+    p.invitedBy = ""
+    s.join(from, now)
+    s.join(to, now)
+    invitesTotal.Inc("accepted")
+    if m.SFUThreshold > 0 && s.call.Mode == models.CallModeMesh && s.active() > m.SFUThreshold {
+        s.call.Mode = models.CallModeSFU
+        callsLogger.Info("Call switched to SFU", "call_id", s.call.ID, "room", roomID, "participants", s.active())
+    }
+
+    if s.call.State != models.CallRinging {
+        return nil, nil
+    }
+    s.call.State = models.CallActive
+    s.call.StartedAt = now
+    callsLogger.Info("Call started", "call_id", s.call.ID, "room", roomID)
+    call := s.snapshot(now)
+    return &call, nil
+}
+
+// UseSFU переводит активный звонок комнаты на SFU независимо от числа участников,
+// например для записи. Возвращает звонок после перевода
+func (m *Manager) UseSFU(roomID string) (models.Call, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s := m.calls[roomID]
+    if s == nil || s.call.State != models.CallActive {
+        return models.Call{}, ErrNoCall
+    }
+    if s.call.Mode != models.CallModeSFU {
+        s.call.Mode = models.CallModeSFU
+        callsLogger.Info("Call switched to SFU", "call_id", s.call.ID, "room", roomID, "participants", s.active())
+    }
+    return s.snapshot(m.now()), nil
+}
+
+// Decline - from отклоняет приглашение to. Возвращает звонок, если он на этом завершился
+func (m *Manager) Decline(roomID, from, to string) (*models.Call, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s, _, err := m.invitation(roomID, to, from)
+    if err != nil {
+        return nil, err
+    }
+    delete(s.pairs, keyOf(from, to))
+    invitesTotal.Inc("declined")
+    return m.settle(s, models.CallDeclined, m.now()), nil
+}
+
+// Cancel - from отзывает свое приглашение to. Возвращает звонок, если он на этом завершился
+func (m *Manager) Cancel(roomID, from, to string) (*models.Call, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s, _, err := m.invitation(roomID, from, to)
+    if err != nil {
+        return nil, err
+    }
+    delete(s.pairs, keyOf(from, to))
+    invitesTotal.Inc("cancelled")
+    return m.settle(s, models.CallCancelled, m.now()), nil
+}
+
+// invitation находит неотвеченное приглашение inviter -> invitee. Вызывается под mu
+func (m *Manager) invitation(roomID, inviter, invitee string) (*session, *pair, error) {
+    s := m.calls[roomID]
+    if s == nil {
+        return nil, nil, ErrNoCall
+    }
+    p := s.pairs[keyOf(inviter, invitee)]
+    if p == nil || p.invitedBy != inviter {
+        return nil, nil, ErrNoInvitation
+    }
+    return s, p, nil
+}
+
+// Signal проверяет кадр сигнализации WebRTC msgType от from к to:
+// offer и кандидаты - только после принятого приглашения, answer - только на offer
+func (m *Manager) Signal(roomID, from, to, msgType string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var p *pair
+    if s := m.calls[roomID]; s != nil {
+        p = s.pairs[keyOf(from, to)]
+    }
+    if p == nil || !p.accepted() {
+        return m.reject(msgType, ErrNotAccepted)
+    }
+
+    switch msgType {
+    case models.MessageTypeWebRTCOffer:
+        p.offeredBy = from
+    case models.MessageTypeWebRTCAnswer:
+        if p.offeredBy != to {
+            return m.reject(msgType, ErrUnexpectedAnswer)
+        }
+        p.offeredBy = ""
+    }
+    return nil
+}
+
+func (m *Manager) reject(msgType string, err error) error {
+    signalingRejected.Inc(msgType)
+    return err
+}
+
+// inOtherCall сообщает, что пользователь в звонке другой комнаты. Вызывается под mu
+func (m *Manager) inOtherCall(roomID, username string) bool {
+    for id, s := range m.calls {
+        if id != roomID && s.inCall(username) {
+            return true
+        }
+    }
+    return false
+}
+
+// invited сообщает, что пользователя уже куда-то приглашают. Вызывается под mu
+func (m *Manager) invited(username string) bool {
+    for _, s := range m.calls {
+        for key, p := range s.pairs {
+            if !p.accepted() && key.has(username) && p.invitedBy != username {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// start вызывается под mu
+func (m *Manager) start(roomID, initiator string, now time.Time) *session {
+    s := &session{
+        call: models.Call{
+            ID:        newCallID(),
+            RoomID:    roomID,
+            State:     models.CallRinging,
+            Mode:      models.CallModeMesh,
+            Initiator: initiator,
+            CreatedAt: now,
+        },
+        participants: make(map[string]*participant),
+        pairs:        make(map[pairKey]*pair),
+    }
+    s.join(initiator, now)
+    m.calls[roomID] = s
+    callsLogger.Info("Call ringing", "call_id", s.call.ID, "room", roomID, "initiator", initiator)
+    return s
+}
+
+// Pending возвращает приглашения, которые ждут ответа username в комнате.
+// Нужны, если приглашенный подключился, пока ему звонят
+func (m *Manager) Pending(roomID, username string) []Invitation {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s := m.calls[roomID]
+    if s == nil {
+        return nil
+    }
+    var pending []Invitation
+    for key, p := range s.pairs {
+        if !p.accepted() && key.has(username) && p.invitedBy != username {
+            pending = append(pending, Invitation{From: p.invitedBy, To: username, At: p.invitedAt, Call: s.snapshot(m.now())})
+        }
+    }
+    return pending
+}
+
+// Leave выводит пользователя из звонка комнаты (положил трубку или отключился).
+// Возвращает снятые приглашения от него и к нему, а также звонок, если он на этом завершился
+func (m *Manager) Leave(roomID, username string) ([]Invitation, *models.Call) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    s := m.calls[roomID]
+    if s == nil {
+        return nil, nil
+    }
+    now := m.now()
+    var dropped []Invitation
+    for key, p := range s.pairs {
+        if !key.has(username) {
+            continue
+        }
+        if !p.accepted() {
+            dropped = append(dropped, Invitation{From: p.invitedBy, To: key.other(p.invitedBy), At: p.invitedAt})
+        }
+        delete(s.pairs, key)
+    }
+    s.leave(username, now)
+
+    reason := models.CallDeclined
+    if username == s.call.Initiator {
+        reason = models.CallCancelled
+    }
+    ended := m.settle(s, reason, now)
+    for i := range dropped {
+        dropped[i].Call = s.snapshot(now)
+    }
+    return dropped, ended
+}
+
+// settle завершает звонок, если в нем не осталось смысла: звонящему больше некого ждать
+// или разговаривать некому. Вызывается под mu
+func (m *Manager) settle(s *session, ringingReason string, now time.Time) *models.Call {
+    switch s.call.State {
+    case models.CallRinging:
+        if len(s.pairs) == 0 {
+            return m.end(s, ringingReason, now)
+        }
+    case models.CallActive:
+        // Кто остался без единого соединения и приглашения (говорил только с ушедшим), тоже выходит.
+        // Через SFU все соединены с сервером, а не друг с другом
+        for username := range s.participants {
+            if s.call.Mode == models.CallModeMesh && s.inCall(username) && !s.paired(username) {
+                s.leave(username, now)
+            }
+        }
+        if s.active() < 2 && !s.ringing() {
+            return m.end(s, models.CallCompleted, now)
+        }
+    }
+    return nil
+}
+
+// Active возвращает текущий звонок комнаты
+func (m *Manager) Active(roomID string) (models.Call, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s := m.calls[roomID]
+    if s == nil {
+        return models.Call{}, false
+    }
+    return s.snapshot(m.now()), true
+}
+
+// InCall возвращает звонок комнаты, если username сейчас в нем участвует
+func (m *Manager) InCall(roomID, username string) (models.Call, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s := m.calls[roomID]
+    if s == nil || !s.inCall(username) {
+        return models.Call{}, false
+    }
+    return s.snapshot(m.now()), true
+}
+
+// Expire снимает приглашения без ответа дольше RingTimeout. Возвращает снятые
+// приглашения и звонки, которые из-за этого завершились
+func (m *Manager) Expire() ([]Invitation, []models.Call) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    var expired []Invitation
+    var ended []models.Call
+    for _, s := range m.calls {
+        n := len(expired)
+        for key, p := range s.pairs {
+            if !p.accepted() && now.Sub(p.invitedAt) > m.RingTimeout {
+                expired = append(expired, Invitation{From: p.invitedBy, To: key.other(p.invitedBy), At: p.invitedAt})
+                delete(s.pairs, key)
+                invitesTotal.Inc("timeout")
+            }
+        }
+        if len(expired) == n {
+            continue
+        }
+        if call := m.settle(s, models.CallMissed, now); call != nil {
+            ended = append(ended, *call)
+        }
+        for i := n; i < len(expired); i++ {
+            expired[i].Call = s.snapshot(now)
+        }
+    }
+    return expired, ended
+}
+
+// end вызывается под mu
+func (m *Manager) end(s *session, reason string, now time.Time) *models.Call {
+    for username := range s.participants {
+        s.leave(username, now)
+    }
+    s.call.State = models.CallEnded
+    s.call.EndReason = reason
+    s.call.EndedAt = now
+    delete(m.calls, s.call.RoomID)
+
+    call := s.snapshot(now)
+    callsTotal.Inc(reason)
+    callsLogger.Info("Call ended", "call_id", call.ID, "room", call.RoomID, "reason", reason, "duration", call.Duration)
+
+    if m.store != nil {
+        go func() {
+            // Не m.ctx: звонки, завершенные при остановке сервера, тоже должны сохраниться
+            if err := m.store.SaveCall(context.Background(), call); err != nil {
+                callsLogger.Error("Failed to save call", "call_id", call.ID, "error", err)
+            }
+        }()
+    }
+    return &call
+}
+
+// Run периодически снимает приглашения без ответа: onExpired получает каждое такое
+// приглашение, onEnded - каждый завершившийся из-за этого звонок
+func (m *Manager) Run(onExpired func(Invitation), onEnded func(models.Call)) {
+    ticker := time.NewTicker(time.Second)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-m.ctx.Done():
+            return
+        case <-ticker.C:
+            expired, ended := m.Expire()
+            for _, inv := range expired {
+                onExpired(inv)
+            }
+            for _, call := range ended {
+                onEnded(call)
+            }
+        }
+    }
+}
+
+func (m *Manager) Stop() {
+    m.cancel()
+}
+
+// inCall сообщает, находится ли пользователь в звонке сейчас
+func (s *session) inCall(username string) bool {
+    p := s.participants[username]
+    return p != nil && !p.since.IsZero()
+}
+
+// paired сообщает, есть ли у пользователя хотя бы одно соединение или приглашение
+func (s *session) paired(username string) bool {
+    for key := range s.pairs {
+        if key.has(username) {
+            return true
+        }
+    }
+    return false
+}
+
+// ringing сообщает, есть ли в звонке неотвеченные приглашения
+func (s *session) ringing() bool {
+    for _, p := range s.pairs {
+        if !p.accepted() {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *session) join(username string, now time.Time) {
+    p := s.participants[username]
+    if p == nil {
+        p = &participant{joinedAt: now}
+        s.participants[username] = p
+    }
+    if p.since.IsZero() {
+        p.since = now
+        p.leftAt = time.Time{}
+    }
+}
+
+func (s *session) leave(username string, now time.Time) {
+    p := s.participants[username]
+    if p == nil || p.since.IsZero() {
+        return
+    }
+    p.total += now.Sub(p.since)
+    p.since = time.Time{}
+    p.leftAt = now
+}
+
+func (s *session) active() int {
+    n := 0
+    for username := range s.participants {
+        if s.inCall(username) {
+            n++
+        }
+    }
+    return n
+}
+
+func (s *session) snapshot(now time.Time) models.Call {
+    call := s.call
+    call.Participants = make([]models.CallParticipant, 0, len(s.participants))
+    for username, p := range s.participants {
+        total := p.total
+        if !p.since.IsZero() {
+            total += now.Sub(p.since)
+        }
+        call.Participants = append(call.Participants, models.CallParticipant{
+            Username: username,
+            JoinedAt: p.joinedAt,
+            LeftAt:   p.leftAt,
+            Duration: int64(total / time.Second),
+        })
+    }
+    sort.Slice(call.Participants, func(i, j int) bool {
+        return call.Participants[i].JoinedAt.Before(call.Participants[j].JoinedAt) ||
+            (call.Participants[i].JoinedAt.Equal(call.Participants[j].JoinedAt) && call.Participants[i].Username < call.Participants[j].Username)
+    })
+    if !call.StartedAt.IsZero() {
+        end := now
+        if !call.EndedAt.IsZero() {
+            end = call.EndedAt
+        }
+        call.Duration = int64(end.Sub(call.StartedAt) / time.Second)
+    }
+    return call
+}
+
+func newCallID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
@@ -0,0 +1,365 @@
+package calls
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "Thoth/internal/models"
+)
+
+const (
+    offer     = models.MessageTypeWebRTCOffer
+    answer    = models.MessageTypeWebRTCAnswer
+    candidate = models.MessageTypeWebRTCCandidate
+)
+
+// clock - управляемые часы для тестов
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+type fakeStore struct{ saved chan models.Call }
+
+func (f *fakeStore) SaveCall(ctx context.Context, call models.Call) error {
+    f.saved <- call
+    return nil
+}
+
+func newTestManager() (*Manager, *clock, *fakeStore) {
+    c := &clock{t: time.Unix(1700000000, 0)}
+    store := &fakeStore{saved: make(chan models.Call, 10)}
+    m := NewManager(store)
+    m.now = c.now
+    return m, c, store
+}
+
+func mustInvite(t *testing.T, m *Manager, roomID, from, to string) {
+    t.Helper()
+    if _, err := m.Invite(roomID, from, to); err != nil {
+        t.Fatalf("invite %s -> %s: %v", from, to, err)
+    }
+}
+
+func mustAccept(t *testing.T, m *Manager, roomID, from, to string) *models.Call {
+    t.Helper()
+    call, err := m.Accept(roomID, from, to)
+    if err != nil {
+        t.Fatalf("accept %s -> %s: %v", from, to, err)
+    }
+    return call
+}
+
+func mustSignal(t *testing.T, m *Manager, from, to, msgType string) {
+    t.Helper()
+    if err := m.Signal("general", from, to, msgType); err != nil {
+        t.Fatalf("%s %s -> %s: %v", msgType, from, to, err)
+    }
+}
+
+func TestCallLifecycle(t *testing.T) {
+    m, c, store := newTestManager()
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if active, ok := m.Active("general"); !ok || active.State != models.CallRinging || active.Initiator != "alice" {
+        t.Fatalf("после приглашения: %+v", active)
+    }
+
+    c.advance(5 * time.Second)
+    started := mustAccept(t, m, "general", "bob", "alice")
+    if started == nil || started.State != models.CallActive || len(started.Participants) != 2 {
+        t.Fatalf("после принятия ожидался активный звонок на двоих: %+v", started)
+    }
+    mustSignal(t, m, "alice", "bob", offer)
+    mustSignal(t, m, "alice", "bob", candidate)
+    mustSignal(t, m, "bob", "alice", answer)
+
+    // alice приглашает carol в идущий звонок
+    mustInvite(t, m, "general", "alice", "carol")
+    if call := mustAccept(t, m, "general", "carol", "alice"); call != nil {
+        t.Fatalf("звонок начался повторно: %+v", call)
+    }
+
+    c.advance(time.Minute)
+    if _, call := m.Leave("general", "carol"); call != nil {
+        t.Fatalf("звонок закончился, хотя остались двое: %+v", call)
+    }
+    c.advance(time.Minute)
+    _, ended := m.Leave("general", "bob")
+    if ended == nil || ended.State != models.CallEnded || ended.EndReason != models.CallCompleted {
+        t.Fatalf("после выхода bob звонок должен завершиться: %+v", ended)
+    }
+    if ended.Duration != 120 {
+        t.Errorf("длительность %d с, ожидалось 120", ended.Duration)
+    }
+    durations := map[string]int64{}
+    for _, p := range ended.Participants {
+        durations[p.Username] = p.Duration
+    }
+    if durations["alice"] != 125 || durations["bob"] != 120 || durations["carol"] != 60 {
+        t.Errorf("длительности участников: %v", durations)
+    }
+
+    select {
+    case saved := <-store.saved:
+        if saved.ID != ended.ID || len(saved.Participants) != 3 {
+            t.Errorf("сохранен не тот звонок: %+v", saved)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("звонок не сохранен")
+    }
+    if _, ok := m.Active("general"); ok {
+        t.Error("завершенный звонок остался активным")
+    }
+}
+
+func TestSignalingRequiresAcceptance(t *testing.T) {
+    m, _, _ := newTestManager()
+
+    if err := m.Signal("general", "alice", "bob", offer); err != ErrNotAccepted {
+        t.Errorf("offer без звонка: %v", err)
+    }
+    mustInvite(t, m, "general", "alice", "bob")
+    for _, msgType := range []string{offer, answer, candidate} {
+        if err := m.Signal("general", "alice", "bob", msgType); err != ErrNotAccepted {
+            t.Errorf("%s до принятия: %v", msgType, err)
+        }
+    }
+
+    mustAccept(t, m, "general", "bob", "alice")
+    if err := m.Signal("general", "bob", "alice", answer); err != ErrUnexpectedAnswer {
+        t.Errorf("answer без offer: %v", err)
+    }
+    mustSignal(t, m, "alice", "bob", offer)
+    if err := m.Signal("general", "alice", "bob", answer); err != ErrUnexpectedAnswer {
+        t.Errorf("ответ на собственный offer: %v", err)
+    }
+    mustSignal(t, m, "bob", "alice", answer)
+    if err := m.Signal("general", "bob", "alice", answer); err != ErrUnexpectedAnswer {
+        t.Errorf("повторный answer: %v", err)
+    }
+    // Повторное согласование в активном звонке
+    mustSignal(t, m, "bob", "alice", offer)
+    mustSignal(t, m, "alice", "bob", answer)
+}
+
+func TestInviteValidation(t *testing.T) {
+    m, _, _ := newTestManager()
+
+    if _, err := m.Invite("general", "alice", ""); err != ErrInvalidTarget {
+        t.Errorf("приглашение без адресата: %v", err)
+    }
+    if _, err := m.Invite("general", "alice", "alice"); err != ErrInvalidTarget {
+        t.Errorf("приглашение самому себе: %v", err)
+    }
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if _, err := m.Invite("general", "alice", "bob"); err != ErrAlreadyInCall {
+        t.Errorf("повторное приглашение: %v", err)
+    }
+    if _, err := m.Invite("general", "carol", "dave"); err != ErrCallInProgress {
+        t.Errorf("второй звонок в комнате: %v", err)
+    }
+    // bob уже звонят
+    if _, err := m.Invite("other", "carol", "bob"); err != ErrBusy {
+        t.Errorf("приглашение пользователю, которому звонят: %v", err)
+    }
+    // alice в звонке в general
+    if _, err := m.Invite("other", "carol", "alice"); err != ErrBusy {
+        t.Errorf("приглашение пользователю в звонке: %v", err)
+    }
+    if _, err := m.Invite("other", "alice", "carol"); err != ErrInAnotherCall {
+        t.Errorf("приглашение из второго звонка: %v", err)
+    }
+    mustInvite(t, m, "other", "carol", "dave")
+
+    if _, err := m.Accept("general", "carol", "alice"); err != ErrNoInvitation {
+        t.Errorf("принятие без приглашения: %v", err)
+    }
+    if _, err := m.Accept("general", "alice", "bob"); err != ErrNoInvitation {
+        t.Errorf("принятие собственного приглашения: %v", err)
+    }
+    if _, err := m.Decline("nowhere", "bob", "alice"); err != ErrNoCall {
+        t.Errorf("отказ без звонка: %v", err)
+    }
+}
+
+func TestCallEndReasons(t *testing.T) {
+    m, c, _ := newTestManager()
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if call, err := m.Cancel("general", "alice", "bob"); err != nil || call == nil || call.EndReason != models.CallCancelled {
+        t.Errorf("звонящий отменил приглашение: %+v, %v", call, err)
+    }
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if call, err := m.Decline("general", "bob", "alice"); err != nil || call == nil || call.EndReason != models.CallDeclined {
+        t.Errorf("приглашенный отказался: %+v, %v", call, err)
+    }
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if dropped, call := m.Leave("general", "alice"); call == nil || call.EndReason != models.CallCancelled || len(dropped) != 1 || dropped[0].To != "bob" {
+        t.Errorf("звонящий отключился: %+v, %+v", dropped, call)
+    }
+
+    mustInvite(t, m, "general", "alice", "bob")
+    c.advance(m.RingTimeout / 2)
+    if expired, ended := m.Expire(); len(expired) != 0 || len(ended) != 0 {
+        t.Fatalf("приглашение снято раньше таймаута: %+v", expired)
+    }
+    if pending := m.Pending("general", "bob"); len(pending) != 1 || pending[0].From != "alice" {
+        t.Errorf("ожидающие приглашения bob: %+v", pending)
+    }
+    c.advance(m.RingTimeout)
+    expired, ended := m.Expire()
+    if len(expired) != 1 || expired[0].From != "alice" || expired[0].To != "bob" {
+        t.Errorf("просроченные приглашения: %+v", expired)
+    }
+    if len(ended) != 1 || ended[0].EndReason != models.CallMissed || ended[0].Duration != 0 {
+        t.Errorf("пропущенный звонок: %+v", ended)
+    }
+}
+
+func TestUnansweredInviteKeepsActiveCall(t *testing.T) {
+    m, c, _ := newTestManager()
+
+    mustInvite(t, m, "general", "alice", "bob")
+    mustAccept(t, m, "general", "bob", "alice")
+    mustInvite(t, m, "general", "alice", "carol")
+
+    c.advance(2 * m.RingTimeout)
+    expired, ended := m.Expire()
+    if len(expired) != 1 || len(ended) != 0 {
+        t.Fatalf("carol не ответила, но alice и bob продолжают: %+v, %+v", expired, ended)
+    }
+    if active, ok := m.Active("general"); !ok || active.State != models.CallActive {
+        t.Errorf("звонок должен остаться активным: %+v", active)
+    }
+    // После отказа carol занята не будет
+    if _, err := m.Invite("other", "dave", "carol"); err != nil {
+        t.Errorf("приглашение после таймаута: %v", err)
+    }
+}
+
+func TestLeaveDropsDisconnectedParticipants(t *testing.T) {
+    m, _, _ := newTestManager()
+
+    // alice соединена с bob и carol, а они друг с другом - нет
+    mustInvite(t, m, "general", "alice", "bob")
+    mustAccept(t, m, "general", "bob", "alice")
+    mustInvite(t, m, "general", "alice", "carol")
+    mustAccept(t, m, "general", "carol", "alice")
+
+    _, call := m.Leave("general", "alice")
+    if call == nil || call.EndReason != models.CallCompleted {
+        t.Errorf("без alice у оставшихся нет соединений, звонок должен завершиться: %+v", call)
+    }
+}
+
+func TestSwitchToSFU(t *testing.T) {
+    m, _, _ := newTestManager()
+    m.SFUThreshold = 3
+
+    for _, username := range []string{"bob", "carol"} {
+        mustInvite(t, m, "general", "alice", username)
+        mustAccept(t, m, "general", username, "alice")
+        if active, _ := m.Active("general"); active.Mode != models.CallModeMesh {
+            t.Fatalf("звонок переведен на SFU при %d участниках", len(active.Participants))
+        }
+    }
+    mustInvite(t, m, "general", "alice", "dave")
+    mustAccept(t, m, "general", "dave", "alice")
+    if active, _ := m.Active("general"); active.Mode != models.CallModeSFU {
+        t.Fatalf("звонок на четверых должен идти через SFU: %+v", active)
+    }
+
+    // Через SFU остальные соединены с сервером: уход alice звонок не завершает
+    if _, call := m.Leave("general", "alice"); call != nil {
+        t.Fatalf("звонок завершился после ухода alice: %+v", call)
+    }
+    // Обратно в попарный режим звонок не возвращается
+    m.Leave("general", "dave")
+    if active, _ := m.Active("general"); active.Mode != models.CallModeSFU {
+        t.Errorf("звонок вернулся в режим %s", active.Mode)
+    }
+    if _, call := m.Leave("general", "carol"); call == nil || call.EndReason != models.CallCompleted {
+        t.Errorf("после ухода предпоследнего звонок должен завершиться: %+v", call)
+    }
+}
+
+func TestUseSFU(t *testing.T) {
+    m, _, _ := newTestManager()
+
+    if _, err := m.UseSFU("general"); err != ErrNoCall {
+        t.Fatalf("без звонка ожидали ErrNoCall, получили %v", err)
+    }
+    mustInvite(t, m, "general", "alice", "bob")
+    if _, err := m.UseSFU("general"); err != ErrNoCall {
+        t.Fatalf("звонок без ответа не переводится на SFU, получили %v", err)
+    }
+    mustAccept(t, m, "general", "bob", "alice")
+
+    call, err := m.UseSFU("general")
+    if err != nil || call.Mode != models.CallModeSFU {
+        t.Fatalf("UseSFU: %+v, %v", call, err)
+    }
+    if active, _ := m.Active("general"); active.Mode != models.CallModeSFU {
+        t.Errorf("режим звонка не сохранился: %s", active.Mode)
+    }
+}
+
+func TestInCall(t *testing.T) {
+    m, _, _ := newTestManager()
+
+    mustInvite(t, m, "general", "alice", "bob")
+    if _, ok := m.InCall("general", "bob"); ok {
+        t.Fatal("приглашенный еще не в звонке")
+    }
+    mustAccept(t, m, "general", "bob", "alice")
+
+    call, ok := m.InCall("general", "bob")
+    if !ok || call.ID == "" {
+        t.Fatalf("InCall: %+v, %v", call, ok)
+    }
+    if other, _ := m.InCall("general", "alice"); other.ID != call.ID {
+        t.Errorf("участники в разных звонках: %s и %s", call.ID, other.ID)
+    }
+    if _, ok := m.InCall("random", "bob"); ok {
+        t.Error("звонок другой комнаты")
+    }
+}
+
+func TestSummarizeStats(t *testing.T) {
+    at := time.Unix(1700000000, 0)
+    report := func(username, peer string, offset int, rtt, loss float64, candidate string) models.CallStats {
+        return models.CallStats{
+            CallID: "c1", Username: username, Peer: peer, RTT: rtt, PacketLoss: loss, Jitter: 4,
+            BitrateIn: 500000, BitrateOut: 1000000, CandidateType: candidate,
+            ReportedAt: at.Add(time.Duration(offset) * 10 * time.Second),
+        }
+    }
+    summaries := SummarizeStats([]models.CallStats{
+        report("bob", "alice", 0, 30, 0, models.CandidateHost),
+        report("alice", "bob", 1, 40, 0.02, models.CandidateSrflx),
+        report("alice", "bob", 0, 20, 0, models.CandidateSrflx),
+        report("alice", "bob", 2, 90, 0.1, models.CandidateRelay),
+    })
+
+    if len(summaries) != 2 || summaries[0].Username != "alice" || summaries[1].Username != "bob" {
+        t.Fatalf("ожидали сводки alice->bob и bob->alice по порядку, получили %+v", summaries)
+    }
+    s := summaries[0]
+    if s.Reports != 3 || s.RTTAvg != 50 || s.RTTMax != 90 || s.PacketLossMax != 0.1 || s.JitterAvg != 4 {
+        t.Errorf("сводка alice: %+v", s)
+    }
+    if !s.From.Equal(at) || !s.To.Equal(at.Add(20*time.Second)) {
+        t.Errorf("период alice: %v - %v", s.From, s.To)
+    }
+    if !s.Relayed || len(s.CandidateTypes) != 2 {
+        t.Errorf("alice переключилась на TURN: relayed=%v types=%v", s.Relayed, s.CandidateTypes)
+    }
+    if summaries[1].Relayed || summaries[1].Reports != 1 {
+        t.Errorf("сводка bob: %+v", summaries[1])
+    }
+}
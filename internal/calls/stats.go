@@ -0,0 +1,114 @@
+package calls
+
+import (
+    "sort"
+    "time"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+)
+
+var (
+    statsReports = metrics.NewCounter("thoth_call_stats_reports_total",
+        "Call quality reports by ICE candidate type of the connection", "candidate_type")
+    statsRTT = metrics.NewHistogram("thoth_call_rtt_seconds",
+        "Round-trip time reported by call participants",
+        []float64{0.025, 0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 1, 2})
+    statsJitter = metrics.NewHistogram("thoth_call_jitter_seconds",
+        "Incoming jitter reported by call participants",
+        []float64{0.005, 0.01, 0.02, 0.03, 0.05, 0.1, 0.2})
+    statsLoss = metrics.NewHistogram("thoth_call_packet_loss_ratio",
+        "Share of lost incoming packets reported by call participants",
+        []float64{0, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5})
+    statsBitrate = metrics.NewHistogram("thoth_call_bitrate_bits_per_second",
+        "Connection bitrate reported by call participants", []float64{32e3, 64e3, 128e3, 256e3, 512e3, 1e6, 2e6, 4e6},
+        "direction")
+)
+
+// ObserveStats учитывает отчет участника в метриках качества звонков
+func ObserveStats(s models.CallStats) {
+    statsReports.Inc(s.CandidateType)
+    statsRTT.Observe(s.RTT / 1000)
+    statsJitter.Observe(s.Jitter / 1000)
+    statsLoss.Observe(s.PacketLoss)
+    statsBitrate.Observe(s.BitrateIn, "in")
+    statsBitrate.Observe(s.BitrateOut, "out")
+}
+
+// StatsSummary - качество одного соединения участника за звонок по его отчетам
+type StatsSummary struct {
+    Username       string    `json:"username"`
+    Peer           string    `json:"peer"`
+    Reports        int       `json:"reports"`
+    From           time.Time `json:"from"`
+    To             time.Time `json:"to"`
+    RTTAvg         float64   `json:"rtt_avg_ms"`
+    RTTMax         float64   `json:"rtt_max_ms"`
+    PacketLossAvg  float64   `json:"packet_loss_avg"`
+    PacketLossMax  float64   `json:"packet_loss_max"`
+    JitterAvg      float64   `json:"jitter_avg_ms"`
+    JitterMax      float64   `json:"jitter_max_ms"`
+    BitrateInAvg   float64   `json:"bitrate_in_avg"`
+    BitrateOutAvg  float64   `json:"bitrate_out_avg"`
+    CandidateTypes []string  `json:"candidate_types"` // Все типы кандидатов за звонок: ICE мог переключиться
+    Relayed        bool      `json:"relayed"`         // Хотя бы часть звонка шла через TURN
+}
+
+// SummarizeStats сводит отчеты звонка по соединениям: участник и его собеседник.
+// Результат упорядочен по участнику и собеседнику
+func SummarizeStats(reports []models.CallStats) []StatsSummary {
+    type connection struct{ username, peer string }
+    byConn := make(map[connection]*StatsSummary)
+    for _, r := range reports {
+        key := connection{r.Username, r.Peer}
+        s := byConn[key]
+        if s == nil {
+            s = &StatsSummary{Username: r.Username, Peer: r.Peer, From: r.ReportedAt, To: r.ReportedAt}
+            byConn[key] = s
+        }
+        s.Reports++
+        if r.ReportedAt.Before(s.From) {
+            s.From = r.ReportedAt
+        }
+        if r.ReportedAt.After(s.To) {
+            s.To = r.ReportedAt
+        }
+        // Пока здесь суммы, средние считаются ниже
+        s.RTTAvg += r.RTT
+        s.PacketLossAvg += r.PacketLoss
+        s.JitterAvg += r.Jitter
+        s.BitrateInAvg += r.BitrateIn
+        s.BitrateOutAvg += r.BitrateOut
+        s.RTTMax = max(s.RTTMax, r.RTT)
+        s.PacketLossMax = max(s.PacketLossMax, r.PacketLoss)
+        s.JitterMax = max(s.JitterMax, r.Jitter)
+        if r.Relayed() {
+            s.Relayed = true
+        }
+        seen := false
+        for _, t := range s.CandidateTypes {
+            seen = seen || t == r.CandidateType
+        }
+        if !seen {
+            s.CandidateTypes = append(s.CandidateTypes, r.CandidateType)
+        }
+    }
+
+    summaries := make([]StatsSummary, 0, len(byConn))
+    for _, s := range byConn {
+        n := float64(s.Reports)
+        s.RTTAvg /= n
+        s.PacketLossAvg /= n
+        s.JitterAvg /= n
+        s.BitrateInAvg /= n
+        s.BitrateOutAvg /= n
+        summaries = append(summaries, *s)
+    }
+    sort.Slice(summaries, func(i, j int) bool {
+        if summaries[i].Username != summaries[j].Username {
+            return summaries[i].Username < summaries[j].Username
+        }
+        return summaries[i].Peer < summaries[j].Peer
+    })
+    return summaries
+}
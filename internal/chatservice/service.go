@@ -8,8 +8,13 @@ import (
     
     "google.golang.org/grpc/codes"
     "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/timestamppb"
     
     "Thoth/proto/chatpb"
+    "Thoth/internal/markdown"
+    "Thoth/internal/models"
+    "Thoth/internal/moderation"
+    "Thoth/internal/ratelimit"
     "Thoth/internal/storage"
 )
 
@@ -19,6 +24,8 @@ var serviceLogger = slog.With("component", "chatservice")
 type ChatService struct {
     chatpb.UnimplementedChatServiceServer
     store *storage.Storage
+
+    Filters *moderation.Chain // Фильтры сообщений перед сохранением; nil - без фильтрации
 }
 
 // NewChatService создает новый экземпляр Chat Service
@@ -29,6 +36,25 @@ func NewChatService(store *storage.Storage) *ChatService {
     }
 }
 
+// RateClass относит gRPC-метод к классу лимитов: отправка сообщений ограничивается
+// как чат, остальные методы - как запросы на чтение
+func RateClass(fullMethod string) string {
+    if fullMethod == chatpb.ChatService_SendMessage_FullMethodName {
+        return ratelimit.ClassChat
+    }
+    return ratelimit.ClassQuery
+}
+
+// RateCaller возвращает отправителя запроса для лимитов пользователя. Он известен только
+// для SendMessage (автор сообщения): в запросах поиска и упоминаний username - это фильтр
+// и чьи упоминания читать, а не тот, кто спрашивает
+func RateCaller(req interface{}) string {
+    if msg, ok := req.(*chatpb.ChatMessage); ok {
+        return msg.GetUsername()
+    }
+    return ""
+}
+
 // SendMessage обрабатывает отправку сообщения в чат
 func (s *ChatService) SendMessage(ctx context.Context, req *chatpb.ChatMessage) (*chatpb.SendMessageResponse, error) {
     serviceLogger.Info("Received SendMessage request", 
@@ -59,20 +85,54 @@ func (s *ChatService) SendMessage(ctx context.Context, req *chatpb.ChatMessage)
     }
 
     // Проверяем длину сообщения
-    if len(req.Content) > 1000 {
+    if len(req.Content) > models.MaxContentLength {
         serviceLogger.Warn("SendMessage: message too long", "length", len(req.Content))
         return &chatpb.SendMessageResponse{
             Success:      false,
-            ErrorMessage: "Message is too long (max 1000 characters)",
+            ErrorMessage: fmt.Sprintf("Message is too long (max %d characters)", models.MaxContentLength),
         }, status.Error(codes.InvalidArgument, "message too long")
     }
 
+    if req.Format != "" && req.Format != models.FormatPlain && req.Format != models.FormatMarkdown {
+        serviceLogger.Warn("SendMessage: unknown format", "format", req.Format)
+        return &chatpb.SendMessageResponse{
+            Success:      false,
+            ErrorMessage: fmt.Sprintf("Unknown format %q", req.Format),
+        }, status.Error(codes.InvalidArgument, "unknown format")
+    }
+
+    if s.Filters != nil {
+        verdict := s.Filters.Check(ctx, moderation.Message{Username: req.Username, RoomID: req.RoomId, Content: req.Content})
+        switch verdict.Action {
+        case moderation.ActionReject:
+            return &chatpb.SendMessageResponse{
+                Success:      false,
+                ErrorMessage: verdict.Reason,
+            }, status.Error(codes.InvalidArgument, verdict.Reason)
+        case moderation.ActionShadowMute:
+            // Отправитель не должен догадаться, что сообщение никто не увидит
+            return &chatpb.SendMessageResponse{
+                Success:   true,
+                MessageId: fmt.Sprintf("%s_%d", req.RoomId, time.Now().UnixNano()),
+            }, nil
+        case moderation.ActionRedact:
+            req.Content = verdict.Content
+        }
+    }
+
     // Создаем storage.Message для сохранения в БД
     storageMsg := storage.Message{
         Username: req.Username,
         Content:  req.Content,
-        // storage.Message не имеет RoomID, но мы можем добавить позже
+        Format:   req.Format,
+        RoomID:   req.RoomId,
+    }
+    if req.Format == models.FormatMarkdown {
+        storageMsg.HTML = markdown.Render(req.Content)
     }
+    // Упоминания сохраняются вместе с сообщением; живых подключений у сервиса нет,
+    // поэтому упомянутые увидят их через ListMentions
+    storageMsg.Mentions, storageMsg.MentionRoom = markdown.ExtractMentions(req.Content, models.MaxMentions)
 
     // Сохраняем в базу данных
     err := s.store.SaveMessage(ctx, storageMsg)
@@ -104,6 +164,96 @@ func (s *ChatService) SendMessage(ctx context.Context, req *chatpb.ChatMessage)
     }, nil
 }
 
+// SearchMessages выполняет полнотекстовый поиск по сохраненным сообщениям одной комнаты.
+// Поиск сразу по всем комнатам не поддерживается, как и в HTTP API
+func (s *ChatService) SearchMessages(ctx context.Context, req *chatpb.SearchMessagesRequest) (*chatpb.SearchMessagesResponse, error) {
+    serviceLogger.Info("Received SearchMessages request",
+        "room_id", req.RoomId,
+        "username", req.Username,
+        "query_length", len(req.Query))
+
+    query := storage.SearchQuery{
+        Query:    req.Query,
+        RoomID:   req.RoomId,
+        Username: req.Username,
+        Limit:    int(req.Limit),
+        Offset:   int(req.Offset),
+    }
+    if req.From != nil {
+        query.From = req.From.AsTime()
+    }
+    if req.To != nil {
+        query.To = req.To.AsTime()
+    }
+
+    if query.RoomID == "" {
+        serviceLogger.Warn("SearchMessages: empty room_id")
+        return nil, status.Error(codes.InvalidArgument, "room_id is required")
+    }
+    if err := query.Validate(); err != nil {
+        serviceLogger.Warn("SearchMessages: invalid request", "error", err)
+        return nil, status.Error(codes.InvalidArgument, err.Error())
+    }
+
+    results, err := s.store.SearchMessages(ctx, query)
+    if err != nil {
+        serviceLogger.Error("Failed to search messages", "error", err)
+        return nil, status.Error(codes.Internal, "database error")
+    }
+
+    resp := &chatpb.SearchMessagesResponse{
+        Results: make([]*chatpb.SearchResult, 0, len(results)),
+    }
+    for _, r := range results {
+        resp.Results = append(resp.Results, &chatpb.SearchResult{
+            MessageId:   int64(r.ID),
+            Username:    r.Username,
+            RoomId:      r.RoomID,
+            Content:     r.Content,
+            SnippetHtml: storage.HighlightHTML(r.Snippet),
+            CreatedAt:   timestamppb.New(r.CreatedAt),
+            Rank:        r.Rank,
+        })
+    }
+
+    serviceLogger.Info("Search completed", "results", len(resp.Results))
+    return resp, nil
+}
+
+// ListMentions возвращает упоминания пользователя от новых к старым
+func (s *ChatService) ListMentions(ctx context.Context, req *chatpb.ListMentionsRequest) (*chatpb.ListMentionsResponse, error) {
+    if req.Username == "" {
+        return nil, status.Error(codes.InvalidArgument, "username is required")
+    }
+    limit := int(req.Limit)
+    if limit <= 0 || limit > 100 {
+        limit = 50
+    }
+
+    mentions, err := s.store.ListMentions(ctx, req.Username, req.UnreadOnly, req.BeforeId, limit)
+    if err != nil {
+        serviceLogger.Error("Failed to list mentions", "error", err, "username", req.Username)
+        return nil, status.Error(codes.Internal, "database error")
+    }
+
+    resp := &chatpb.ListMentionsResponse{
+        Mentions: make([]*chatpb.Mention, 0, len(mentions)),
+    }
+    for _, m := range mentions {
+        resp.Mentions = append(resp.Mentions, &chatpb.Mention{
+            Id:        m.ID,
+            MessageId: int64(m.MessageID),
+            RoomId:    m.RoomID,
+            Author:    m.Author,
+            Kind:      m.Kind,
+            Content:   m.Content,
+            Read:      m.ReadAt.Valid,
+            CreatedAt: timestamppb.New(m.CreatedAt),
+        })
+    }
+    return resp, nil
+}
+
 // Дополнительные методы можно добавить позже:
 
 // GetRecentMessages - получение истории сообщений
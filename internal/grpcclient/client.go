@@ -85,6 +85,30 @@ func (c *ChatClient) SendMessage(ctx context.Context, username, content, roomID
     return resp, nil
 }
 
+// SearchMessages выполняет полнотекстовый поиск по сообщениям через gRPC
+func (c *ChatClient) SearchMessages(ctx context.Context, req *chatpb.SearchMessagesRequest) (*chatpb.SearchMessagesResponse, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    start := time.Now()
+    resp, err := c.client.SearchMessages(ctx, req)
+    duration := time.Since(start)
+
+    if err != nil {
+        clientLogger.Error("gRPC SearchMessages failed",
+            "error", err,
+            "duration", duration,
+            "room_id", req.RoomId)
+        return nil, fmt.Errorf("grpc search messages failed: %w", err)
+    }
+
+    clientLogger.Info("gRPC SearchMessages successful",
+        "duration", duration,
+        "results", len(resp.Results))
+
+    return resp, nil
+}
+
 // Close закрывает соединение с Chat Service
 func (c *ChatClient) Close() error {
     if c.conn != nil {
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "log/slog"
+    "mime"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/blobstore"
+    "Thoth/internal/imaging"
+    "Thoth/internal/storage"
+)
+
+var attachmentLogger = slog.With("component", "attachments")
+
+// DefaultMaxUploadSize - предельный размер одного файла по умолчанию
+const DefaultMaxUploadSize = 10 << 20
+
+// DefaultUploadTypes - типы файлов, разрешенные по умолчанию. Тип определяется по содержимому,
+// а не по заголовку Content-Type от клиента
+var DefaultUploadTypes = []string{
+    "image/png", "image/jpeg", "image/gif", "image/webp",
+    "application/pdf", "application/zip", "text/plain",
+}
+
+// AttachmentHandler принимает загрузки файлов и отдает их участникам комнаты
+type AttachmentHandler struct {
+    Store        *storage.Storage
+    Blobs        blobstore.Store
+    Signer       *auth.Signer
+    MaxSize      int64
+    AllowedTypes []string
+}
+
+func NewAttachmentHandler(store *storage.Storage, blobs blobstore.Store, signer *auth.Signer) *AttachmentHandler {
+    return &AttachmentHandler{
+        Store:        store,
+        Blobs:        blobs,
+        Signer:       signer,
+        MaxSize:      DefaultMaxUploadSize,
+        AllowedTypes: DefaultUploadTypes,
+    }
+}
+
+// member проверяет токен участника (заголовок X-Thoth-Token или параметр token) и то,
+// что пользователь действительно состоит в комнате roomID
+func (ah *AttachmentHandler) member(r *http.Request, roomID string) (auth.MemberClaims, bool) {
+    claims, err := ah.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != roomID {
+        return claims, false
+    }
+    if _, err := ah.Store.GetRoomMember(r.Context(), roomID, claims.Username); err != nil {
+        if !errors.Is(err, storage.ErrNotFound) {
+            attachmentLogger.Error("Failed to check room membership", "room", roomID, "error", err)
+        }
+        return claims, false
+    }
+    return claims, true
+}
+
+// Upload принимает файл из поля "file" формы multipart/form-data:
+// POST /api/rooms/{room}/attachments. Возвращает вложение, ID которого клиент
+// затем указывает в чат-сообщении
+func (ah *AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+    roomID := r.PathValue("room")
+    claims, ok := ah.member(r, roomID)
+    if !ok {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    // Запас на заголовки multipart
+    r.Body = http.MaxBytesReader(w, r.Body, ah.MaxSize+64<<10)
+    mr, err := r.MultipartReader()
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "expected multipart/form-data")
+        return
+    }
+
+    var part io.ReadCloser
+    var filename string
+    for {
+        p, err := mr.NextPart()
+        if err != nil {
+            writeError(w, http.StatusBadRequest, "form field \"file\" is required")
+            return
+        }
+        if p.FormName() == "file" {
+            part, filename = p, p.FileName()
+            break
+        }
+        p.Close()
+    }
+    defer part.Close()
+
+    // Файл сначала пишется во временный файл: так известен точный размер,
+    // а недокачанная загрузка не попадает в хранилище
+    tmp, err := os.CreateTemp("", "thoth-upload-*")
+    if err != nil {
+        attachmentLogger.Error("Failed to create temp file", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    size, err := io.Copy(tmp, io.LimitReader(part, ah.MaxSize+1))
+    var maxBytesErr *http.MaxBytesError
+    if errors.As(err, &maxBytesErr) || size > ah.MaxSize {
+        writeError(w, http.StatusRequestEntityTooLarge, "file is too large (max "+strconv.FormatInt(ah.MaxSize, 10)+" bytes)")
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "failed to read upload")
+        return
+    }
+    if size == 0 {
+        writeError(w, http.StatusBadRequest, "file is empty")
+        return
+    }
+
+    if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    contentType, ok := ah.detectType(tmp)
+    if !ok {
+        writeError(w, http.StatusUnsupportedMediaType, "file type "+contentType+" is not allowed")
+        return
+    }
+
+    id, err := randomToken(16)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    a := storage.Attachment{
+        ID:          id,
+        RoomID:      roomID,
+        Uploader:    claims.Username,
+        Filename:    sanitizeFilename(filename),
+        ContentType: contentType,
+        Size:        size,
+        BlobKey:     "attachments/" + id,
+    }
+
+    if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    // Картинки очищаются от метаданных (EXIF с координатами и т.п.) до сохранения,
+    // заодно для них строится превью
+    var body io.Reader = tmp
+    var thumbnail []byte
+    if mediaType, _, _ := mime.ParseMediaType(contentType); imaging.IsSupported(mediaType) {
+        data, err := io.ReadAll(tmp) // размер ограничен MaxSize
+        if err != nil {
+            writeError(w, http.StatusInternalServerError, "internal error")
+            return
+        }
+        img, err := imaging.Process(data, mediaType)
+        if err != nil {
+            attachmentLogger.Warn("Rejected invalid image", "room", roomID, "username", claims.Username, "error", err)
+            writeError(w, http.StatusUnprocessableEntity, "invalid image")
+            return
+        }
+        body, a.Size = bytes.NewReader(img.Data), int64(len(img.Data))
+        a.Width, a.Height = img.Width, img.Height
+        if img.Thumbnail != nil {
+            a.ThumbnailKey, a.ThumbnailType = "thumbnails/"+id, img.ThumbnailType
+            thumbnail = img.Thumbnail
+        }
+    }
+
+    if err := ah.Blobs.Put(r.Context(), a.BlobKey, body, a.Size, contentType); err != nil {
+        attachmentLogger.Error("Failed to store blob", "key", a.BlobKey, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    if thumbnail != nil {
+        if err := ah.Blobs.Put(r.Context(), a.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), a.ThumbnailType); err != nil {
+            attachmentLogger.Error("Failed to store thumbnail", "key", a.ThumbnailKey, "error", err)
+            ah.removeBlobs(r.Context(), a)
+            writeError(w, http.StatusInternalServerError, "internal error")
+            return
+        }
+    }
+    if a, err = ah.Store.CreateAttachment(r.Context(), a); err != nil {
+        attachmentLogger.Error("Failed to save attachment", "error", err)
+        ah.removeBlobs(r.Context(), a)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    attachmentLogger.Info("File uploaded", "id", a.ID, "room", roomID, "username", claims.Username, "type", contentType, "size", a.Size)
+    writeJSON(w, http.StatusCreated, a.Model())
+}
+
+// removeBlobs удаляет объекты вложения, для которого не удалось завершить загрузку
+func (ah *AttachmentHandler) removeBlobs(ctx context.Context, a storage.Attachment) {
+    for _, key := range []string{a.BlobKey, a.ThumbnailKey} {
+        if key == "" {
+            continue
+        }
+        if err := ah.Blobs.Delete(ctx, key); err != nil {
+            attachmentLogger.Error("Failed to remove orphan blob", "key", key, "error", err)
+        }
+    }
+}
+
+// detectType определяет тип по первым 512 байтам и проверяет его по списку разрешенных
+func (ah *AttachmentHandler) detectType(r io.Reader) (string, bool) {
+    head, _ := bufio.NewReaderSize(r, 512).Peek(512)
+    contentType := http.DetectContentType(head)
+
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return contentType, false
+    }
+    for _, allowed := range ah.AllowedTypes {
+        if mediaType == allowed {
+            return contentType, true
+        }
+    }
+    return mediaType, false
+}
+
+// Download отдает файл: GET /api/attachments/{id}?token=<токен участника>.
+// Доступ есть только у участников комнаты, в которую файл был загружен
+func (ah *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+    ah.serve(w, r, false)
+}
+
+// Thumbnail отдает превью картинки: GET /api/attachments/{id}/thumbnail с тем же доступом
+func (ah *AttachmentHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+    ah.serve(w, r, true)
+}
+
+func (ah *AttachmentHandler) serve(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+    a, err := ah.Store.GetAttachment(r.Context(), r.PathValue("id"))
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "attachment not found")
+        return
+    }
+    if err != nil {
+        attachmentLogger.Error("Failed to load attachment", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    // Чужим комнатам отвечаем так же, как на несуществующий файл
+    if _, ok := ah.member(r, a.RoomID); !ok {
+        writeError(w, http.StatusNotFound, "attachment not found")
+        return
+    }
+
+    key, contentType := a.BlobKey, a.ContentType
+    if thumbnail {
+        if a.ThumbnailKey == "" {
+            writeError(w, http.StatusNotFound, "thumbnail not found")
+            return
+        }
+        key, contentType = a.ThumbnailKey, a.ThumbnailType
+    }
+
+    blob, err := ah.Blobs.Open(r.Context(), key)
+    if err != nil {
+        attachmentLogger.Error("Failed to open blob", "key", key, "error", err)
+        writeError(w, http.StatusNotFound, "attachment not found")
+        return
+    }
+    defer blob.Close()
+
+    disposition := "attachment"
+    if strings.HasPrefix(contentType, "image/") {
+        disposition = "inline"
+    }
+
+    w.Header().Set("Content-Type", contentType)
+    if !thumbnail {
+        w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+    }
+    w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+    w.Header().Set("Cache-Control", "private, max-age=3600")
+
+    if _, err := io.Copy(w, blob); err != nil {
+        attachmentLogger.Warn("Attachment download interrupted", "id", a.ID, "error", err)
+    }
+}
+
+// sanitizeFilename оставляет от имени файла только последний компонент пути без управляющих символов
+func sanitizeFilename(name string) string {
+    name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+    name = strings.Map(func(r rune) rune {
+        if r < 0x20 || r == 0x7f || r == '"' {
+            return -1
+        }
+        return r
+    }, name)
+    name = strings.TrimSpace(name)
+
+    for len(name) > 255 {
+        _, size := utf8.DecodeLastRuneInString(name)
+        name = name[:len(name)-size]
+    }
+    if name == "" || name == "." || name == "/" {
+        return "file"
+    }
+    return name
+}
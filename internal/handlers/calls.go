@@ -0,0 +1,95 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/calls"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+// CallHandler отдает участникам комнаты текущий звонок и историю звонков,
+// администраторам - качество соединений в звонке
+type CallHandler struct {
+    Store  *storage.Storage
+    Signer *auth.Signer
+    Calls  *calls.Manager
+}
+
+func NewCallHandler(store *storage.Storage, signer *auth.Signer, manager *calls.Manager) *CallHandler {
+    return &CallHandler{Store: store, Signer: signer, Calls: manager}
+}
+
+// List обрабатывает GET /api/rooms/{room}/calls?before=<RFC 3339>&limit=...
+func (ch *CallHandler) List(w http.ResponseWriter, r *http.Request) {
+    roomID := r.PathValue("room")
+    claims, err := ch.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != roomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    params := r.URL.Query()
+    limit, err := parseOptionalInt(params.Get("limit"))
+    if err != nil || limit < 0 || limit > 100 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+        return
+    }
+    if limit == 0 {
+        limit = 20
+    }
+    var before time.Time
+    if v := params.Get("before"); v != "" {
+        if before, err = time.Parse(time.RFC3339, v); err != nil {
+            writeError(w, http.StatusBadRequest, "before must be an RFC 3339 timestamp")
+            return
+        }
+    }
+
+    history, err := ch.Store.ListCalls(r.Context(), roomID, before, limit)
+    if err != nil {
+        chatLogger.Error("Failed to list calls", "room", roomID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    if history == nil {
+        history = []models.Call{}
+    }
+
+    resp := map[string]interface{}{"calls": history}
+    if active, ok := ch.Calls.Active(roomID); ok {
+        resp["active"] = active
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// Stats обрабатывает GET /api/calls/{id}/stats?limit=... (административный API): отчеты
+// участников о качестве соединений и сводку по каждому соединению
+func (ch *CallHandler) Stats(w http.ResponseWriter, r *http.Request) {
+    callID := r.PathValue("id")
+    limit, err := parseOptionalInt(r.URL.Query().Get("limit"))
+    if err != nil || limit < 0 || limit > 20000 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 20000")
+        return
+    }
+    if limit == 0 {
+        limit = 5000
+    }
+
+    reports, err := ch.Store.ListCallStats(r.Context(), callID, limit)
+    if err != nil {
+        chatLogger.Error("Failed to list call stats", "call_id", callID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    if reports == nil {
+        reports = []models.CallStats{}
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "call_id":     callID,
+        "connections": calls.SummarizeStats(reports),
+        "reports":     reports,
+    })
+}
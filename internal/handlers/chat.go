@@ -1,11 +1,17 @@
 package handlers
 
 import (
+    "context"
+    "errors"
     "net/http"
     "log/slog"
+    "time"
 
     "github.com/gorilla/websocket"
+    "Thoth/internal/auth"
     "Thoth/internal/models"
+    "Thoth/internal/ratelimit"
+    "Thoth/internal/sfu"
     "Thoth/internal/storage"
     wsHub "Thoth/internal/websocket"
 )
@@ -14,10 +20,171 @@ var chatLogger = slog.With("component", "chat")
 type ChatHandler struct {
     Hub *wsHub.Hub
     Store *storage.Storage
+    Signer *auth.Signer // Выдает токены участника для загрузки и скачивания файлов
+    Limiter *ratelimit.Limiter // Лимиты частоты сообщений; nil - без ограничений
+    Origins *OriginPolicy // С каких страниц можно подключаться; по умолчанию только с того же хоста
+
+    members memberStore // Участники комнат и занятые имена; nil - без базы
+}
+
+// memberStore - то, что ServeWS берет из базы. Реализуется *storage.Storage
+type memberStore interface {
+    TouchRoomMember(ctx context.Context, roomID, username string) (storage.RoomMember, bool, error)
+    ClaimUsername(ctx context.Context, username string) (bool, error)
+}
+
+func NewChatHandler(hub *wsHub.Hub, store *storage.Storage, signer *auth.Signer) *ChatHandler {
+    origins, _ := ParseOriginPolicy("")
+    ch := &ChatHandler{Hub: hub, Store: store, Signer: signer, Origins: origins}
+    if store != nil {
+        ch.members = store
+    }
+    return ch
+}
+
+// anonymousName - имя подключения без имени. Его никто не занимает
+const anonymousName = "Аноним"
+
+// identity - что подтверждено о подключении
+type identity struct {
+    Role     string // Роль в комнате
+    Verified bool   // Имя подтверждено ключом пользователя
+}
+
+// identify определяет роль подключения в комнате и подтверждено ли его имя.
+// Имя в запросе ничем не подтверждено, поэтому роль из таблицы достается только
+// создателю комнаты, по ключу владельца или по токену, выданному владельцу.
+// Имя подтверждает ключ пользователя, токен подтвержденной сессии или то, что
+// имя еще никем не занято. Ссылка на встречу ни роли, ни имени не подтверждает
+func (ch *ChatHandler) identify(r *http.Request, roomID, username string) identity {
+    id := identity{Role: storage.RoleMember}
+
+    // owner - подключение вправе получить роль из таблицы: первый вход в комнату
+    // (создатель комнаты становится владельцем) или подтверждение владельца
+    var member storage.RoomMember
+    stored, owner := false, false
+    if ch.members != nil {
+        m, created, err := ch.members.TouchRoomMember(r.Context(), roomID, username)
+        if err != nil {
+            chatLogger.Error("Failed to record room member", "username", username, "room", roomID, "error", err)
+        } else {
+            member, stored, owner = m, true, created
+        }
+    }
+
+    var prev auth.MemberClaims
+    hasPrev := false
+    if ch.Signer != nil {
+        if key, err := ch.Signer.VerifyOwnerKey(r.URL.Query().Get("owner_key")); err == nil &&
+            key.RoomID == roomID && key.Username == username {
+            owner = true
+        }
+        if claims, err := ch.Signer.VerifyMemberToken(memberToken(r)); err == nil &&
+            claims.RoomID == roomID && claims.Username == username {
+            prev, hasPrev = claims, true
+            // Токен любого подключения под этим именем ничего не доказывает:
+            // в счет идут только роль владельца и подтвержденное имя, выданные раньше
+            owner = owner || claims.Role == storage.RoleOwner
+            id.Verified = id.Verified || claims.Verified
+        }
+        if name, err := ch.Signer.VerifyUserKey(r.URL.Query().Get("user_key")); err == nil && name == username {
+            id.Verified = true
+        }
+    }
+
+    switch {
+    case owner && stored:
+        // Роль из таблицы важнее роли в токене: снятая роль не должна жить еще 12 часов
+        id.Role = member.Role
+    case owner && hasPrev && prev.Role != "":
+        // Без базы роль переходит только через токен
+        id.Role = prev.Role
+    }
+
+    // Свободное имя закрепляется за первым, кто его выбрал
+    if !id.Verified && ch.members != nil && username != anonymousName {
+        claimed, err := ch.members.ClaimUsername(r.Context(), username)
+        if err != nil {
+            chatLogger.Error("Failed to claim username", "username", username, "error", err)
+        }
+        id.Verified = claimed
+    }
+    return id
+}
+
+// UpgradeToken обрабатывает POST /api/ws-token - токен для подключения к /ws.
+// POST, потому что браузер присылает Origin и на запросы к своему же хосту,
+// а ответ на запрос с чужой страницы та прочитать не может
+func (ch *ChatHandler) UpgradeToken(w http.ResponseWriter, r *http.Request) {
+    origin := r.Header.Get("Origin")
+    if !ch.Origins.Allowed(origin, r.Host) {
+        rejectUpgrade(r, "origin", nil)
+        writeError(w, http.StatusForbidden, "origin not allowed")
+        return
+    }
+    token, err := ch.Signer.IssueUpgradeToken(origin)
+    if err != nil {
+        chatLogger.Error("Failed to issue upgrade token", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "token":      token,
+        "expires_in": int(auth.UpgradeTokenTTL.Seconds()),
+    })
+}
+
+// checkUpgrade - CheckOrigin апгрейдера: Origin из разрешенных и токен подключения
+// (параметр csrf), выданный той же странице
+func (ch *ChatHandler) checkUpgrade(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    if !ch.Origins.Allowed(origin, r.Host) {
+        rejectUpgrade(r, "origin", nil)
+        return false
+    }
+    if ch.Signer != nil {
+        if err := ch.Signer.VerifyUpgradeToken(r.URL.Query().Get("csrf"), origin); err != nil {
+            rejectUpgrade(r, "token", err)
+            return false
+        }
+    }
+    return true
 }
 
-func NewChatHandler(hub *wsHub.Hub, store *storage.Storage) *ChatHandler {
-    return &ChatHandler{Hub: hub, Store: store}
+func rejectUpgrade(r *http.Request, reason string, err error) {
+    upgradeRejectedTotal.Inc(reason)
+    chatLogger.Warn("WebSocket upgrade rejected",
+        "reason", reason,
+        "origin", r.Header.Get("Origin"),
+        "remote", r.RemoteAddr,
+        "error", err)
+}
+
+// verifyMeeting проверяет токен ссылки на встречу и то, что встречу не отменили.
+// При ошибке возвращает HTTP-статус для ответа
+func (ch *ChatHandler) verifyMeeting(r *http.Request, token string) (auth.MeetingClaims, int, error) {
+    if ch.Signer == nil {
+        return auth.MeetingClaims{}, http.StatusNotFound, errors.New("meeting links are disabled")
+    }
+    claims, err := ch.Signer.VerifyMeetingToken(token)
+    if errors.Is(err, auth.ErrExpiredToken) {
+        return claims, http.StatusGone, errors.New("meeting is over")
+    }
+    if err != nil {
+        return claims, http.StatusForbidden, errors.New("invalid meeting link")
+    }
+    if ch.Store != nil {
+        _, err := ch.Store.GetMeeting(r.Context(), claims.MeetingID)
+        if errors.Is(err, storage.ErrNotFound) {
+            return claims, http.StatusGone, errors.New("meeting was cancelled")
+        }
+        if err != nil {
+            chatLogger.Error("Failed to load meeting", "meeting_id", claims.MeetingID, "error", err)
+            return claims, http.StatusInternalServerError, errors.New("internal error")
+        }
+    }
+    return claims, 0, nil
 }
 
 // ServeWS обрабатывает WebSocket подключения
@@ -25,13 +192,33 @@ func (ch *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
     // Получаем параметры из URL
     username := r.URL.Query().Get("username")
     roomID := r.URL.Query().Get("room")
+
+    // Ссылка на встречу задает комнату, персональная - еще и имя приглашенного.
+    // Имя она не подтверждает: организатор получает ссылки всех приглашенных
+    if token := r.URL.Query().Get("meeting"); token != "" {
+        claims, status, err := ch.verifyMeeting(r, token)
+        if err != nil {
+            chatLogger.Warn("Meeting link rejected", "remote", r.RemoteAddr, "error", err)
+            writeError(w, status, err.Error())
+            return
+        }
+        roomID = claims.RoomID
+        if claims.Username != "" {
+            username = claims.Username
+        }
+    }
     
     if username == "" {
-        username = "Аноним"
+        username = anonymousName
     }
     if roomID == "" {
         roomID = "general"
     }
+    // Этим именем подписаны кадры SFU
+    if username == sfu.PeerName {
+        writeError(w, http.StatusBadRequest, "username is reserved")
+        return
+    }
     
     chatLogger.Info("WebSocket connection attempt", 
         "username", username, 
@@ -41,23 +228,7 @@ func (ch *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 
     // Превращаем HTTP запрос в WebSocket соединение
     upgrader := &websocket.Upgrader{
-        CheckOrigin: func(r *http.Request) bool {
-            origin := r.Header.Get("Origin")
-            // Для разработки разрешаем localhost
-            allowedOrigins := []string{
-                "https://localhost:8443",
-                "https://thoth-webrtc.duckdns.org:8443",
-                "https://127.0.0.1:8443",
-            }
-            
-            for _, allowed := range allowedOrigins {
-                if origin == allowed {
-                    return true
-                }
-            }
-            
-            return true // Временно, для отладки
-        },
+        CheckOrigin: ch.checkUpgrade,
 
         // БУФЕРЫ ДЛЯ WebRTC
         ReadBufferSize:  4096, 
@@ -72,6 +243,8 @@ func (ch *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 
     chatLogger.Info("WebSocket connection established for the client in the room", "username", username, "room", roomID)
 
+    id := ch.identify(r, roomID, username)
+
     // Создаем нового клиента
     client := &wsHub.Client{
         Hub:      ch.Hub,
@@ -79,8 +252,48 @@ func (ch *ChatHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
         Send:     make(chan models.Message, 1024),
         Username: username,
         RoomID:   roomID,
+        Role:     id.Role,
         Store:    ch.Store,
     }
+    // Лимит пользователя - только по подтвержденному имени, иначе любой мог бы
+    // израсходовать чужой лимит, подключившись под его именем
+    if ch.Limiter != nil {
+        limitUser := ""
+        if id.Verified {
+            limitUser = username
+        }
+        client.Limits = ch.Limiter.NewConn(limitUser, ratelimit.RemoteIP(r.RemoteAddr))
+    }
+
+    // Первым кадром клиент получает токен участника комнаты.
+    // Send еще никто не читает и не закрывает, поэтому пишем напрямую
+    if ch.Signer != nil {
+        token, err := ch.Signer.IssueMemberToken(auth.MemberClaims{RoomID: roomID, Username: username, Role: id.Role, Verified: id.Verified})
+        if err != nil {
+            chatLogger.Error("Failed to issue member token", "username", username, "error", err)
+        } else {
+            session := models.Message{
+                Type:      models.MessageTypeSession,
+                Username:  username,
+                RoomID:    roomID,
+                Token:     token,
+                Timestamp: time.Now(),
+            }
+            // Владелец получает долгоживущий ключ: с ним роль вернется и через 12 часов,
+            // и в другом браузере. Так же ключ пользователя сохраняет за ним имя
+            if id.Role == storage.RoleOwner {
+                if session.OwnerKey, err = ch.Signer.IssueOwnerKey(roomID, username); err != nil {
+                    chatLogger.Error("Failed to issue owner key", "username", username, "error", err)
+                }
+            }
+            if id.Verified {
+                if session.UserKey, err = ch.Signer.IssueUserKey(username); err != nil {
+                    chatLogger.Error("Failed to issue user key", "username", username, "error", err)
+                }
+            }
+            client.Send <- session
+        }
+    }
 
     // Регистрируем клиента в Hub
     ch.Hub.Register <- client
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "Thoth/internal/auth"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+    wsHub "Thoth/internal/websocket"
+)
+
+// fakeMembers - участники комнат и занятые имена в памяти
+type fakeMembers struct {
+    mu      sync.Mutex
+    roles   map[string]string // "<комната>/<имя>" -> роль
+    claimed map[string]bool
+}
+
+func (f *fakeMembers) TouchRoomMember(ctx context.Context, roomID, username string) (storage.RoomMember, bool, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    key := roomID + "/" + username
+    if role, ok := f.roles[key]; ok {
+        return storage.RoomMember{RoomID: roomID, Username: username, Role: role}, false, nil
+    }
+    role := storage.RoleOwner
+    for k := range f.roles {
+        if strings.HasPrefix(k, roomID+"/") {
+            role = storage.RoleMember
+        }
+    }
+    f.roles[key] = role
+    return storage.RoomMember{RoomID: roomID, Username: username, Role: role}, true, nil
+}
+
+func (f *fakeMembers) ClaimUsername(ctx context.Context, username string) (bool, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.claimed[username] {
+        return false, nil
+    }
+    f.claimed[username] = true
+    return true, nil
+}
+
+func (f *fakeMembers) setRole(roomID, username, role string) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.roles[roomID+"/"+username] = role
+}
+
+// wsTestServer - ServeWS с хабом, подписью токенов и участниками в памяти
+type wsTestServer struct {
+    url     string
+    signer  *auth.Signer
+    members *fakeMembers
+}
+
+func newWSTestServer(t *testing.T) *wsTestServer {
+    t.Helper()
+    hub := wsHub.NewHub()
+    go hub.Run()
+    t.Cleanup(hub.Stop)
+
+    signer := auth.NewSigner([]byte("secret"))
+    members := &fakeMembers{roles: make(map[string]string), claimed: make(map[string]bool)}
+    ch := NewChatHandler(hub, nil, signer)
+    ch.members = members
+
+    srv := httptest.NewServer(http.HandlerFunc(ch.ServeWS))
+    t.Cleanup(srv.Close)
+    return &wsTestServer{url: "ws" + strings.TrimPrefix(srv.URL, "http"), signer: signer, members: members}
+}
+
+// session подключается с параметрами query и возвращает кадр session и данные его токена
+func (s *wsTestServer) session(t *testing.T, query url.Values) (models.Message, auth.MemberClaims) {
+    t.Helper()
+    csrf, err := s.signer.IssueUpgradeToken("")
+    if err != nil {
+        t.Fatal(err)
+    }
+    query.Set("csrf", csrf)
+    if query.Get("room") == "" {
+        query.Set("room", "general")
+    }
+
+    conn, _, err := websocket.DefaultDialer.Dial(s.url+"?"+query.Encode(), nil)
+    if err != nil {
+        t.Fatalf("Ошибка подключения: %v", err)
+    }
+    defer conn.Close()
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+    var msg models.Message
+    if err := conn.ReadJSON(&msg); err != nil || msg.Type != models.MessageTypeSession {
+        t.Fatalf("Ожидался кадр session: %+v, %v", msg, err)
+    }
+    claims, err := s.signer.VerifyMemberToken(msg.Token)
+    if err != nil {
+        t.Fatalf("Неверный токен участника: %v", err)
+    }
+    return msg, claims
+}
+
+func TestServeWSOwnerKeepsRoleWithKeys(t *testing.T) {
+    s := newWSTestServer(t)
+
+    first, claims := s.session(t, url.Values{"username": {"alice"}})
+    if claims.Role != storage.RoleOwner || !claims.Verified || first.OwnerKey == "" || first.UserKey == "" {
+        t.Fatalf("Создатель комнаты должен стать владельцем с ключами: %+v", claims)
+    }
+
+    // Через 12 часов токена уже нет, но ключи возвращают роль и имя
+    _, claims = s.session(t, url.Values{"username": {"alice"}, "owner_key": {first.OwnerKey}, "user_key": {first.UserKey}})
+    if claims.Role != storage.RoleOwner || !claims.Verified {
+        t.Errorf("Владелец с ключами: %+v", claims)
+    }
+    // Токен, выданный владельцу, тоже годится
+    _, claims = s.session(t, url.Values{"username": {"alice"}, "token": {first.Token}})
+    if claims.Role != storage.RoleOwner || !claims.Verified {
+        t.Errorf("Владелец с токеном: %+v", claims)
+    }
+}
+
+func TestServeWSNameSquatting(t *testing.T) {
+    s := newWSTestServer(t)
+    s.session(t, url.Values{"username": {"alice"}})
+
+    // Кто-то набирает имя владельца без ключей
+    squat, claims := s.session(t, url.Values{"username": {"alice"}})
+    if claims.Role != storage.RoleMember || claims.Verified || squat.OwnerKey != "" || squat.UserKey != "" {
+        t.Fatalf("Чужое имя без ключей дало права: %+v", claims)
+    }
+
+    // Повтор его собственного токена тоже ничего не дает
+    replay, claims := s.session(t, url.Values{"username": {"alice"}, "token": {squat.Token}})
+    if claims.Role != storage.RoleMember || claims.Verified || replay.OwnerKey != "" || replay.UserKey != "" {
+        t.Errorf("Повтор токена без подтверждения дал права: %+v", claims)
+    }
+
+    // Ключ владельца другой комнаты не подходит
+    other, _ := s.signer.IssueOwnerKey("other", "alice")
+    if _, claims := s.session(t, url.Values{"username": {"alice"}, "owner_key": {other}}); claims.Role != storage.RoleMember {
+        t.Errorf("Ключ владельца другой комнаты дал роль %q", claims.Role)
+    }
+}
+
+func TestServeWSRevokedRole(t *testing.T) {
+    s := newWSTestServer(t)
+    first, _ := s.session(t, url.Values{"username": {"alice"}})
+
+    s.members.setRole("general", "alice", storage.RoleMember)
+
+    for name, query := range map[string]url.Values{
+        "токен":         {"username": {"alice"}, "token": {first.Token}},
+        "ключ владельца": {"username": {"alice"}, "owner_key": {first.OwnerKey}},
+    } {
+        msg, claims := s.session(t, query)
+        if claims.Role != storage.RoleMember || msg.OwnerKey != "" {
+            t.Errorf("%s: снятая роль вернулась: %+v", name, claims)
+        }
+    }
+}
+
+func TestServeWSClaimsFreeName(t *testing.T) {
+    s := newWSTestServer(t)
+    s.session(t, url.Values{"username": {"alice"}})
+
+    bob, claims := s.session(t, url.Values{"username": {"bob"}})
+    if claims.Role != storage.RoleMember || !claims.Verified || bob.UserKey == "" {
+        t.Errorf("Свободное имя должно закрепиться за первым: %+v", claims)
+    }
+
+    // Аноним имени не занимает
+    if _, claims := s.session(t, url.Values{}); claims.Verified {
+        t.Errorf("Аноним получил подтвержденное имя: %+v", claims)
+    }
+}
+
+func TestServeWSMeetingLinkIsNotIdentity(t *testing.T) {
+    s := newWSTestServer(t)
+    s.session(t, url.Values{"username": {"alice"}})
+
+    // Любой участник может пригласить владельца и получить его персональную ссылку
+    link, err := s.signer.IssueMeetingToken(auth.MeetingClaims{MeetingID: "m1", RoomID: "general", Username: "alice"}, time.Now().Add(time.Hour))
+    if err != nil {
+        t.Fatal(err)
+    }
+    msg, claims := s.session(t, url.Values{"meeting": {link}})
+    if msg.Username != "alice" {
+        t.Fatalf("Ссылка должна задать имя приглашенного, получено %q", msg.Username)
+    }
+    if claims.Role != storage.RoleMember || claims.Verified || msg.OwnerKey != "" || msg.UserKey != "" {
+        t.Errorf("Персональная ссылка дала права владельца: %+v", claims)
+    }
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+    "net/http"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/ice"
+)
+
+// ICEHandler отдает участникам чата ICE-серверы с временными учетными данными TURN
+type ICEHandler struct {
+    Signer *auth.Signer
+    Config *ice.Config
+}
+
+func NewICEHandler(signer *auth.Signer, config *ice.Config) *ICEHandler {
+    return &ICEHandler{Signer: signer, Config: config}
+}
+
+// Servers обрабатывает GET /api/ice-servers (по токену участника).
+// Учетные данные TURN привязаны к пользователю, поэтому ответ не кешируется
+func (ih *ICEHandler) Servers(w http.ResponseWriter, r *http.Request) {
+    claims, err := ih.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+
+    servers, expires := ih.Config.Servers(claims.Username)
+    if servers == nil {
+        servers = []ice.Server{}
+    }
+    w.Header().Set("Cache-Control", "no-store")
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "ice_servers": servers,
+        "expires_at":  expires,
+    })
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/meetings"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+const maxMeetingBody = 16 << 10
+
+// MeetingHandler планирует встречи в комнате и выдает ссылки на них и файлы .ics
+type MeetingHandler struct {
+    Store  *storage.Storage
+    Signer *auth.Signer
+    Links  meetings.Links
+    Alarm  time.Duration // Напоминание календаря в .ics; 0 - без напоминания
+}
+
+func NewMeetingHandler(store *storage.Storage, signer *auth.Signer, publicURL string) *MeetingHandler {
+    return &MeetingHandler{
+        Store:  store,
+        Signer: signer,
+        Links:  meetings.Links{PublicURL: publicURL, Signer: signer},
+        Alarm:  10 * time.Minute,
+    }
+}
+
+// meetingBody - встреча со ссылками. InviteLinks - персональные ссылки приглашенных:
+// организатор получает все, приглашенный - свою
+type meetingBody struct {
+    models.Meeting
+    JoinURL     string            `json:"join_url"`
+    ICSURL      string            `json:"ics_url"`
+    InviteLinks map[string]string `json:"invite_links,omitempty"`
+}
+
+// Create обрабатывает POST /api/rooms/{room}/meetings
+// {"title": "...", "starts_at": "<RFC 3339>", "duration_minutes": 30, "invitees": ["bob"]}
+func (mh *MeetingHandler) Create(w http.ResponseWriter, r *http.Request) {
+    roomID := r.PathValue("room")
+    claims, err := mh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != roomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    var req struct {
+        Title           string    `json:"title"`
+        StartsAt        time.Time `json:"starts_at"`
+        DurationMinutes int64     `json:"duration_minutes"`
+        Invitees        []string  `json:"invitees"`
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMeetingBody)).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON body")
+        return
+    }
+    if req.DurationMinutes == 0 {
+        req.DurationMinutes = 60
+    }
+
+    m := models.Meeting{
+        ID:        meetings.NewID(),
+        RoomID:    roomID,
+        Title:     req.Title,
+        Organizer: claims.Username,
+        StartsAt:  req.StartsAt.UTC(),
+        Duration:  req.DurationMinutes * 60,
+        Invitees:  req.Invitees,
+    }
+    if err := models.ValidateMeeting(&m, time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    m, err = mh.Store.CreateMeeting(r.Context(), m)
+    if err != nil {
+        chatLogger.Error("Failed to create meeting", "room", roomID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    chatLogger.Info("Meeting scheduled", "meeting_id", m.ID, "room", roomID, "organizer", m.Organizer, "starts_at", m.StartsAt)
+
+    body, err := mh.body(m, claims.Username)
+    if err != nil {
+        chatLogger.Error("Failed to issue meeting links", "meeting_id", m.ID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    writeJSON(w, http.StatusCreated, body)
+}
+
+// List обрабатывает GET /api/rooms/{room}/meetings?limit=... - предстоящие и идущие встречи
+func (mh *MeetingHandler) List(w http.ResponseWriter, r *http.Request) {
+    roomID := r.PathValue("room")
+    claims, err := mh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != roomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    limit, err := parseOptionalInt(r.URL.Query().Get("limit"))
+    if err != nil || limit < 0 || limit > 100 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+        return
+    }
+    if limit == 0 {
+        limit = 20
+    }
+
+    list, err := mh.Store.ListMeetings(r.Context(), roomID, time.Now(), limit)
+    if err != nil {
+        chatLogger.Error("Failed to list meetings", "room", roomID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    resp := make([]meetingBody, 0, len(list))
+    for _, m := range list {
+        body, err := mh.body(m, claims.Username)
+        if err != nil {
+            chatLogger.Error("Failed to issue meeting links", "meeting_id", m.ID, "error", err)
+            writeError(w, http.StatusInternalServerError, "internal error")
+            return
+        }
+        resp = append(resp, body)
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"meetings": resp})
+}
+
+// Delete обрабатывает DELETE /api/meetings/{id}. Отменить встречу может только организатор
+func (mh *MeetingHandler) Delete(w http.ResponseWriter, r *http.Request) {
+    m, ok := mh.load(w, r)
+    if !ok {
+        return
+    }
+    claims, err := mh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != m.RoomID || claims.Username != m.Organizer {
+        writeError(w, http.StatusForbidden, "only the organizer can cancel the meeting")
+        return
+    }
+    if err := mh.Store.DeleteMeeting(r.Context(), m.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+        chatLogger.Error("Failed to delete meeting", "meeting_id", m.ID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    chatLogger.Info("Meeting cancelled", "meeting_id", m.ID, "room", m.RoomID)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// ICS обрабатывает GET /api/meetings/{id}/ics?token=... - событие для календаря.
+// Подходит токен ссылки на эту встречу или токен участника ее комнаты. В событие попадает
+// персональная ссылка, если по ней и пришли, иначе общая
+func (mh *MeetingHandler) ICS(w http.ResponseWriter, r *http.Request) {
+    m, ok := mh.load(w, r)
+    if !ok {
+        return
+    }
+    username := ""
+    token := memberToken(r)
+    if claims, err := mh.Signer.VerifyMeetingToken(token); err == nil && claims.MeetingID == m.ID {
+        username = claims.Username
+    } else if claims, err := mh.Signer.VerifyMemberToken(token); err != nil || claims.RoomID != m.RoomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    link, err := mh.Links.JoinURL(m, username)
+    if err != nil {
+        chatLogger.Error("Failed to issue meeting link", "meeting_id", m.ID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+    w.Header().Set("Content-Disposition", `attachment; filename="meeting-`+m.ID+`.ics"`)
+    w.Header().Set("Cache-Control", "no-store")
+    w.Write(meetings.ICS(m, link, mh.Alarm))
+}
+
+// load находит встречу из пути запроса; при ошибке уже ответил клиенту
+func (mh *MeetingHandler) load(w http.ResponseWriter, r *http.Request) (models.Meeting, bool) {
+    m, err := mh.Store.GetMeeting(r.Context(), r.PathValue("id"))
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "meeting not found")
+        return m, false
+    }
+    if err != nil {
+        chatLogger.Error("Failed to load meeting", "meeting_id", r.PathValue("id"), "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return m, false
+    }
+    return m, true
+}
+
+func (mh *MeetingHandler) body(m models.Meeting, viewer string) (meetingBody, error) {
+    body := meetingBody{Meeting: m}
+    var err error
+    if body.JoinURL, err = mh.Links.JoinURL(m, ""); err != nil {
+        return body, err
+    }
+    if body.ICSURL, err = mh.Links.ICSURL(m); err != nil {
+        return body, err
+    }
+
+    var invitees []string
+    switch {
+    case viewer == m.Organizer:
+        invitees = append([]string{m.Organizer}, m.Invitees...)
+    case m.Invited(viewer):
+        invitees = []string{viewer}
+    }
+    for _, username := range invitees {
+        link, err := mh.Links.JoinURL(m, username)
+        if err != nil {
+            return body, err
+        }
+        if body.InviteLinks == nil {
+            body.InviteLinks = make(map[string]string)
+        }
+        body.InviteLinks[username] = link
+    }
+    return body, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "strconv"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var mentionLogger = slog.With("component", "mentions")
+
+// MentionHandler отдает пользователю упоминания его во всех комнатах.
+// Пользователь определяется по токену участника, выданному при подключении к чату
+type MentionHandler struct {
+    Store  *storage.Storage
+    Signer *auth.Signer
+}
+
+func NewMentionHandler(store *storage.Storage, signer *auth.Signer) *MentionHandler {
+    return &MentionHandler{Store: store, Signer: signer}
+}
+
+// List обрабатывает GET /api/mentions?unread=true&before=<id>&limit=...
+func (mh *MentionHandler) List(w http.ResponseWriter, r *http.Request) {
+    claims, err := mh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+
+    params := r.URL.Query()
+    unreadOnly := params.Get("unread") == "true" || params.Get("unread") == "1"
+    limit, err := parseOptionalInt(params.Get("limit"))
+    if err != nil || limit < 0 || limit > 100 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+        return
+    }
+    if limit == 0 {
+        limit = 50
+    }
+    var before int64
+    if v := params.Get("before"); v != "" {
+        if before, err = strconv.ParseInt(v, 10, 64); err != nil || before < 0 {
+            writeError(w, http.StatusBadRequest, "invalid before")
+            return
+        }
+    }
+
+    mentions, err := mh.Store.ListMentions(r.Context(), claims.Username, unreadOnly, before, limit)
+    if err != nil {
+        mentionLogger.Error("Failed to list mentions", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]models.Mention, 0, len(mentions))
+    for _, m := range mentions {
+        resp = append(resp, m.Model())
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"mentions": resp})
+}
+
+type markMentionsReadRequest struct {
+    UpTo int64 `json:"up_to"` // 0 - отметить все
+}
+
+// MarkRead обрабатывает POST /api/mentions/read {"up_to": <id>}
+func (mh *MentionHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+    claims, err := mh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+
+    var req markMentionsReadRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil || req.UpTo < 0 {
+        writeError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+
+    n, err := mh.Store.MarkMentionsRead(r.Context(), claims.Username, req.UpTo)
+    if err != nil {
+        mentionLogger.Error("Failed to mark mentions read", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]int64{"marked": n})
+}
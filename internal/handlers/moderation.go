@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "Thoth/internal/moderation"
+    "Thoth/internal/storage"
+)
+
+// ModerationHandler показывает модераторам журнал фильтров сообщений (административный API)
+type ModerationHandler struct {
+    Store *storage.Storage
+}
+
+func NewModerationHandler(store *storage.Storage) *ModerationHandler {
+    return &ModerationHandler{Store: store}
+}
+
+type moderationEventBody struct {
+    ID        int64     `json:"id"`
+    RoomID    string    `json:"room_id"`
+    Username  string    `json:"username"`
+    Filter    string    `json:"filter"`
+    Action    string    `json:"action"`
+    Reason    string    `json:"reason,omitempty"`
+    Content   string    `json:"content"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// List обрабатывает GET /api/moderation/events?room=&username=&action=&before=<id>&limit=...
+func (mh *ModerationHandler) List(w http.ResponseWriter, r *http.Request) {
+    params := r.URL.Query()
+    query := storage.ModerationQuery{
+        RoomID:   params.Get("room"),
+        Username: params.Get("username"),
+        Action:   params.Get("action"),
+    }
+    switch query.Action {
+    case "", moderation.ActionRedact, moderation.ActionReject, moderation.ActionShadowMute:
+    default:
+        writeError(w, http.StatusBadRequest, "unknown action")
+        return
+    }
+
+    limit, err := parseOptionalInt(params.Get("limit"))
+    if err != nil || limit < 0 || limit > 200 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 200")
+        return
+    }
+    if limit == 0 {
+        limit = 50
+    }
+    query.Limit = limit
+    if v := params.Get("before"); v != "" {
+        if query.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil || query.BeforeID < 0 {
+            writeError(w, http.StatusBadRequest, "invalid before")
+            return
+        }
+    }
+
+    events, err := mh.Store.ListModerationEvents(r.Context(), query)
+    if err != nil {
+        chatLogger.Error("Failed to list moderation events", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]moderationEventBody, 0, len(events))
+    for _, e := range events {
+        resp = append(resp, moderationEventBody{
+            ID: e.ID, RoomID: e.RoomID, Username: e.Username, Filter: e.Filter,
+            Action: e.Action, Reason: e.Reason, Content: e.Content, CreatedAt: e.CreatedAt,
+        })
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"events": resp})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "html/template"
+    "log/slog"
+    "net/http"
+    "net/mail"
+    "net/url"
+    "strings"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/notify"
+    "Thoth/internal/storage"
+)
+
+var notificationLogger = slog.With("component", "notifications")
+
+// MaxDigestDelay - наибольшая задержка письма, которую может выбрать пользователь
+const MaxDigestDelay = 24 * time.Hour
+
+// ConfirmationCooldown - как часто можно повторно отправить письмо с подтверждением адреса
+const ConfirmationCooldown = 10 * time.Minute
+
+// NotificationHandler управляет email-уведомлениями: настройки пользователя, подтверждение адреса
+// и отписка по ссылке из письма
+type NotificationHandler struct {
+    Store     *storage.Storage
+    Signer    *auth.Signer
+    Mailer    notify.Mailer // nil - письма выключены, адрес задать нельзя
+    PublicURL string        // Адрес чата для ссылки подтверждения
+}
+
+func NewNotificationHandler(store *storage.Storage, signer *auth.Signer) *NotificationHandler {
+    return &NotificationHandler{Store: store, Signer: signer}
+}
+
+type notificationPreferencesBody struct {
+    Email          string `json:"email"`
+    EmailEnabled   bool   `json:"email_enabled"`
+    EmailConfirmed bool   `json:"email_confirmed"`         // Только в ответе: адрес подтвержден по ссылке
+    DelayMinutes   int    `json:"delay_minutes,omitempty"` // 0 - задержка сервера по умолчанию
+}
+
+// verifiedMember возвращает данные токена участника. Настройки привязаны к имени,
+// поэтому доступны только сессии, подтвердившей имя ключом пользователя
+func (nh *NotificationHandler) verifiedMember(w http.ResponseWriter, r *http.Request) (auth.MemberClaims, bool) {
+    claims, err := nh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return claims, false
+    }
+    if !claims.Verified {
+        writeError(w, http.StatusForbidden, "verified username required")
+        return claims, false
+    }
+    return claims, true
+}
+
+// GetPreferences обрабатывает GET /api/notifications/preferences
+func (nh *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+    claims, ok := nh.verifiedMember(w, r)
+    if !ok {
+        return
+    }
+
+    p, err := nh.Store.GetNotificationPreferences(r.Context(), claims.Username)
+    if errors.Is(err, storage.ErrNotFound) {
+        writeJSON(w, http.StatusOK, notificationPreferencesBody{})
+        return
+    }
+    if err != nil {
+        notificationLogger.Error("Failed to load preferences", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    writeJSON(w, http.StatusOK, notificationPreferencesBody{
+        Email:          p.Email,
+        EmailEnabled:   p.EmailEnabled,
+        EmailConfirmed: p.EmailConfirmed,
+        DelayMinutes:   int(p.Delay / time.Minute),
+    })
+}
+
+// PutPreferences обрабатывает PUT /api/notifications/preferences.
+// На новый адрес уходит письмо со ссылкой подтверждения; до перехода по ней писем с упоминаниями нет
+func (nh *NotificationHandler) PutPreferences(w http.ResponseWriter, r *http.Request) {
+    claims, ok := nh.verifiedMember(w, r)
+    if !ok {
+        return
+    }
+
+    var body notificationPreferencesBody
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+    if body.Email != "" {
+        addr, err := mail.ParseAddress(body.Email)
+        if err != nil || addr.Address != body.Email {
+            writeError(w, http.StatusBadRequest, "invalid email address")
+            return
+        }
+    }
+    if body.EmailEnabled && body.Email == "" {
+        writeError(w, http.StatusBadRequest, "email is required to enable notifications")
+        return
+    }
+    if body.Email != "" && nh.Mailer == nil {
+        writeError(w, http.StatusServiceUnavailable, "email notifications are disabled on this server")
+        return
+    }
+    delay := time.Duration(body.DelayMinutes) * time.Minute
+    if delay < 0 || delay > MaxDigestDelay {
+        writeError(w, http.StatusBadRequest, "delay_minutes must be between 0 and 1440")
+        return
+    }
+
+    p, err := nh.Store.SaveNotificationPreferences(r.Context(), storage.NotificationPreferences{
+        Username:     claims.Username,
+        Email:        body.Email,
+        EmailEnabled: body.EmailEnabled,
+        Delay:        delay,
+    })
+    if err != nil {
+        notificationLogger.Error("Failed to save preferences", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    notificationLogger.Info("Notification preferences updated", "username", claims.Username, "email_enabled", p.EmailEnabled)
+
+    if p.Email != "" && !p.EmailConfirmed {
+        nh.sendConfirmation(r.Context(), p)
+    }
+    body.EmailConfirmed = p.EmailConfirmed
+    writeJSON(w, http.StatusOK, body)
+}
+
+// sendConfirmation отправляет ссылку подтверждения адреса не чаще ConfirmationCooldown.
+// Ошибки только логируются: настройки уже сохранены, письмо уйдет при следующем сохранении
+func (nh *NotificationHandler) sendConfirmation(ctx context.Context, p storage.NotificationPreferences) {
+    reserved, err := nh.Store.ReserveEmailConfirmation(ctx, p.Username, ConfirmationCooldown)
+    if err != nil || !reserved {
+        if err != nil {
+            notificationLogger.Error("Failed to reserve email confirmation", "username", p.Username, "error", err)
+        }
+        return
+    }
+
+    token, err := nh.Signer.IssueEmailConfirmToken(p.Username, p.Email)
+    if err != nil {
+        notificationLogger.Error("Failed to issue email confirmation token", "username", p.Username, "error", err)
+        return
+    }
+    confirmURL := strings.TrimRight(nh.PublicURL, "/") + "/notifications/confirm?token=" + url.QueryEscape(token)
+
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+    err = nh.Mailer.Send(ctx, notify.Email{
+        To:      p.Email,
+        Subject: "Thoth: подтвердите адрес для уведомлений",
+        Body: fmt.Sprintf("Пользователь %s указал этот адрес для писем с упоминаниями в Thoth.\n\n"+
+            "Чтобы получать их, перейдите по ссылке:\n%s\n\n"+
+            "Если это были не вы, просто проигнорируйте письмо.\n", p.Username, confirmURL),
+    })
+    if err != nil {
+        notificationLogger.Error("Failed to send email confirmation", "username", p.Username, "error", err)
+        return
+    }
+    notificationLogger.Info("Email confirmation sent", "username", p.Username)
+}
+
+var confirmEmailPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Thoth - подтверждение адреса</title></head>
+<body>
+{{if .Done}}<p>Адрес {{.Email}} подтвержден: письма с упоминаниями для {{.Username}} будут приходить на него.</p>
+{{else}}<form method="post">
+<p>Получать письма с упоминаниями для {{.Username}} на {{.Email}}?</p>
+<button type="submit">Подтвердить</button>
+</form>{{end}}
+</body>
+</html>`))
+
+// ConfirmEmail обрабатывает ссылку из письма /notifications/confirm?token=...
+// Как и отписка, GET только показывает форму, адрес подтверждает POST
+func (nh *NotificationHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+    claims, err := nh.Signer.VerifyEmailConfirmToken(r.URL.Query().Get("token"))
+    if err != nil {
+        http.Error(w, "invalid or expired confirmation link", http.StatusBadRequest)
+        return
+    }
+
+    done := false
+    if r.Method == http.MethodPost {
+        err := nh.Store.ConfirmEmail(r.Context(), claims.Username, claims.Email)
+        if errors.Is(err, storage.ErrNotFound) {
+            http.Error(w, "the address has been changed since this link was sent", http.StatusConflict)
+            return
+        }
+        if err != nil {
+            notificationLogger.Error("Failed to confirm email", "username", claims.Username, "error", err)
+            http.Error(w, "internal error", http.StatusInternalServerError)
+            return
+        }
+        notificationLogger.Info("Email address confirmed", "username", claims.Username)
+        done = true
+    }
+
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    if err := confirmEmailPage.Execute(w, struct {
+        Username string
+        Email    string
+        Done     bool
+    }{claims.Username, claims.Email, done}); err != nil {
+        notificationLogger.Error("Failed to render confirmation page", "error", err)
+    }
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Thoth - отписка</title></head>
+<body>
+{{if .Done}}<p>Письма с уведомлениями для {{.Username}} отключены.</p>
+{{else}}<form method="post">
+<p>Отключить письма с уведомлениями для {{.Username}}?</p>
+<button type="submit">Отписаться</button>
+</form>{{end}}
+</body>
+</html>`))
+
+// Unsubscribe обрабатывает ссылку из письма /unsubscribe?token=...
+// GET показывает подтверждение (ссылки в письмах открывают почтовые сканеры),
+// POST отключает письма - в том числе one-click запросом почтового клиента по RFC 8058
+func (nh *NotificationHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+    username, err := nh.Signer.VerifyUnsubscribeToken(r.URL.Query().Get("token"))
+    if err != nil {
+        http.Error(w, "invalid or expired unsubscribe link", http.StatusBadRequest)
+        return
+    }
+
+    done := false
+    if r.Method == http.MethodPost {
+        if err := nh.Store.DisableEmailNotifications(r.Context(), username); err != nil {
+            notificationLogger.Error("Failed to unsubscribe", "username", username, "error", err)
+            http.Error(w, "internal error", http.StatusInternalServerError)
+            return
+        }
+        notificationLogger.Info("User unsubscribed from email notifications", "username", username)
+        done = true
+    }
+
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    if err := unsubscribePage.Execute(w, struct {
+        Username string
+        Done     bool
+    }{username, done}); err != nil {
+        notificationLogger.Error("Failed to render unsubscribe page", "error", err)
+    }
+}
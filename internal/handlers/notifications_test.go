@@ -0,0 +1,58 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "Thoth/internal/auth"
+)
+
+func TestNotificationPreferencesRequireVerifiedName(t *testing.T) {
+    signer := auth.NewSigner([]byte("secret"))
+    nh := NewNotificationHandler(nil, signer)
+
+    // Кто угодно может зайти под именем alice, но ее настройки ему недоступны
+    token, _ := signer.IssueMemberToken(auth.MemberClaims{RoomID: "general", Username: "alice"})
+    for name, handler := range map[string]http.HandlerFunc{
+        "GET": nh.GetPreferences,
+        "PUT": nh.PutPreferences,
+    } {
+        req := httptest.NewRequest(name, "/api/notifications/preferences", strings.NewReader(`{"email":"eve@example.com","email_enabled":true}`))
+        req.Header.Set("X-Thoth-Token", token)
+        rec := httptest.NewRecorder()
+        handler(rec, req)
+        if rec.Code != http.StatusForbidden {
+            t.Errorf("%s без подтвержденного имени: код %d", name, rec.Code)
+        }
+    }
+}
+
+func TestNotificationEmailRequiresMailer(t *testing.T) {
+    signer := auth.NewSigner([]byte("secret"))
+    nh := NewNotificationHandler(nil, signer)
+
+    token, _ := signer.IssueMemberToken(auth.MemberClaims{RoomID: "general", Username: "alice", Verified: true})
+    req := httptest.NewRequest("PUT", "/api/notifications/preferences", strings.NewReader(`{"email":"alice@example.com","email_enabled":true}`))
+    req.Header.Set("X-Thoth-Token", token)
+    rec := httptest.NewRecorder()
+    nh.PutPreferences(rec, req)
+    if rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Адрес без почтового сервера: код %d", rec.Code)
+    }
+}
+
+func TestConfirmEmailRejectsForeignTokens(t *testing.T) {
+    signer := auth.NewSigner([]byte("secret"))
+    nh := NewNotificationHandler(nil, signer)
+
+    unsubscribe, _ := signer.IssueUnsubscribeToken("alice")
+    for _, method := range []string{"GET", "POST"} {
+        rec := httptest.NewRecorder()
+        nh.ConfirmEmail(rec, httptest.NewRequest(method, "/notifications/confirm?token="+unsubscribe, nil))
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("%s с токеном отписки: код %d", method, rec.Code)
+        }
+    }
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+    "fmt"
+    "net"
+    "net/url"
+    "strings"
+
+    "Thoth/internal/metrics"
+)
+
+var upgradeRejectedTotal = metrics.NewCounter("thoth_ws_upgrade_rejected_total",
+    "WebSocket upgrade requests rejected by origin or token checks", "reason")
+
+// OriginPolicy решает, страницам с каких Origin можно подключаться к /ws.
+// Страница с того же хоста, что и сервер, разрешена всегда
+type OriginPolicy struct {
+    exact     map[string]bool
+    wildcards []originPattern
+
+    // Dev разрешает localhost, 127.0.0.1 и [::1] на любом порту - для разработки
+    Dev bool
+}
+
+// originPattern - "https://*.example.com[:port]": любой поддомен, но не сам домен
+type originPattern struct {
+    scheme string
+    suffix string // ".example.com"
+    port   string
+}
+
+// ParseOriginPolicy разбирает список через запятую: точные Origin ("https://chat.example.com:8443")
+// и шаблоны поддоменов ("https://*.example.com"). Путь, логин и параметры запрещены
+func ParseOriginPolicy(spec string) (*OriginPolicy, error) {
+    p := &OriginPolicy{exact: make(map[string]bool)}
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if err := p.add(entry); err != nil {
+            return nil, err
+        }
+    }
+    return p, nil
+}
+
+func (p *OriginPolicy) add(entry string) error {
+    scheme, rest, ok := strings.Cut(strings.ToLower(entry), "://")
+    if !ok || (scheme != "http" && scheme != "https") {
+        return fmt.Errorf("origin %q: scheme must be http or https", entry)
+    }
+    if strings.HasPrefix(rest, "*.") {
+        host, port := splitPort(strings.TrimPrefix(rest, "*"))
+        if strings.ContainsAny(host, "*/?#@") || len(host) < 2 {
+            return fmt.Errorf("origin %q: invalid wildcard", entry)
+        }
+        p.wildcards = append(p.wildcards, originPattern{scheme: scheme, suffix: host, port: defaultPort(scheme, port)})
+        return nil
+    }
+    origin, ok := normalizeOrigin(entry)
+    if !ok || strings.Contains(origin, "*") {
+        return fmt.Errorf("origin %q: expected scheme://host[:port] without path", entry)
+    }
+    p.exact[origin] = true
+    return nil
+}
+
+// Allowed проверяет Origin запроса к серверу host. Пустой Origin присылают только
+// не браузеры - им подделка запроса не грозит, их проверяет токен подключения
+func (p *OriginPolicy) Allowed(origin, host string) bool {
+    if origin == "" {
+        return true
+    }
+    normalized, ok := normalizeOrigin(origin)
+    if !ok {
+        return false
+    }
+    u, _ := url.Parse(normalized)
+    if strings.EqualFold(u.Host, host) || p.exact[normalized] {
+        return true
+    }
+
+    hostname, port := u.Hostname(), defaultPort(u.Scheme, u.Port())
+    if p.Dev && isLoopback(hostname) {
+        return true
+    }
+    for _, w := range p.wildcards {
+        if u.Scheme == w.scheme && port == w.port && strings.HasSuffix(hostname, w.suffix) {
+            return true
+        }
+    }
+    return false
+}
+
+// normalizeOrigin приводит Origin к виду scheme://host[:port] в нижнем регистре,
+// без портов по умолчанию
+func normalizeOrigin(origin string) (string, bool) {
+    u, err := url.Parse(strings.ToLower(origin))
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+        u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+        return "", false
+    }
+    host := u.Hostname()
+    if strings.Contains(host, ":") {
+        host = "[" + host + "]"
+    }
+    if port := u.Port(); port != "" && port != defaultPort(u.Scheme, "") {
+        host += ":" + port
+    }
+    return u.Scheme + "://" + host, true
+}
+
+func splitPort(hostport string) (host, port string) {
+    if h, p, err := net.SplitHostPort(hostport); err == nil {
+        return h, p
+    }
+    return hostport, ""
+}
+
+func defaultPort(scheme, port string) string {
+    if port != "" {
+        return port
+    }
+    if scheme == "https" {
+        return "443"
+    }
+    return "80"
+}
+
+func isLoopback(hostname string) bool {
+    if hostname == "localhost" {
+        return true
+    }
+    ip := net.ParseIP(hostname)
+    return ip != nil && ip.IsLoopback()
+}
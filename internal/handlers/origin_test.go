@@ -0,0 +1,51 @@
+package handlers
+
+import "testing"
+
+func TestOriginPolicy(t *testing.T) {
+    p, err := ParseOriginPolicy("https://chat.example.com, https://*.thoth.dev, http://*.lan:8080")
+    if err != nil {
+        t.Fatalf("ParseOriginPolicy: %v", err)
+    }
+    const host = "thoth.internal:8443"
+    cases := map[string]bool{
+        "":                                  true, // Не браузер
+        "https://thoth.internal:8443":       true, // Тот же хост
+        "https://chat.example.com":          true,
+        "https://CHAT.example.com:443":      true,
+        "http://chat.example.com":           false,
+        "https://chat.example.com:8443":     false,
+        "https://chat.example.com.evil.com": false,
+        "https://a.thoth.dev":               true,
+        "https://a.b.thoth.dev":             true,
+        "https://thoth.dev":                 false,
+        "https://evilthoth.dev":             false,
+        "https://a.thoth.dev:8443":          false,
+        "http://printer.lan:8080":           true,
+        "http://printer.lan":                false,
+        "https://localhost:3000":            false,
+        "null":                              false,
+        "https://chat.example.com/path":     false,
+    }
+    for origin, want := range cases {
+        if got := p.Allowed(origin, host); got != want {
+            t.Errorf("Allowed(%q) = %v, ожидалось %v", origin, got, want)
+        }
+    }
+
+    p.Dev = true
+    for _, origin := range []string{"https://localhost:3000", "http://127.0.0.1:5173", "http://[::1]:8080"} {
+        if !p.Allowed(origin, host) {
+            t.Errorf("в режиме разработки %q отклонен", origin)
+        }
+    }
+    if p.Allowed("https://evil.example", host) {
+        t.Error("режим разработки разрешил чужой Origin")
+    }
+
+    for _, bad := range []string{"chat.example.com", "ftp://chat.example.com", "https://chat.example.com/app", "https://*", "https://user@chat.example.com"} {
+        if _, err := ParseOriginPolicy(bad); err == nil {
+            t.Errorf("ParseOriginPolicy(%q) без ошибки", bad)
+        }
+    }
+}
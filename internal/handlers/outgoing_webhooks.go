@@ -0,0 +1,188 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+type outgoingWebhookRequest struct {
+    URL      string   `json:"url"`
+    Events   []string `json:"events"`
+    Keywords []string `json:"keywords"`
+}
+
+type outgoingWebhookResponse struct {
+    ID        string    `json:"id"`
+    RoomID    string    `json:"room_id"`
+    URL       string    `json:"url"`
+    Events    []string  `json:"events"`
+    Keywords  []string  `json:"keywords"`
+    Active    bool      `json:"active"`
+    Secret    string    `json:"secret,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+type deliveryResponse struct {
+    ID            int64           `json:"id"`
+    Event         string          `json:"event"`
+    Status        string          `json:"status"`
+    Attempts      int             `json:"attempts"`
+    LastError     string          `json:"last_error,omitempty"`
+    NextAttemptAt time.Time       `json:"next_attempt_at"`
+    CreatedAt     time.Time       `json:"created_at"`
+    DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+    Payload       json.RawMessage `json:"payload"`
+}
+
+// CreateOutgoing создает исходящий вебхук: POST /api/rooms/{room}/outgoing-webhooks.
+// Секрет для проверки подписи возвращается только в этом ответе
+func (wh *WebhookHandler) CreateOutgoing(w http.ResponseWriter, r *http.Request) {
+    var req outgoingWebhookRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON body")
+        return
+    }
+
+    u, err := url.Parse(req.URL)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        writeError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+        return
+    }
+    if len(req.Events) == 0 {
+        writeError(w, http.StatusBadRequest, "at least one event is required")
+        return
+    }
+    for _, event := range req.Events {
+        if !models.IsEventType(event) {
+            writeError(w, http.StatusBadRequest, "unknown event: "+event)
+            return
+        }
+    }
+    keywords := make([]string, 0, len(req.Keywords))
+    for _, keyword := range req.Keywords {
+        if keyword = strings.TrimSpace(keyword); keyword != "" {
+            keywords = append(keywords, keyword)
+        }
+    }
+
+    id, err := randomToken(9)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    secret, err := randomToken(32)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    hook, err := wh.Store.CreateOutgoingWebhook(r.Context(), storage.OutgoingWebhook{
+        ID:       id,
+        RoomID:   r.PathValue("room"),
+        URL:      u.String(),
+        Secret:   secret,
+        Events:   req.Events,
+        Keywords: keywords,
+    })
+    if err != nil {
+        webhookLogger.Error("Failed to create outgoing webhook", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    webhookLogger.Info("Outgoing webhook created", "id", hook.ID, "room", hook.RoomID, "events", hook.Events)
+    resp := toOutgoingWebhookResponse(hook)
+    resp.Secret = hook.Secret
+    writeJSON(w, http.StatusCreated, resp)
+}
+
+// ListOutgoing возвращает исходящие вебхуки комнаты (без секретов)
+func (wh *WebhookHandler) ListOutgoing(w http.ResponseWriter, r *http.Request) {
+    hooks, err := wh.Store.ListOutgoingWebhooks(r.Context(), r.PathValue("room"), "")
+    if err != nil {
+        webhookLogger.Error("Failed to list outgoing webhooks", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]outgoingWebhookResponse, 0, len(hooks))
+    for _, hook := range hooks {
+        resp = append(resp, toOutgoingWebhookResponse(hook))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteOutgoing удаляет исходящий вебхук вместе с очередью и журналом доставок
+func (wh *WebhookHandler) DeleteOutgoing(w http.ResponseWriter, r *http.Request) {
+    err := wh.Store.DeleteOutgoingWebhook(r.Context(), r.PathValue("id"))
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "unknown webhook")
+        return
+    }
+    if err != nil {
+        webhookLogger.Error("Failed to delete outgoing webhook", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries возвращает журнал доставок: GET /api/outgoing-webhooks/{id}/deliveries?limit=50
+func (wh *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+    limit := 50
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > 500 {
+            writeError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+            return
+        }
+        limit = n
+    }
+
+    deliveries, err := wh.Store.ListWebhookDeliveries(r.Context(), r.PathValue("id"), limit)
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "unknown webhook")
+        return
+    }
+    if err != nil {
+        webhookLogger.Error("Failed to list webhook deliveries", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]deliveryResponse, 0, len(deliveries))
+    for _, d := range deliveries {
+        resp = append(resp, deliveryResponse{
+            ID:            d.ID,
+            Event:         d.EventType,
+            Status:        d.Status,
+            Attempts:      d.Attempts,
+            LastError:     d.LastError,
+            NextAttemptAt: d.NextAttemptAt,
+            CreatedAt:     d.CreatedAt,
+            DeliveredAt:   d.DeliveredAt,
+            Payload:       d.Payload,
+        })
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func toOutgoingWebhookResponse(hook storage.OutgoingWebhook) outgoingWebhookResponse {
+    return outgoingWebhookResponse{
+        ID:        hook.ID,
+        RoomID:    hook.RoomID,
+        URL:       hook.URL,
+        Events:    hook.Events,
+        Keywords:  hook.Keywords,
+        Active:    hook.Active,
+        CreatedAt: hook.CreatedAt,
+    }
+}
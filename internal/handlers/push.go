@@ -0,0 +1,112 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "net/http"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/storage"
+    "Thoth/internal/webpush"
+)
+
+var pushLogger = slog.With("component", "push")
+
+// PushHandler регистрирует подписки браузеров на Web Push
+type PushHandler struct {
+    Store        *storage.Storage
+    Signer       *auth.Signer
+    Keys         *webpush.VAPIDKeys
+    AllowedHosts []string // Push-сервисы, на которые разрешено отправлять уведомления
+}
+
+func NewPushHandler(store *storage.Storage, signer *auth.Signer, keys *webpush.VAPIDKeys) *PushHandler {
+    return &PushHandler{
+        Store:        store,
+        Signer:       signer,
+        Keys:         keys,
+        AllowedHosts: webpush.DefaultPushHosts,
+    }
+}
+
+// PublicKey обрабатывает GET /api/push/vapid-public-key - applicationServerKey для подписки
+func (ph *PushHandler) PublicKey(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"public_key": ph.Keys.PublicKey()})
+}
+
+// Subscribe обрабатывает POST /api/push/subscriptions с телом PushSubscription.toJSON().
+// Уведомления приходят по имени, поэтому подписаться может только сессия с подтвержденным именем
+func (ph *PushHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+    claims, err := ph.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+    if !claims.Verified {
+        writeError(w, http.StatusForbidden, "verified username required")
+        return
+    }
+
+    var sub webpush.Subscription
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&sub); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid request body")
+        return
+    }
+    if !webpush.AllowedEndpoint(sub.Endpoint, ph.AllowedHosts) {
+        pushLogger.Warn("Rejected push endpoint", "username", claims.Username, "endpoint", sub.Endpoint)
+        writeError(w, http.StatusBadRequest, "push service is not allowed")
+        return
+    }
+    if err := webpush.ValidateKeys(sub.Keys); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid subscription keys: "+err.Error())
+        return
+    }
+
+    if _, err := ph.Store.SavePushSubscription(r.Context(), storage.PushSubscription{
+        Username: claims.Username,
+        Endpoint: sub.Endpoint,
+        P256dh:   sub.Keys.P256dh,
+        Auth:     sub.Keys.Auth,
+    }); err != nil {
+        pushLogger.Error("Failed to save push subscription", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    pushLogger.Info("Push subscription registered", "username", claims.Username)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// Unsubscribe обрабатывает DELETE /api/push/subscriptions {"endpoint": "..."}
+func (ph *PushHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+    claims, err := ph.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+    if !claims.Verified {
+        writeError(w, http.StatusForbidden, "verified username required")
+        return
+    }
+
+    var body struct {
+        Endpoint string `json:"endpoint"`
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&body); err != nil || body.Endpoint == "" {
+        writeError(w, http.StatusBadRequest, "endpoint is required")
+        return
+    }
+
+    err = ph.Store.DeletePushSubscription(r.Context(), claims.Username, body.Endpoint)
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "subscription not found")
+        return
+    }
+    if err != nil {
+        pushLogger.Error("Failed to delete push subscription", "username", claims.Username, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "Thoth/internal/auth"
+)
+
+func TestPushSubscriptionsRequireVerifiedName(t *testing.T) {
+    signer := auth.NewSigner([]byte("secret"))
+    ph := NewPushHandler(nil, signer, nil)
+
+    // Без подтвержденного имени чужие упоминания и звонки ушли бы в браузер самозванца
+    token, _ := signer.IssueMemberToken(auth.MemberClaims{RoomID: "general", Username: "alice"})
+    for method, handler := range map[string]http.HandlerFunc{
+        "POST":   ph.Subscribe,
+        "DELETE": ph.Unsubscribe,
+    } {
+        req := httptest.NewRequest(method, "/api/push/subscriptions", strings.NewReader(`{"endpoint":"https://fcm.googleapis.com/fcm/send/x"}`))
+        req.Header.Set("X-Thoth-Token", token)
+        rec := httptest.NewRecorder()
+        handler(rec, req)
+        if rec.Code != http.StatusForbidden {
+            t.Errorf("%s без подтвержденного имени: код %d", method, rec.Code)
+        }
+    }
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/models"
+    "Thoth/internal/recording"
+    "Thoth/internal/storage"
+)
+
+// RecordingHandler отдает участникам комнаты записи звонков. Сами файлы скачиваются
+// как вложения: GET /api/attachments/{id}
+type RecordingHandler struct {
+    Store    *storage.Storage
+    Signer   *auth.Signer
+    Recorder *recording.Recorder // nil - запись выключена, отдаются только прошлые записи
+}
+
+func NewRecordingHandler(store *storage.Storage, signer *auth.Signer, recorder *recording.Recorder) *RecordingHandler {
+    return &RecordingHandler{Store: store, Signer: signer, Recorder: recorder}
+}
+
+// List обрабатывает GET /api/rooms/{room}/recordings?before=<RFC 3339>&limit=...
+func (rh *RecordingHandler) List(w http.ResponseWriter, r *http.Request) {
+    roomID := r.PathValue("room")
+    claims, err := rh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil || claims.RoomID != roomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    params := r.URL.Query()
+    limit, err := parseOptionalInt(params.Get("limit"))
+    if err != nil || limit < 0 || limit > 100 {
+        writeError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+        return
+    }
+    if limit == 0 {
+        limit = 20
+    }
+    var before time.Time
+    if v := params.Get("before"); v != "" {
+        if before, err = time.Parse(time.RFC3339, v); err != nil {
+            writeError(w, http.StatusBadRequest, "before must be an RFC 3339 timestamp")
+            return
+        }
+    }
+
+    recordings, err := rh.Store.ListRecordings(r.Context(), roomID, before, limit)
+    if err != nil {
+        chatLogger.Error("Failed to list recordings", "room", roomID, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    if recordings == nil {
+        recordings = []models.Recording{}
+    }
+
+    resp := map[string]interface{}{"recordings": recordings}
+    if rh.Recorder != nil {
+        if active, ok := rh.Recorder.Active(roomID); ok {
+            resp["active"] = active
+        }
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "net/http"
+    "strings"
+)
+
+// writeJSON отдает ответ в JSON с указанным статусом
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        chatLogger.Error("Failed to encode JSON response", "error", err)
+    }
+}
+
+// writeError отдает ошибку в виде {"error": "..."}
+func writeError(w http.ResponseWriter, status int, message string) {
+    writeJSON(w, status, map[string]string{"error": message})
+}
+
+// RequireAdmin пропускает только запросы с заголовком "Authorization: Bearer <token>".
+// Пустой token означает, что административный API выключен
+func RequireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if token == "" {
+            writeError(w, http.StatusForbidden, "admin API is disabled")
+            return
+        }
+        got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+            chatLogger.Warn("Unauthorized admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+            writeError(w, http.StatusUnauthorized, "unauthorized")
+            return
+        }
+        next(w, r)
+    }
+}
+
+// memberToken достает токен участника из заголовка X-Thoth-Token или параметра token.
+// Параметр нужен для ссылок, которые браузер открывает сам (картинки, скачивание)
+func memberToken(r *http.Request) string {
+    if token := r.Header.Get("X-Thoth-Token"); token != "" {
+        return token
+    }
+    return r.URL.Query().Get("token")
+}
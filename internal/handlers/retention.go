@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "time"
+
+    "Thoth/internal/storage"
+)
+
+// RetentionHandler управляет политиками хранения сообщений (административный API)
+type RetentionHandler struct {
+    Store *storage.Storage
+}
+
+func NewRetentionHandler(store *storage.Storage) *RetentionHandler {
+    return &RetentionHandler{Store: store}
+}
+
+type retentionPolicyBody struct {
+    RoomID   string    `json:"room_id"`
+    MaxAge   string    `json:"max_age,omitempty"` // Длительность в формате Go: "720h"
+    MaxCount int       `json:"max_count"`
+    Archive  bool      `json:"archive"`
+    Updated  time.Time `json:"updated_at,omitempty"`
+}
+
+// List возвращает все политики, включая глобальную с room_id "*"
+func (rh *RetentionHandler) List(w http.ResponseWriter, r *http.Request) {
+    policies, err := rh.Store.ListRetentionPolicies(r.Context())
+    if err != nil {
+        chatLogger.Error("Failed to list retention policies", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]retentionPolicyBody, 0, len(policies))
+    for _, p := range policies {
+        resp = append(resp, toRetentionPolicyBody(p))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// Put создает или заменяет политику: PUT /api/retention-policies/{room}.
+// Для глобальной политики room = "*"
+func (rh *RetentionHandler) Put(w http.ResponseWriter, r *http.Request) {
+    var body retentionPolicyBody
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON body")
+        return
+    }
+
+    policy := storage.RetentionPolicy{
+        RoomID:   r.PathValue("room"),
+        MaxCount: body.MaxCount,
+        Archive:  body.Archive,
+    }
+    if body.MaxAge != "" {
+        maxAge, err := time.ParseDuration(body.MaxAge)
+        if err != nil || maxAge < time.Minute {
+            writeError(w, http.StatusBadRequest, "max_age must be a duration of at least 1m")
+            return
+        }
+        policy.MaxAge = maxAge
+    }
+    if policy.MaxCount < 0 {
+        writeError(w, http.StatusBadRequest, "max_count cannot be negative")
+        return
+    }
+    if policy.MaxAge == 0 && policy.MaxCount == 0 {
+        writeError(w, http.StatusBadRequest, "max_age or max_count is required")
+        return
+    }
+
+    saved, err := rh.Store.UpsertRetentionPolicy(r.Context(), policy)
+    if err != nil {
+        chatLogger.Error("Failed to save retention policy", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    chatLogger.Info("Retention policy updated", "room", saved.RoomID, "max_age", saved.MaxAge, "max_count", saved.MaxCount, "archive", saved.Archive)
+    writeJSON(w, http.StatusOK, toRetentionPolicyBody(saved))
+}
+
+// Delete удаляет политику комнаты; после этого для нее действует глобальная
+func (rh *RetentionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+    err := rh.Store.DeleteRetentionPolicy(r.Context(), r.PathValue("room"))
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "policy not found")
+        return
+    }
+    if err != nil {
+        chatLogger.Error("Failed to delete retention policy", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func toRetentionPolicyBody(p storage.RetentionPolicy) retentionPolicyBody {
+    body := retentionPolicyBody{
+        RoomID:   p.RoomID,
+        MaxCount: p.MaxCount,
+        Archive:  p.Archive,
+        Updated:  p.UpdatedAt,
+    }
+    if p.MaxAge > 0 {
+        body.MaxAge = p.MaxAge.String()
+    }
+    return body
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/storage"
+)
+
+// SearchHandler обслуживает поиск по истории сообщений. Искать можно только
+// в комнате, на которую выдан токен участника
+type SearchHandler struct {
+    Store  *storage.Storage
+    Signer *auth.Signer
+}
+
+func NewSearchHandler(store *storage.Storage, signer *auth.Signer) *SearchHandler {
+    return &SearchHandler{Store: store, Signer: signer}
+}
+
+type searchResultResponse struct {
+    MessageID   int       `json:"message_id"`
+    Username    string    `json:"username"`
+    RoomID      string    `json:"room_id"`
+    Content     string    `json:"content"`
+    SnippetHTML string    `json:"snippet_html"`
+    CreatedAt   time.Time `json:"created_at"`
+    Rank        float32   `json:"rank"`
+}
+
+// Search обрабатывает GET /api/search?q=...&room=...&user=...&from=...&to=...&limit=...&offset=...
+// Даты принимаются в RFC 3339 или в виде YYYY-MM-DD. Без room поиск идет по комнате из токена
+func (sh *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+    params := r.URL.Query()
+
+    claims, err := sh.Signer.VerifyMemberToken(memberToken(r))
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, "unauthorized")
+        return
+    }
+    if room := params.Get("room"); room != "" && room != claims.RoomID {
+        writeError(w, http.StatusForbidden, "not a member of this room")
+        return
+    }
+
+    query := storage.SearchQuery{
+        Query:    params.Get("q"),
+        RoomID:   claims.RoomID,
+        Username: params.Get("user"),
+    }
+
+    if query.From, err = parseSearchTime(params.Get("from")); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+        return
+    }
+    if query.To, err = parseSearchTime(params.Get("to")); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+        return
+    }
+    if query.Limit, err = parseOptionalInt(params.Get("limit")); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid limit")
+        return
+    }
+    if query.Offset, err = parseOptionalInt(params.Get("offset")); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid offset")
+        return
+    }
+
+    if err := query.Validate(); err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    results, err := sh.Store.SearchMessages(r.Context(), query)
+    if err != nil {
+        chatLogger.Error("Failed to search messages", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]searchResultResponse, 0, len(results))
+    for _, res := range results {
+        resp = append(resp, searchResultResponse{
+            MessageID:   res.ID,
+            Username:    res.Username,
+            RoomID:      res.RoomID,
+            Content:     res.Content,
+            SnippetHTML: storage.HighlightHTML(res.Snippet),
+            CreatedAt:   res.CreatedAt,
+            Rank:        res.Rank,
+        })
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"results": resp})
+}
+
+func parseSearchTime(value string) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, nil
+    }
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    return time.Parse(time.DateOnly, value)
+}
+
+func parseOptionalInt(value string) (int, error) {
+    if value == "" {
+        return 0, nil
+    }
+    return strconv.Atoi(value)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+    wsHub "Thoth/internal/websocket"
+)
+
+var webhookLogger = slog.With("component", "webhooks")
+
+// maxWebhookBody - предел размера тела входящего вебхука
+const maxWebhookBody = 64 << 10
+
+// WebhookHandler обслуживает входящие вебхуки и управление ими
+type WebhookHandler struct {
+    Hub       *wsHub.Hub
+    Store     *storage.Storage
+    PublicURL string // Внешний адрес сервера, из него строятся URL вебхуков
+}
+
+func NewWebhookHandler(hub *wsHub.Hub, store *storage.Storage, publicURL string) *WebhookHandler {
+    return &WebhookHandler{Hub: hub, Store: store, PublicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// IncomingPayload - формат тела входящего вебхука
+type IncomingPayload struct {
+    Text        string         `json:"text"`
+    Format      string         `json:"format,omitempty"` // plain или markdown
+    Username    string         `json:"username,omitempty"` // Подпись в клиенте; автор сообщения - всегда имя вебхука
+    Attachments []models.Embed `json:"attachments,omitempty"`
+}
+
+type incomingWebhookResponse struct {
+    ID        string    `json:"id"`
+    RoomID    string    `json:"room_id"`
+    Name      string    `json:"name"`
+    URL       string    `json:"url,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Deliver принимает POST /hooks/{id}/{token} и публикует сообщение в комнату вебхука
+func (wh *WebhookHandler) Deliver(w http.ResponseWriter, r *http.Request) {
+    id := r.PathValue("id")
+    token := r.PathValue("token")
+
+    hook, err := wh.Store.GetIncomingWebhook(r.Context(), id)
+    if errors.Is(err, storage.ErrNotFound) || (err == nil && !tokenMatches(token, hook.TokenHash)) {
+        webhookLogger.Warn("Rejected incoming webhook", "id", id, "remote", r.RemoteAddr)
+        writeError(w, http.StatusNotFound, "unknown webhook")
+        return
+    }
+    if err != nil {
+        webhookLogger.Error("Failed to load incoming webhook", "id", id, "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    var payload IncomingPayload
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&payload); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON payload")
+        return
+    }
+
+    // Автор - сам вебхук: иначе он мог бы писать от имени любого участника,
+    // получать за него упоминания и события
+    msg, err := wh.Hub.PostMessage(r.Context(), wh.Store, models.Message{
+        Username:    hook.Name,
+        DisplayName: strings.TrimSpace(payload.Username),
+        Content:  payload.Text,
+        Format:   payload.Format,
+        RoomID:   hook.RoomID,
+        Embeds:   payload.Attachments,
+    })
+    if errors.Is(err, wsHub.ErrInvalidMessage) {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to deliver message")
+        return
+    }
+
+    webhookLogger.Info("Incoming webhook delivered", "id", hook.ID, "room", hook.RoomID, "message_id", msg.ID)
+    writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "message_id": msg.ID})
+}
+
+// Create создает входящий вебхук для комнаты: POST /api/rooms/{room}/webhooks {"name": "..."}.
+// Токен возвращается только в этом ответе
+func (wh *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Name string `json:"name"`
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid JSON body")
+        return
+    }
+    req.Name = strings.TrimSpace(req.Name)
+    if req.Name == "" {
+        writeError(w, http.StatusBadRequest, "name is required")
+        return
+    }
+
+    id, err := randomToken(9)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    token, err := randomToken(24)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    hook, err := wh.Store.CreateIncomingWebhook(r.Context(), storage.IncomingWebhook{
+        ID:        id,
+        RoomID:    r.PathValue("room"),
+        Name:      req.Name,
+        TokenHash: hashToken(token),
+    })
+    if err != nil {
+        webhookLogger.Error("Failed to create incoming webhook", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    webhookLogger.Info("Incoming webhook created", "id", hook.ID, "room", hook.RoomID, "name", hook.Name)
+    resp := toIncomingWebhookResponse(hook)
+    resp.URL = wh.PublicURL + "/hooks/" + hook.ID + "/" + token
+    writeJSON(w, http.StatusCreated, resp)
+}
+
+// List возвращает вебхуки комнаты (без токенов)
+func (wh *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+    hooks, err := wh.Store.ListIncomingWebhooks(r.Context(), r.PathValue("room"))
+    if err != nil {
+        webhookLogger.Error("Failed to list incoming webhooks", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+
+    resp := make([]incomingWebhookResponse, 0, len(hooks))
+    for _, hook := range hooks {
+        resp = append(resp, toIncomingWebhookResponse(hook))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// Delete удаляет входящий вебхук
+func (wh *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+    err := wh.Store.DeleteIncomingWebhook(r.Context(), r.PathValue("id"))
+    if errors.Is(err, storage.ErrNotFound) {
+        writeError(w, http.StatusNotFound, "unknown webhook")
+        return
+    }
+    if err != nil {
+        webhookLogger.Error("Failed to delete incoming webhook", "error", err)
+        writeError(w, http.StatusInternalServerError, "internal error")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func toIncomingWebhookResponse(hook storage.IncomingWebhook) incomingWebhookResponse {
+    return incomingWebhookResponse{
+        ID:        hook.ID,
+        RoomID:    hook.RoomID,
+        Name:      hook.Name,
+        CreatedAt: hook.CreatedAt,
+    }
+}
+
+// randomToken возвращает n случайных байт в base64url без паддинга
+func randomToken(n int) (string, error) {
+    b := make([]byte, n)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+func tokenMatches(token, hash string) bool {
+    return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(hash)) == 1
+}
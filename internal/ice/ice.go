@@ -0,0 +1,110 @@
+package ice
+
+import (
+    "crypto/hmac"
+    "crypto/sha1"
+    "encoding/base64"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// DefaultTTL - срок временных учетных данных TURN. Браузер проверяет их при каждом
+// продлении выделения на TURN-сервере, поэтому срок должен покрывать самый длинный звонок
+const DefaultTTL = 12 * time.Hour
+
+// Server - один ICE-сервер в формате RTCIceServer браузера
+type Server struct {
+    URLs       []string `json:"urls"`
+    Username   string   `json:"username,omitempty"`
+    Credential string   `json:"credential,omitempty"`
+}
+
+// Config - ICE-серверы, которые сервер раздает клиентам. Для TURN выдаются временные
+// учетные данные по TURN REST API (use-auth-secret в coturn): общий секрет знают
+// только Thoth и TURN-сервер
+type Config struct {
+    STUN   []string
+    TURN   []string
+    Secret []byte
+    TTL    time.Duration
+
+    now func() time.Time
+}
+
+// NewConfig создает конфигурацию. Без TURN-серверов секрет не нужен
+func NewConfig(stun, turn []string, secret string) (*Config, error) {
+    if len(turn) > 0 && secret == "" {
+        return nil, fmt.Errorf("TURN servers require a shared secret")
+    }
+    return &Config{STUN: stun, TURN: turn, Secret: []byte(secret), TTL: DefaultTTL, now: time.Now}, nil
+}
+
+// ParseURLs разбирает список адресов через запятую и проверяет схемы:
+// stun: и stuns: для STUN, turn: и turns: для TURN
+func ParseURLs(spec string, schemes ...string) ([]string, error) {
+    var urls []string
+    for _, u := range strings.Split(spec, ",") {
+        u = strings.TrimSpace(u)
+        if u == "" {
+            continue
+        }
+        scheme, rest, ok := strings.Cut(u, ":")
+        if !ok || rest == "" || !contains(schemes, scheme) {
+            return nil, fmt.Errorf("invalid ICE server URL %q, expected %s", u, strings.Join(schemes, " or "))
+        }
+        urls = append(urls, u)
+    }
+    return urls, nil
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+// Servers возвращает ICE-серверы для пользователя и срок действия учетных данных TURN
+func (c *Config) Servers(username string) ([]Server, time.Time) {
+    expires := c.now().Add(c.TTL)
+    var servers []Server
+    if len(c.STUN) > 0 {
+        servers = append(servers, Server{URLs: c.STUN})
+    }
+    if len(c.TURN) > 0 {
+        user, credential := Credentials(c.Secret, username, expires)
+        servers = append(servers, Server{URLs: c.TURN, Username: user, Credential: credential})
+    }
+    return servers, expires
+}
+
+// Password проверяет имя TURN, выданное Servers, и возвращает ожидаемый для него пароль.
+// false - имя не в формате TURN REST API или срок его действия истек
+func (c *Config) Password(user string) (string, bool) {
+    expiry, _, ok := strings.Cut(user, ":")
+    if !ok || len(c.Secret) == 0 {
+        return "", false
+    }
+    unix, err := strconv.ParseInt(expiry, 10, 64)
+    if err != nil || c.now().Unix() > unix {
+        return "", false
+    }
+    return password(c.Secret, user), true
+}
+
+// Credentials выпускает учетные данные TURN REST API: имя "<unix-время истечения>:<пользователь>",
+// пароль - base64(HMAC-SHA1(секрет, имя))
+func Credentials(secret []byte, username string, expires time.Time) (string, string) {
+    user := strconv.FormatInt(expires.Unix(), 10) + ":" + username
+    return user, password(secret, user)
+}
+
+func password(secret []byte, user string) string {
+    mac := hmac.New(sha1.New, secret)
+    mac.Write([]byte(user))
+    return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package ice
+
+import (
+    "testing"
+    "time"
+)
+
+func TestCredentials(t *testing.T) {
+    // Ожидаемое значение посчитано независимо:
+    // echo -n 1700000000:alice | openssl dgst -sha1 -hmac secret -binary | base64
+    user, credential := Credentials([]byte("secret"), "alice", time.Unix(1700000000, 0))
+    if user != "1700000000:alice" {
+        t.Errorf("имя пользователя TURN: %q", user)
+    }
+    if credential != "d8soP47RbdIKLDUOpnJPVQyq5Ts=" {
+        t.Errorf("пароль TURN: %q", credential)
+    }
+}
+
+func TestServers(t *testing.T) {
+    cfg, err := NewConfig([]string{"stun:stun.example.com:3478"}, []string{"turn:turn.example.com:3478", "turns:turn.example.com:5349"}, "secret")
+    if err != nil {
+        t.Fatal(err)
+    }
+    now := time.Unix(1700000000, 0)
+    cfg.now = func() time.Time { return now }
+    cfg.TTL = time.Hour
+
+    servers, expires := cfg.Servers("alice")
+    if !expires.Equal(now.Add(time.Hour)) {
+        t.Errorf("срок действия: %v", expires)
+    }
+    if len(servers) != 2 || servers[0].Username != "" || len(servers[1].URLs) != 2 {
+        t.Fatalf("серверы: %+v", servers)
+    }
+    user, credential := Credentials([]byte("secret"), "alice", expires)
+    if servers[1].Username != user || servers[1].Credential != credential {
+        t.Errorf("учетные данные TURN: %+v", servers[1])
+    }
+
+    if _, err := NewConfig(nil, []string{"turn:turn.example.com"}, ""); err == nil {
+        t.Error("TURN без секрета должен быть ошибкой")
+    }
+}
+
+func TestParseURLs(t *testing.T) {
+    urls, err := ParseURLs(" turn:a.example.com:3478 , turns:b.example.com:5349?transport=tcp,", "turn", "turns")
+    if err != nil || len(urls) != 2 {
+        t.Fatalf("разбор адресов: %v, %v", urls, err)
+    }
+    for _, spec := range []string{"stun:a.example.com", "https://a.example.com", "turn:"} {
+        if _, err := ParseURLs(spec, "turn", "turns"); err == nil {
+            t.Errorf("адрес %q должен быть отклонен", spec)
+        }
+    }
+}
+
+func TestPassword(t *testing.T) {
+    cfg, _ := NewConfig(nil, []string{"turn:turn.example.com"}, "secret")
+    now := time.Unix(1700000000, 0)
+    cfg.now = func() time.Time { return now }
+
+    servers, _ := cfg.Servers("alice")
+    turn := servers[0]
+    if password, ok := cfg.Password(turn.Username); !ok || password != turn.Credential {
+        t.Errorf("выданное имя не прошло проверку: %q, %v", password, ok)
+    }
+
+    now = now.Add(cfg.TTL + time.Second)
+    if _, ok := cfg.Password(turn.Username); ok {
+        t.Error("просроченное имя прошло проверку")
+    }
+    for _, user := range []string{"alice", "soon:alice", ""} {
+        if _, ok := cfg.Password(user); ok {
+            t.Errorf("имя %q прошло проверку", user)
+        }
+    }
+}
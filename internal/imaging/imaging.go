@@ -0,0 +1,169 @@
+package imaging
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/gif" // декодер GIF для image.Decode
+    "image/jpeg"
+    "image/png"
+
+    "golang.org/x/image/draw"
+    _ "golang.org/x/image/webp" // декодер WebP для image.Decode
+)
+
+// ThumbnailSize - наибольшая сторона превью в пикселях
+const ThumbnailSize = 320
+
+// MaxPixels ограничивает размер декодируемой картинки, чтобы маленький файл
+// с огромными заявленными размерами не съел всю память
+const MaxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Result - обработанная картинка
+type Result struct {
+    Data          []byte // Файл без метаданных; для GIF совпадает с исходным
+    Width         int    // Размеры с учетом ориентации из EXIF
+    Height        int
+    Thumbnail     []byte // nil для анимированного WebP: его кадры декодер не читает
+    ThumbnailType string
+}
+
+// IsSupported сообщает, умеет ли пакет обрабатывать картинки такого типа
+func IsSupported(mediaType string) bool {
+    switch mediaType {
+    case "image/jpeg", "image/png", "image/gif", "image/webp":
+        return true
+    }
+    return false
+}
+
+// Process удаляет из картинки метаданные (EXIF с координатами, XMP, комментарии)
+// и строит превью. Сжатые данные JPEG, PNG и WebP не перекодируются
+func Process(data []byte, mediaType string) (Result, error) {
+    var res Result
+    orientation := 1
+    animated := false
+
+    switch mediaType {
+    case "image/jpeg":
+        stripped, o, err := stripJPEG(data)
+        if err != nil {
+            return res, err
+        }
+        res.Data, orientation = stripped, o
+    case "image/png":
+        stripped, err := stripPNG(data)
+        if err != nil {
+            return res, err
+        }
+        res.Data = stripped
+    case "image/webp":
+        // Ориентацию из EXIF в WebP браузеры не применяют, поэтому она не сохраняется
+        stripped, a, err := stripWebP(data)
+        if err != nil {
+            return res, err
+        }
+        res.Data, animated = stripped, a
+    case "image/gif":
+        // В GIF нет EXIF
+        res.Data = data
+    default:
+        return res, fmt.Errorf("unsupported image type %q", mediaType)
+    }
+
+    cfg, _, err := image.DecodeConfig(bytes.NewReader(res.Data))
+    if err != nil {
+        return res, err
+    }
+    if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+        return res, ErrTooLarge
+    }
+    res.Width, res.Height = cfg.Width, cfg.Height
+    if orientation >= 5 {
+        res.Width, res.Height = res.Height, res.Width
+    }
+    if animated {
+        return res, nil
+    }
+
+    img, _, err := image.Decode(bytes.NewReader(res.Data))
+    if err != nil {
+        return res, err
+    }
+    thumb := orient(scaleToFit(img, ThumbnailSize), orientation)
+
+    var buf bytes.Buffer
+    if mediaType == "image/jpeg" {
+        err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+        res.ThumbnailType = "image/jpeg"
+    } else {
+        // PNG сохраняет прозрачность исходных PNG и GIF
+        err = png.Encode(&buf, thumb)
+        res.ThumbnailType = "image/png"
+    }
+    if err != nil {
+        return res, err
+    }
+    res.Thumbnail = buf.Bytes()
+    return res, nil
+}
+
+// scaleToFit уменьшает картинку так, чтобы большая сторона не превышала size
+func scaleToFit(src image.Image, size int) image.Image {
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w > size || h > size {
+        if w >= h {
+            w, h = size, max(1, h*size/w)
+        } else {
+            w, h = max(1, w*size/h), size
+        }
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, w, h))
+    draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+    return dst
+}
+
+// orient поворачивает и отражает картинку согласно тегу EXIF Orientation (1-8)
+func orient(src image.Image, orientation int) image.Image {
+    if orientation <= 1 || orientation > 8 {
+        return src
+    }
+
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    dw, dh := w, h
+    if orientation >= 5 {
+        dw, dh = h, w
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+    for y := 0; y < dh; y++ {
+        for x := 0; x < dw; x++ {
+            var sx, sy int
+            switch orientation {
+            case 2: // отражение по горизонтали
+                sx, sy = w-1-x, y
+            case 3: // поворот на 180°
+                sx, sy = w-1-x, h-1-y
+            case 4: // отражение по вертикали
+                sx, sy = x, h-1-y
+            case 5: // транспонирование
+                sx, sy = y, x
+            case 6: // поворот на 90° по часовой
+                sx, sy = y, h-1-x
+            case 7: // транспонирование относительно побочной диагонали
+                sx, sy = w-1-y, h-1-x
+            case 8: // поворот на 90° против часовой
+                sx, sy = w-1-y, x
+            }
+            dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+        }
+    }
+    return dst
+}
+
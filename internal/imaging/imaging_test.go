@@ -0,0 +1,198 @@
+package imaging
+
+import (
+    "bytes"
+    "encoding/binary"
+    "hash/crc32"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "image/png"
+    "testing"
+)
+
+func testImage(w, h int) image.Image {
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+        }
+    }
+    return img
+}
+
+// exifWithGPS - APP1 с ориентацией и фиктивным блоком GPS, как у снимков с телефона
+func exifWithGPS(orientation int) []byte {
+    tiff := []byte{
+        'I', 'I', 0x2A, 0x00,
+        0x08, 0x00, 0x00, 0x00,
+        0x02, 0x00,
+        0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), 0x00, 0x00, 0x00,
+        0x25, 0x88, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26, 0x00, 0x00, 0x00, // GPS IFD
+        0x00, 0x00, 0x00, 0x00,
+    }
+    tiff = append(tiff, []byte("GPS 55.7558N 37.6173E")...)
+    payload := append([]byte("Exif\x00\x00"), tiff...)
+
+    segment := []byte{0xFF, 0xE1, 0, 0}
+    binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+    return append(segment, payload...)
+}
+
+func TestProcessJPEGStripsEXIFAndKeepsOrientation(t *testing.T) {
+    var buf bytes.Buffer
+    if err := jpeg.Encode(&buf, testImage(400, 200), nil); err != nil {
+        t.Fatal(err)
+    }
+    raw := buf.Bytes()
+    withExif := append(append(append([]byte(nil), raw[:2]...), exifWithGPS(6)...), raw[2:]...)
+
+    res, err := Process(withExif, "image/jpeg")
+    if err != nil {
+        t.Fatalf("Ошибка обработки: %v", err)
+    }
+    if bytes.Contains(res.Data, []byte("GPS")) {
+        t.Error("Координаты GPS остались в файле")
+    }
+    if _, o, _ := stripJPEG(res.Data); o != 6 {
+        t.Errorf("Ориентация не сохранена: %d", o)
+    }
+    if _, err := jpeg.Decode(bytes.NewReader(res.Data)); err != nil {
+        t.Errorf("Очищенный JPEG не декодируется: %v", err)
+    }
+
+    // Ориентация 6 - поворот на 90°, поэтому стороны меняются местами
+    if res.Width != 200 || res.Height != 400 {
+        t.Errorf("Размеры %dx%d, ожидалось 200x400", res.Width, res.Height)
+    }
+    thumb, err := jpeg.Decode(bytes.NewReader(res.Thumbnail))
+    if err != nil {
+        t.Fatalf("Превью не декодируется: %v", err)
+    }
+    if b := thumb.Bounds(); b.Dx() != 160 || b.Dy() != ThumbnailSize {
+        t.Errorf("Размер превью %dx%d, ожидалось 160x%d", b.Dx(), b.Dy(), ThumbnailSize)
+    }
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+    chunk := make([]byte, 8, 12+len(data))
+    binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+    copy(chunk[4:], chunkType)
+    chunk = append(chunk, data...)
+    return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestProcessPNGStripsTextChunks(t *testing.T) {
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, testImage(50, 30)); err != nil {
+        t.Fatal(err)
+    }
+    raw := buf.Bytes()
+
+    // Метаданные вставляются сразу после IHDR (8 байт сигнатуры + 25 байт чанка)
+    const afterIHDR = 8 + 25
+    var withMeta []byte
+    withMeta = append(withMeta, raw[:afterIHDR]...)
+    withMeta = append(withMeta, pngChunk("tEXt", []byte("Comment\x00secret"))...)
+    withMeta = append(withMeta, pngChunk("eXIf", []byte("MM\x00\x2aGPS"))...)
+    withMeta = append(withMeta, raw[afterIHDR:]...)
+
+    res, err := Process(withMeta, "image/png")
+    if err != nil {
+        t.Fatalf("Ошибка обработки: %v", err)
+    }
+    if bytes.Contains(res.Data, []byte("secret")) || bytes.Contains(res.Data, []byte("eXIf")) {
+        t.Error("Метаданные остались в PNG")
+    }
+    if !bytes.Equal(res.Data, raw) {
+        t.Error("После очистки PNG должен совпасть с исходным файлом без метаданных")
+    }
+    if res.Width != 50 || res.Height != 30 || res.ThumbnailType != "image/png" {
+        t.Errorf("Неожиданный результат: %dx%d %s", res.Width, res.Height, res.ThumbnailType)
+    }
+}
+
+// webpLossless1x1 - минимальный WebP без сжатия потерями, картинка 1x1
+const webpLossless1x1 = "VP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"
+
+func webpChunk(fourCC string, data []byte) []byte {
+    chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+    chunk = append(chunk, data...)
+    if len(data)%2 == 1 {
+        chunk = append(chunk, 0)
+    }
+    return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+    body := []byte("WEBP")
+    for _, c := range chunks {
+        body = append(body, c...)
+    }
+    return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestProcessWebPStripsEXIFAndXMP(t *testing.T) {
+    // VP8X с флагами EXIF и XMP, холст 1x1
+    vp8x := webpChunk("VP8X", []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+    exif := webpChunk("EXIF", exifWithGPS(1)[10:]) // TIFF без заголовка сегмента APP1
+    xmp := webpChunk("XMP ", []byte(`<x:xmpmeta><exif:GPSLatitude>55,45.35N</exif:GPSLatitude></x:xmpmeta>`))
+    withMeta := webpFile(vp8x, []byte(webpLossless1x1), exif, xmp)
+
+    res, err := Process(withMeta, "image/webp")
+    if err != nil {
+        t.Fatalf("Ошибка обработки: %v", err)
+    }
+    if bytes.Contains(res.Data, []byte("GPS")) || bytes.Contains(res.Data, []byte("EXIF")) {
+        t.Error("Метаданные остались в WebP")
+    }
+    want := webpFile(webpChunk("VP8X", make([]byte, 10)), []byte(webpLossless1x1))
+    if !bytes.Equal(res.Data, want) {
+        t.Errorf("Неожиданный результат очистки:\n%q\nожидалось\n%q", res.Data, want)
+    }
+    if res.Width != 1 || res.Height != 1 || res.Thumbnail == nil {
+        t.Errorf("Неожиданный результат: %dx%d, превью %d байт", res.Width, res.Height, len(res.Thumbnail))
+    }
+}
+
+func TestProcessAnimatedWebPWithoutThumbnail(t *testing.T) {
+    vp8x := webpChunk("VP8X", []byte{webpFlagAnimation | webpFlagEXIF, 0, 0, 0, 1, 0, 0, 1, 0, 0}) // холст 2x2
+    anim := webpChunk("ANIM", make([]byte, 6))
+    frame := webpChunk("ANMF", append(make([]byte, 16), webpLossless1x1...))
+    exif := webpChunk("EXIF", exifWithGPS(1)[10:])
+
+    res, err := Process(webpFile(vp8x, anim, frame, exif), "image/webp")
+    if err != nil {
+        t.Fatalf("Ошибка обработки: %v", err)
+    }
+    if bytes.Contains(res.Data, []byte("GPS")) || !bytes.Contains(res.Data, []byte("ANMF")) {
+        t.Error("Из анимации должны уйти только метаданные")
+    }
+    if res.Width != 2 || res.Height != 2 || res.Thumbnail != nil {
+        t.Errorf("Неожиданный результат: %dx%d, превью %d байт", res.Width, res.Height, len(res.Thumbnail))
+    }
+}
+
+func TestProcessRejectsCorruptImage(t *testing.T) {
+    if _, err := Process([]byte("\xff\xd8\xff\xe1\xff\xff"), "image/jpeg"); err == nil {
+        t.Error("Поврежденный JPEG должен быть отклонен")
+    }
+    if _, err := Process([]byte("RIFF\xff\x00\x00\x00WEBPVP8L"), "image/webp"); err == nil {
+        t.Error("Поврежденный WebP должен быть отклонен")
+    }
+}
+
+func TestOrient(t *testing.T) {
+    src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+    src.Set(0, 0, color.RGBA{255, 0, 0, 255}) // красный слева
+    src.Set(1, 0, color.RGBA{0, 0, 255, 255}) // синий справа
+
+    // Поворот по часовой: левый пиксель оказывается сверху
+    dst := orient(src, 6)
+    if b := dst.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+        t.Fatalf("Размер после поворота %v", b)
+    }
+    if r, _, _, _ := dst.At(0, 0).RGBA(); r == 0 {
+        t.Error("После поворота на 90° по часовой красный пиксель должен быть сверху")
+    }
+}
@@ -0,0 +1,245 @@
+package imaging
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "hash/crc32"
+)
+
+var errCorrupt = errors.New("corrupt image")
+
+// Маркеры JPEG
+const (
+    markerSOI   = 0xD8
+    markerSOS   = 0xDA
+    markerAPP1  = 0xE1 // EXIF и XMP
+    markerAPP13 = 0xED // IPTC (Photoshop)
+    markerCOM   = 0xFE
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// stripJPEG удаляет сегменты APP1 (EXIF, XMP), APP13 (IPTC) и комментарии, не трогая
+// сжатые данные. Если в EXIF была ориентация, отличная от 1, вместо исходного EXIF
+// записывается минимальный блок только с ней, чтобы картинка не "легла на бок".
+// Возвращает очищенный файл и исходную ориентацию (1, если ее не было)
+func stripJPEG(data []byte) ([]byte, int, error) {
+    if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+        return nil, 0, errCorrupt
+    }
+
+    orientation := 1
+    var kept [][]byte
+    pos := 2
+    for {
+        // Допускаются заполняющие байты 0xFF перед маркером
+        for pos < len(data) && data[pos] == 0xFF && pos+1 < len(data) && data[pos+1] == 0xFF {
+            pos++
+        }
+        if pos+4 > len(data) || data[pos] != 0xFF {
+            return nil, 0, errCorrupt
+        }
+        marker := data[pos+1]
+
+        // Маркеры без длины
+        if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+            kept = append(kept, data[pos:pos+2])
+            pos += 2
+            continue
+        }
+
+        length := int(binary.BigEndian.Uint16(data[pos+2:]))
+        end := pos + 2 + length
+        if length < 2 || end > len(data) {
+            return nil, 0, errCorrupt
+        }
+
+        if marker == markerSOS {
+            // Дальше идут сжатые данные: копируем остаток файла как есть
+            kept = append(kept, data[pos:])
+            break
+        }
+
+        segment := data[pos:end]
+        payload := data[pos+4 : end]
+        switch marker {
+        case markerAPP1:
+            if bytes.HasPrefix(payload, exifHeader) {
+                if o := exifOrientation(payload[len(exifHeader):]); o != 0 {
+                    orientation = o
+                }
+            }
+        case markerAPP13, markerCOM:
+        default:
+            kept = append(kept, segment)
+        }
+        pos = end
+    }
+
+    out := bytes.NewBuffer(make([]byte, 0, len(data)))
+    out.Write([]byte{0xFF, markerSOI})
+    for i, segment := range kept {
+        // Минимальный EXIF ставим после APP0 (JFIF), если он есть, иначе сразу после SOI
+        if i == 0 && orientation != 1 {
+            if len(segment) > 1 && segment[1] == 0xE0 {
+                out.Write(segment)
+                out.Write(orientationSegment(orientation))
+                continue
+            }
+            out.Write(orientationSegment(orientation))
+        }
+        out.Write(segment)
+    }
+    return out.Bytes(), orientation, nil
+}
+
+// exifOrientation читает тег Orientation (0x0112) из IFD0 блока TIFF. 0 - тега нет или блок поврежден
+func exifOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 0
+    }
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 0
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd+2 > len(tiff) {
+        return 0
+    }
+    count := int(order.Uint16(tiff[ifd:]))
+    for i := 0; i < count; i++ {
+        entry := ifd + 2 + i*12
+        if entry+12 > len(tiff) {
+            return 0
+        }
+        if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+            if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+                return o
+            }
+            return 0
+        }
+    }
+    return 0
+}
+
+// orientationSegment строит сегмент APP1 с EXIF, содержащим только тег Orientation
+func orientationSegment(orientation int) []byte {
+    tiff := []byte{
+        'M', 'M', 0x00, 0x2A, // big-endian TIFF
+        0x00, 0x00, 0x00, 0x08, // IFD0 сразу после заголовка
+        0x00, 0x01, // одна запись
+        0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // Orientation, SHORT, 1 значение
+        0x00, byte(orientation), 0x00, 0x00,
+        0x00, 0x00, 0x00, 0x00, // следующего IFD нет
+    }
+    payload := append(append([]byte(nil), exifHeader...), tiff...)
+
+    segment := []byte{0xFF, markerAPP1, 0, 0}
+    binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+    return append(segment, payload...)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// strippedPNGChunks - вспомогательные чанки с метаданными: EXIF, текст, время изменения
+var strippedPNGChunks = map[string]bool{
+    "eXIf": true,
+    "tEXt": true,
+    "zTXt": true,
+    "iTXt": true,
+    "tIME": true,
+}
+
+// stripPNG удаляет чанки с метаданными, остальные (включая цветовой профиль) копирует без изменений
+func stripPNG(data []byte) ([]byte, error) {
+    if !bytes.HasPrefix(data, pngSignature) {
+        return nil, errCorrupt
+    }
+
+    out := bytes.NewBuffer(make([]byte, 0, len(data)))
+    out.Write(pngSignature)
+    pos := len(pngSignature)
+    for pos < len(data) {
+        if pos+12 > len(data) {
+            return nil, errCorrupt
+        }
+        length := int(binary.BigEndian.Uint32(data[pos:]))
+        end := pos + 12 + length
+        if length < 0 || end > len(data) {
+            return nil, errCorrupt
+        }
+        chunkType := string(data[pos+4 : pos+8])
+        if crc32.ChecksumIEEE(data[pos+4:end-4]) != binary.BigEndian.Uint32(data[end-4:]) {
+            return nil, errCorrupt
+        }
+
+        if !strippedPNGChunks[chunkType] {
+            out.Write(data[pos:end])
+        }
+        pos = end
+        if chunkType == "IEND" {
+            break
+        }
+    }
+    return out.Bytes(), nil
+}
+
+// Флаги чанка VP8X
+const (
+    webpFlagAnimation = 1 << 1
+    webpFlagXMP       = 1 << 2
+    webpFlagEXIF      = 1 << 3
+)
+
+// stripWebP удаляет чанки EXIF и XMP и снимает их флаги в VP8X, остальные чанки
+// (включая цветовой профиль и кадры анимации) копирует без изменений.
+// animated сообщает, что файл анимированный
+func stripWebP(data []byte) (out []byte, animated bool, err error) {
+    if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+        return nil, false, errCorrupt
+    }
+    end := 8 + int(binary.LittleEndian.Uint32(data[4:]))
+    if end > len(data) || end < 12 {
+        return nil, false, errCorrupt
+    }
+
+    out = make([]byte, 12, end)
+    copy(out, data[:12])
+    pos := 12
+    for pos < end {
+        if pos+8 > end {
+            return nil, false, errCorrupt
+        }
+        size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+        chunkEnd := pos + 8 + size
+        if size < 0 || chunkEnd > end {
+            return nil, false, errCorrupt
+        }
+        // Данные чанка выравниваются до четной длины
+        next := min(chunkEnd+(size&1), end)
+
+        switch string(data[pos : pos+4]) {
+        case "EXIF", "XMP ":
+        case "VP8X":
+            if size < 1 {
+                return nil, false, errCorrupt
+            }
+            start := len(out)
+            out = append(out, data[pos:next]...)
+            out[start+8] &^= webpFlagEXIF | webpFlagXMP
+            animated = data[pos+8]&webpFlagAnimation != 0
+        default:
+            out = append(out, data[pos:next]...)
+        }
+        pos = next
+    }
+    binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+    return out, animated, nil
+}
@@ -0,0 +1,78 @@
+package markdown
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestRender(t *testing.T) {
+    tests := []struct {
+        name string
+        src  string
+        want string
+    }{
+        {"обычный текст", "привет", "<p>привет</p>"},
+        {"абзацы и переносы", "a\nb\n\nc", "<p>a<br>b</p><p>c</p>"},
+        {"жирный и курсив", "**жирный** и *курсив* и _тоже_", "<p><strong>жирный</strong> и <em>курсив</em> и <em>тоже</em></p>"},
+        {"snake_case не курсив", "some_var_name", "<p>some_var_name</p>"},
+        {"незакрытое выделение", "2 * 3 = 6", "<p>2 * 3 = 6</p>"},
+        {"строчный код", "вызови `rm -rf *` **не**", "<p>вызови <code>rm -rf *</code> <strong>не</strong></p>"},
+        {"блок кода", "```go\nfmt.Println(\"<b>\")\n```", `<pre><code class="language-go">fmt.Println(&#34;&lt;b&gt;&#34;)</code></pre>`},
+        {"незакрытый блок кода", "```\nx", "<pre><code>x</code></pre>"},
+        {"ссылка", "[док](https://go.dev/doc)", `<p><a href="https://go.dev/doc" rel="nofollow noopener noreferrer" target="_blank">док</a></p>`},
+        {"голая ссылка", "см. https://go.dev.", `<p>см. <a href="https://go.dev" rel="nofollow noopener noreferrer" target="_blank">https://go.dev</a>.</p>`},
+        {"упоминание", "@alice, глянь", `<p><span class="mention" data-mention="alice">@alice</span>, глянь</p>`},
+        {"почта не упоминание", "bob@example.com", "<p>bob@example.com</p>"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := Render(tt.src); got != tt.want {
+                t.Errorf("Render(%q)\n получено  %s\n ожидалось %s", tt.src, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRenderIsSafe(t *testing.T) {
+    inputs := []string{
+        "<script>alert(1)</script>",
+        "<img src=x onerror=alert(1)>",
+        "[клик](javascript:alert(1))",
+        "[клик](data:text/html;base64,PHNjcmlwdD4=)",
+        `[клик](https://a.com"onmouseover="alert(1))`,
+        "**<b>**",
+        "`</code><script>`",
+        "@<svg/onload=alert(1)>",
+    }
+    for _, src := range inputs {
+        out := Render(src)
+        for _, bad := range []string{"<script", "<img", "<svg", `href="javascript:`, `href="data:`, `"onmouseover`} {
+            if strings.Contains(out, bad) {
+                t.Errorf("Render(%q) содержит %q: %s", src, bad, out)
+            }
+        }
+    }
+}
+
+func TestMentionsSkipCode(t *testing.T) {
+    got := Mentions(Parse("@bob и @Анна, а еще `@carol` и снова @bob"))
+    if want := []string{"bob", "Анна"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Mentions() = %v, ожидалось %v", got, want)
+    }
+}
+
+func TestExtractMentions(t *testing.T) {
+    users, room := ExtractMentions("@room внимание: @alice, @bob, @carol", 2)
+    if !room {
+        t.Error("ожидалось упоминание @room")
+    }
+    if want := []string{"alice", "bob"}; !reflect.DeepEqual(users, want) {
+        t.Errorf("ExtractMentions() = %v, ожидалось %v", users, want)
+    }
+
+    if _, room := ExtractMentions("почта room@example.com", 10); room {
+        t.Error("адрес почты не является упоминанием")
+    }
+}
@@ -0,0 +1,297 @@
+package markdown
+
+import (
+    "net/url"
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Kind - тип узла дерева разбора
+type Kind int
+
+const (
+    Paragraph Kind = iota
+    CodeBlock
+    Text
+    LineBreak
+    Code
+    Strong
+    Emphasis
+    Link
+    Mention
+)
+
+// Node - узел дерева. Дерево содержит только поддерживаемые конструкции,
+// поэтому любой HTML во входном тексте остается обычным текстом
+type Node struct {
+    Kind     Kind
+    Text     string // Text, Code, CodeBlock; имя для Mention
+    URL      string // Link
+    Lang     string // CodeBlock
+    Children []*Node
+}
+
+// maxDepth ограничивает вложенность выделений, чтобы разбор оставался линейным по глубине
+const maxDepth = 8
+
+// Parse разбирает подмножество Markdown: блоки кода ```, `код`, **жирный**,
+// *курсив* и _курсив_, [текст](ссылка), голые http(s)-ссылки и @упоминания
+func Parse(src string) []*Node {
+    src = strings.ReplaceAll(src, "\r\n", "\n")
+    lines := strings.Split(src, "\n")
+
+    var blocks []*Node
+    for i := 0; i < len(lines); {
+        line := lines[i]
+
+        if fence, ok := strings.CutPrefix(strings.TrimLeft(line, " "), "```"); ok {
+            block := &Node{Kind: CodeBlock, Lang: codeLang(fence)}
+            var body []string
+            for i++; i < len(lines); i++ {
+                if strings.HasPrefix(strings.TrimLeft(lines[i], " "), "```") {
+                    i++
+                    break
+                }
+                body = append(body, lines[i])
+            }
+            block.Text = strings.Join(body, "\n")
+            blocks = append(blocks, block)
+            continue
+        }
+
+        if strings.TrimSpace(line) == "" {
+            i++
+            continue
+        }
+
+        var para []string
+        for ; i < len(lines); i++ {
+            if strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimLeft(lines[i], " "), "```") {
+                break
+            }
+            para = append(para, lines[i])
+        }
+        blocks = append(blocks, &Node{Kind: Paragraph, Children: parseInline(strings.Join(para, "\n"), 0, true)})
+    }
+    return blocks
+}
+
+// codeLang оставляет от подписи блока кода только безопасное имя языка
+func codeLang(s string) string {
+    s = strings.TrimSpace(s)
+    if len(s) > 20 {
+        return ""
+    }
+    for _, r := range s {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '_' || r == '#') {
+            return ""
+        }
+    }
+    return strings.ToLower(s)
+}
+
+var autolinkPattern = regexp.MustCompile(`^https?://[^\s<>"'` + "`" + `]+`)
+
+// parseInline разбирает строчную разметку. links = false внутри ссылки, чтобы не вкладывать <a> в <a>
+func parseInline(s string, depth int, links bool) []*Node {
+    var nodes []*Node
+    var text strings.Builder
+
+    flush := func() {
+        if text.Len() > 0 {
+            nodes = append(nodes, &Node{Kind: Text, Text: text.String()})
+            text.Reset()
+        }
+    }
+    emit := func(n *Node) {
+        flush()
+        nodes = append(nodes, n)
+    }
+
+    for i := 0; i < len(s); {
+        c := s[i]
+        rest := s[i:]
+
+        switch {
+        case c == '\n':
+            emit(&Node{Kind: LineBreak})
+            i++
+            continue
+
+        case c == '`':
+            if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+                emit(&Node{Kind: Code, Text: rest[1 : end+1]})
+                i += end + 2
+                continue
+            }
+
+        case c == '*' && strings.HasPrefix(rest, "**") && depth < maxDepth:
+            if inner, ok := delimited(rest, "**"); ok {
+                emit(&Node{Kind: Strong, Children: parseInline(inner, depth+1, links)})
+                i += len(inner) + 4
+                continue
+            }
+
+        case (c == '*' || c == '_') && depth < maxDepth:
+            // _ внутри слова (snake_case) выделением не считается
+            if c == '_' && wordBefore(s, i) {
+                break
+            }
+            if inner, ok := delimited(rest, string(c)); ok && (c == '*' || !wordAfter(s, i+len(inner)+2)) {
+                emit(&Node{Kind: Emphasis, Children: parseInline(inner, depth+1, links)})
+                i += len(inner) + 2
+                continue
+            }
+
+        case c == '[' && links:
+            if label, target, n, ok := linkAt(rest); ok {
+                emit(&Node{Kind: Link, URL: target, Children: parseInline(label, depth+1, false)})
+                i += n
+                continue
+            }
+
+        case c == 'h' && links && !wordBefore(s, i):
+            if m := autolinkPattern.FindString(rest); m != "" {
+                m = strings.TrimRight(m, ".,;:!?)]}»")
+                if safeURL(m) {
+                    emit(&Node{Kind: Link, URL: m, Children: []*Node{{Kind: Text, Text: m}}})
+                    i += len(m)
+                    continue
+                }
+            }
+
+        case c == '@' && !wordBefore(s, i):
+            if name := mentionAt(rest[1:]); name != "" {
+                emit(&Node{Kind: Mention, Text: name})
+                i += 1 + len(name)
+                continue
+            }
+        }
+
+        _, size := utf8.DecodeRuneInString(rest)
+        text.WriteString(rest[:size])
+        i += size
+    }
+    flush()
+    return nodes
+}
+
+// delimited ищет закрывающий разделитель для выделения, открытого в начале s.
+// Содержимое не может быть пустым, начинаться или заканчиваться пробелом
+func delimited(s, delim string) (string, bool) {
+    body := s[len(delim):]
+    end := strings.Index(body, delim)
+    if end <= 0 {
+        return "", false
+    }
+    inner := body[:end]
+    if strings.TrimSpace(inner) != inner || strings.Contains(inner, "\n\n") {
+        return "", false
+    }
+    return inner, true
+}
+
+// linkAt разбирает [текст](ссылка) в начале s и возвращает длину конструкции
+func linkAt(s string) (label, target string, n int, ok bool) {
+    closeLabel := strings.Index(s, "](")
+    if closeLabel <= 1 || strings.ContainsAny(s[1:closeLabel], "\n[") {
+        return "", "", 0, false
+    }
+    closeURL := strings.IndexByte(s[closeLabel+2:], ')')
+    if closeURL <= 0 {
+        return "", "", 0, false
+    }
+    target = s[closeLabel+2 : closeLabel+2+closeURL]
+    if strings.ContainsAny(target, " \n\t") || !safeURL(target) {
+        return "", "", 0, false
+    }
+    return s[1:closeLabel], target, closeLabel + 3 + closeURL, true
+}
+
+// safeURL пропускает только абсолютные ссылки http, https и mailto
+func safeURL(raw string) bool {
+    u, err := url.Parse(raw)
+    if err != nil {
+        return false
+    }
+    switch u.Scheme {
+    case "http", "https":
+        return u.Host != ""
+    case "mailto":
+        return u.Opaque != ""
+    }
+    return false
+}
+
+// mentionAt возвращает имя упоминания в начале s: буквы, цифры, "_", "-" и "." (не в конце)
+func mentionAt(s string) string {
+    end := 0
+    for end < len(s) {
+        r, size := utf8.DecodeRuneInString(s[end:])
+        if !isNameRune(r) {
+            break
+        }
+        end += size
+    }
+    name := strings.TrimRight(s[:end], ".-")
+    if utf8.RuneCountInString(name) > 64 {
+        return ""
+    }
+    return name
+}
+
+func isNameRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+func wordBefore(s string, i int) bool {
+    if i == 0 {
+        return false
+    }
+    r, _ := utf8.DecodeLastRuneInString(s[:i])
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func wordAfter(s string, i int) bool {
+    if i >= len(s) {
+        return false
+    }
+    r, _ := utf8.DecodeRuneInString(s[i:])
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Mentions возвращает имена упомянутых пользователей без повторов, в порядке появления.
+// Упоминания внутри кода не учитываются
+func Mentions(nodes []*Node) []string {
+    var names []string
+    seen := make(map[string]bool)
+    var walk func([]*Node)
+    walk = func(nodes []*Node) {
+        for _, n := range nodes {
+            if n.Kind == Mention && !seen[n.Text] {
+                seen[n.Text] = true
+                names = append(names, n.Text)
+            }
+            walk(n.Children)
+        }
+    }
+    walk(nodes)
+    return names
+}
+
+// ExtractMentions разбирает текст сообщения (в любом формате) и возвращает упомянутых
+// пользователей не более limit штук. Упоминание @room возвращается отдельным флагом
+func ExtractMentions(src string, limit int) (users []string, room bool) {
+    for _, name := range Mentions(Parse(src)) {
+        if name == "room" {
+            room = true
+            continue
+        }
+        if len(users) < limit {
+            users = append(users, name)
+        }
+    }
+    return users, room
+}
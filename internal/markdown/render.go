@@ -0,0 +1,57 @@
+package markdown
+
+import (
+    "html"
+    "strings"
+)
+
+// Render разбирает текст и возвращает безопасный HTML. В выводе могут быть только
+// теги p, br, pre, code, strong, em, a (http, https, mailto) и span.mention
+func Render(src string) string {
+    return HTML(Parse(src))
+}
+
+// HTML выводит дерево разбора в HTML, экранируя весь текст
+func HTML(nodes []*Node) string {
+    var b strings.Builder
+    writeNodes(&b, nodes)
+    return b.String()
+}
+
+func writeNodes(b *strings.Builder, nodes []*Node) {
+    for _, n := range nodes {
+        switch n.Kind {
+        case Paragraph:
+            b.WriteString("<p>")
+            writeNodes(b, n.Children)
+            b.WriteString("</p>")
+        case CodeBlock:
+            b.WriteString("<pre><code")
+            if n.Lang != "" {
+                b.WriteString(` class="language-` + html.EscapeString(n.Lang) + `"`)
+            }
+            b.WriteString(">" + html.EscapeString(n.Text) + "</code></pre>")
+        case Text:
+            b.WriteString(html.EscapeString(n.Text))
+        case LineBreak:
+            b.WriteString("<br>")
+        case Code:
+            b.WriteString("<code>" + html.EscapeString(n.Text) + "</code>")
+        case Strong:
+            b.WriteString("<strong>")
+            writeNodes(b, n.Children)
+            b.WriteString("</strong>")
+        case Emphasis:
+            b.WriteString("<em>")
+            writeNodes(b, n.Children)
+            b.WriteString("</em>")
+        case Link:
+            b.WriteString(`<a href="` + html.EscapeString(n.URL) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+            writeNodes(b, n.Children)
+            b.WriteString("</a>")
+        case Mention:
+            name := html.EscapeString(n.Text)
+            b.WriteString(`<span class="mention" data-mention="` + name + `">@` + name + `</span>`)
+        }
+    }
+}
@@ -0,0 +1,72 @@
+package meetings
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "Thoth/internal/models"
+)
+
+const icsTime = "20060102T150405Z"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// ICS собирает событие iCalendar (RFC 5545) для встречи со ссылкой joinURL.
+// alarm > 0 добавляет напоминание календаря за alarm до начала
+func ICS(m models.Meeting, joinURL string, alarm time.Duration) []byte {
+    participants := append([]string{m.Organizer}, m.Invitees...)
+    description := fmt.Sprintf("Комната: %s\nОрганизатор: %s\nУчастники: %s\nПодключиться: %s",
+        m.RoomID, m.Organizer, strings.Join(participants, ", "), joinURL)
+
+    lines := []string{
+        "BEGIN:VCALENDAR",
+        "VERSION:2.0",
+        "PRODID:-//Thoth//Meetings//RU",
+        "CALSCALE:GREGORIAN",
+        "METHOD:PUBLISH",
+        "BEGIN:VEVENT",
+        "UID:" + m.ID + "@thoth",
+        "DTSTAMP:" + m.CreatedAt.UTC().Format(icsTime),
+        "DTSTART:" + m.StartsAt.UTC().Format(icsTime),
+        "DTEND:" + m.EndsAt().UTC().Format(icsTime),
+        "SUMMARY:" + icsEscaper.Replace(m.Title),
+        "DESCRIPTION:" + icsEscaper.Replace(description),
+        "LOCATION:" + icsEscaper.Replace(joinURL),
+        "URL:" + joinURL,
+    }
+    if alarm > 0 {
+        lines = append(lines,
+            "BEGIN:VALARM",
+            "ACTION:DISPLAY",
+            fmt.Sprintf("TRIGGER:-PT%dM", int(alarm/time.Minute)),
+            "DESCRIPTION:"+icsEscaper.Replace(m.Title),
+            "END:VALARM",
+        )
+    }
+    lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+    var b strings.Builder
+    for _, line := range lines {
+        foldLine(&b, line)
+    }
+    return []byte(b.String())
+}
+
+// foldLine пишет строку содержимого, перенося ее через каждые 75 байт (RFC 5545, 3.1).
+// Перенос не разрывает символы UTF-8
+func foldLine(b *strings.Builder, line string) {
+    limit := 75
+    for len(line) > limit {
+        cut := limit
+        for cut > 0 && line[cut]&0xC0 == 0x80 {
+            cut--
+        }
+        b.WriteString(line[:cut])
+        b.WriteString("\r\n ")
+        line = line[cut:]
+        limit = 74 // Пробел в начале продолжения тоже считается
+    }
+    b.WriteString(line)
+    b.WriteString("\r\n")
+}
@@ -0,0 +1,190 @@
+package meetings
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "log/slog"
+    "net/url"
+    "strings"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+)
+
+var remindersLogger = slog.With("component", "meetings")
+
+var remindersTotal = metrics.NewCounter("thoth_meeting_reminders_total",
+    "Meeting reminders posted to rooms by outcome", "result")
+
+// Этапы напоминаний: заранее, за Lead до начала, и в момент начала
+const (
+    reminderSoon  = 1
+    reminderStart = 2
+)
+
+// Store - операции хранилища, которые нужны Reminder. Реализуется *storage.Storage
+type Store interface {
+    DueMeetings(ctx context.Context, now, before time.Time, sent int) ([]models.Meeting, error)
+    ClaimMeetingReminder(ctx context.Context, id string, sent int) (bool, error)
+}
+
+// Links строит ссылки на встречи: страница чата с токеном встречи в параметре meeting
+// и файл .ics с тем же токеном
+type Links struct {
+    PublicURL string
+    Signer    *auth.Signer
+}
+
+// JoinURL возвращает ссылку на встречу. Непустой username - персональная ссылка приглашенного
+func (l Links) JoinURL(m models.Meeting, username string) (string, error) {
+    token, err := l.Signer.IssueMeetingToken(auth.MeetingClaims{MeetingID: m.ID, RoomID: m.RoomID, Username: username}, m.EndsAt())
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(l.PublicURL, "/") + "/?meeting=" + url.QueryEscape(token), nil
+}
+
+// ICSURL возвращает ссылку на событие встречи для календаря с общим токеном встречи
+func (l Links) ICSURL(m models.Meeting) (string, error) {
+    token, err := l.Signer.IssueMeetingToken(auth.MeetingClaims{MeetingID: m.ID, RoomID: m.RoomID}, m.EndsAt())
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(l.PublicURL, "/") + "/api/meetings/" + url.PathEscape(m.ID) + "/ics?token=" + url.QueryEscape(token), nil
+}
+
+// Reminder периодически напоминает о встречах сообщениями от system в их комнатах:
+// за Lead до начала и в момент начала. Приглашенные упоминаются и получают уведомления.
+// Несколько экземпляров сервера не дублируют напоминания: каждое сначала отмечается в базе
+type Reminder struct {
+    Interval time.Duration // Период проверки
+    Lead     time.Duration // За сколько до начала напомнить
+
+    store Store
+    links Links
+    post  func(ctx context.Context, msg models.Message) error
+    now   func() time.Time
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+// NewReminder создает напоминания; post публикует сообщение в комнате (Hub.PostMessage)
+func NewReminder(store Store, links Links, post func(ctx context.Context, msg models.Message) error) *Reminder {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &Reminder{
+        Interval: 30 * time.Second,
+        Lead:     10 * time.Minute,
+        store:    store,
+        links:    links,
+        post:     post,
+        now:      time.Now,
+        ctx:      ctx,
+        cancel:   cancel,
+    }
+}
+
+// Run проверяет встречи с периодом Interval до вызова Stop
+func (r *Reminder) Run() {
+    remindersLogger.Info("Meeting reminders are running", "interval", r.Interval, "lead", r.Lead)
+
+    ticker := time.NewTicker(r.Interval)
+    defer ticker.Stop()
+
+    for {
+        if err := r.RunOnce(r.ctx); err != nil && r.ctx.Err() == nil {
+            remindersLogger.Error("Meeting reminder run failed", "error", err)
+        }
+
+        select {
+        case <-r.ctx.Done():
+            remindersLogger.Info("Meeting reminders stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (r *Reminder) Stop() {
+    r.cancel()
+}
+
+// RunOnce отправляет наступившие напоминания. Сначала - о начавшихся встречах:
+// если встречу создали меньше чем за Lead до начала, заблаговременное напоминание
+// уже не нужно
+func (r *Reminder) RunOnce(ctx context.Context) error {
+    now := r.now()
+    for _, stage := range []struct {
+        sent   int
+        before time.Time
+    }{
+        {reminderStart, now},
+        {reminderSoon, now.Add(r.Lead)},
+    } {
+        due, err := r.store.DueMeetings(ctx, now, stage.before, stage.sent)
+        if err != nil {
+            return err
+        }
+        for _, m := range due {
+            if err := r.remind(ctx, m, stage.sent, now); err != nil {
+                remindersTotal.Inc("failed")
+                remindersLogger.Error("Failed to post meeting reminder", "meeting_id", m.ID, "room", m.RoomID, "error", err)
+            }
+        }
+    }
+    return nil
+}
+
+func (r *Reminder) remind(ctx context.Context, m models.Meeting, stage int, now time.Time) error {
+    claimed, err := r.store.ClaimMeetingReminder(ctx, m.ID, stage)
+    if err != nil || !claimed {
+        return err
+    }
+    link, err := r.links.JoinURL(m, "")
+    if err != nil {
+        return err
+    }
+    if err := r.post(ctx, models.Message{
+        Username:  "system",
+        RoomID:    m.RoomID,
+        Content:   reminderText(m, stage, now, link),
+        Timestamp: now,
+    }); err != nil {
+        return err
+    }
+    remindersTotal.Inc("sent")
+    remindersLogger.Info("Meeting reminder posted", "meeting_id", m.ID, "room", m.RoomID, "stage", stage)
+    return nil
+}
+
+// reminderText - текст напоминания. Если с упоминаниями всех участников текст не влезает
+// в сообщение, участники не перечисляются
+func reminderText(m models.Meeting, stage int, now time.Time, link string) string {
+    head := fmt.Sprintf("📅 Встреча «%s» начинается.", m.Title)
+    if stage == reminderSoon {
+        minutes := int((m.StartsAt.Sub(now) + time.Minute - 1) / time.Minute)
+        head = fmt.Sprintf("📅 Через %d мин. начнется встреча «%s».", minutes, m.Title)
+    }
+    tail := "\nПодключиться: " + link
+
+    mentions := make([]string, 0, len(m.Invitees)+1)
+    for _, username := range append([]string{m.Organizer}, m.Invitees...) {
+        mentions = append(mentions, "@"+username)
+    }
+    text := head + " Участники: " + strings.Join(mentions, " ") + tail
+    if len(text) > models.MaxContentLength {
+        text = head + tail
+    }
+    return text
+}
+
+// NewID - идентификатор новой встречи
+func NewID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
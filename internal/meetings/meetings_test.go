@@ -0,0 +1,145 @@
+package meetings
+
+import (
+    "context"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/models"
+)
+
+// fakeStore хранит встречи в памяти и повторяет условия запросов storage
+type fakeStore struct {
+    meetings []models.Meeting
+    sent     map[string]int
+}
+
+func (s *fakeStore) DueMeetings(ctx context.Context, now, before time.Time, sent int) ([]models.Meeting, error) {
+    var due []models.Meeting
+    for _, m := range s.meetings {
+        if s.sent[m.ID] < sent && !m.StartsAt.After(before) && m.EndsAt().After(now) {
+            due = append(due, m)
+        }
+    }
+    return due, nil
+}
+
+func (s *fakeStore) ClaimMeetingReminder(ctx context.Context, id string, sent int) (bool, error) {
+    if s.sent[id] >= sent {
+        return false, nil
+    }
+    s.sent[id] = sent
+    return true, nil
+}
+
+func testMeeting(id string, starts time.Time) models.Meeting {
+    return models.Meeting{
+        ID: id, RoomID: "general", Title: "Планерка", Organizer: "alice",
+        StartsAt: starts, Duration: 1800, Invitees: []string{"bob"}, CreatedAt: starts.Add(-24 * time.Hour),
+    }
+}
+
+func TestReminder(t *testing.T) {
+    now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+    store := &fakeStore{
+        meetings: []models.Meeting{
+            testMeeting("soon", now.Add(7*time.Minute)),
+            testMeeting("later", now.Add(time.Hour)),
+            testMeeting("started", now.Add(-time.Minute)), // Создана впритык: только напоминание о начале
+            testMeeting("over", now.Add(-time.Hour)),
+        },
+        sent: map[string]int{},
+    }
+    signer := auth.NewSigner([]byte("secret"))
+    var posted []models.Message
+    r := NewReminder(store, Links{PublicURL: "https://chat.example.com/", Signer: signer}, func(ctx context.Context, msg models.Message) error {
+        posted = append(posted, msg)
+        return nil
+    })
+    r.now = func() time.Time { return now }
+
+    if err := r.RunOnce(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if len(posted) != 2 {
+        t.Fatalf("ожидали напоминания о started и soon, получили %d: %+v", len(posted), posted)
+    }
+    if !strings.HasPrefix(posted[0].Content, "📅 Встреча «Планерка» начинается.") || store.sent["started"] != reminderStart {
+        t.Errorf("напоминание о начале: %q", posted[0].Content)
+    }
+    if !strings.HasPrefix(posted[1].Content, "📅 Через 7 мин.") || !strings.Contains(posted[1].Content, "@alice @bob") {
+        t.Errorf("заблаговременное напоминание: %q", posted[1].Content)
+    }
+    if posted[1].Username != "system" || posted[1].RoomID != "general" {
+        t.Errorf("напоминание не от system или не в ту комнату: %+v", posted[1])
+    }
+
+    // В ссылке - общий токен встречи без имени
+    link := posted[1].Content[strings.Index(posted[1].Content, "https://"):]
+    u, err := url.Parse(link)
+    if err != nil || u.Host != "chat.example.com" || u.Path != "/" {
+        t.Fatalf("ссылка: %q, %v", link, err)
+    }
+    claims, err := signer.VerifyMeetingToken(u.Query().Get("meeting"))
+    if err != nil || claims.MeetingID != "soon" || claims.RoomID != "general" || claims.Username != "" {
+        t.Errorf("токен ссылки: %+v, %v", claims, err)
+    }
+
+    // Повторный проход ничего не отправляет, пока не наступит начало
+    posted = nil
+    r.RunOnce(context.Background())
+    if len(posted) != 0 {
+        t.Fatalf("напоминания повторились: %+v", posted)
+    }
+    now = now.Add(7 * time.Minute)
+    r.RunOnce(context.Background())
+    if len(posted) != 1 || !strings.Contains(posted[0].Content, "начинается") {
+        t.Errorf("в момент начала: %+v", posted)
+    }
+}
+
+func TestReminderTextFitsMessage(t *testing.T) {
+    now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+    m := testMeeting("m1", now.Add(10*time.Minute))
+    m.Invitees = nil
+    for i := 0; i < models.MaxMeetingInvitees; i++ {
+        m.Invitees = append(m.Invitees, strings.Repeat("u", 60)+string(rune('a'+i)))
+    }
+    text := reminderText(m, reminderSoon, now, "https://chat.example.com/?meeting=x")
+    if len(text) > models.MaxContentLength || strings.Contains(text, "@") {
+        t.Errorf("длинный список участников должен быть опущен: %d байт", len(text))
+    }
+}
+
+func TestICS(t *testing.T) {
+    starts := time.Date(2026, 10, 20, 9, 30, 0, 0, time.FixedZone("MSK", 3*3600))
+    m := testMeeting("m1", starts)
+    m.Title = "Ретро; итоги, планы"
+    m.Invitees = []string{"bob", "carol"}
+    ics := string(ICS(m, "https://chat.example.com/?meeting="+strings.Repeat("t", 120), 10*time.Minute))
+
+    if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+        t.Fatalf("не календарь:\n%s", ics)
+    }
+    for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+        if len(line) > 75 {
+            t.Errorf("строка длиннее 75 байт: %q", line)
+        }
+    }
+    unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+    for _, want := range []string{
+        "UID:m1@thoth",
+        "DTSTART:20261020T063000Z",
+        "DTEND:20261020T070000Z",
+        `SUMMARY:Ретро\; итоги\, планы`,
+        `Участники: alice\, bob\, carol\n`,
+        "TRIGGER:-PT10M",
+    } {
+        if !strings.Contains(unfolded, want) {
+            t.Errorf("нет %q в\n%s", want, unfolded)
+        }
+    }
+}
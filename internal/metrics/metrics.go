@@ -0,0 +1,296 @@
+package metrics
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// Пакет реализует минимальный набор метрик (счетчики, измерители и гистограммы с метками)
+// и отдает их в текстовом формате Prometheus без внешних зависимостей
+
+type metricKind string
+
+const (
+    kindCounter metricKind = "counter"
+    kindGauge     metricKind = "gauge"
+    kindHistogram metricKind = "histogram"
+)
+
+// Registry хранит зарегистрированные метрики
+type Registry struct {
+    mu      sync.Mutex
+    metrics []*metric
+}
+
+// Default - реестр, в который регистрируются метрики пакетов по умолчанию
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+    return &Registry{}
+}
+
+type metric struct {
+    name   string
+    help   string
+    kind   metricKind
+    labels []string
+    bounds []float64 // Верхние границы корзин гистограммы по возрастанию
+
+    mu     sync.Mutex
+    values map[string]*sample
+}
+
+type sample struct {
+    labelValues []string
+    value       float64   // Значение; у гистограммы - сумма наблюдений
+    count       uint64    // Число наблюдений гистограммы
+    buckets     []uint64  // Наблюдения по корзинам bounds, без накопления
+}
+
+func (r *Registry) register(name, help string, kind metricKind, labels []string) *metric {
+    m := &metric{name: name, help: help, kind: kind, labels: labels, values: make(map[string]*sample)}
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for _, existing := range r.metrics {
+        if existing.name == name {
+            panic("metrics: duplicate metric " + name)
+        }
+    }
+    r.metrics = append(r.metrics, m)
+    return m
+}
+
+// sample возвращает значение для набора меток, создавая его. Вызывается под m.mu
+func (m *metric) sample(labelValues []string) *sample {
+    if len(labelValues) != len(m.labels) {
+        panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+    }
+    key := strings.Join(labelValues, "\xff")
+    s, ok := m.values[key]
+    if !ok {
+        s = &sample{labelValues: append([]string(nil), labelValues...)}
+        if m.kind == kindHistogram {
+            s.buckets = make([]uint64, len(m.bounds))
+        }
+        m.values[key] = s
+    }
+    return s
+}
+
+func (m *metric) add(delta float64, labelValues []string, set bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s := m.sample(labelValues)
+    if set {
+        s.value = delta
+    } else {
+        s.value += delta
+    }
+}
+
+func (m *metric) get(labelValues []string) float64 {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if s, ok := m.values[strings.Join(labelValues, "\xff")]; ok {
+        return s.value
+    }
+    return 0
+}
+
+// Counter - монотонно растущий счетчик
+type Counter struct{ m *metric }
+
+// NewCounter регистрирует счетчик в реестре Default
+func NewCounter(name, help string, labels ...string) *Counter {
+    return Default.NewCounter(name, help, labels...)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+    return &Counter{m: r.register(name, help, kindCounter, labels)}
+}
+
+// Inc увеличивает счетчик на 1
+func (c *Counter) Inc(labelValues ...string) {
+    c.m.add(1, labelValues, false)
+}
+
+// Add увеличивает счетчик на delta (отрицательные значения игнорируются)
+func (c *Counter) Add(delta float64, labelValues ...string) {
+    if delta < 0 {
+        return
+    }
+    c.m.add(delta, labelValues, false)
+}
+
+// Value возвращает текущее значение (для тестов и диагностики)
+func (c *Counter) Value(labelValues ...string) float64 {
+    return c.m.get(labelValues)
+}
+
+// Gauge - значение, которое может расти и уменьшаться
+type Gauge struct{ m *metric }
+
+// NewGauge регистрирует измеритель в реестре Default
+func NewGauge(name, help string, labels ...string) *Gauge {
+    return Default.NewGauge(name, help, labels...)
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+    return &Gauge{m: r.register(name, help, kindGauge, labels)}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+    g.m.add(value, labelValues, true)
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+    g.m.add(delta, labelValues, false)
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+    return g.m.get(labelValues)
+}
+
+// Histogram - распределение наблюдений по корзинам, например задержек
+type Histogram struct{ m *metric }
+
+// NewHistogram регистрирует гистограмму в реестре Default. buckets - верхние границы
+// корзин по возрастанию; корзина +Inf добавляется сама
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+    return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+    if !sort.Float64sAreSorted(buckets) {
+        panic("metrics: buckets of " + name + " are not sorted")
+    }
+    m := r.register(name, help, kindHistogram, labels)
+    m.bounds = append([]float64(nil), buckets...)
+    return &Histogram{m: m}
+}
+
+// Observe добавляет наблюдение
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+    h.m.mu.Lock()
+    defer h.m.mu.Unlock()
+    s := h.m.sample(labelValues)
+    s.value += value
+    s.count++
+    if i := sort.SearchFloat64s(h.m.bounds, value); i < len(s.buckets) {
+        s.buckets[i]++
+    }
+}
+
+// Count возвращает число наблюдений (для тестов и диагностики)
+func (h *Histogram) Count(labelValues ...string) uint64 {
+    h.m.mu.Lock()
+    defer h.m.mu.Unlock()
+    if s, ok := h.m.values[strings.Join(labelValues, "\xff")]; ok {
+        return s.count
+    }
+    return 0
+}
+
+// WriteTo выводит все метрики реестра в текстовом формате Prometheus
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+    r.mu.Lock()
+    metrics := append([]*metric(nil), r.metrics...)
+    r.mu.Unlock()
+
+    sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+    var b strings.Builder
+    for _, m := range metrics {
+        fmt.Fprintf(&b, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+        fmt.Fprintf(&b, "# TYPE %s %s\n", m.name, m.kind)
+
+        m.mu.Lock()
+        keys := make([]string, 0, len(m.values))
+        for key := range m.values {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        for _, key := range keys {
+            s := m.values[key]
+            if m.kind == kindHistogram {
+                var cumulative uint64
+                for i, bound := range m.bounds {
+                    cumulative += s.buckets[i]
+                    writeSample(&b, m.name+"_bucket", m.labels, s.labelValues, "le", formatValue(bound), float64(cumulative))
+                }
+                writeSample(&b, m.name+"_bucket", m.labels, s.labelValues, "le", "+Inf", float64(s.count))
+                writeSample(&b, m.name+"_sum", m.labels, s.labelValues, "", "", s.value)
+                writeSample(&b, m.name+"_count", m.labels, s.labelValues, "", "", float64(s.count))
+                continue
+            }
+            writeSample(&b, m.name, m.labels, s.labelValues, "", "", s.value)
+        }
+        m.mu.Unlock()
+    }
+
+    n, err := io.WriteString(w, b.String())
+    return int64(n), err
+}
+
+// writeSample выводит строку значения. extra - дополнительная метка, например le у корзин гистограммы
+func writeSample(b *strings.Builder, name string, labels, labelValues []string, extra, extraValue string, value float64) {
+    b.WriteString(name)
+    if len(labels) > 0 || extra != "" {
+        b.WriteByte('{')
+        for i, label := range labels {
+            if i > 0 {
+                b.WriteByte(',')
+            }
+            fmt.Fprintf(b, "%s=\"%s\"", label, escapeLabel(labelValues[i]))
+        }
+        if extra != "" {
+            if len(labels) > 0 {
+                b.WriteByte(',')
+            }
+            fmt.Fprintf(b, "%s=\"%s\"", extra, extraValue)
+        }
+        b.WriteByte('}')
+    }
+    b.WriteByte(' ')
+    b.WriteString(formatValue(value))
+    b.WriteByte('\n')
+}
+
+// Handler отдает метрики реестра Default
+func Handler() http.Handler {
+    return Default.Handler()
+}
+
+func (r *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        r.WriteTo(w)
+    })
+}
+
+func formatValue(v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    case math.IsNaN(v):
+        return "NaN"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+    helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+    labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
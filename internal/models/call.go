@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Состояния звонка
+const (
+    CallRinging = "ringing" // Предложение отправлено, никто еще не ответил
+    CallActive  = "active"  // Хотя бы двое участников соединились
+    CallEnded   = "ended"
+)
+
+// Причины завершения звонка
+const (
+    CallCompleted = "completed" // Был разговор
+    CallMissed    = "missed"    // Никто не ответил вовремя
+    CallCancelled = "cancelled" // Звонящий положил трубку до ответа
+    CallDeclined  = "declined"  // Все приглашенные отказались
+)
+
+// Режимы звонка
+const (
+    CallModeMesh = "mesh" // Браузеры участников соединяются попарно
+    CallModeSFU  = "sfu"  // Каждый браузер соединяется с сервером, сервер пересылает потоки остальным
+)
+
+// Причины в кадрах call_decline и call_cancel (поле content)
+const (
+    InviteDeclined  = "declined"  // Приглашенный отказался или отключился
+    InviteBusy      = "busy"      // Приглашенный уже в другом звонке или его уже приглашают
+    InviteTimeout   = "timeout"   // Никто не ответил за время звонка
+    InviteCancelled = "cancelled" // Звонящий передумал или отключился
+)
+
+// Call - звонок в комнате. Приходит клиентам в кадрах call_invite, call_started и call_ended
+type Call struct {
+    ID           string            `json:"id"`
+    RoomID       string            `json:"room_id"`
+    State        string            `json:"state"`
+    Mode         string            `json:"mode"`
+    Initiator    string            `json:"initiator"`
+    EndReason    string            `json:"end_reason,omitempty"`
+    Participants []CallParticipant `json:"participants"`
+    CreatedAt    time.Time         `json:"created_at"`
+    StartedAt    time.Time         `json:"started_at,omitempty"` // Первый ответ; нулевое, если разговора не было
+    EndedAt      time.Time         `json:"ended_at,omitempty"`
+    Duration     int64             `json:"duration_seconds"` // От первого ответа до конца
+}
+
+// Виды дорожек в записи звонка
+const (
+    TrackAudio = "audio"
+    TrackVideo = "video"
+)
+
+// Recording - запись звонка комнаты. Каждая дорожка участника пишется в отдельный файл,
+// файлы хранятся как вложения комнаты. Приходит клиентам в кадрах recording_started и recording_stopped
+type Recording struct {
+    ID        string          `json:"id"`
+    RoomID    string          `json:"room_id"`
+    CallID    string          `json:"call_id"`
+    StartedBy string          `json:"started_by"`
+    StartedAt time.Time       `json:"started_at"`
+    EndedAt   time.Time       `json:"ended_at,omitempty"`
+    Files     []RecordingFile `json:"files,omitempty"`
+}
+
+// RecordingFile - дорожка участника Username в записи
+type RecordingFile struct {
+    Username string `json:"username"`
+    Kind     string `json:"kind"`
+    Attachment
+}
+
+// MediaState - что участник передает в звонок. Приходит в кадрах media_state и users_list
+type MediaState struct {
+    Audio  bool `json:"audio"`
+    Video  bool `json:"video"`
+    Screen bool `json:"screen"` // Показывает экран
+    Hand   bool `json:"hand"`   // Поднял руку
+}
+
+// UserState - подключенный участник комнаты в кадре users_list
+type UserState struct {
+    Username string `json:"username"`
+    MediaState
+}
+
+// CallParticipant - участник звонка. Duration - суммарное время в звонке,
+// если участник выходил и возвращался
+type CallParticipant struct {
+    Username string    `json:"username"`
+    JoinedAt time.Time `json:"joined_at"`
+    LeftAt   time.Time `json:"left_at,omitempty"`
+    Duration int64     `json:"duration_seconds"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Типы событий чата, на которые могут подписываться внешние системы
+const (
+    EventMessage     = "message"
+    EventUserJoined  = "user_joined"
+    EventUserLeft    = "user_left"
+    EventMention     = "mention"
+    EventCallOffer   = "call_offer" // Звонок пользователю, которого нет в комнате
+    EventCallStarted = "call_started"
+    EventCallEnded   = "call_ended"
+)
+
+// Event - событие в комнате, которое хаб сообщает подписчикам
+type Event struct {
+    Type      string    `json:"event"`
+    RoomID    string    `json:"room_id"`
+    Username  string    `json:"username"`
+    Target    string    `json:"target,omitempty"` // Адресат EventMention и EventCallOffer
+    Message   *Message  `json:"message,omitempty"`
+    Call      *Call     `json:"call,omitempty"` // Для EventCallStarted и EventCallEnded
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// IsEventType сообщает, поддерживается ли тип события
+func IsEventType(eventType string) bool {
+    switch eventType {
+    case EventMessage, EventUserJoined, EventUserLeft, EventMention, EventCallOffer, EventCallStarted, EventCallEnded:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// Ограничения на запланированную встречу. Приглашенные упоминаются в напоминании,
+// поэтому их не больше, чем упоминаний в сообщении
+const (
+    MaxMeetingTitle    = 200
+    MaxMeetingInvitees = MaxMentions
+    MinMeetingDuration = 5 * time.Minute
+    MaxMeetingDuration = 24 * time.Hour
+)
+
+var (
+    ErrMeetingTitle    = errors.New("title is required")
+    ErrMeetingInPast   = errors.New("starts_at must be in the future")
+    ErrMeetingDuration = fmt.Errorf("duration must be between %v and %v", MinMeetingDuration, MaxMeetingDuration)
+)
+
+// Meeting - запланированный звонок в комнате. Ссылки на подключение выдает сервер,
+// напоминания приходят в комнату сообщениями от system
+type Meeting struct {
+    ID        string    `json:"id"`
+    RoomID    string    `json:"room_id"`
+    Title     string    `json:"title"`
+    Organizer string    `json:"organizer"`
+    StartsAt  time.Time `json:"starts_at"`
+    Duration  int64     `json:"duration_seconds"`
+    Invitees  []string  `json:"invitees"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// EndsAt - время окончания встречи по расписанию
+func (m Meeting) EndsAt() time.Time {
+    return m.StartsAt.Add(time.Duration(m.Duration) * time.Second)
+}
+
+// Invited сообщает, приглашен ли пользователь. Организатор считается приглашенным
+func (m Meeting) Invited(username string) bool {
+    if username == m.Organizer {
+        return true
+    }
+    for _, invitee := range m.Invitees {
+        if invitee == username {
+            return true
+        }
+    }
+    return false
+}
+
+// ValidateMeeting проверяет новую встречу: название, время и приглашенных.
+// Пробелы по краям названия и имен убираются, повторы приглашенных - тоже
+func ValidateMeeting(m *Meeting, now time.Time) error {
+    m.Title = strings.TrimSpace(m.Title)
+    if m.Title == "" {
+        return ErrMeetingTitle
+    }
+    if utf8.RuneCountInString(m.Title) > MaxMeetingTitle {
+        return fmt.Errorf("title is too long (max %d characters)", MaxMeetingTitle)
+    }
+    if !m.StartsAt.After(now) {
+        return ErrMeetingInPast
+    }
+    if d := time.Duration(m.Duration) * time.Second; d < MinMeetingDuration || d > MaxMeetingDuration {
+        return ErrMeetingDuration
+    }
+
+    invitees := make([]string, 0, len(m.Invitees))
+    seen := make(map[string]bool)
+    for _, username := range m.Invitees {
+        username = strings.TrimSpace(username)
+        if username == "" || seen[username] || username == m.Organizer {
+            continue
+        }
+        seen[username] = true
+        invitees = append(invitees, username)
+    }
+    if len(invitees) > MaxMeetingInvitees {
+        return fmt.Errorf("too many invitees (max %d)", MaxMeetingInvitees)
+    }
+    m.Invitees = invitees
+    return nil
+}
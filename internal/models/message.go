@@ -1,29 +1,225 @@
 package models
 
-import "time"
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
 
 type Message struct {
     Type      string    `json:"type"`
     ID        int       `json:"id"`
     Username  string    `json:"username"`
     Content   string    `json:"content"`
+    Format    string    `json:"format,omitempty"` // plain (по умолчанию) или markdown
+    HTML      string    `json:"html,omitempty"`   // Отрисованный сервером Markdown
     Timestamp time.Time `json:"timestamp"`
     RoomID    string    `json:"room_id"`
-    TargetUser string      `json:"target_user,omitempty"`
-    WebRTCData interface{} `json:"webrtc_data,omitempty"`
+    TargetUser  string        `json:"target_user,omitempty"`
+    WebRTCData  *WebRTCData   `json:"webrtc_data,omitempty"`
+    Embeds      []Embed       `json:"embeds,omitempty"`
+    Attachments []Attachment  `json:"attachments,omitempty"`
+    Previews    []LinkPreview `json:"previews,omitempty"`
+    Token       string        `json:"token,omitempty"` // Токен участника в кадре session
+    OwnerKey    string        `json:"owner_key,omitempty"` // Ключ владельца комнаты в кадре session
+    UserKey     string        `json:"user_key,omitempty"`  // Ключ пользователя, подтверждающий имя, в кадре session
+    Call        *Call         `json:"call,omitempty"`  // Звонок в кадрах call_started и call_ended
+    Recording   *Recording    `json:"recording,omitempty"` // Запись в кадрах recording_started и recording_stopped
+    Media       *MediaState   `json:"media,omitempty"`     // Состояние отправителя в кадре media_state
+    Users       []UserState   `json:"users,omitempty"`     // Участники и их MediaState в кадре users_list
+    Stats       *CallStats    `json:"stats,omitempty"`     // Отчет о качестве соединения в кадре call_stats
+    DisplayName string        `json:"display_name,omitempty"` // Подпись сообщения вебхука; Username - имя самого вебхука
+}
+
+// Attachment - загруженный файл, прикрепленный к сообщению. Клиент присылает только ID,
+// остальные поля сервер заполняет из базы
+type Attachment struct {
+    ID          string `json:"id"`
+    Filename    string `json:"filename,omitempty"`
+    ContentType string `json:"content_type,omitempty"`
+    Size        int64  `json:"size,omitempty"`
+    URL         string `json:"url,omitempty"`
+
+    // Только для картинок
+    Width        int    `json:"width,omitempty"`
+    Height       int    `json:"height,omitempty"`
+    ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// LinkPreview - превью ссылки из сообщения, собранное по OpenGraph-метаданным страницы.
+// Приходит клиентам отдельным кадром message_update после самого сообщения
+type LinkPreview struct {
+    URL         string `json:"url"`
+    Title       string `json:"title,omitempty"`
+    Description string `json:"description,omitempty"`
+    ImageURL    string `json:"image_url,omitempty"`
+    SiteName    string `json:"site_name,omitempty"`
+}
+
+// Mention - упоминание пользователя в сообщении, как его видит упомянутый
+type Mention struct {
+    ID        int64     `json:"id"`
+    MessageID int       `json:"message_id"`
+    RoomID    string    `json:"room_id"`
+    Author    string    `json:"author"`
+    Kind      string    `json:"kind"`
+    Content   string    `json:"content"`
+    Read      bool      `json:"read"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// AttachmentURL - путь для скачивания вложения. Для доступа к нему нужен токен участника комнаты
+func AttachmentURL(id string) string {
+    return "/api/attachments/" + url.PathEscape(id)
+}
+
+// ThumbnailURL - путь к превью картинки; доступ такой же, как к самому вложению
+func ThumbnailURL(id string) string {
+    return AttachmentURL(id) + "/thumbnail"
+}
+
+// Embed - простое вложение-карточка (заголовок, ссылка, текст, цвет полосы),
+// которое приходит от внешних систем через входящие вебхуки
+type Embed struct {
+    Title     string `json:"title,omitempty"`
+    TitleLink string `json:"title_link,omitempty"`
+    Text      string `json:"text,omitempty"`
+    Color     string `json:"color,omitempty"`
+    Footer    string `json:"footer,omitempty"`
 }
 
 const (
-    MessageTypeChat         = "chat"
-    MessageTypeUserJoined   = "user_joined"
-    MessageTypeUserLeft     = "user_left"
-    MessageTypeUsersList    = "users_list"
+    MessageTypeChat          = "chat"
+    MessageTypeUserJoined    = "user_joined"
+    MessageTypeUserLeft      = "user_left"
+    MessageTypeUsersList     = "users_list"
+    MessageTypeError         = "error"
+    MessageTypeSession       = "session"
+    MessageTypeMessageUpdate = "message_update"
+    MessageTypeMention       = "mention"
+    MessageTypeRateLimited   = "rate_limited"
     MessageTypeWebRTCOffer     = "webrtc_offer"
     MessageTypeWebRTCAnswer    = "webrtc_answer"
     MessageTypeWebRTCCandidate = "webrtc_candidate"
+    MessageTypeCallInvite      = "call_invite"  // Приглашение в звонок: target_user - кого зовут
+    MessageTypeCallAccept      = "call_accept"  // Приглашенный принял; только после этого идет SDP
+    MessageTypeCallDecline     = "call_decline" // Приглашенный отказался; content - причина
+    MessageTypeCallCancel      = "call_cancel"  // Звонящий отозвал приглашение; content - причина
+    MessageTypeCallHangup      = "call_hangup"  // Клиент выходит из звонка комнаты
+    MessageTypeCallStarted     = "call_started" // Сервер: звонок стал активным
+    MessageTypeCallEnded       = "call_ended"   // Сервер: звонок завершен
+    MessageTypeCallMode        = "call_mode"    // Сервер: звонок переведен в другой режим (call.mode)
+    MessageTypeRecordingStart   = "recording_start"   // Владелец комнаты включает запись звонка
+    MessageTypeRecordingStop    = "recording_stop"    // Владелец комнаты выключает запись
+    MessageTypeRecordingStarted = "recording_started" // Сервер: звонок записывается
+    MessageTypeRecordingStopped = "recording_stopped" // Сервер: запись остановлена, файлы сохраняются
+    MessageTypeMediaState       = "media_state"       // Участник включил или выключил микрофон, камеру, показ экрана, поднял руку
+    MessageTypeCallStats        = "call_stats"        // Участник присылает качество соединения в звонке, никому не пересылается
+)
+
+// Форматы текста сообщения
+const (
+    FormatPlain    = "plain"
+    FormatMarkdown = "markdown"
+)
+
+// Ограничения на содержимое сообщений
+const (
+    MaxContentLength = 1000
+    MaxEmbeds        = 10
+    MaxEmbedText     = 2000
+    MaxAttachments   = 10
+    MaxMentions      = 20
+    MaxDisplayName   = 64
+    MaxUsername      = 64
 )
 
+// Виды упоминаний: личное (@username) и всей комнаты (@room)
+const (
+    MentionUser = "user"
+    MentionRoom = "room"
+)
+
+var (
+    ErrEmptyContent   = errors.New("message content cannot be empty")
+    ErrContentTooLong = fmt.Errorf("message is too long (max %d characters)", MaxContentLength)
+)
+
+// ValidateChatMessage проверяет чат-сообщение перед сохранением и рассылкой.
+// Используется для всех источников сообщений: WebSocket, gRPC и вебхуков
+func ValidateChatMessage(msg *Message) error {
+    if strings.TrimSpace(msg.Content) == "" && len(msg.Embeds) == 0 && len(msg.Attachments) == 0 {
+        return ErrEmptyContent
+    }
+    if len(msg.Content) > MaxContentLength {
+        return ErrContentTooLong
+    }
+    if msg.Format != "" && msg.Format != FormatPlain && msg.Format != FormatMarkdown {
+        return fmt.Errorf("unknown format %q", msg.Format)
+    }
+    if len(msg.DisplayName) > MaxDisplayName {
+        return fmt.Errorf("display name is too long (max %d bytes)", MaxDisplayName)
+    }
+    if len(msg.Embeds) > MaxEmbeds {
+        return fmt.Errorf("too many attachments (max %d)", MaxEmbeds)
+    }
+    for i, e := range msg.Embeds {
+        if err := e.Validate(); err != nil {
+            return fmt.Errorf("attachment %d: %w", i, err)
+        }
+    }
+    if len(msg.Attachments) > MaxAttachments {
+        return fmt.Errorf("too many files (max %d)", MaxAttachments)
+    }
+    seen := make(map[string]bool, len(msg.Attachments))
+    for _, a := range msg.Attachments {
+        if a.ID == "" || seen[a.ID] {
+            return errors.New("file references must be unique and non-empty")
+        }
+        seen[a.ID] = true
+    }
+    return nil
+}
+
+// Validate проверяет одно вложение-карточку
+func (e Embed) Validate() error {
+    if e.Title == "" && e.Text == "" {
+        return errors.New("title or text is required")
+    }
+    if len(e.Title)+len(e.Text)+len(e.Footer) > MaxEmbedText {
+        return fmt.Errorf("attachment is too long (max %d characters)", MaxEmbedText)
+    }
+    if e.TitleLink != "" {
+        u, err := url.Parse(e.TitleLink)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return errors.New("title_link must be an absolute http(s) URL")
+        }
+    }
+    if e.Color != "" && !isEmbedColor(e.Color) {
+        return errors.New("color must be good, warning, danger or #rrggbb")
+    }
+    return nil
+}
+
+func isEmbedColor(color string) bool {
+    switch color {
+    case "good", "warning", "danger":
+        return true
+    }
+    if len(color) != 7 || color[0] != '#' {
+        return false
+    }
+    for _, c := range color[1:] {
+        if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+            return false
+        }
+    }
+    return true
+}
+
 type User struct {
     Username string `json:"username"`
     RoomID   string `json:"room_id"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestValidateChatMessage(t *testing.T) {
+    tests := []struct {
+        name    string
+        msg     Message
+        wantErr bool
+    }{
+        {"обычный текст", Message{Content: "привет"}, false},
+        {"пустое сообщение", Message{Content: "   "}, true},
+        {"слишком длинное", Message{Content: strings.Repeat("a", MaxContentLength+1)}, true},
+        {"только вложение", Message{Embeds: []Embed{{Title: "Build #42", Color: "good"}}}, false},
+        {"вложение без текста", Message{Content: "x", Embeds: []Embed{{Color: "good"}}}, true},
+        {"ссылка не http", Message{Content: "x", Embeds: []Embed{{Title: "t", TitleLink: "javascript:alert(1)"}}}, true},
+        {"hex цвет", Message{Content: "x", Embeds: []Embed{{Text: "t", Color: "#FF00aa"}}}, false},
+        {"неверный цвет", Message{Content: "x", Embeds: []Embed{{Text: "t", Color: "red"}}}, true},
+        {"только файл", Message{Attachments: []Attachment{{ID: "a1"}}}, false},
+        {"повтор файла", Message{Attachments: []Attachment{{ID: "a1"}, {ID: "a1"}}}, true},
+        {"markdown", Message{Content: "**x**", Format: FormatMarkdown}, false},
+        {"неизвестный формат", Message{Content: "x", Format: "html"}, true},
+        {"файл без ID", Message{Content: "x", Attachments: []Attachment{{Filename: "a.png"}}}, true},
+        {"подпись вебхука", Message{Content: "x", DisplayName: "CI"}, false},
+        {"слишком длинная подпись", Message{Content: "x", DisplayName: strings.Repeat("a", MaxDisplayName+1)}, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := ValidateChatMessage(&tt.msg)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("ValidateChatMessage() ошибка = %v, ожидалась ошибка: %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateSignaling(t *testing.T) {
+    mid, index := "0", uint16(0)
+    sdp := "v=0\r\no=- 1 2 IN IP4 127.0.0.1\r\ns=-\r\n"
+    candidate := "candidate:1 1 udp 2122260223 192.168.1.2 54321 typ host"
+    signal := func(msgType string, data *WebRTCData) Message {
+        return Message{Type: msgType, Username: "alice", TargetUser: "bob", WebRTCData: data}
+    }
+
+    tests := []struct {
+        name    string
+        msg     Message
+        wantErr bool
+    }{
+        {"offer", signal(MessageTypeWebRTCOffer, &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: sdp}}), false},
+        {"answer", signal(MessageTypeWebRTCAnswer, &WebRTCData{Answer: &SessionDescription{Type: "answer", SDP: sdp}}), false},
+        {"кандидат", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{Candidate: candidate, SDPMid: &mid, SDPMLineIndex: &index}}), false},
+        {"конец кандидатов", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{}}), false},
+        {"без адресата", Message{Type: MessageTypeWebRTCOffer, Username: "alice", WebRTCData: &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: sdp}}}, true},
+        {"самому себе", Message{Type: MessageTypeWebRTCOffer, Username: "alice", TargetUser: "alice", WebRTCData: &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: sdp}}}, true},
+        {"без данных", signal(MessageTypeWebRTCOffer, nil), true},
+        {"answer в кадре offer", signal(MessageTypeWebRTCOffer, &WebRTCData{Answer: &SessionDescription{Type: "answer", SDP: sdp}}), true},
+        {"offer вместе с кандидатом", signal(MessageTypeWebRTCOffer, &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: sdp}, Candidate: &ICECandidate{}}), true},
+        {"тип описания не совпадает", signal(MessageTypeWebRTCAnswer, &WebRTCData{Answer: &SessionDescription{Type: "offer", SDP: sdp}}), true},
+        {"не SDP", signal(MessageTypeWebRTCOffer, &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: "<script>"}}), true},
+        {"слишком длинный SDP", signal(MessageTypeWebRTCOffer, &WebRTCData{Offer: &SessionDescription{Type: "offer", SDP: sdp + strings.Repeat("a", MaxSDPLength)}}), true},
+        {"кандидат без sdpMid", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{Candidate: candidate}}), true},
+        {"не кандидат", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{Candidate: "a=fingerprint", SDPMid: &mid}}), true},
+        {"перевод строки в кандидате", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{Candidate: candidate + "\r\na=x", SDPMid: &mid}}), true},
+        {"слишком длинный кандидат", signal(MessageTypeWebRTCCandidate, &WebRTCData{Candidate: &ICECandidate{Candidate: candidate + strings.Repeat(" x", MaxCandidateLength), SDPMid: &mid}}), true},
+        {"не сигнализация", signal(MessageTypeChat, &WebRTCData{}), true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := ValidateSignaling(&tt.msg)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("ValidateSignaling() ошибка = %v, ожидалась ошибка: %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateCallStats(t *testing.T) {
+    report := func(modify func(s *CallStats)) Message {
+        s := &CallStats{Peer: "bob", RTT: 42, PacketLoss: 0.01, Jitter: 3.5, BitrateIn: 800000, BitrateOut: 1200000, CandidateType: CandidateRelay}
+        if modify != nil {
+            modify(s)
+        }
+        return Message{Type: MessageTypeCallStats, Username: "alice", Stats: s}
+    }
+
+    tests := []struct {
+        name    string
+        msg     Message
+        wantErr bool
+    }{
+        {"отчет", report(nil), false},
+        {"через SFU напрямую", report(func(s *CallStats) { s.Peer, s.CandidateType = "sfu", CandidateHost }), false},
+        {"без отчета", Message{Type: MessageTypeCallStats, Username: "alice"}, true},
+        {"без собеседника", report(func(s *CallStats) { s.Peer = "" }), true},
+        {"слишком длинное имя собеседника", report(func(s *CallStats) { s.Peer = strings.Repeat("b", MaxUsername+1) }), true},
+        {"о себе", report(func(s *CallStats) { s.Peer = "alice" }), true},
+        {"потери больше 100%", report(func(s *CallStats) { s.PacketLoss = 1.5 }), true},
+        {"отрицательный RTT", report(func(s *CallStats) { s.RTT = -1 }), true},
+        {"огромный битрейт", report(func(s *CallStats) { s.BitrateIn = MaxStatsBitrate * 2 }), true},
+        {"неизвестный тип кандидата", report(func(s *CallStats) { s.CandidateType = "tcp" }), true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := ValidateCallStats(&tt.msg)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("ValidateCallStats() ошибка = %v, ожидалась ошибка: %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateMeeting(t *testing.T) {
+    now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+    meeting := func(modify func(m *Meeting)) Meeting {
+        m := Meeting{Title: " Планерка ", Organizer: "alice", StartsAt: now.Add(time.Hour), Duration: 1800,
+            Invitees: []string{"bob", " carol", "bob", "alice", ""}}
+        if modify != nil {
+            modify(&m)
+        }
+        return m
+    }
+
+    m := meeting(nil)
+    if err := ValidateMeeting(&m, now); err != nil {
+        t.Fatalf("ValidateMeeting: %v", err)
+    }
+    if m.Title != "Планерка" || strings.Join(m.Invitees, ",") != "bob,carol" {
+        t.Errorf("название %q, приглашенные %v", m.Title, m.Invitees)
+    }
+    if !m.EndsAt().Equal(now.Add(90*time.Minute)) || !m.Invited("alice") || !m.Invited("carol") || m.Invited("dave") {
+        t.Errorf("EndsAt или Invited: %+v", m)
+    }
+
+    many := make([]string, MaxMeetingInvitees+1)
+    for i := range many {
+        many[i] = fmt.Sprintf("user%d", i)
+    }
+    tests := []struct {
+        name string
+        m    Meeting
+        want error
+    }{
+        {"без названия", meeting(func(m *Meeting) { m.Title = "  " }), ErrMeetingTitle},
+        {"в прошлом", meeting(func(m *Meeting) { m.StartsAt = now.Add(-time.Minute) }), ErrMeetingInPast},
+        {"слишком короткая", meeting(func(m *Meeting) { m.Duration = 60 }), ErrMeetingDuration},
+        {"слишком длинная", meeting(func(m *Meeting) { m.Duration = 25 * 3600 }), ErrMeetingDuration},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := ValidateMeeting(&tt.m, now); err != tt.want {
+                t.Errorf("ожидали %v, получили %v", tt.want, err)
+            }
+        })
+    }
+    crowded := meeting(func(m *Meeting) { m.Invitees = many })
+    if err := ValidateMeeting(&crowded, now); err == nil {
+        t.Error("слишком много приглашенных")
+    }
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// Ограничения на сигнализацию WebRTC. Описание сессии с несколькими кодеками и
+// simulcast занимает единицы килобайт, кандидат ICE - пару сотен байт
+const (
+    MaxSDPLength       = 16 << 10
+    MaxCandidateLength = 512
+    MaxSDPMidLength    = 64
+)
+
+// Ограничения на отчет call_stats: значения за пределами - ошибка измерения или подделка
+const (
+    MaxStatsRTT     = 60000 // мс
+    MaxStatsJitter  = 60000 // мс
+    MaxStatsBitrate = 1e9   // бит/с
+)
+
+// Типы кандидата ICE выбранной пары (RTCIceCandidateType). relay - через TURN, остальные - напрямую
+const (
+    CandidateHost  = "host"
+    CandidateSrflx = "srflx"
+    CandidatePrflx = "prflx"
+    CandidateRelay = "relay"
+)
+
+var (
+    ErrNoSignalingTarget = errors.New("target_user is required")
+    ErrSignalingSelf     = errors.New("cannot signal yourself")
+    ErrBadWebRTCData     = errors.New("webrtc_data does not match the message type")
+    ErrNoStats           = errors.New("stats are required")
+)
+
+// WebRTCData - содержимое webrtc_data. Заполнено ровно одно поле: offer для webrtc_offer,
+// answer для webrtc_answer, candidate для webrtc_candidate
+type WebRTCData struct {
+    Offer     *SessionDescription `json:"offer,omitempty"`
+    Answer    *SessionDescription `json:"answer,omitempty"`
+    Candidate *ICECandidate       `json:"candidate,omitempty"`
+}
+
+// SessionDescription - SDP в том виде, в котором его сериализует RTCSessionDescription
+type SessionDescription struct {
+    Type string `json:"type"`
+    SDP  string `json:"sdp"`
+}
+
+// ICECandidate - кандидат ICE в виде RTCIceCandidateInit. Пустой Candidate означает
+// конец кандидатов
+type ICECandidate struct {
+    Candidate        string  `json:"candidate"`
+    SDPMid           *string `json:"sdpMid,omitempty"`
+    SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+    UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// ValidateSignaling проверяет кадр webrtc_offer, webrtc_answer или webrtc_candidate
+// от участника перед пересылкой адресату
+func ValidateSignaling(msg *Message) error {
+    if msg.TargetUser == "" {
+        return ErrNoSignalingTarget
+    }
+    if msg.TargetUser == msg.Username {
+        return ErrSignalingSelf
+    }
+    d := msg.WebRTCData
+    if d == nil {
+        return ErrBadWebRTCData
+    }
+
+    switch msg.Type {
+    case MessageTypeWebRTCOffer:
+        if d.Answer != nil || d.Candidate != nil {
+            return ErrBadWebRTCData
+        }
+        return d.Offer.validate("offer")
+    case MessageTypeWebRTCAnswer:
+        if d.Offer != nil || d.Candidate != nil {
+            return ErrBadWebRTCData
+        }
+        return d.Answer.validate("answer")
+    case MessageTypeWebRTCCandidate:
+        if d.Offer != nil || d.Answer != nil || d.Candidate == nil {
+            return ErrBadWebRTCData
+        }
+        return d.Candidate.validate()
+    }
+    return fmt.Errorf("unknown signaling type %q", msg.Type)
+}
+
+// CallStats - сводка getStats одного соединения участника за период между отчетами.
+// Клиент присылает ее в кадре call_stats; CallID, Username и ReportedAt заполняет сервер
+type CallStats struct {
+    CallID        string    `json:"call_id,omitempty"`
+    Username      string    `json:"username,omitempty"`
+    Peer          string    `json:"peer"`           // Собеседник или sfu
+    RTT           float64   `json:"rtt_ms"`         // currentRoundTripTime выбранной пары кандидатов
+    PacketLoss    float64   `json:"packet_loss"`    // Доля потерянных входящих пакетов за период, от 0 до 1
+    Jitter        float64   `json:"jitter_ms"`      // Наибольший jitter входящих дорожек
+    BitrateIn     float64   `json:"bitrate_in"`     // бит/с
+    BitrateOut    float64   `json:"bitrate_out"`    // бит/с
+    CandidateType string    `json:"candidate_type"` // Тип локального кандидата выбранной пары
+    ReportedAt    time.Time `json:"reported_at,omitempty"`
+}
+
+// Relayed сообщает, идет ли соединение через TURN
+func (s CallStats) Relayed() bool {
+    return s.CandidateType == CandidateRelay
+}
+
+// ValidateCallStats проверяет отчет call_stats от участника
+func ValidateCallStats(msg *Message) error {
+    s := msg.Stats
+    if s == nil {
+        return ErrNoStats
+    }
+    if s.Peer == "" {
+        return errors.New("peer is required")
+    }
+    if len(s.Peer) > MaxUsername {
+        return fmt.Errorf("peer is too long (max %d bytes)", MaxUsername)
+    }
+    if s.Peer == msg.Username {
+        return ErrSignalingSelf
+    }
+    for _, v := range []struct {
+        name  string
+        value float64
+        max   float64
+    }{
+        {"rtt_ms", s.RTT, MaxStatsRTT},
+        {"packet_loss", s.PacketLoss, 1},
+        {"jitter_ms", s.Jitter, MaxStatsJitter},
+        {"bitrate_in", s.BitrateIn, MaxStatsBitrate},
+        {"bitrate_out", s.BitrateOut, MaxStatsBitrate},
+    } {
+        if v.value < 0 || v.value > v.max {
+            return fmt.Errorf("%s must be between 0 and %g", v.name, v.max)
+        }
+    }
+    switch s.CandidateType {
+    case CandidateHost, CandidateSrflx, CandidatePrflx, CandidateRelay:
+    default:
+        return fmt.Errorf("unknown candidate_type %q", s.CandidateType)
+    }
+    return nil
+}
+
+func (s *SessionDescription) validate(sdpType string) error {
+    if s == nil || s.Type != sdpType {
+        return ErrBadWebRTCData
+    }
+    if len(s.SDP) > MaxSDPLength {
+        return fmt.Errorf("%s is too long (max %d bytes)", sdpType, MaxSDPLength)
+    }
+    if !strings.HasPrefix(s.SDP, "v=0") || !utf8.ValidString(s.SDP) {
+        return fmt.Errorf("%s is not a session description", sdpType)
+    }
+    return nil
+}
+
+func (c *ICECandidate) validate() error {
+    if len(c.Candidate) > MaxCandidateLength {
+        return fmt.Errorf("candidate is too long (max %d bytes)", MaxCandidateLength)
+    }
+    if c.SDPMid != nil && len(*c.SDPMid) > MaxSDPMidLength {
+        return fmt.Errorf("sdpMid is too long (max %d bytes)", MaxSDPMidLength)
+    }
+    if c.UsernameFragment != nil && len(*c.UsernameFragment) > MaxSDPMidLength {
+        return fmt.Errorf("usernameFragment is too long (max %d bytes)", MaxSDPMidLength)
+    }
+    if c.Candidate == "" {
+        return nil
+    }
+    if !strings.HasPrefix(c.Candidate, "candidate:") || strings.ContainsAny(c.Candidate, "\r\n") || !utf8.ValidString(c.Candidate) {
+        return errors.New("candidate must be an a=candidate attribute value")
+    }
+    if c.SDPMid == nil && c.SDPMLineIndex == nil {
+        return errors.New("candidate needs sdpMid or sdpMLineIndex")
+    }
+    return nil
+}
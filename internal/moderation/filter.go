@@ -0,0 +1,124 @@
+package moderation
+
+import (
+    "context"
+    "log/slog"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/storage"
+)
+
+var moderationLogger = slog.With("component", "moderation")
+
+var actionsTotal = metrics.NewCounter("thoth_moderation_actions_total",
+    "Messages redacted, rejected or shadow-muted by content filters", "filter", "action")
+
+// Решения фильтров
+const (
+    ActionAllow      = "allow"
+    ActionRedact     = "redact"      // Сообщение проходит с исправленным текстом
+    ActionReject     = "reject"      // Автор получает ошибку, сообщение не сохраняется
+    ActionShadowMute = "shadow_mute" // Автор видит свое сообщение, остальные - нет, в БД оно не попадает
+)
+
+// Message - то, что видят фильтры
+type Message struct {
+    Username string
+    RoomID   string
+    Content  string
+}
+
+// Verdict - решение фильтра. Для ActionRedact Content содержит исправленный текст
+type Verdict struct {
+    Action  string
+    Content string
+    Reason  string // Причина для автора и модераторов
+    Filter  string // Имя сработавшего фильтра, заполняет Chain
+}
+
+// Allow - решение "пропустить без изменений"
+var Allow = Verdict{Action: ActionAllow}
+
+// Filter - звено цепочки. Check вызывается для каждого сообщения из разных горутин
+// и должен быть потокобезопасным
+type Filter interface {
+    Name() string
+    Check(ctx context.Context, msg Message) Verdict
+}
+
+// Func превращает функцию в Filter - для своих проверок без отдельного типа
+func Func(name string, check func(ctx context.Context, msg Message) Verdict) Filter {
+    return funcFilter{name: name, check: check}
+}
+
+type funcFilter struct {
+    name  string
+    check func(ctx context.Context, msg Message) Verdict
+}
+
+func (f funcFilter) Name() string                                   { return f.name }
+func (f funcFilter) Check(ctx context.Context, msg Message) Verdict { return f.check(ctx, msg) }
+
+// Store - журнал решений для модераторов. Реализуется *storage.Storage
+type Store interface {
+    SaveModerationEvent(ctx context.Context, e storage.ModerationEvent) error
+}
+
+// Chain прогоняет сообщение через фильтры по порядку до сохранения и рассылки.
+// redact передает следующим фильтрам уже исправленный текст, reject и shadow_mute
+// останавливают цепочку. Все решения кроме allow пишутся в лог и журнал
+type Chain struct {
+    Filters []Filter
+    store   Store
+}
+
+// NewChain создает цепочку. store может быть nil - тогда решения только логируются
+func NewChain(store Store, filters ...Filter) *Chain {
+    return &Chain{Filters: filters, store: store}
+}
+
+// NewDefaultChain - встроенные фильтры: повторы, ссылки, затем словарь words
+func NewDefaultChain(store Store, words *Wordlist) *Chain {
+    return NewChain(store, NewRepeatFilter(), NewLinkFloodFilter(), NewWordlistFilter(words))
+}
+
+// Check возвращает итоговое решение. Для allow и redact Content - текст для публикации
+func (c *Chain) Check(ctx context.Context, msg Message) Verdict {
+    original := msg
+    result := Verdict{Action: ActionAllow, Content: msg.Content}
+    for _, f := range c.Filters {
+        v := f.Check(ctx, msg)
+        v.Filter = f.Name()
+        switch v.Action {
+        case ActionRedact:
+            c.record(ctx, original, v)
+            msg.Content = v.Content
+            result = v
+        case ActionReject, ActionShadowMute:
+            c.record(ctx, original, v)
+            return v
+        }
+    }
+    return result
+}
+
+// record сохраняет исходный текст сообщения, чтобы модератор видел, что именно сработало
+func (c *Chain) record(ctx context.Context, msg Message, v Verdict) {
+    actionsTotal.Inc(v.Filter, v.Action)
+    moderationLogger.Info("Message filtered", "filter", v.Filter, "action", v.Action, "reason", v.Reason,
+        "username", msg.Username, "room", msg.RoomID)
+
+    if c.store == nil {
+        return
+    }
+    if err := c.store.SaveModerationEvent(ctx, storage.ModerationEvent{
+        RoomID:   msg.RoomID,
+        Username: msg.Username,
+        Filter:   v.Filter,
+        Action:   v.Action,
+        Reason:   v.Reason,
+        Content:  msg.Content,
+    }); err != nil {
+        moderationLogger.Error("Failed to save moderation event", "filter", v.Filter, "username", msg.Username, "error", err)
+    }
+}
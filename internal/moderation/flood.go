@@ -0,0 +1,156 @@
+package moderation
+
+import (
+    "context"
+    "hash/fnv"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+)
+
+// sweepInterval - как часто забывать пользователей без свежей истории
+const sweepInterval = time.Minute
+
+// history - недавние события по пользователям с периодической очисткой
+type history struct {
+    mu        sync.Mutex
+    events    map[string][]event
+    lastSweep time.Time
+}
+
+type event struct {
+    at  time.Time
+    key uint64
+    n   int
+}
+
+// add отбрасывает события старше window, добавляет новое и возвращает историю пользователя
+func (h *history) add(user string, e event, window time.Duration) []event {
+    if h.events == nil {
+        h.events = make(map[string][]event)
+    }
+    if e.at.Sub(h.lastSweep) > sweepInterval {
+        for u, events := range h.events {
+            if len(events) == 0 || e.at.Sub(events[len(events)-1].at) > window {
+                delete(h.events, u)
+            }
+        }
+        h.lastSweep = e.at
+    }
+
+    events := h.events[user]
+    i := 0
+    for i < len(events) && e.at.Sub(events[i].at) > window {
+        i++
+    }
+    events = append(events[i:], e)
+    if len(events) > maxHistory {
+        events = events[len(events)-maxHistory:]
+    }
+    h.events[user] = events
+    return events
+}
+
+// maxHistory - сколько последних сообщений пользователя помнить
+const maxHistory = 50
+
+// RepeatFilter отклоняет сообщение, если пользователь уже отправил тот же текст
+// MaxRepeats раз за Window (в любых комнатах). Регистр и пробелы не учитываются
+type RepeatFilter struct {
+    MaxRepeats int
+    Window     time.Duration
+
+    history history
+    now     func() time.Time
+}
+
+func NewRepeatFilter() *RepeatFilter {
+    return &RepeatFilter{MaxRepeats: 3, Window: time.Minute, now: time.Now}
+}
+
+func (f *RepeatFilter) Name() string { return "repeat" }
+
+func (f *RepeatFilter) Check(ctx context.Context, msg Message) Verdict {
+    text := strings.Join(strings.Fields(strings.ToLower(msg.Content)), " ")
+    if text == "" {
+        return Allow
+    }
+    h := fnv.New64a()
+    h.Write([]byte(text))
+    key := h.Sum64()
+
+    f.history.mu.Lock()
+    events := f.history.add(msg.Username, event{at: f.now(), key: key}, f.Window)
+    f.history.mu.Unlock()
+
+    same := 0
+    for _, e := range events {
+        if e.key == key {
+            same++
+        }
+    }
+    if same > f.MaxRepeats {
+        return Verdict{Action: ActionReject, Reason: "repeated message, please do not flood"}
+    }
+    return Allow
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+
+// LinkFloodFilter ограничивает ссылки: больше MaxPerMessage в одном сообщении - reject,
+// больше MaxPerWindow за Window от одного пользователя - shadow_mute на MuteFor
+type LinkFloodFilter struct {
+    MaxPerMessage int
+    MaxPerWindow  int
+    Window        time.Duration
+    MuteFor       time.Duration
+
+    history history
+    muted   map[string]time.Time // Под shadow_mute до указанного времени; под history.mu
+    now     func() time.Time
+}
+
+func NewLinkFloodFilter() *LinkFloodFilter {
+    return &LinkFloodFilter{
+        MaxPerMessage: 5,
+        MaxPerWindow:  10,
+        Window:        time.Minute,
+        MuteFor:       10 * time.Minute,
+        muted:         make(map[string]time.Time),
+        now:           time.Now,
+    }
+}
+
+func (f *LinkFloodFilter) Name() string { return "links" }
+
+func (f *LinkFloodFilter) Check(ctx context.Context, msg Message) Verdict {
+    now := f.now()
+    f.history.mu.Lock()
+    defer f.history.mu.Unlock()
+
+    if until, ok := f.muted[msg.Username]; ok {
+        if now.Before(until) {
+            return Verdict{Action: ActionShadowMute, Reason: "muted for link flooding"}
+        }
+        delete(f.muted, msg.Username)
+    }
+
+    links := len(linkPattern.FindAllStringIndex(msg.Content, -1))
+    if links == 0 {
+        return Allow
+    }
+    if links > f.MaxPerMessage {
+        return Verdict{Action: ActionReject, Reason: "too many links in one message"}
+    }
+
+    total := 0
+    for _, e := range f.history.add(msg.Username, event{at: now, n: links}, f.Window) {
+        total += e.n
+    }
+    if total > f.MaxPerWindow {
+        f.muted[msg.Username] = now.Add(f.MuteFor)
+        return Verdict{Action: ActionShadowMute, Reason: "link flooding"}
+    }
+    return Allow
+}
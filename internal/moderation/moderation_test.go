@@ -0,0 +1,153 @@
+package moderation
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    "Thoth/internal/storage"
+)
+
+type fakeStore struct {
+    events []storage.ModerationEvent
+}
+
+func (f *fakeStore) SaveModerationEvent(ctx context.Context, e storage.ModerationEvent) error {
+    f.events = append(f.events, e)
+    return nil
+}
+
+// clock - управляемые часы для тестов
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestWordlistRedacts(t *testing.T) {
+    f := NewWordlistFilter(DefaultWordlist())
+    cases := map[string]string{
+        "Ну ты и МУДАК!":             "Ну ты и *****!",
+        "заЁбанный день, fucking bug": "********* день, ******* bug",
+        "классный мандарин, shitake?": "", // Части слов и похожие слова не трогаем
+    }
+    for in, want := range cases {
+        v := f.Check(context.Background(), Message{Content: in})
+        if want == "" {
+            if v.Action != ActionAllow {
+                t.Errorf("%q: %s, ожидался allow", in, v.Action)
+            }
+            continue
+        }
+        if v.Action != ActionRedact || v.Content != want {
+            t.Errorf("%q: %s %q, ожидалось %q", in, v.Action, v.Content, want)
+        }
+    }
+
+    f.Action = ActionReject
+    if v := f.Check(context.Background(), Message{Content: "бля"}); v.Action != ActionReject {
+        t.Errorf("Action = reject: получено %s", v.Action)
+    }
+}
+
+func TestWordlistLoad(t *testing.T) {
+    w := NewWordlist()
+    if err := w.Load(strings.NewReader("# свои слова\n\nкриптоскам*\nspam\n")); err != nil {
+        t.Fatal(err)
+    }
+    if w.Len() != 2 || !w.Match("Криптоскамеры") || !w.Match("SPAM") || w.Match("spammer") {
+        t.Errorf("словарь разобран неверно: %+v", w)
+    }
+}
+
+func TestRepeatFilter(t *testing.T) {
+    c := &clock{t: time.Unix(1700000000, 0)}
+    f := NewRepeatFilter()
+    f.now = c.now
+    ctx := context.Background()
+
+    for i := 0; i < 3; i++ {
+        if v := f.Check(ctx, Message{Username: "alice", Content: "Купите  слона"}); v.Action != ActionAllow {
+            t.Fatalf("повтор %d отклонен раньше времени", i+1)
+        }
+    }
+    if v := f.Check(ctx, Message{Username: "alice", Content: "купите слона"}); v.Action != ActionReject {
+        t.Errorf("четвертый повтор: %s, ожидался reject", v.Action)
+    }
+    if v := f.Check(ctx, Message{Username: "bob", Content: "купите слона"}); v.Action != ActionAllow {
+        t.Errorf("повторы alice затронули bob: %s", v.Action)
+    }
+
+    c.advance(2 * f.Window)
+    if v := f.Check(ctx, Message{Username: "alice", Content: "купите слона"}); v.Action != ActionAllow {
+        t.Errorf("после окна: %s, ожидался allow", v.Action)
+    }
+}
+
+func TestLinkFloodFilter(t *testing.T) {
+    c := &clock{t: time.Unix(1700000000, 0)}
+    f := NewLinkFloodFilter()
+    f.now = c.now
+    ctx := context.Background()
+
+    many := strings.Repeat("https://spam.example/x ", f.MaxPerMessage+1)
+    if v := f.Check(ctx, Message{Username: "alice", Content: many}); v.Action != ActionReject {
+        t.Errorf("%d ссылок в сообщении: %s, ожидался reject", f.MaxPerMessage+1, v.Action)
+    }
+
+    three := "www.a.example http://b.example https://c.example"
+    for i := 0; i < 3; i++ {
+        if v := f.Check(ctx, Message{Username: "bob", Content: three}); v.Action != ActionAllow {
+            t.Fatalf("сообщение %d: %s", i+1, v.Action)
+        }
+    }
+    if v := f.Check(ctx, Message{Username: "bob", Content: three}); v.Action != ActionShadowMute {
+        t.Fatalf("12 ссылок за минуту: %s, ожидался shadow_mute", v.Action)
+    }
+    if v := f.Check(ctx, Message{Username: "bob", Content: "привет"}); v.Action != ActionShadowMute {
+        t.Errorf("во время мьюта: %s", v.Action)
+    }
+    c.advance(f.MuteFor + time.Second)
+    if v := f.Check(ctx, Message{Username: "bob", Content: "привет"}); v.Action != ActionAllow {
+        t.Errorf("после мьюта: %s", v.Action)
+    }
+}
+
+func TestChainOrderAndJournal(t *testing.T) {
+    store := &fakeStore{}
+    var seen []string
+    spy := Func("spy", func(ctx context.Context, msg Message) Verdict {
+        seen = append(seen, msg.Content)
+        if strings.Contains(msg.Content, "казино") {
+            return Verdict{Action: ActionReject, Reason: "casino"}
+        }
+        return Allow
+    })
+    chain := NewChain(store, NewWordlistFilter(DefaultWordlist()), spy)
+    ctx := context.Background()
+
+    if v := chain.Check(ctx, Message{Username: "alice", RoomID: "general", Content: "привет"}); v.Action != ActionAllow || v.Content != "привет" {
+        t.Errorf("чистое сообщение: %+v", v)
+    }
+
+    v := chain.Check(ctx, Message{Username: "alice", RoomID: "general", Content: "сука, опять"})
+    if v.Action != ActionRedact || v.Content != "****, опять" || v.Filter != "wordlist" {
+        t.Errorf("redact: %+v", v)
+    }
+    if seen[len(seen)-1] != "****, опять" {
+        t.Errorf("следующий фильтр получил %q вместо исправленного текста", seen[len(seen)-1])
+    }
+
+    v = chain.Check(ctx, Message{Username: "bob", RoomID: "dev", Content: "бля, казино"})
+    if v.Action != ActionReject || v.Filter != "spy" || v.Reason != "casino" {
+        t.Errorf("reject: %+v", v)
+    }
+
+    if len(store.events) != 3 {
+        t.Fatalf("в журнале %d записей, ожидалось 3 (allow не пишется)", len(store.events))
+    }
+    last := store.events[2]
+    if last.Action != ActionReject || last.Username != "bob" || last.RoomID != "dev" || last.Content != "бля, казино" {
+        t.Errorf("запись журнала: %+v", last)
+    }
+}
@@ -0,0 +1,163 @@
+package moderation
+
+import (
+    "bufio"
+    "context"
+    "embed"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "unicode"
+)
+
+//go:embed wordlists/*.txt
+var builtinWordlists embed.FS
+
+// Wordlist - набор запрещенных слов: точные слова и префиксы (запись "слово*").
+// Сравнение без учета регистра, ё считается за е
+type Wordlist struct {
+    words    map[string]bool
+    prefixes []string
+}
+
+func NewWordlist() *Wordlist {
+    return &Wordlist{words: make(map[string]bool)}
+}
+
+// DefaultWordlist - встроенные русский и английский списки
+func DefaultWordlist() *Wordlist {
+    w := NewWordlist()
+    for _, name := range []string{"wordlists/ru.txt", "wordlists/en.txt"} {
+        f, err := builtinWordlists.Open(name)
+        if err != nil {
+            panic(err)
+        }
+        if err := w.Load(f); err != nil {
+            panic(err)
+        }
+        f.Close()
+    }
+    return w
+}
+
+// LoadWordlist - встроенные списки плюс слова из файла path, если он задан
+func LoadWordlist(path string) (*Wordlist, error) {
+    w := DefaultWordlist()
+    if path == "" {
+        return w, nil
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    if err := w.Load(f); err != nil {
+        return nil, fmt.Errorf("read %s: %w", path, err)
+    }
+    return w, nil
+}
+
+// Load добавляет слова по одному на строку. Пустые строки и строки с # пропускаются
+func (w *Wordlist) Load(r io.Reader) error {
+    sc := bufio.NewScanner(r)
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        w.Add(line)
+    }
+    return sc.Err()
+}
+
+func (w *Wordlist) Add(entry string) {
+    if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+        if prefix = normalizeWord(prefix); prefix != "" {
+            w.prefixes = append(w.prefixes, prefix)
+        }
+        return
+    }
+    if word := normalizeWord(entry); word != "" {
+        w.words[word] = true
+    }
+}
+
+// Len - число записей в списке
+func (w *Wordlist) Len() int {
+    return len(w.words) + len(w.prefixes)
+}
+
+// Match сообщает, запрещено ли слово
+func (w *Wordlist) Match(word string) bool {
+    word = normalizeWord(word)
+    if w.words[word] {
+        return true
+    }
+    for _, p := range w.prefixes {
+        if strings.HasPrefix(word, p) {
+            return true
+        }
+    }
+    return false
+}
+
+func normalizeWord(s string) string {
+    return strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+}
+
+// WordlistFilter заменяет запрещенные слова звездочками (или отклоняет сообщение,
+// если Action = ActionReject). Слово - непрерывная последовательность букв и цифр,
+// поэтому "классный" не совпадает с "ass"
+type WordlistFilter struct {
+    Words  *Wordlist
+    Action string // ActionRedact или ActionReject
+}
+
+func NewWordlistFilter(words *Wordlist) *WordlistFilter {
+    return &WordlistFilter{Words: words, Action: ActionRedact}
+}
+
+func (f *WordlistFilter) Name() string { return "wordlist" }
+
+func (f *WordlistFilter) Check(ctx context.Context, msg Message) Verdict {
+    var b strings.Builder
+    found := 0
+    rest := msg.Content
+    for rest != "" {
+        // Разделители копируются как есть
+        i := strings.IndexFunc(rest, isWordRune)
+        if i < 0 {
+            b.WriteString(rest)
+            break
+        }
+        b.WriteString(rest[:i])
+        rest = rest[i:]
+
+        end := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+        if end < 0 {
+            end = len(rest)
+        }
+        word := rest[:end]
+        rest = rest[end:]
+
+        if f.Words.Match(word) {
+            found++
+            b.WriteString(strings.Repeat("*", len([]rune(word))))
+        } else {
+            b.WriteString(word)
+        }
+    }
+
+    if found == 0 {
+        return Allow
+    }
+    if f.Action == ActionReject {
+        return Verdict{Action: ActionReject, Reason: "message contains prohibited words"}
+    }
+    return Verdict{Action: ActionRedact, Content: b.String(), Reason: "prohibited words redacted"}
+}
+
+func isWordRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/tls"
+    "encoding/hex"
+    "fmt"
+    "mime"
+    "mime/quotedprintable"
+    "net"
+    "net/smtp"
+    "strings"
+    "time"
+)
+
+// Email - одно письмо в виде простого текста
+type Email struct {
+    To      string
+    Subject string
+    Body    string
+    Headers map[string]string // Дополнительные заголовки, например List-Unsubscribe
+}
+
+// Mailer отправляет письма. Реализуется *SMTPMailer
+type Mailer interface {
+    Send(ctx context.Context, email Email) error
+}
+
+// SMTPMailer отправляет письма через SMTP-сервер. STARTTLS используется, если сервер его
+// поддерживает; пароль без TLS net/smtp передает только на localhost, поэтому для
+// разработки подходит локальная заглушка вроде MailHog
+type SMTPMailer struct {
+    Addr     string // host:port
+    From     string
+    Username string // Пустой - без авторизации
+    Password string
+    Timeout  time.Duration
+}
+
+func NewSMTPMailer(addr, from string) *SMTPMailer {
+    return &SMTPMailer{Addr: addr, From: from, Timeout: 30 * time.Second}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+    host, _, err := net.SplitHostPort(m.Addr)
+    if err != nil {
+        return fmt.Errorf("smtp address: %w", err)
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+    defer cancel()
+
+    conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.Addr)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+
+    c, err := smtp.NewClient(conn, host)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    if ok, _ := c.Extension("STARTTLS"); ok {
+        if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+            return fmt.Errorf("starttls: %w", err)
+        }
+    }
+    if m.Username != "" {
+        if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+            return fmt.Errorf("smtp auth: %w", err)
+        }
+    }
+
+    if err := c.Mail(m.From); err != nil {
+        return err
+    }
+    if err := c.Rcpt(email.To); err != nil {
+        return err
+    }
+    w, err := c.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(buildMessage(m.From, email, time.Now())); err != nil {
+        return err
+    }
+    if err := w.Close(); err != nil {
+        return err
+    }
+    return c.Quit()
+}
+
+// buildMessage собирает письмо в UTF-8 с телом в quoted-printable
+func buildMessage(from string, email Email, now time.Time) []byte {
+    var buf bytes.Buffer
+    header := func(name, value string) {
+        // Перевод строки в значении позволил бы дописать чужие заголовки
+        value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+        fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+    }
+
+    header("From", from)
+    header("To", email.To)
+    header("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+    header("Date", now.Format(time.RFC1123Z))
+    header("Message-ID", "<"+messageID()+"@thoth>")
+    for name, value := range email.Headers {
+        header(name, value)
+    }
+    header("MIME-Version", "1.0")
+    header("Content-Type", "text/plain; charset=utf-8")
+    header("Content-Transfer-Encoding", "quoted-printable")
+    buf.WriteString("\r\n")
+
+    qp := quotedprintable.NewWriter(&buf)
+    qp.Write([]byte(strings.ReplaceAll(email.Body, "\n", "\r\n")))
+    qp.Close()
+    return buf.Bytes()
+}
+
+func messageID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
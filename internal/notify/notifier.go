@@ -0,0 +1,176 @@
+package notify
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "net/url"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var notifyLogger = slog.With("component", "notify")
+
+var digestsTotal = metrics.NewCounter("thoth_notify_digests_total",
+    "Mention digests processed by the email notifier", "result")
+
+// Store - операции хранилища, которые нужны Notifier. Реализуется *storage.Storage
+type Store interface {
+    PendingMentionDigests(ctx context.Context, defaultDelay time.Duration, limit int) ([]storage.MentionDigest, error)
+    MarkMentionsNotified(ctx context.Context, ids []int64) error
+}
+
+// Presence сообщает, подключен ли пользователь к чату. Реализуется *websocket.Hub
+type Presence interface {
+    IsOnline(username string) bool
+}
+
+// Notifier периодически собирает непрочитанные упоминания и отправляет их пользователям
+// одним письмом-дайджестом, если те не в сети. Личных сообщений в чате пока нет,
+// поэтому дайджест состоит только из упоминаний
+type Notifier struct {
+    store    Store
+    mailer   Mailer
+    presence Presence
+    signer   *auth.Signer
+
+    PublicURL string        // Адрес чата для ссылок в письме
+    Interval  time.Duration // Период проверки
+    Delay     time.Duration // Задержка по умолчанию перед отправкой упоминания
+    BatchSize int           // Сколько пользователей обрабатывать за один проход
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+func NewNotifier(store Store, mailer Mailer, presence Presence, signer *auth.Signer) *Notifier {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &Notifier{
+        store:     store,
+        mailer:    mailer,
+        presence:  presence,
+        signer:    signer,
+        Interval:  time.Minute,
+        Delay:     15 * time.Minute,
+        BatchSize: 100,
+        ctx:       ctx,
+        cancel:    cancel,
+    }
+}
+
+// Run проверяет упоминания сразу и затем с периодом Interval до вызова Stop
+func (n *Notifier) Run() {
+    notifyLogger.Info("Email notifier is running", "interval", n.Interval, "delay", n.Delay)
+
+    ticker := time.NewTicker(n.Interval)
+    defer ticker.Stop()
+
+    for {
+        if err := n.RunOnce(n.ctx); err != nil && n.ctx.Err() == nil {
+            notifyLogger.Error("Notification run failed", "error", err)
+        }
+
+        select {
+        case <-n.ctx.Done():
+            notifyLogger.Info("Email notifier stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (n *Notifier) Stop() {
+    n.cancel()
+}
+
+// RunOnce отправляет созревшие дайджесты. Упоминания пользователя, который сейчас в сети,
+// отмечаются без письма: он уже получил их как уведомления в чате. Неудачная отправка
+// повторится на следующем проходе
+func (n *Notifier) RunOnce(ctx context.Context) error {
+    digests, err := n.store.PendingMentionDigests(ctx, n.Delay, n.BatchSize)
+    if err != nil {
+        return err
+    }
+
+    for _, d := range digests {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+
+        result := "sent"
+        if n.presence != nil && n.presence.IsOnline(d.Username) {
+            result = "skipped_online"
+        } else if err := n.send(ctx, d); err != nil {
+            notifyLogger.Error("Failed to send digest", "username", d.Username, "error", err)
+            digestsTotal.Inc("error")
+            continue
+        }
+        digestsTotal.Inc(result)
+
+        ids := make([]int64, len(d.Mentions))
+        for i, m := range d.Mentions {
+            ids[i] = m.ID
+        }
+        if err := n.store.MarkMentionsNotified(ctx, ids); err != nil {
+            return err
+        }
+        notifyLogger.Info("Digest processed", "username", d.Username, "mentions", len(ids), "result", result)
+    }
+    return nil
+}
+
+func (n *Notifier) send(ctx context.Context, d storage.MentionDigest) error {
+    token, err := n.signer.IssueUnsubscribeToken(d.Username)
+    if err != nil {
+        return err
+    }
+    unsubscribeURL := strings.TrimRight(n.PublicURL, "/") + "/unsubscribe?token=" + url.QueryEscape(token)
+
+    return n.mailer.Send(ctx, Email{
+        To:      d.Email,
+        Subject: fmt.Sprintf("Thoth: новые упоминания (%d)", len(d.Mentions)),
+        Body:    digestBody(d, n.PublicURL, unsubscribeURL),
+        Headers: map[string]string{
+            // RFC 8058: почтовый клиент может отписать пользователя одним POST-запросом
+            "List-Unsubscribe":      "<" + unsubscribeURL + ">",
+            "List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+        },
+    })
+}
+
+// maxQuoteRunes - сколько символов сообщения цитировать в письме
+const maxQuoteRunes = 300
+
+func digestBody(d storage.MentionDigest, chatURL, unsubscribeURL string) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Здравствуйте, %s!\n\n", d.Username)
+    fmt.Fprintf(&b, "Пока вас не было в чате, вас упомянули %d раз(а):\n", len(d.Mentions))
+
+    for _, m := range d.Mentions {
+        quote := m.Content
+        if utf8.RuneCountInString(quote) > maxQuoteRunes {
+            quote = string([]rune(quote)[:maxQuoteRunes]) + "…"
+        }
+        who := m.Author
+        if m.Kind == models.MentionRoom {
+            who += " (всей комнате)"
+        }
+        fmt.Fprintf(&b, "\n[%s] %s, %s:\n", m.RoomID, who, m.CreatedAt.Format("02.01 15:04"))
+        for _, line := range strings.Split(quote, "\n") {
+            b.WriteString("> " + line + "\n")
+        }
+    }
+
+    if chatURL != "" {
+        fmt.Fprintf(&b, "\nОткрыть чат: %s\n", chatURL)
+    }
+    fmt.Fprintf(&b, "\nЧтобы больше не получать такие письма, перейдите по ссылке:\n%s\n", unsubscribeURL)
+    return b.String()
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "io"
+    "mime"
+    "mime/quotedprintable"
+    "net"
+    "net/mail"
+    "net/url"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "Thoth/internal/auth"
+    "Thoth/internal/storage"
+)
+
+// smtpStub - минимальный SMTP-сервер, который принимает письма и сохраняет их как есть
+type smtpStub struct {
+    ln   net.Listener
+    mu   sync.Mutex
+    rcpt []string
+    data []string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    s := &smtpStub{ln: ln}
+    t.Cleanup(func() { ln.Close() })
+    go func() {
+        for {
+            conn, err := ln.Accept()
+            if err != nil {
+                return
+            }
+            go s.serve(conn)
+        }
+    }()
+    return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+    defer conn.Close()
+    r := bufio.NewReader(conn)
+    reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+    reply("220 stub ready")
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        cmd := strings.ToUpper(strings.TrimSpace(line))
+        switch {
+        case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+            reply("250 stub")
+        case strings.HasPrefix(cmd, "RCPT TO:"):
+            s.mu.Lock()
+            s.rcpt = append(s.rcpt, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+            s.mu.Unlock()
+            reply("250 ok")
+        case cmd == "DATA":
+            reply("354 go ahead")
+            var body strings.Builder
+            for {
+                l, err := r.ReadString('\n')
+                if err != nil {
+                    return
+                }
+                if l == ".\r\n" {
+                    break
+                }
+                body.WriteString(strings.TrimPrefix(l, "."))
+            }
+            s.mu.Lock()
+            s.data = append(s.data, body.String())
+            s.mu.Unlock()
+            reply("250 queued")
+        case cmd == "QUIT":
+            reply("221 bye")
+            return
+        default:
+            reply("250 ok")
+        }
+    }
+}
+
+type fakeStore struct {
+    digests  []storage.MentionDigest
+    notified []int64
+}
+
+func (f *fakeStore) PendingMentionDigests(ctx context.Context, defaultDelay time.Duration, limit int) ([]storage.MentionDigest, error) {
+    return f.digests, nil
+}
+
+func (f *fakeStore) MarkMentionsNotified(ctx context.Context, ids []int64) error {
+    f.notified = append(f.notified, ids...)
+    return nil
+}
+
+type onlineSet map[string]bool
+
+func (o onlineSet) IsOnline(username string) bool { return o[username] }
+
+func TestNotifierSendsDigestToOfflineUsers(t *testing.T) {
+    stub := newSMTPStub(t)
+    signer := auth.NewSigner([]byte("secret"))
+
+    store := &fakeStore{digests: []storage.MentionDigest{
+        {Username: "bob", Email: "bob@example.com", Mentions: []storage.Mention{
+            {ID: 1, RoomID: "general", Author: "alice", Kind: "user", Content: "@bob посмотри PR", CreatedAt: time.Now()},
+            {ID: 2, RoomID: "ops", Author: "carol", Kind: "room", Content: "@room деплой в 18:00", CreatedAt: time.Now()},
+        }},
+        {Username: "dave", Email: "dave@example.com", Mentions: []storage.Mention{
+            {ID: 3, RoomID: "general", Author: "alice", Kind: "user", Content: "@dave привет"},
+        }},
+    }}
+
+    n := NewNotifier(store, NewSMTPMailer(stub.ln.Addr().String(), "thoth@example.com"), onlineSet{"dave": true}, signer)
+    n.PublicURL = "https://chat.example.com"
+    if err := n.RunOnce(context.Background()); err != nil {
+        t.Fatalf("RunOnce: %v", err)
+    }
+
+    if len(store.notified) != 3 {
+        t.Errorf("отмечены упоминания %v, ожидались все три", store.notified)
+    }
+    stub.mu.Lock()
+    defer stub.mu.Unlock()
+    if len(stub.data) != 1 || len(stub.rcpt) != 1 || stub.rcpt[0] != "bob@example.com" {
+        t.Fatalf("ожидалось одно письмо для bob, получатели %v", stub.rcpt)
+    }
+
+    msg, err := mail.ReadMessage(strings.NewReader(stub.data[0]))
+    if err != nil {
+        t.Fatalf("письмо не разбирается: %v", err)
+    }
+    if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); !strings.Contains(subject, "(2)") {
+        t.Errorf("тема %q не содержит число упоминаний", subject)
+    }
+    body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+    for _, want := range []string{"посмотри PR", "[ops] carol (всей комнате)", "https://chat.example.com"} {
+        if !strings.Contains(string(body), want) {
+            t.Errorf("в письме нет %q:\n%s", want, body)
+        }
+    }
+
+    link := strings.Trim(msg.Header.Get("List-Unsubscribe"), "<>")
+    u, err := url.Parse(link)
+    if err != nil || !strings.HasPrefix(link, "https://chat.example.com/unsubscribe?") {
+        t.Fatalf("неверная ссылка отписки %q", link)
+    }
+    if user, err := signer.VerifyUnsubscribeToken(u.Query().Get("token")); err != nil || user != "bob" {
+        t.Errorf("токен отписки: %q, %v", user, err)
+    }
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, email Email) error {
+    return errors.New("smtp is down")
+}
+
+func TestNotifierRetriesFailedDigests(t *testing.T) {
+    store := &fakeStore{digests: []storage.MentionDigest{
+        {Username: "bob", Email: "bob@example.com", Mentions: []storage.Mention{{ID: 1, Content: "@bob"}}},
+    }}
+    n := NewNotifier(store, failingMailer{}, nil, auth.NewSigner([]byte("secret")))
+
+    if err := n.RunOnce(context.Background()); err != nil {
+        t.Fatalf("RunOnce: %v", err)
+    }
+    if len(store.notified) != 0 {
+        t.Errorf("неотправленные упоминания отмечены: %v", store.notified)
+    }
+}
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+    raw := buildMessage("thoth@example.com", Email{
+        To:      "bob@example.com\r\nBcc: eve@example.com",
+        Subject: "тема",
+        Body:    "текст",
+    }, time.Now())
+    if strings.Contains(string(raw), "\r\nBcc:") {
+        t.Errorf("в письмо попал внедренный заголовок:\n%s", raw)
+    }
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+    "context"
+    "log/slog"
+    "net"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+)
+
+var limiterLogger = slog.With("component", "ratelimit")
+
+// UnaryServerInterceptor ограничивает gRPC-запросы по пользователю и по IP клиента.
+// classify определяет класс лимита по имени метода, caller - отправителя запроса.
+// Если caller вернул пустую строку (запрос не говорит, кто его прислал), лимит
+// пользователя не проверяется
+func (l *Limiter) UnaryServerInterceptor(classify func(fullMethod string) string, caller func(req interface{}) string) grpc.UnaryServerInterceptor {
+    return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+        user := caller(req)
+        var ip string
+        if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+            ip = hostOf(p.Addr.String())
+        }
+
+        if scope := l.Allow(classify(info.FullMethod), user, ip); scope != "" {
+            limiterLogger.Warn("gRPC request rate limited", "method", info.FullMethod, "username", user, "ip", ip, "scope", scope)
+            return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+        }
+        return handler(ctx, req)
+    }
+}
+
+// hostOf отбрасывает порт из адреса host:port
+func hostOf(addr string) string {
+    if host, _, err := net.SplitHostPort(addr); err == nil {
+        return host
+    }
+    return addr
+}
+
+// RemoteIP возвращает IP клиента из RemoteAddr HTTP-запроса
+func RemoteIP(remoteAddr string) string {
+    return hostOf(remoteAddr)
+}
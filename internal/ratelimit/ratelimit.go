@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "Thoth/internal/metrics"
+)
+
+var rejectedTotal = metrics.NewCounter("thoth_ratelimit_rejected_total",
+    "Messages and requests rejected by rate limits", "class", "scope")
+
+// Классы сообщений с отдельными лимитами
+const (
+    ClassChat      = "chat"      // Чат-сообщения
+    ClassSignaling = "signaling" // webrtc_offer, webrtc_answer и приглашения в звонок
+    ClassCandidate = "candidate" // webrtc_candidate: приходят пачками при установке соединения
+    ClassQuery     = "query"     // Запросы на чтение (поиск, упоминания)
+    ClassOther     = "other"
+)
+
+// Уровни, на которых действует лимит
+const (
+    ScopeConnection = "connection"
+    ScopeUser       = "user"
+    ScopeIP         = "ip"
+    ScopeCall       = "call" // Пара участников внутри одного звонка
+)
+
+// Rule - корзина токенов: Rate токенов в секунду, не больше Burst за раз.
+// Нулевое правило лимит не ограничивает
+type Rule struct {
+    Rate  float64
+    Burst int
+}
+
+func (r Rule) enabled() bool {
+    return r.Rate > 0 && r.Burst > 0
+}
+
+// Limits - правила одного класса сообщений на каждом уровне
+type Limits struct {
+    Connection Rule
+    User       Rule
+    IP         Rule
+    Call       Rule
+}
+
+// DefaultLimits - лимиты по умолчанию. Кандидатов ICE при звонке бывают десятки за секунду,
+// а живой человек не пишет больше пары сообщений в секунду. Одному собеседнику в звонке
+// кандидаты нужны пачкой при соединении и при перезапуске ICE, а не потоком
+func DefaultLimits() map[string]Limits {
+    return map[string]Limits{
+        ClassChat:      {Connection: Rule{1, 5}, User: Rule{2, 10}, IP: Rule{5, 30}},
+        ClassSignaling: {Connection: Rule{2, 10}, User: Rule{4, 20}, IP: Rule{10, 50}},
+        ClassCandidate: {Connection: Rule{20, 100}, User: Rule{40, 200}, IP: Rule{100, 500}, Call: Rule{2, 60}},
+        ClassQuery:     {User: Rule{5, 20}, IP: Rule{10, 40}},
+        ClassOther:     {Connection: Rule{2, 10}, User: Rule{4, 20}, IP: Rule{10, 50}},
+    }
+}
+
+// ParseLimits применяет к limits переопределения вида
+// "chat.connection=1/5,candidate.ip=100/500": класс.уровень=скорость/емкость.
+// Значение 0/0 снимает лимит на этом уровне
+func ParseLimits(spec string, limits map[string]Limits) error {
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        key, value, ok := strings.Cut(entry, "=")
+        class, scope, ok2 := strings.Cut(key, ".")
+        rate, burst, ok3 := strings.Cut(value, "/")
+        if !ok || !ok2 || !ok3 {
+            return fmt.Errorf("invalid rate limit %q, expected class.scope=rate/burst", entry)
+        }
+        r, err := strconv.ParseFloat(rate, 64)
+        if err != nil || r < 0 {
+            return fmt.Errorf("invalid rate in %q", entry)
+        }
+        b, err := strconv.Atoi(burst)
+        if err != nil || b < 0 {
+            return fmt.Errorf("invalid burst in %q", entry)
+        }
+
+        l := limits[class]
+        switch scope {
+        case ScopeConnection:
+            l.Connection = Rule{r, b}
+        case ScopeUser:
+            l.User = Rule{r, b}
+        case ScopeIP:
+            l.IP = Rule{r, b}
+        case ScopeCall:
+            l.Call = Rule{r, b}
+        default:
+            return fmt.Errorf("unknown scope %q in %q", scope, entry)
+        }
+        limits[class] = l
+    }
+    return nil
+}
+
+// bucket - корзина токенов. Не потокобезопасна
+type bucket struct {
+    tokens float64
+    last   time.Time
+}
+
+func (b *bucket) allow(rule Rule, now time.Time) bool {
+    if b.last.IsZero() {
+        b.tokens = float64(rule.Burst)
+    } else {
+        b.tokens = min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+    }
+    b.last = now
+    if b.tokens < 1 {
+        return false
+    }
+    b.tokens--
+    return true
+}
+
+// full сообщает, что корзина успела пополниться полностью и ее можно забыть
+func (b *bucket) full(rule Rule, now time.Time) bool {
+    return b.tokens+now.Sub(b.last).Seconds()*rule.Rate >= float64(rule.Burst)
+}
+
+// keyed - корзины по ключу (пользователь или IP) для одного правила
+type keyed struct {
+    mu        sync.Mutex
+    rule      Rule
+    buckets   map[string]*bucket
+    lastSweep time.Time
+}
+
+// sweepInterval - как часто удалять полные корзины, чтобы карта не росла бесконечно
+const sweepInterval = time.Minute
+
+func (k *keyed) allow(key string, now time.Time) bool {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+
+    if now.Sub(k.lastSweep) > sweepInterval {
+        for key, b := range k.buckets {
+            if b.full(k.rule, now) {
+                delete(k.buckets, key)
+            }
+        }
+        k.lastSweep = now
+    }
+
+    b, ok := k.buckets[key]
+    if !ok {
+        b = &bucket{}
+        k.buckets[key] = b
+    }
+    return b.allow(k.rule, now)
+}
+
+// Limiter хранит общие для всех подключений лимиты по пользователям и IP
+type Limiter struct {
+    limits map[string]Limits
+    users  map[string]*keyed
+    ips    map[string]*keyed
+    calls  map[string]*keyed
+    now    func() time.Time
+}
+
+// New создает Limiter. Классы без правил в limits подчиняются правилам ClassOther
+func New(limits map[string]Limits) *Limiter {
+    l := &Limiter{
+        limits: limits,
+        users:  make(map[string]*keyed),
+        ips:    make(map[string]*keyed),
+        calls:  make(map[string]*keyed),
+        now:    time.Now,
+    }
+    for class, rules := range limits {
+        if rules.User.enabled() {
+            l.users[class] = &keyed{rule: rules.User, buckets: make(map[string]*bucket)}
+        }
+        if rules.IP.enabled() {
+            l.ips[class] = &keyed{rule: rules.IP, buckets: make(map[string]*bucket)}
+        }
+        if rules.Call.enabled() {
+            l.calls[class] = &keyed{rule: rules.Call, buckets: make(map[string]*bucket)}
+        }
+    }
+    return l
+}
+
+func (l *Limiter) class(class string) string {
+    if _, ok := l.limits[class]; ok {
+        return class
+    }
+    return ClassOther
+}
+
+// Allow проверяет лимиты пользователя и IP. Возвращает уровень, на котором сработал лимит,
+// или пустую строку, если запрос разрешен. Пустые user и ip не проверяются
+func (l *Limiter) Allow(class, user, ip string) string {
+    class = l.class(class)
+    now := l.now()
+    if k := l.users[class]; k != nil && user != "" && !k.allow(user, now) {
+        rejectedTotal.Inc(class, ScopeUser)
+        return ScopeUser
+    }
+    if k := l.ips[class]; k != nil && ip != "" && !k.allow(ip, now) {
+        rejectedTotal.Inc(class, ScopeIP)
+        return ScopeIP
+    }
+    return ""
+}
+
+// AllowCall проверяет лимит внутри звонка. key - звонок и пара участников, например
+// "<id звонка>/<отправитель>/<адресат>". Возвращает ScopeCall или пустую строку
+func (l *Limiter) AllowCall(class, key string) string {
+    class = l.class(class)
+    if k := l.calls[class]; k != nil && !k.allow(key, l.now()) {
+        rejectedTotal.Inc(class, ScopeCall)
+        return ScopeCall
+    }
+    return ""
+}
+
+// Conn - лимиты одного подключения. Используется из одной горутины (ReadPump)
+type Conn struct {
+    limiter *Limiter
+    user    string
+    ip      string
+    buckets map[string]*bucket
+}
+
+// NewConn создает лимиты подключения. Пустой user - имя не подтверждено, лимит
+// пользователя не проверяется
+func (l *Limiter) NewConn(user, ip string) *Conn {
+    return &Conn{limiter: l, user: user, ip: ip, buckets: make(map[string]*bucket)}
+}
+
+// Allow проверяет лимит подключения, затем пользователя и IP. Возвращает уровень,
+// на котором сработал лимит, или пустую строку
+func (c *Conn) Allow(class string) string {
+    class = c.limiter.class(class)
+    if rule := c.limiter.limits[class].Connection; rule.enabled() {
+        b, ok := c.buckets[class]
+        if !ok {
+            b = &bucket{}
+            c.buckets[class] = b
+        }
+        if !b.allow(rule, c.limiter.now()) {
+            rejectedTotal.Inc(class, ScopeConnection)
+            return ScopeConnection
+        }
+    }
+    return c.limiter.Allow(class, c.user, c.ip)
+}
+
+// AllowCall проверяет лимит звонка, в котором участвует подключение (Limiter.AllowCall)
+func (c *Conn) AllowCall(class, key string) string {
+    return c.limiter.AllowCall(class, key)
+}
+
+// Configure создает Limiter с лимитами по умолчанию и переопределениями из spec
+// (формат ParseLimits). spec = "off" выключает ограничения: возвращается nil
+func Configure(spec string) (*Limiter, error) {
+    if strings.TrimSpace(spec) == "off" {
+        return nil, nil
+    }
+    limits := DefaultLimits()
+    if err := ParseLimits(spec, limits); err != nil {
+        return nil, err
+    }
+    return New(limits), nil
+}
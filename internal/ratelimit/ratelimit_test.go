@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+)
+
+// clock - управляемые часы для тестов
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(limits map[string]Limits) (*Limiter, *clock) {
+    c := &clock{t: time.Unix(1700000000, 0)}
+    l := New(limits)
+    l.now = c.now
+    return l, c
+}
+
+func TestConnBurstAndRefill(t *testing.T) {
+    l, c := newTestLimiter(map[string]Limits{ClassChat: {Connection: Rule{Rate: 1, Burst: 3}}})
+    conn := l.NewConn("alice", "10.0.0.1")
+
+    for i := 0; i < 3; i++ {
+        if scope := conn.Allow(ClassChat); scope != "" {
+            t.Fatalf("сообщение %d отклонено (%s) в пределах burst", i, scope)
+        }
+    }
+    if scope := conn.Allow(ClassChat); scope != ScopeConnection {
+        t.Fatalf("четвертое сообщение: %q, ожидался лимит подключения", scope)
+    }
+
+    c.advance(time.Second)
+    if scope := conn.Allow(ClassChat); scope != "" {
+        t.Errorf("после секунды токен не пополнился: %q", scope)
+    }
+}
+
+func TestUserLimitSpansConnections(t *testing.T) {
+    l, _ := newTestLimiter(map[string]Limits{ClassChat: {User: Rule{Rate: 1, Burst: 2}}})
+    first, second := l.NewConn("alice", "10.0.0.1"), l.NewConn("alice", "10.0.0.2")
+
+    first.Allow(ClassChat)
+    second.Allow(ClassChat)
+    if scope := second.Allow(ClassChat); scope != ScopeUser {
+        t.Errorf("третье сообщение пользователя с двух подключений: %q, ожидался лимит пользователя", scope)
+    }
+    if scope := l.NewConn("bob", "10.0.0.1").Allow(ClassChat); scope != "" {
+        t.Errorf("лимит alice затронул bob: %q", scope)
+    }
+}
+
+func TestIPLimitAndClasses(t *testing.T) {
+    l, _ := newTestLimiter(map[string]Limits{
+        ClassChat:      {IP: Rule{Rate: 1, Burst: 1}},
+        ClassCandidate: {Connection: Rule{Rate: 10, Burst: 50}},
+        ClassOther:     {Connection: Rule{Rate: 1, Burst: 1}},
+    })
+
+    l.NewConn("alice", "10.0.0.1").Allow(ClassChat)
+    if scope := l.NewConn("bob", "10.0.0.1").Allow(ClassChat); scope != ScopeIP {
+        t.Errorf("второй пользователь с того же IP: %q, ожидался лимит IP", scope)
+    }
+
+    conn := l.NewConn("carol", "10.0.0.2")
+    for i := 0; i < 50; i++ {
+        if scope := conn.Allow(ClassCandidate); scope != "" {
+            t.Fatalf("кандидат %d отклонен: %s", i, scope)
+        }
+    }
+
+    // Неизвестный класс подчиняется правилам ClassOther
+    conn.Allow("typing")
+    if scope := conn.Allow("typing"); scope != ScopeConnection {
+        t.Errorf("неизвестный класс без лимита: %q", scope)
+    }
+}
+
+func TestCallLimitPerPair(t *testing.T) {
+    l, c := newTestLimiter(map[string]Limits{ClassCandidate: {Connection: Rule{Rate: 100, Burst: 100}, Call: Rule{Rate: 1, Burst: 3}}})
+    conn := l.NewConn("alice", "10.0.0.1")
+
+    for i := 0; i < 3; i++ {
+        if scope := conn.AllowCall(ClassCandidate, "call-1/alice/bob"); scope != "" {
+            t.Fatalf("кандидат %d отклонен (%s) в пределах burst", i, scope)
+        }
+    }
+    if scope := conn.AllowCall(ClassCandidate, "call-1/alice/bob"); scope != ScopeCall {
+        t.Fatalf("поток кандидатов одному адресату: %q, ожидался лимит звонка", scope)
+    }
+    // Другой собеседник и другой звонок считаются отдельно
+    if scope := conn.AllowCall(ClassCandidate, "call-1/alice/carol"); scope != "" {
+        t.Errorf("лимит пары alice/bob затронул carol: %q", scope)
+    }
+    if scope := conn.AllowCall(ClassCandidate, "call-2/alice/bob"); scope != "" {
+        t.Errorf("лимит прошлого звонка перешел на новый: %q", scope)
+    }
+    // Классы без правила звонка не ограничиваются
+    if scope := conn.AllowCall(ClassChat, "call-1/alice/bob"); scope != "" {
+        t.Errorf("класс без лимита звонка: %q", scope)
+    }
+
+    c.advance(time.Second)
+    if scope := conn.AllowCall(ClassCandidate, "call-1/alice/bob"); scope != "" {
+        t.Errorf("после секунды токен не пополнился: %q", scope)
+    }
+}
+
+func TestKeyedSweepsFullBuckets(t *testing.T) {
+    l, c := newTestLimiter(map[string]Limits{ClassChat: {User: Rule{Rate: 1, Burst: 2}}})
+    for _, user := range []string{"a", "b", "c"} {
+        l.Allow(ClassChat, user, "")
+    }
+    c.advance(2 * sweepInterval)
+    l.Allow(ClassChat, "d", "")
+    if n := len(l.users[ClassChat].buckets); n != 1 {
+        t.Errorf("после очистки осталось %d корзин, ожидалась 1", n)
+    }
+}
+
+func TestParseLimits(t *testing.T) {
+    limits := DefaultLimits()
+    if err := ParseLimits("chat.connection=0.5/3, candidate.ip=0/0", limits); err != nil {
+        t.Fatalf("ParseLimits: %v", err)
+    }
+    if got := limits[ClassChat].Connection; got != (Rule{0.5, 3}) {
+        t.Errorf("chat.connection = %+v", got)
+    }
+    if limits[ClassCandidate].IP.enabled() {
+        t.Error("candidate.ip=0/0 должен снимать лимит")
+    }
+    if err := ParseLimits("candidate.call=1/20", limits); err != nil || limits[ClassCandidate].Call != (Rule{1, 20}) {
+        t.Errorf("candidate.call: %+v, %v", limits[ClassCandidate].Call, err)
+    }
+
+    for _, bad := range []string{"chat=1/2", "chat.room=1/2", "chat.user=x/2", "chat.user=1"} {
+        if err := ParseLimits(bad, DefaultLimits()); err == nil {
+            t.Errorf("ParseLimits(%q) без ошибки", bad)
+        }
+    }
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+    l, _ := newTestLimiter(map[string]Limits{ClassChat: {User: Rule{Rate: 1, Burst: 1}}})
+    interceptor := l.UnaryServerInterceptor(func(string) string { return ClassChat },
+        func(req interface{}) string { return req.(usernameReq).GetUsername() })
+
+    ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+    info := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/SendMessage"}
+    handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+    if _, err := interceptor(ctx, usernameReq("alice"), info, handler); err != nil {
+        t.Fatalf("первый запрос: %v", err)
+    }
+    _, err := interceptor(ctx, usernameReq("alice"), info, handler)
+    if status.Code(err) != codes.ResourceExhausted {
+        t.Errorf("второй запрос: %v, ожидался ResourceExhausted", err)
+    }
+}
+
+func TestUnaryServerInterceptorUnknownCaller(t *testing.T) {
+    l, _ := newTestLimiter(map[string]Limits{ClassQuery: {User: Rule{Rate: 1, Burst: 1}}})
+    // Поиск по автору alice не говорит, кто спрашивает: лимит alice не расходуется
+    interceptor := l.UnaryServerInterceptor(func(string) string { return ClassQuery },
+        func(interface{}) string { return "" })
+
+    info := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/SearchMessages"}
+    handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+    for i := 0; i < 3; i++ {
+        if _, err := interceptor(context.Background(), usernameReq("alice"), info, handler); err != nil {
+            t.Fatalf("запрос %d: %v", i, err)
+        }
+    }
+    if scope := l.Allow(ClassQuery, "alice", ""); scope != "" {
+        t.Errorf("лимит alice израсходован чужими запросами: %s", scope)
+    }
+}
+
+type usernameReq string
+
+func (u usernameReq) GetUsername() string { return string(u) }
@@ -0,0 +1,348 @@
+package recording
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/pion/rtp"
+    "github.com/pion/webrtc/v4"
+    "github.com/pion/webrtc/v4/pkg/media/oggwriter"
+
+    "Thoth/internal/blobstore"
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+    "Thoth/internal/sfu"
+    "Thoth/internal/storage"
+)
+
+var recordingLogger = slog.With("component", "recording")
+
+var (
+    recordingsActive = metrics.NewGauge("thoth_recordings_active",
+        "Calls being recorded right now")
+    filesTotal = metrics.NewCounter("thoth_recording_files_total",
+        "Recorded tracks by outcome", "result")
+)
+
+var (
+    ErrRecording    = errors.New("call is already being recorded")
+    ErrNotRecording = errors.New("call is not being recorded")
+)
+
+// Store сохраняет сведения о завершенных записях
+type Store interface {
+    SaveRecording(ctx context.Context, rec models.Recording, files []storage.RecordingFile) error
+}
+
+// Recorder пишет дорожки звонков, которые пересылает SFU, в файлы во временном каталоге:
+// звук Opus - в Ogg, видео VP8 - в WebM. После остановки записи файлы переносятся
+// в хранилище blob-объектов и становятся вложениями комнаты
+type Recorder struct {
+    Dir string // Каталог для файлов, пока идет запись
+
+    store Store
+    blobs blobstore.Store
+
+    mu       sync.Mutex
+    sessions map[string]*session // [roomID]
+    saving   sync.WaitGroup
+
+    now func() time.Time
+}
+
+type session struct {
+    rec models.Recording
+    dir string
+
+    mu     sync.Mutex
+    files  []*file
+    closed bool
+}
+
+// file - дорожка одного участника. Реализует sfu.Sink
+type file struct {
+    username    string
+    kind        string
+    filename    string
+    contentType string
+    path        string
+
+    mu      sync.Mutex
+    w       mediaWriter // nil после закрытия
+    packets int
+}
+
+type mediaWriter interface {
+    WriteRTP(packet *rtp.Packet) error
+    Close() error
+}
+
+func NewRecorder(dir string, store Store, blobs blobstore.Store) (*Recorder, error) {
+    if err := os.MkdirAll(dir, 0o750); err != nil {
+        return nil, err
+    }
+    return &Recorder{
+        Dir:      dir,
+        store:    store,
+        blobs:    blobs,
+        sessions: make(map[string]*session),
+        now:      time.Now,
+    }, nil
+}
+
+// Start начинает запись звонка callID. Дорожки участников подключает SFU через Sink
+func (r *Recorder) Start(roomID, callID, startedBy string) (models.Recording, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if r.sessions[roomID] != nil {
+        return models.Recording{}, ErrRecording
+    }
+    rec := models.Recording{
+        ID:        newRecordingID(),
+        RoomID:    roomID,
+        CallID:    callID,
+        StartedBy: startedBy,
+        StartedAt: r.now(),
+    }
+    dir := filepath.Join(r.Dir, rec.ID)
+    if err := os.MkdirAll(dir, 0o750); err != nil {
+        return models.Recording{}, err
+    }
+    r.sessions[roomID] = &session{rec: rec, dir: dir}
+    recordingsActive.Set(float64(len(r.sessions)))
+    recordingLogger.Info("Recording started", "recording_id", rec.ID, "room", roomID, "call_id", callID, "started_by", startedBy)
+    return rec, nil
+}
+
+// Active возвращает идущую запись комнаты
+func (r *Recorder) Active(roomID string) (models.Recording, bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if s := r.sessions[roomID]; s != nil {
+        return s.rec, true
+    }
+    return models.Recording{}, false
+}
+
+// Sink возвращает функцию, которой SFU открывает файлы для дорожек записи комнаты
+func (r *Recorder) Sink(roomID string) sfu.SinkFunc {
+    return func(owner string, codec webrtc.RTPCodecParameters) sfu.Sink {
+        r.mu.Lock()
+        s := r.sessions[roomID]
+        r.mu.Unlock()
+        if s == nil {
+            return nil
+        }
+        f, err := s.open(owner, codec)
+        if err != nil {
+            recordingLogger.Error("Failed to open track file", "recording_id", s.rec.ID, "username", owner, "error", err)
+            return nil
+        }
+        if f == nil {
+            return nil
+        }
+        return f
+    }
+}
+
+// Finish останавливает запись комнаты, закрывает файлы и переносит их в хранилище в фоне
+func (r *Recorder) Finish(roomID string) (models.Recording, error) {
+    r.mu.Lock()
+    s := r.sessions[roomID]
+    delete(r.sessions, roomID)
+    recordingsActive.Set(float64(len(r.sessions)))
+    r.mu.Unlock()
+    if s == nil {
+        return models.Recording{}, ErrNotRecording
+    }
+
+    s.mu.Lock()
+    s.closed = true
+    files := s.files
+    s.mu.Unlock()
+    for _, f := range files {
+        if err := f.Close(); err != nil {
+            recordingLogger.Warn("Failed to finalize track file", "recording_id", s.rec.ID, "file", f.filename, "error", err)
+        }
+    }
+
+    s.rec.EndedAt = r.now()
+    recordingLogger.Info("Recording stopped", "recording_id", s.rec.ID, "room", roomID, "files", len(files))
+    r.saving.Add(1)
+    go r.save(s.rec, s.dir, files)
+    return s.rec, nil
+}
+
+// Stop завершает все записи и ждет, пока их файлы сохранятся
+func (r *Recorder) Stop() {
+    r.mu.Lock()
+    rooms := make([]string, 0, len(r.sessions))
+    for roomID := range r.sessions {
+        rooms = append(rooms, roomID)
+    }
+    r.mu.Unlock()
+    for _, roomID := range rooms {
+        r.Finish(roomID)
+    }
+    r.saving.Wait()
+}
+
+// save загружает непустые файлы записи в хранилище и сохраняет запись в базе
+func (r *Recorder) save(rec models.Recording, dir string, files []*file) {
+    defer r.saving.Done()
+    defer os.RemoveAll(dir)
+
+    ctx := context.Background()
+    var saved []storage.RecordingFile
+    for _, f := range files {
+        sf, err := r.upload(ctx, rec, f)
+        if err != nil {
+            filesTotal.Inc("failed")
+            recordingLogger.Error("Failed to store track file", "recording_id", rec.ID, "file", f.filename, "error", err)
+            continue
+        }
+        if sf == nil {
+            filesTotal.Inc("empty")
+            continue
+        }
+        filesTotal.Inc("saved")
+        saved = append(saved, *sf)
+    }
+
+    if err := r.store.SaveRecording(ctx, rec, saved); err != nil {
+        recordingLogger.Error("Failed to save recording", "recording_id", rec.ID, "error", err)
+        for _, f := range saved {
+            if err := r.blobs.Delete(ctx, f.BlobKey); err != nil {
+                recordingLogger.Error("Failed to remove orphan blob", "key", f.BlobKey, "error", err)
+            }
+        }
+        return
+    }
+    recordingLogger.Info("Recording saved", "recording_id", rec.ID, "room", rec.RoomID, "files", len(saved))
+}
+
+// upload переносит файл в хранилище. nil без ошибки - в дорожку ничего не пришло
+func (r *Recorder) upload(ctx context.Context, rec models.Recording, f *file) (*storage.RecordingFile, error) {
+    in, err := os.Open(f.path)
+    if err != nil {
+        return nil, err
+    }
+    defer in.Close()
+    info, err := in.Stat()
+    if err != nil {
+        return nil, err
+    }
+    if info.Size() == 0 || f.packets == 0 {
+        return nil, nil
+    }
+
+    id := newRecordingID()
+    a := storage.Attachment{
+        ID:          id,
+        RoomID:      rec.RoomID,
+        Uploader:    rec.StartedBy,
+        Filename:    f.filename,
+        ContentType: f.contentType,
+        Size:        info.Size(),
+        BlobKey:     "recordings/" + id,
+    }
+    if err := r.blobs.Put(ctx, a.BlobKey, io.LimitReader(in, a.Size), a.Size, a.ContentType); err != nil {
+        return nil, err
+    }
+    return &storage.RecordingFile{Attachment: a, Username: f.username, Kind: f.kind}, nil
+}
+
+// open создает файл для дорожки участника. nil без ошибки - кодек не записывается
+func (s *session) open(owner string, codec webrtc.RTPCodecParameters) (*file, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.closed {
+        return nil, nil
+    }
+
+    f := &file{username: owner}
+    var ext string
+    switch {
+    case strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus):
+        f.kind, f.contentType, ext = models.TrackAudio, "audio/ogg", ".ogg"
+    case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8):
+        f.kind, f.contentType, ext = models.TrackVideo, "video/webm", ".webm"
+    default:
+        filesTotal.Inc("unsupported")
+        recordingLogger.Warn("Track codec is not supported for recording", "recording_id", s.rec.ID, "username", owner, "codec", codec.MimeType)
+        return nil, nil
+    }
+
+    // Участник мог переподключиться: следующие его дорожки того же вида - отдельные файлы
+    n := 1
+    for _, other := range s.files {
+        if other.username == owner && other.kind == f.kind {
+            n++
+        }
+    }
+    f.filename = fmt.Sprintf("recording-%s-%s-%s", s.rec.StartedAt.UTC().Format("20060102-150405"), owner, f.kind)
+    if n > 1 {
+        f.filename += fmt.Sprintf("-%d", n)
+    }
+    f.filename += ext
+    f.path = filepath.Join(s.dir, fmt.Sprintf("%d%s", len(s.files), ext))
+
+    if f.kind == models.TrackAudio {
+        channels := codec.Channels
+        if channels == 0 {
+            channels = 2
+        }
+        w, err := oggwriter.New(f.path, codec.ClockRate, channels)
+        if err != nil {
+            return nil, err
+        }
+        f.w = w
+    } else {
+        out, err := os.Create(f.path)
+        if err != nil {
+            return nil, err
+        }
+        f.w = newWebMWriter(out)
+    }
+    s.files = append(s.files, f)
+    return f, nil
+}
+
+func (f *file) WriteRTP(packet *rtp.Packet) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.w == nil {
+        return nil
+    }
+    f.packets++
+    return f.w.WriteRTP(packet)
+}
+
+// Close закрывает файл; повторный вызов ничего не делает
+func (f *file) Close() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.w == nil {
+        return nil
+    }
+    err := f.w.Close()
+    f.w = nil
+    return err
+}
+
+func newRecordingID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
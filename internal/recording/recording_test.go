@@ -0,0 +1,309 @@
+package recording
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "io"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/pion/rtp"
+    "github.com/pion/webrtc/v4"
+
+    "Thoth/internal/blobstore"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+type fakeStore struct {
+    mu         sync.Mutex
+    recordings []models.Recording
+    files      [][]storage.RecordingFile
+}
+
+func (s *fakeStore) SaveRecording(ctx context.Context, rec models.Recording, files []storage.RecordingFile) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.recordings = append(s.recordings, rec)
+    s.files = append(s.files, files)
+    return nil
+}
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+var (
+    opus = webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}}
+    vp8  = webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}}
+    h264 = webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}}
+)
+
+// vp8Frame собирает кадр VP8: опорный с размером 640x480 или промежуточный
+func vp8Frame(keyframe bool) []byte {
+    if !keyframe {
+        return []byte{0x01, 0x00, 0x00, 0xAA, 0xBB}
+    }
+    frame := []byte{0x00, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0, 0, 0, 0, 0xCC}
+    binary.LittleEndian.PutUint16(frame[6:8], 640)
+    binary.LittleEndian.PutUint16(frame[8:10], 480)
+    return frame
+}
+
+// vp8Packets - по одному RTP-пакету на кадр с шагом 100 мс
+func vp8Packets(keyframes ...bool) []*rtp.Packet {
+    var packets []*rtp.Packet
+    for i, keyframe := range keyframes {
+        packets = append(packets, &rtp.Packet{
+            Header: rtp.Header{
+                Version:        2,
+                Marker:         true,
+                PayloadType:    96,
+                SequenceNumber: uint16(1000 + i),
+                Timestamp:      uint32(5000 + i*9000),
+                SSRC:           1,
+            },
+            Payload: append([]byte{0x10}, vp8Frame(keyframe)...), // Дескриптор: начало раздела 0
+        })
+    }
+    return packets
+}
+
+type element struct {
+    id      uint32
+    payload []byte
+}
+
+// readEBML раскладывает файл в плоский список элементов, заходя внутрь контейнеров
+func readEBML(t *testing.T, data []byte) []element {
+    t.Helper()
+    masters := map[uint32]bool{idEBML: true, idSegment: true, idInfo: true, idTracks: true,
+        idTrackEntry: true, idVideo: true, idCluster: true}
+
+    var elements []element
+    for len(data) > 0 {
+        idLen := 1
+        for idLen <= 4 && data[0]&(0x80>>(idLen-1)) == 0 {
+            idLen++
+        }
+        var id uint32
+        for _, b := range data[:idLen] {
+            id = id<<8 | uint32(b)
+        }
+        data = data[idLen:]
+
+        sizeLen := 1
+        for sizeLen <= 8 && data[0]&(0x80>>(sizeLen-1)) == 0 {
+            sizeLen++
+        }
+        size := uint64(data[0] & (0xFF >> sizeLen))
+        for _, b := range data[1:sizeLen] {
+            size = size<<8 | uint64(b)
+        }
+        data = data[sizeLen:]
+
+        if masters[id] {
+            elements = append(elements, element{id: id})
+            continue
+        }
+        if size > uint64(len(data)) {
+            t.Fatalf("элемент %x размером %d выходит за конец файла", id, size)
+        }
+        elements = append(elements, element{id: id, payload: data[:size]})
+        data = data[size:]
+    }
+    return elements
+}
+
+func uintValue(b []byte) uint64 {
+    var v uint64
+    for _, c := range b {
+        v = v<<8 | uint64(c)
+    }
+    return v
+}
+
+func TestWebMWriter(t *testing.T) {
+    var out bytes.Buffer
+    w := newWebMWriter(nopCloser{&out})
+
+    // Первый кадр промежуточный: до опорного ничего не пишется
+    for _, p := range vp8Packets(false, true, false, false, true, false) {
+        if err := w.WriteRTP(p); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    var docType, codec string
+    var width, height uint64
+    var clusters []uint64
+    var blocks []struct {
+        at       int64
+        keyframe bool
+    }
+    for _, e := range readEBML(t, out.Bytes()) {
+        switch e.id {
+        case idDocType:
+            docType = string(e.payload)
+        case idCodecID:
+            codec = string(e.payload)
+        case idPixelWidth:
+            width = uintValue(e.payload)
+        case idPixelHeight:
+            height = uintValue(e.payload)
+        case idTimecode:
+            clusters = append(clusters, uintValue(e.payload))
+        case idSimpleBlock:
+            if e.payload[0] != 0x81 {
+                t.Fatalf("блок другой дорожки: %x", e.payload[0])
+            }
+            at := int64(clusters[len(clusters)-1]) + int64(int16(binary.BigEndian.Uint16(e.payload[1:3])))
+            blocks = append(blocks, struct {
+                at       int64
+                keyframe bool
+            }{at, e.payload[3]&0x80 != 0})
+        }
+    }
+
+    if docType != "webm" || codec != "V_VP8" || width != 640 || height != 480 {
+        t.Fatalf("заголовок: doctype=%q codec=%q %dx%d", docType, codec, width, height)
+    }
+    if len(blocks) != 5 {
+        t.Fatalf("ожидали 5 кадров начиная с опорного, получили %d", len(blocks))
+    }
+    for i, b := range blocks {
+        if want := int64(i * 100); b.at != want {
+            t.Errorf("кадр %d: время %d мс, ожидали %d", i, b.at, want)
+        }
+        if want := i == 0 || i == 3; b.keyframe != want {
+            t.Errorf("кадр %d: опорный=%v", i, b.keyframe)
+        }
+    }
+    // Каждый опорный кадр открывает кластер
+    if len(clusters) != 2 || clusters[1] != 300 {
+        t.Errorf("кластеры: %v", clusters)
+    }
+}
+
+func TestEBMLSize(t *testing.T) {
+    cases := map[uint64][]byte{
+        0:     {0x80},
+        126:   {0xFE},
+        127:   {0x40, 0x7F}, // 0xFF зарезервирован под неизвестный размер
+        16382: {0x7F, 0xFE},
+        16383: {0x20, 0x3F, 0xFF},
+    }
+    for size, want := range cases {
+        if got := ebmlSize(size); !bytes.Equal(got, want) {
+            t.Errorf("ebmlSize(%d) = %x, ожидали %x", size, got, want)
+        }
+    }
+}
+
+func TestRecorder(t *testing.T) {
+    store := &fakeStore{}
+    blobs, err := blobstore.NewLocalStore(t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    dir := t.TempDir()
+    r, err := NewRecorder(dir, store, blobs)
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) }
+
+    if sink := r.Sink("general")("alice", opus); sink != nil {
+        t.Fatal("без записи Sink должен возвращать nil")
+    }
+    rec, err := r.Start("general", "call-1", "alice")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := r.Start("general", "call-1", "bob"); err != ErrRecording {
+        t.Fatalf("повторный Start: ожидали ErrRecording, получили %v", err)
+    }
+    if active, ok := r.Active("general"); !ok || active.ID != rec.ID {
+        t.Fatalf("Active: %+v, %v", active, ok)
+    }
+
+    open := r.Sink("general")
+    if sink := open("bob", h264); sink != nil {
+        t.Error("H.264 не записывается, Sink должен быть nil")
+    }
+    audio := open("alice", opus)
+    for i := 0; i < 10; i++ {
+        err := audio.WriteRTP(&rtp.Packet{
+            Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: uint16(i), Timestamp: uint32(i * 960), SSRC: 2},
+            Payload: []byte{0xFC, 0xFF, 0xFE},
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    video := open("alice", vp8)
+    for _, p := range vp8Packets(true, false, false) {
+        if err := video.WriteRTP(p); err != nil {
+            t.Fatal(err)
+        }
+    }
+    open("bob", vp8) // Камера выключена: пакетов нет, файл не сохраняется
+
+    stopped, err := r.Finish("general")
+    if err != nil || stopped.ID != rec.ID || stopped.EndedAt.IsZero() {
+        t.Fatalf("Finish: %+v, %v", stopped, err)
+    }
+    if _, err := r.Finish("general"); err != ErrNotRecording {
+        t.Fatalf("повторный Finish: ожидали ErrNotRecording, получили %v", err)
+    }
+    r.Stop() // Ждет сохранения
+
+    if len(store.recordings) != 1 || store.recordings[0].ID != rec.ID || store.recordings[0].StartedBy != "alice" {
+        t.Fatalf("сохраненные записи: %+v", store.recordings)
+    }
+    files := store.files[0]
+    if len(files) != 2 {
+        t.Fatalf("ожидали два файла alice, получили %+v", files)
+    }
+    kinds := map[string]storage.RecordingFile{}
+    for _, f := range files {
+        if f.Username != "alice" || f.RoomID != "general" || f.Uploader != "alice" {
+            t.Errorf("файл записан не за тем участником: %+v", f)
+        }
+        kinds[f.Kind] = f
+    }
+    if f := kinds[models.TrackAudio]; f.ContentType != "audio/ogg" || f.Filename != "recording-20261019-120000-alice-audio.ogg" {
+        t.Errorf("звуковая дорожка: %+v", f)
+    }
+    if f := kinds[models.TrackVideo]; f.ContentType != "video/webm" || f.Filename != "recording-20261019-120000-alice-video.webm" {
+        t.Errorf("видеодорожка: %+v", f)
+    }
+
+    for _, f := range files {
+        blob, err := blobs.Open(context.Background(), f.BlobKey)
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, _ := io.ReadAll(blob)
+        blob.Close()
+        if int64(len(data)) != f.Size {
+            t.Errorf("%s: размер в хранилище %d, в базе %d", f.Filename, len(data), f.Size)
+        }
+        magic := map[string][]byte{models.TrackAudio: []byte("OggS"), models.TrackVideo: {0x1A, 0x45, 0xDF, 0xA3}}[f.Kind]
+        if !bytes.HasPrefix(data, magic) {
+            t.Errorf("%s: неожиданное начало файла %x", f.Filename, data[:8])
+        }
+    }
+
+    // Временные файлы удаляются после сохранения
+    if _, err := os.Stat(filepath.Join(dir, rec.ID)); !os.IsNotExist(err) {
+        t.Errorf("каталог записи не удален: %v", err)
+    }
+}
@@ -0,0 +1,238 @@
+package recording
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+
+    "github.com/pion/rtp"
+    "github.com/pion/rtp/codecs"
+    "github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+// Элементы Matroska/WebM, которые пишет webmWriter
+const (
+    idEBML               = 0x1A45DFA3
+    idEBMLVersion        = 0x4286
+    idEBMLReadVersion    = 0x42F7
+    idEBMLMaxIDLength    = 0x42F2
+    idEBMLMaxSizeLength  = 0x42F3
+    idDocType            = 0x4282
+    idDocTypeVersion     = 0x4287
+    idDocTypeReadVersion = 0x4285
+    idSegment            = 0x18538067
+    idInfo               = 0x1549A966
+    idTimecodeScale      = 0x2AD7B1
+    idMuxingApp          = 0x4D80
+    idWritingApp         = 0x5741
+    idTracks             = 0x1654AE6B
+    idTrackEntry         = 0xAE
+    idTrackNumber        = 0xD7
+    idTrackUID           = 0x73C5
+    idTrackType          = 0x83
+    idCodecID            = 0x86
+    idVideo              = 0xE0
+    idPixelWidth         = 0xB0
+    idPixelHeight        = 0xBA
+    idCluster            = 0x1F43B675
+    idTimecode           = 0xE7
+    idSimpleBlock        = 0xA3
+)
+
+const (
+    vp8ClockRate = 90000
+    // Смещение кадра внутри кластера - int16 в миллисекундах; новый кластер начинаем заранее
+    maxClusterSpan = 30000
+    // Сколько пакетов samplebuilder ждет опоздавших, прежде чем собрать кадр без них
+    maxLatePackets = 128
+)
+
+var errNotKeyframe = errors.New("not a VP8 keyframe")
+
+// webmWriter собирает из RTP-пакетов VP8 кадры и пишет их в WebM с одной видеодорожкой.
+// Сегмент и кластеры пишутся с неизвестным размером, как у MediaRecorder в браузере,
+// поэтому файл можно читать, даже если запись оборвалась. Кадры до первого опорного
+// пропускаются: размер картинки берется из его заголовка
+type webmWriter struct {
+    out     io.WriteCloser
+    builder *samplebuilder.SampleBuilder
+
+    started   bool
+    firstTS   uint32 // RTP-время первого записанного кадра
+    cluster   int64  // Время начала текущего кластера, мс
+    inCluster bool
+}
+
+func newWebMWriter(out io.WriteCloser) *webmWriter {
+    return &webmWriter{
+        out:     out,
+        builder: samplebuilder.New(maxLatePackets, &codecs.VP8Packet{}, vp8ClockRate),
+    }
+}
+
+// WriteRTP принимает пакет; готовые кадры сразу уходят в файл
+func (w *webmWriter) WriteRTP(packet *rtp.Packet) error {
+    w.builder.Push(packet)
+    for sample := w.builder.Pop(); sample != nil; sample = w.builder.Pop() {
+        if err := w.writeFrame(sample.Data, sample.PacketTimestamp); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Close дописывает собранные кадры и закрывает файл
+func (w *webmWriter) Close() error {
+    w.builder.Flush()
+    var err error
+    for sample := w.builder.Pop(); sample != nil; sample = w.builder.Pop() {
+        if err == nil {
+            err = w.writeFrame(sample.Data, sample.PacketTimestamp)
+        }
+    }
+    if cerr := w.out.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+func (w *webmWriter) writeFrame(frame []byte, ts uint32) error {
+    keyframe := len(frame) > 0 && frame[0]&0x01 == 0
+    if !w.started {
+        if !keyframe {
+            return nil
+        }
+        width, height, err := vp8Size(frame)
+        if err != nil {
+            return nil
+        }
+        if err := w.writeHeader(width, height); err != nil {
+            return err
+        }
+        w.started, w.firstTS = true, ts
+    }
+
+    at := int64(ts-w.firstTS) * 1000 / vp8ClockRate
+    if !w.inCluster || keyframe || at-w.cluster > maxClusterSpan || at < w.cluster {
+        cluster := append(ebmlID(idCluster), unknownSize...)
+        cluster = append(cluster, ebmlUint(idTimecode, uint64(at))...)
+        if err := w.write(cluster); err != nil {
+            return err
+        }
+        w.cluster, w.inCluster = at, true
+    }
+
+    block := make([]byte, 4, 4+len(frame))
+    block[0] = 0x81 // Дорожка 1
+    binary.BigEndian.PutUint16(block[1:3], uint16(int16(at-w.cluster)))
+    if keyframe {
+        block[3] = 0x80
+    }
+    return w.write(ebmlElement(idSimpleBlock, append(block, frame...)))
+}
+
+func (w *webmWriter) writeHeader(width, height int) error {
+    header := ebmlElement(idEBML, concat(
+        ebmlUint(idEBMLVersion, 1),
+        ebmlUint(idEBMLReadVersion, 1),
+        ebmlUint(idEBMLMaxIDLength, 4),
+        ebmlUint(idEBMLMaxSizeLength, 8),
+        ebmlString(idDocType, "webm"),
+        ebmlUint(idDocTypeVersion, 4),
+        ebmlUint(idDocTypeReadVersion, 2),
+    ))
+    header = append(header, ebmlID(idSegment)...)
+    header = append(header, unknownSize...)
+    header = append(header, ebmlElement(idInfo, concat(
+        ebmlUint(idTimecodeScale, 1000000), // Время в миллисекундах
+        ebmlString(idMuxingApp, "thoth"),
+        ebmlString(idWritingApp, "thoth"),
+    ))...)
+    header = append(header, ebmlElement(idTracks, ebmlElement(idTrackEntry, concat(
+        ebmlUint(idTrackNumber, 1),
+        ebmlUint(idTrackUID, 1),
+        ebmlUint(idTrackType, 1), // Видео
+        ebmlString(idCodecID, "V_VP8"),
+        ebmlElement(idVideo, concat(
+            ebmlUint(idPixelWidth, uint64(width)),
+            ebmlUint(idPixelHeight, uint64(height)),
+        )),
+    )))...)
+    return w.write(header)
+}
+
+func (w *webmWriter) write(b []byte) error {
+    _, err := w.out.Write(b)
+    return err
+}
+
+// vp8Size читает размер картинки из заголовка опорного кадра VP8 (RFC 6386, 9.1)
+func vp8Size(frame []byte) (int, int, error) {
+    if len(frame) < 10 || frame[0]&0x01 != 0 || frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+        return 0, 0, errNotKeyframe
+    }
+    width := int(binary.LittleEndian.Uint16(frame[6:8]) & 0x3fff)
+    height := int(binary.LittleEndian.Uint16(frame[8:10]) & 0x3fff)
+    return width, height, nil
+}
+
+// unknownSize - размер элемента, который пишется потоком и заранее неизвестен
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// ebmlID кодирует идентификатор элемента: в нем уже есть маркер длины
+func ebmlID(id uint32) []byte {
+    switch {
+    case id > 0xFFFFFF:
+        return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+    case id > 0xFFFF:
+        return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+    case id > 0xFF:
+        return []byte{byte(id >> 8), byte(id)}
+    }
+    return []byte{byte(id)}
+}
+
+// ebmlSize кодирует размер числом переменной длины в наименьшее число байт
+func ebmlSize(size uint64) []byte {
+    length := 1
+    // Значение из одних единиц зарезервировано под неизвестный размер
+    for length < 8 && size >= 1<<(7*length)-1 {
+        length++
+    }
+    b := make([]byte, length)
+    for i := length - 1; i >= 0; i-- {
+        b[i] = byte(size)
+        size >>= 8
+    }
+    b[0] |= 0x80 >> (length - 1)
+    return b
+}
+
+func ebmlElement(id uint32, payload []byte) []byte {
+    b := append(ebmlID(id), ebmlSize(uint64(len(payload)))...)
+    return append(b, payload...)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+    var payload []byte
+    for {
+        payload = append([]byte{byte(v)}, payload...)
+        v >>= 8
+        if v == 0 {
+            break
+        }
+    }
+    return ebmlElement(id, payload)
+}
+
+func ebmlString(id uint32, v string) []byte {
+    return ebmlElement(id, []byte(v))
+}
+
+func concat(parts ...[]byte) []byte {
+    var b []byte
+    for _, p := range parts {
+        b = append(b, p...)
+    }
+    return b
+}
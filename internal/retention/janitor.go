@@ -0,0 +1,223 @@
+package retention
+
+import (
+    "context"
+    "log/slog"
+    "time"
+
+    "Thoth/internal/blobstore"
+    "Thoth/internal/metrics"
+    "Thoth/internal/storage"
+)
+
+var janitorLogger = slog.With("component", "retention")
+
+var (
+    purgedMessages = metrics.NewCounter("thoth_retention_purged_messages_total",
+        "Messages removed by retention policies", "reason", "action")
+    purgedFiles = metrics.NewCounter("thoth_retention_purged_files_total",
+        "Attachment files removed together with their messages", "result")
+    janitorRuns = metrics.NewCounter("thoth_retention_runs_total",
+        "Retention janitor runs", "result")
+    lastRunTimestamp = metrics.NewGauge("thoth_retention_last_run_timestamp_seconds",
+        "Unix time of the last completed retention run")
+    lastRunDuration = metrics.NewGauge("thoth_retention_last_run_duration_seconds",
+        "Duration of the last retention run")
+)
+
+// Store - операции хранилища, которые нужны janitor. Реализуется *storage.Storage
+type Store interface {
+    ListRetentionPolicies(ctx context.Context) ([]storage.RetentionPolicy, error)
+    ListMessageRooms(ctx context.Context) ([]string, error)
+    PurgeMessagesOlderThan(ctx context.Context, roomID string, cutoff time.Time, batch int, archive bool) (int, []string, error)
+    PurgeMessagesOverCount(ctx context.Context, roomID string, maxCount, batch int, archive bool) (int, []string, error)
+}
+
+// Janitor периодически применяет политики хранения: удаляет или архивирует
+// устаревшие сообщения небольшими пачками. Вложения удаляются вместе с сообщениями,
+// у архивируемых сообщений они остаются
+type Janitor struct {
+    store Store
+    blobs blobstore.Store
+
+    Interval   time.Duration // Период между запусками
+    BatchSize  int           // Сообщений в одной пачке
+    BatchPause time.Duration // Пауза между пачками, чтобы не нагружать базу
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+// NewJanitor создает janitor. Файлы вложений удаленных сообщений удаляются из blobs
+func NewJanitor(store Store, blobs blobstore.Store) *Janitor {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &Janitor{
+        store:      store,
+        blobs:      blobs,
+        Interval:   time.Hour,
+        BatchSize:  500,
+        BatchPause: 100 * time.Millisecond,
+        ctx:        ctx,
+        cancel:     cancel,
+    }
+}
+
+// Run запускает очистку сразу и затем с периодом Interval до вызова Stop
+func (j *Janitor) Run() {
+    janitorLogger.Info("Retention janitor is running", "interval", j.Interval, "batch_size", j.BatchSize)
+
+    ticker := time.NewTicker(j.Interval)
+    defer ticker.Stop()
+
+    for {
+        if err := j.RunOnce(j.ctx); err != nil && j.ctx.Err() == nil {
+            janitorLogger.Error("Retention run failed", "error", err)
+        }
+
+        select {
+        case <-j.ctx.Done():
+            janitorLogger.Info("Retention janitor stopped")
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (j *Janitor) Stop() {
+    j.cancel()
+}
+
+// RunOnce применяет политики ко всем комнатам с сообщениями. Для комнаты действует
+// ее собственная политика, а если ее нет - глобальная
+func (j *Janitor) RunOnce(ctx context.Context) error {
+    start := time.Now()
+
+    err := j.runOnce(ctx)
+
+    result := "ok"
+    if err != nil {
+        result = "error"
+    }
+    janitorRuns.Inc(result)
+    lastRunTimestamp.Set(float64(time.Now().Unix()))
+    lastRunDuration.Set(time.Since(start).Seconds())
+    return err
+}
+
+func (j *Janitor) runOnce(ctx context.Context) error {
+    policies, err := j.store.ListRetentionPolicies(ctx)
+    if err != nil {
+        return err
+    }
+    if len(policies) == 0 {
+        return nil
+    }
+
+    byRoom := make(map[string]storage.RetentionPolicy, len(policies))
+    for _, p := range policies {
+        byRoom[p.RoomID] = p
+    }
+    global, hasGlobal := byRoom[storage.GlobalRetentionRoom]
+
+    rooms, err := j.store.ListMessageRooms(ctx)
+    if err != nil {
+        return err
+    }
+
+    total := 0
+    for _, room := range rooms {
+        policy, ok := byRoom[room]
+        if !ok {
+            if !hasGlobal {
+                continue
+            }
+            policy = global
+        }
+
+        n, err := j.applyPolicy(ctx, room, policy)
+        total += n
+        if err != nil {
+            return err
+        }
+    }
+
+    janitorLogger.Info("Retention run completed", "rooms", len(rooms), "purged", total)
+    return nil
+}
+
+// applyPolicy удаляет сообщения комнаты пачками, пока есть что удалять
+func (j *Janitor) applyPolicy(ctx context.Context, room string, policy storage.RetentionPolicy) (int, error) {
+    action := "deleted"
+    if policy.Archive {
+        action = "archived"
+    }
+
+    total := 0
+    if policy.MaxAge > 0 {
+        cutoff := time.Now().Add(-policy.MaxAge)
+        n, err := j.drain(ctx, func() (int, error) {
+            n, keys, err := j.store.PurgeMessagesOlderThan(ctx, room, cutoff, j.BatchSize, policy.Archive)
+            j.deleteBlobs(keys)
+            return n, err
+        })
+        purgedMessages.Add(float64(n), "max_age", action)
+        total += n
+        if err != nil {
+            return total, err
+        }
+    }
+
+    if policy.MaxCount > 0 {
+        n, err := j.drain(ctx, func() (int, error) {
+            n, keys, err := j.store.PurgeMessagesOverCount(ctx, room, policy.MaxCount, j.BatchSize, policy.Archive)
+            j.deleteBlobs(keys)
+            return n, err
+        })
+        purgedMessages.Add(float64(n), "max_count", action)
+        total += n
+        if err != nil {
+            return total, err
+        }
+    }
+
+    if total > 0 {
+        janitorLogger.Info("Messages purged", "room", room, "count", total, "action", action)
+    }
+    return total, nil
+}
+
+// deleteBlobs удаляет файлы вложений, записи о которых уже удалены вместе с сообщениями.
+// Ошибка не останавливает очистку: вложение уже недоступно, файл остается только на диске
+func (j *Janitor) deleteBlobs(keys []string) {
+    for _, key := range keys {
+        // Контекст janitor не используем: после Stop файлы уже удаленных записей все равно нужно убрать
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        err := j.blobs.Delete(ctx, key)
+        cancel()
+        if err != nil {
+            janitorLogger.Error("Failed to delete attachment file", "key", key, "error", err)
+            purgedFiles.Inc("error")
+            continue
+        }
+        purgedFiles.Inc("ok")
+    }
+}
+
+// drain вызывает purge, пока очередная пачка заполнена целиком
+func (j *Janitor) drain(ctx context.Context, purge func() (int, error)) (int, error) {
+    total := 0
+    for {
+        n, err := purge()
+        total += n
+        if err != nil || n < j.BatchSize {
+            return total, err
+        }
+
+        select {
+        case <-ctx.Done():
+            return total, ctx.Err()
+        case <-time.After(j.BatchPause):
+        }
+    }
+}
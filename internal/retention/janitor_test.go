@@ -0,0 +1,145 @@
+package retention
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "Thoth/internal/blobstore"
+    "Thoth/internal/storage"
+)
+
+// fakeStore имитирует комнаты с заданным числом сообщений старше cutoff
+type fakeStore struct {
+    policies []storage.RetentionPolicy
+    old      map[string]int // Сообщений старше любого cutoff
+    total    map[string]int
+    files    map[string][]string // Ключи файлов вложений старых сообщений
+    calls    int
+}
+
+func (f *fakeStore) ListRetentionPolicies(ctx context.Context) ([]storage.RetentionPolicy, error) {
+    return f.policies, nil
+}
+
+func (f *fakeStore) ListMessageRooms(ctx context.Context) ([]string, error) {
+    var rooms []string
+    for room := range f.total {
+        rooms = append(rooms, room)
+    }
+    return rooms, nil
+}
+
+func (f *fakeStore) PurgeMessagesOlderThan(ctx context.Context, roomID string, cutoff time.Time, batch int, archive bool) (int, []string, error) {
+    f.calls++
+    n := min(f.old[roomID], batch)
+    f.old[roomID] -= n
+    f.total[roomID] -= n
+    // Как и storage, при архивации вложения остаются и ключей нет
+    if archive {
+        return n, nil, nil
+    }
+    keys := f.files[roomID]
+    delete(f.files, roomID)
+    return n, keys, nil
+}
+
+func (f *fakeStore) PurgeMessagesOverCount(ctx context.Context, roomID string, maxCount, batch int, archive bool) (int, []string, error) {
+    f.calls++
+    n := min(max(f.total[roomID]-maxCount, 0), batch)
+    f.total[roomID] -= n
+    return n, nil, nil
+}
+
+func TestJanitorAppliesRoomAndGlobalPolicies(t *testing.T) {
+    store := &fakeStore{
+        policies: []storage.RetentionPolicy{
+            {RoomID: storage.GlobalRetentionRoom, MaxAge: 24 * time.Hour},
+            {RoomID: "ops", MaxCount: 10, Archive: true},
+        },
+        old:   map[string]int{"general": 25, "ops": 5},
+        total: map[string]int{"general": 40, "ops": 32},
+    }
+
+    j := NewJanitor(store, nil)
+    j.BatchSize = 10
+    j.BatchPause = 0
+
+    before := purgedMessages.Value("max_age", "deleted")
+    if err := j.RunOnce(context.Background()); err != nil {
+        t.Fatalf("Ошибка очистки: %v", err)
+    }
+
+    // general: глобальная политика по возрасту, удаляются 25 старых сообщений тремя пачками
+    if store.total["general"] != 15 {
+        t.Errorf("general: ожидалось 15 сообщений, осталось %d", store.total["general"])
+    }
+    // ops: своя политика по количеству, возраст не учитывается
+    if store.total["ops"] != 10 || store.old["ops"] != 5 {
+        t.Errorf("ops: ожидалось 10 сообщений и нетронутые старые, получено %d и %d", store.total["ops"], store.old["ops"])
+    }
+    if got := purgedMessages.Value("max_age", "deleted") - before; got != 25 {
+        t.Errorf("Метрика удаленных по возрасту: ожидалось 25, получено %v", got)
+    }
+}
+
+// putBlobs создает файлы вложений с ключами keys
+func putBlobs(t *testing.T, keys ...string) blobstore.Store {
+    t.Helper()
+    blobs, err := blobstore.NewLocalStore(t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range keys {
+        if err := blobs.Put(context.Background(), key, strings.NewReader("data"), 4, "text/plain"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return blobs
+}
+
+func blobExists(t *testing.T, blobs blobstore.Store, key string) bool {
+    t.Helper()
+    f, err := blobs.Open(context.Background(), key)
+    if errors.Is(err, blobstore.ErrNotFound) {
+        return false
+    }
+    if err != nil {
+        t.Fatalf("%s: %v", key, err)
+    }
+    f.Close()
+    return true
+}
+
+func TestJanitorAttachmentFiles(t *testing.T) {
+    keys := []string{"attachments/a1", "thumbnails/a1"}
+    for _, archive := range []bool{false, true} {
+        blobs := putBlobs(t, append(keys, "attachments/a2")...)
+        store := &fakeStore{
+            policies: []storage.RetentionPolicy{{RoomID: "general", MaxAge: time.Hour, Archive: archive}},
+            old:      map[string]int{"general": 1},
+            total:    map[string]int{"general": 2},
+            files:    map[string][]string{"general": keys},
+        }
+        j := NewJanitor(store, blobs)
+        j.BatchPause = 0
+        if err := j.RunOnce(context.Background()); err != nil {
+            t.Fatalf("archive=%v: ошибка очистки: %v", archive, err)
+        }
+        if store.total["general"] != 1 {
+            t.Errorf("archive=%v: старое сообщение не убрано", archive)
+        }
+
+        // Файлы удаленного сообщения удалены, архивированного - остались
+        for _, key := range keys {
+            if blobExists(t, blobs, key) != archive {
+                t.Errorf("archive=%v: %s: файл вложения должен остаться только при архивации", archive, key)
+            }
+        }
+        if !blobExists(t, blobs, "attachments/a2") {
+            t.Errorf("archive=%v: файл живого вложения удален", archive)
+        }
+    }
+}
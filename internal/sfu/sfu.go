@@ -0,0 +1,618 @@
+package sfu
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "sync"
+    "time"
+
+    "github.com/pion/interceptor"
+    "github.com/pion/rtcp"
+    "github.com/pion/rtp"
+    "github.com/pion/webrtc/v4"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+)
+
+var sfuLogger = slog.With("component", "sfu")
+
+var (
+    peersActive = metrics.NewGauge("thoth_sfu_peers",
+        "Peer connections terminated by the SFU")
+    tracksActive = metrics.NewGauge("thoth_sfu_tracks",
+        "Media tracks published to the SFU")
+)
+
+// PeerName - имя, от которого SFU присылает сигнализацию и которому клиенты адресуют свою
+const PeerName = "sfu"
+
+// Ошибки сигнализации с SFU
+var (
+    ErrNotJoined = errors.New("not connected to the SFU")
+    ErrGlare     = errors.New("renegotiation is in progress, retry after the pending offer")
+    ErrBadSignal = errors.New("malformed signaling payload")
+    ErrNoRoom    = errors.New("room has no participants connected to the SFU")
+)
+
+// keyframeInterval - как часто просить у отправителей опорный кадр, чтобы новые
+// получатели и потерявшие пакеты не ждали его долго
+const keyframeInterval = 3 * time.Second
+
+// Config - сетевые настройки SFU
+type Config struct {
+    ICEServers []webrtc.ICEServer // STUN, чтобы узнать свой внешний адрес
+    PublicIP   string             // Внешний IP за NAT 1:1 (например, в облаке); пусто - определять по ICE
+    MinPort    uint16             // Диапазон UDP-портов для соединений; 0 - любые
+    MaxPort    uint16
+}
+
+// SFU завершает соединение каждого участника звонка на сервере и пересылает его
+// RTP-потоки остальным участникам комнаты. Сервер всегда предлагает (offer),
+// клиенты отвечают; offer клиента принимается, если сервер ничего не ждет
+type SFU struct {
+    // Send доставляет кадр сигнализации участнику message.TargetUser. Вызывается по порядку
+    // для каждого участника, поэтому может блокироваться
+    Send func(models.Message)
+
+    api    *webrtc.API
+    config webrtc.Configuration
+
+    mu    sync.Mutex
+    rooms map[string]*room
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+// Sink получает копии RTP-пакетов трека, например для записи. Пакеты принадлежат Sink
+type Sink interface {
+    WriteRTP(packet *rtp.Packet) error
+    Close() error
+}
+
+// SinkFunc открывает Sink для трека участника owner; nil - трек не нужен
+type SinkFunc func(owner string, codec webrtc.RTPCodecParameters) Sink
+
+type room struct {
+    id     string
+    peers  map[string]*peer
+    tracks map[string]*track // [владелец/id трека]
+    record SinkFunc          // Запись включена: копии треков уходят в открытые им Sink
+}
+
+type track struct {
+    owner string
+    codec webrtc.RTPCodecParameters
+    local *webrtc.TrackLocalStaticRTP
+
+    mu   sync.Mutex
+    sink Sink
+}
+
+type peer struct {
+    username string
+    pc       *webrtc.PeerConnection
+    offered  bool // Первый offer отправлен
+    pending  bool // Треки менялись, пока ждали ответа: нужен новый offer
+    // Кандидаты, пришедшие раньше ответа: без удаленного описания их некуда добавить
+    candidates []webrtc.ICECandidateInit
+
+    out  chan models.Message // Сигнализация участнику по порядку
+    done chan struct{}
+}
+
+// New создает SFU
+func New(cfg Config) (*SFU, error) {
+    var settings webrtc.SettingEngine
+    if cfg.PublicIP != "" {
+        if net.ParseIP(cfg.PublicIP) == nil {
+            return nil, fmt.Errorf("invalid SFU public IP %q", cfg.PublicIP)
+        }
+        settings.SetNAT1To1IPs([]string{cfg.PublicIP}, webrtc.ICECandidateTypeHost)
+    }
+    if cfg.MinPort != 0 || cfg.MaxPort != 0 {
+        if err := settings.SetEphemeralUDPPortRange(cfg.MinPort, cfg.MaxPort); err != nil {
+            return nil, fmt.Errorf("SFU port range: %w", err)
+        }
+    }
+
+    api, err := newAPI(settings)
+    if err != nil {
+        return nil, err
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    return &SFU{
+        api:    api,
+        config: webrtc.Configuration{ICEServers: cfg.ICEServers},
+        rooms:  make(map[string]*room),
+        ctx:    ctx,
+        cancel: cancel,
+    }, nil
+}
+
+func newAPI(settings webrtc.SettingEngine) (*webrtc.API, error) {
+    media := &webrtc.MediaEngine{}
+    if err := media.RegisterDefaultCodecs(); err != nil {
+        return nil, err
+    }
+    // NACK, отчеты RTCP и TWCC - как у браузера
+    registry := &interceptor.Registry{}
+    if err := webrtc.RegisterDefaultInterceptors(media, registry); err != nil {
+        return nil, err
+    }
+    return webrtc.NewAPI(webrtc.WithSettingEngine(settings), webrtc.WithMediaEngine(media), webrtc.WithInterceptorRegistry(registry)), nil
+}
+
+// Serving сообщает, подключены ли к SFU участники звонка комнаты
+func (s *SFU) Serving(roomID string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.rooms[roomID] != nil
+}
+
+// Join подключает участника звонка: SFU создает соединение и присылает ему offer
+func (s *SFU) Join(roomID, username string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    r := s.rooms[roomID]
+    if r == nil {
+        r = &room{id: roomID, peers: make(map[string]*peer), tracks: make(map[string]*track)}
+        s.rooms[roomID] = r
+    }
+    if r.peers[username] != nil {
+        return nil
+    }
+
+    pc, err := s.api.NewPeerConnection(s.config)
+    if err != nil {
+        return err
+    }
+    // Принимаем от участника звук и видео, даже если он включит их позже
+    for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+        if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+            pc.Close()
+            return err
+        }
+    }
+
+    p := &peer{username: username, pc: pc, out: make(chan models.Message, 64), done: make(chan struct{})}
+    pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+        if c != nil {
+            candidate := models.ICECandidate(c.ToJSON())
+            p.send(roomID, models.MessageTypeWebRTCCandidate, &models.WebRTCData{Candidate: &candidate})
+        }
+    })
+    pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+        if state == webrtc.PeerConnectionStateFailed {
+            sfuLogger.Warn("Peer connection failed", "room", roomID, "username", username)
+            go s.Leave(roomID, username)
+        }
+    })
+    pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+        s.forward(roomID, username, remote)
+    })
+
+    r.peers[username] = p
+    go p.pump(s.ctx, s.Send)
+    sfuLogger.Info("Peer joined", "room", roomID, "username", username, "peers", len(r.peers))
+    s.signal(r)
+    s.updateGauges()
+    return nil
+}
+
+// Leave отключает участника и перестает пересылать его потоки остальным
+func (s *SFU) Leave(roomID, username string) {
+    s.mu.Lock()
+    r := s.rooms[roomID]
+    var p *peer
+    if r != nil {
+        p = r.peers[username]
+    }
+    if p == nil {
+        s.mu.Unlock()
+        return
+    }
+    delete(r.peers, username)
+    for key, t := range r.tracks {
+        if t.owner == username {
+            delete(r.tracks, key)
+        }
+    }
+    if len(r.peers) == 0 {
+        delete(s.rooms, roomID)
+    } else {
+        s.signal(r)
+    }
+    s.updateGauges()
+    s.mu.Unlock()
+
+    // Закрытие ждет обработчиков соединения, которые сами берут s.mu
+    p.close()
+    sfuLogger.Info("Peer left", "room", roomID, "username", username)
+}
+
+// Close отключает всех участников звонка комнаты
+func (s *SFU) Close(roomID string) {
+    s.mu.Lock()
+    r := s.rooms[roomID]
+    delete(s.rooms, roomID)
+    s.updateGauges()
+    s.mu.Unlock()
+    if r == nil {
+        return
+    }
+    for _, p := range r.peers {
+        p.close()
+    }
+    sfuLogger.Info("Room closed", "room", roomID)
+}
+
+// HandleSignal принимает от участника answer, offer или ICE-кандидата
+func (s *SFU) HandleSignal(roomID, username string, msg models.Message) error {
+    data := msg.WebRTCData
+    if data == nil {
+        return ErrBadSignal
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r := s.rooms[roomID]
+    if r == nil || r.peers[username] == nil {
+        return ErrNotJoined
+    }
+    p := r.peers[username]
+
+    switch msg.Type {
+    case models.MessageTypeWebRTCAnswer:
+        if data.Answer == nil {
+            return ErrBadSignal
+        }
+        if err := p.setRemote(sessionDescription(data.Answer)); err != nil {
+            return fmt.Errorf("%w: %v", ErrBadSignal, err)
+        }
+    case models.MessageTypeWebRTCOffer:
+        // Клиент добавил треки в уже установленное соединение
+        if data.Offer == nil {
+            return ErrBadSignal
+        }
+        if p.pc.SignalingState() != webrtc.SignalingStateStable {
+            return ErrGlare
+        }
+        if err := p.setRemote(sessionDescription(data.Offer)); err != nil {
+            return fmt.Errorf("%w: %v", ErrBadSignal, err)
+        }
+        answer, err := p.pc.CreateAnswer(nil)
+        if err == nil {
+            err = p.pc.SetLocalDescription(answer)
+        }
+        if err != nil {
+            return err
+        }
+        p.send(roomID, models.MessageTypeWebRTCAnswer, &models.WebRTCData{Answer: modelDescription(answer)})
+    case models.MessageTypeWebRTCCandidate:
+        if data.Candidate == nil {
+            return ErrBadSignal
+        }
+        candidate := webrtc.ICECandidateInit(*data.Candidate)
+        if p.pc.RemoteDescription() == nil {
+            p.candidates = append(p.candidates, candidate)
+            return nil
+        }
+        if err := p.pc.AddICECandidate(candidate); err != nil {
+            return fmt.Errorf("%w: %v", ErrBadSignal, err)
+        }
+        return nil
+    }
+    if p.pending {
+        s.offer(r, p)
+    }
+    return nil
+}
+
+// forward пересылает трек участника остальным, пока тот его отправляет
+func (s *SFU) forward(roomID, owner string, remote *webrtc.TrackRemote) {
+    local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), owner)
+    if err != nil {
+        sfuLogger.Error("Failed to create forwarding track", "room", roomID, "username", owner, "error", err)
+        return
+    }
+    key := owner + "/" + remote.ID()
+
+    s.mu.Lock()
+    r := s.rooms[roomID]
+    if r == nil || r.peers[owner] == nil {
+        s.mu.Unlock()
+        return
+    }
+    t := &track{owner: owner, codec: remote.Codec(), local: local}
+    r.tracks[key] = t
+    if r.record != nil {
+        t.setSink(r.record(owner, t.codec))
+    }
+    sfuLogger.Info("Track published", "room", roomID, "username", owner, "kind", remote.Kind().String())
+    s.signal(r)
+    s.updateGauges()
+    s.mu.Unlock()
+
+    defer func() {
+        t.setSink(nil)
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        if r := s.rooms[roomID]; r != nil && r.tracks[key] == t {
+            delete(r.tracks, key)
+            s.signal(r)
+            s.updateGauges()
+        }
+    }()
+
+    buf := make([]byte, 1500)
+    for {
+        n, _, err := remote.Read(buf)
+        if err != nil {
+            return
+        }
+        if _, err := local.Write(buf[:n]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+            return
+        }
+        t.tee(buf[:n])
+    }
+}
+
+// Record включает запись звонка комнаты: для уже пересылаемых и будущих треков
+// открываются Sink через open, пока запись не выключат StopRecording
+func (s *SFU) Record(roomID string, open SinkFunc) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r := s.rooms[roomID]
+    if r == nil {
+        return ErrNoRoom
+    }
+    r.record = open
+    for _, t := range r.tracks {
+        t.setSink(open(t.owner, t.codec))
+    }
+    return nil
+}
+
+// StopRecording выключает запись и закрывает Sink всех треков комнаты
+func (s *SFU) StopRecording(roomID string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r := s.rooms[roomID]
+    if r == nil {
+        return
+    }
+    r.record = nil
+    for _, t := range r.tracks {
+        t.setSink(nil)
+    }
+}
+
+// setSink заменяет Sink трека, закрывая прежний
+func (t *track) setSink(sink Sink) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.sink != nil {
+        if err := t.sink.Close(); err != nil {
+            sfuLogger.Warn("Failed to close track sink", "username", t.owner, "error", err)
+        }
+    }
+    t.sink = sink
+}
+
+// tee отдает копию пакета Sink трека, если он есть
+func (t *track) tee(raw []byte) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.sink == nil {
+        return
+    }
+    var packet rtp.Packet
+    if err := packet.Unmarshal(append([]byte(nil), raw...)); err != nil {
+        return
+    }
+    if err := t.sink.WriteRTP(&packet); err != nil {
+        sfuLogger.Warn("Track sink failed, detaching", "username", t.owner, "error", err)
+        t.sink.Close()
+        t.sink = nil
+    }
+}
+
+// signal приводит отправляемые каждому участнику треки к трекам комнаты. Вызывается под mu
+func (s *SFU) signal(r *room) {
+    for _, p := range r.peers {
+        s.offer(r, p)
+    }
+}
+
+// offer вызывается под mu
+func (s *SFU) offer(r *room, p *peer) {
+    if p.pc.SignalingState() != webrtc.SignalingStateStable {
+        // Ждем ответа на прошлый offer, новый отправим после него
+        p.pending = true
+        return
+    }
+    p.pending = false
+
+    changed := false
+    sending := make(map[string]bool)
+    for _, sender := range p.pc.GetSenders() {
+        t := sender.Track()
+        if t == nil {
+            continue
+        }
+        key := t.StreamID() + "/" + t.ID()
+        if tr := r.tracks[key]; tr == nil || tr.local != t {
+            if err := p.pc.RemoveTrack(sender); err != nil {
+                sfuLogger.Error("Failed to remove track", "room", r.id, "username", p.username, "error", err)
+            }
+            changed = true
+            continue
+        }
+        sending[key] = true
+    }
+    for key, tr := range r.tracks {
+        if tr.owner == p.username || sending[key] {
+            continue
+        }
+        sender, err := p.pc.AddTrack(tr.local)
+        if err != nil {
+            sfuLogger.Error("Failed to add track", "room", r.id, "username", p.username, "error", err)
+            continue
+        }
+        go drainRTCP(sender)
+        changed = true
+    }
+    if p.offered && !changed {
+        return
+    }
+
+    offer, err := p.pc.CreateOffer(nil)
+    if err == nil {
+        err = p.pc.SetLocalDescription(offer)
+    }
+    if err != nil {
+        sfuLogger.Error("Failed to create offer", "room", r.id, "username", p.username, "error", err)
+        return
+    }
+    p.offered = true
+    p.send(r.id, models.MessageTypeWebRTCOffer, &models.WebRTCData{Offer: modelDescription(offer)})
+}
+
+func sessionDescription(d *models.SessionDescription) webrtc.SessionDescription {
+    return webrtc.SessionDescription{Type: webrtc.NewSDPType(d.Type), SDP: d.SDP}
+}
+
+func modelDescription(d webrtc.SessionDescription) *models.SessionDescription {
+    return &models.SessionDescription{Type: d.Type.String(), SDP: d.SDP}
+}
+
+// drainRTCP читает RTCP от получателя: без этого не работают NACK и отчеты
+func drainRTCP(sender *webrtc.RTPSender) {
+    buf := make([]byte, 1500)
+    for {
+        if _, _, err := sender.Read(buf); err != nil {
+            return
+        }
+    }
+}
+
+// Run периодически просит у отправителей опорные кадры
+func (s *SFU) Run() {
+    ticker := time.NewTicker(keyframeInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-s.ctx.Done():
+            return
+        case <-ticker.C:
+            s.requestKeyframes()
+        }
+    }
+}
+
+func (s *SFU) requestKeyframes() {
+    s.mu.Lock()
+    var pcs []*webrtc.PeerConnection
+    for _, r := range s.rooms {
+        for _, p := range r.peers {
+            pcs = append(pcs, p.pc)
+        }
+    }
+    s.mu.Unlock()
+
+    for _, pc := range pcs {
+        for _, receiver := range pc.GetReceivers() {
+            if t := receiver.Track(); t != nil && t.Kind() == webrtc.RTPCodecTypeVideo {
+                pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(t.SSRC())}})
+            }
+        }
+    }
+}
+
+func (s *SFU) Stop() {
+    s.cancel()
+    s.mu.Lock()
+    rooms := s.rooms
+    s.rooms = make(map[string]*room)
+    s.updateGauges()
+    s.mu.Unlock()
+    for _, r := range rooms {
+        for _, p := range r.peers {
+            p.close()
+        }
+    }
+}
+
+// updateGauges вызывается под mu
+func (s *SFU) updateGauges() {
+    peers, tracks := 0, 0
+    for _, r := range s.rooms {
+        peers += len(r.peers)
+        tracks += len(r.tracks)
+    }
+    peersActive.Set(float64(peers))
+    tracksActive.Set(float64(tracks))
+}
+
+// setRemote применяет описание участника и отложенные до него кандидаты. Вызывается под mu
+func (p *peer) setRemote(desc webrtc.SessionDescription) error {
+    if err := p.pc.SetRemoteDescription(desc); err != nil {
+        return err
+    }
+    for _, c := range p.candidates {
+        if err := p.pc.AddICECandidate(c); err != nil {
+            sfuLogger.Warn("Failed to add buffered ICE candidate", "username", p.username, "error", err)
+        }
+    }
+    p.candidates = nil
+    return nil
+}
+
+// send ставит кадр сигнализации в очередь участника. Не блокирует
+func (p *peer) send(roomID, msgType string, data *models.WebRTCData) {
+    msg := models.Message{
+        Type:       msgType,
+        Username:   PeerName,
+        TargetUser: p.username,
+        RoomID:     roomID,
+        WebRTCData: data,
+        Timestamp:  time.Now(),
+    }
+    select {
+    case p.out <- msg:
+    case <-p.done:
+    default:
+        sfuLogger.Error("Signaling queue is full, message dropped", "username", p.username, "type", msgType)
+    }
+}
+
+// pump отправляет сигнализацию участнику по одному кадру, сохраняя порядок
+func (p *peer) pump(ctx context.Context, send func(models.Message)) {
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-p.done:
+            return
+        case msg := <-p.out:
+            if send != nil {
+                send(msg)
+            }
+        }
+    }
+}
+
+func (p *peer) close() {
+    close(p.done)
+    if err := p.pc.Close(); err != nil {
+        sfuLogger.Warn("Failed to close peer connection", "username", p.username, "error", err)
+    }
+}
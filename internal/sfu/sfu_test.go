@@ -0,0 +1,239 @@
+package sfu
+
+import (
+    "net"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/pion/rtp"
+    "github.com/pion/webrtc/v4"
+
+    "Thoth/internal/models"
+)
+
+// loopbackAPI - соединения только через 127.0.0.1, чтобы тест не зависел от сети
+func loopbackAPI(t *testing.T) *webrtc.API {
+    t.Helper()
+    var settings webrtc.SettingEngine
+    settings.SetIncludeLoopbackCandidate(true)
+    settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+    settings.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+    api, err := newAPI(settings)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return api
+}
+
+// router доставляет сигнализацию между SFU и тестовыми клиентами, пока тест не закончился
+type router struct {
+    mu      sync.Mutex
+    stopped bool
+    clients map[string]*testClient
+}
+
+func (r *router) deliver(fn func()) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if !r.stopped {
+        fn()
+    }
+}
+
+func (r *router) stop() {
+    r.mu.Lock()
+    r.stopped = true
+    r.mu.Unlock()
+}
+
+// testClient - участник звонка вместо браузера: отвечает на offer SFU
+type testClient struct {
+    t      *testing.T
+    name   string
+    sfu    *SFU
+    router *router
+    pc     *webrtc.PeerConnection
+    tracks chan *webrtc.TrackRemote
+}
+
+func newTestClient(t *testing.T, s *SFU, r *router, api *webrtc.API, name string) *testClient {
+    t.Helper()
+    pc, err := api.NewPeerConnection(webrtc.Configuration{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { pc.Close() })
+    c := &testClient{t: t, name: name, sfu: s, router: r, pc: pc, tracks: make(chan *webrtc.TrackRemote, 4)}
+    r.clients[name] = c
+    pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+        if candidate != nil {
+            r.deliver(func() {
+                init := models.ICECandidate(candidate.ToJSON())
+                c.signal(models.MessageTypeWebRTCCandidate, &models.WebRTCData{Candidate: &init})
+            })
+        }
+    })
+    pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+        c.tracks <- track
+    })
+    return c
+}
+
+func (c *testClient) signal(msgType string, data *models.WebRTCData) {
+    if err := c.sfu.HandleSignal("general", c.name, models.Message{Type: msgType, WebRTCData: data}); err != nil {
+        c.t.Errorf("%s: сигнал %s отклонен: %v", c.name, msgType, err)
+    }
+}
+
+// handle обрабатывает кадр от SFU так же, как chat-client.js
+func (c *testClient) handle(msg models.Message) {
+    data := msg.WebRTCData
+    switch msg.Type {
+    case models.MessageTypeWebRTCOffer:
+        if err := c.pc.SetRemoteDescription(sessionDescription(data.Offer)); err != nil {
+            c.t.Errorf("%s: offer: %v", c.name, err)
+            return
+        }
+        answer, err := c.pc.CreateAnswer(nil)
+        if err == nil {
+            err = c.pc.SetLocalDescription(answer)
+        }
+        if err != nil {
+            c.t.Errorf("%s: answer: %v", c.name, err)
+            return
+        }
+        c.signal(models.MessageTypeWebRTCAnswer, &models.WebRTCData{Answer: modelDescription(answer)})
+    case models.MessageTypeWebRTCCandidate:
+        c.pc.AddICECandidate(webrtc.ICECandidateInit(*data.Candidate))
+    }
+}
+
+// testSink считает пакеты записи и отмечает закрытие
+type testSink struct {
+    packets chan *rtp.Packet
+    closed  chan struct{}
+}
+
+func (s *testSink) WriteRTP(packet *rtp.Packet) error {
+    select {
+    case s.packets <- packet:
+    default:
+    }
+    return nil
+}
+
+func (s *testSink) Close() error {
+    close(s.closed)
+    return nil
+}
+
+func TestForwardsTracksBetweenParticipants(t *testing.T) {
+    s, err := New(Config{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    s.api = loopbackAPI(t)
+    defer s.Stop()
+
+    r := &router{clients: make(map[string]*testClient)}
+    defer r.stop()
+    api := loopbackAPI(t)
+    alice := newTestClient(t, s, r, api, "alice")
+    bob := newTestClient(t, s, r, api, "bob")
+    s.Send = func(msg models.Message) {
+        r.deliver(func() {
+            if msg.Username != PeerName {
+                t.Errorf("кадр не от SFU: %+v", msg)
+            }
+            r.clients[msg.TargetUser].handle(msg)
+        })
+    }
+
+    video, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "camera", "alice-browser")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := alice.pc.AddTrack(video); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := s.Join("general", "alice"); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Join("general", "bob"); err != nil {
+        t.Fatal(err)
+    }
+
+    // alice отправляет видео, пока тест не закончится
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        ticker := time.NewTicker(20 * time.Millisecond)
+        defer ticker.Stop()
+        for seq := uint16(0); ; seq++ {
+            select {
+            case <-done:
+                return
+            case <-ticker.C:
+                video.WriteRTP(&rtp.Packet{
+                    Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 3000},
+                    Payload: []byte{0x10, 0x00, 0x00, 0x9d, 0x01, 0x2a},
+                })
+            }
+        }
+    }()
+
+    select {
+    case track := <-bob.tracks:
+        if track.StreamID() != "alice" || track.Kind() != webrtc.RTPCodecTypeVideo {
+            t.Errorf("bob получил трек %s/%s, ожидалось видео alice", track.StreamID(), track.Kind())
+        }
+    case <-time.After(15 * time.Second):
+        t.Fatal("bob не получил видео alice через SFU")
+    }
+    select {
+    case track := <-alice.tracks:
+        t.Errorf("alice получила собственный трек обратно: %s", track.StreamID())
+    default:
+    }
+    if got := tracksActive.Value(); got != 1 {
+        t.Errorf("треков в метрике: %v", got)
+    }
+
+    // Запись подключается к уже пересылаемому треку
+    if err := s.Record("other", func(string, webrtc.RTPCodecParameters) Sink { return nil }); err != ErrNoRoom {
+        t.Errorf("запись комнаты без SFU: %v", err)
+    }
+    sink := &testSink{packets: make(chan *rtp.Packet, 16), closed: make(chan struct{})}
+    err = s.Record("general", func(owner string, codec webrtc.RTPCodecParameters) Sink {
+        if owner != "alice" || codec.MimeType != webrtc.MimeTypeVP8 {
+            t.Errorf("запись открыта для %s/%s", owner, codec.MimeType)
+        }
+        return sink
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case <-sink.packets:
+    case <-time.After(5 * time.Second):
+        t.Fatal("в запись не пришло ни одного пакета")
+    }
+
+    s.Leave("general", "alice")
+    select {
+    case <-sink.closed:
+    case <-time.After(5 * time.Second):
+        t.Error("запись трека не закрыта после выхода alice")
+    }
+    if got := peersActive.Value(); got != 1 {
+        t.Errorf("участников после выхода alice: %v", got)
+    }
+    if got := tracksActive.Value(); got != 0 {
+        t.Errorf("треки alice остались: %v", got)
+    }
+    if err := s.HandleSignal("general", "alice", models.Message{Type: models.MessageTypeWebRTCCandidate, WebRTCData: &models.WebRTCData{Candidate: &models.ICECandidate{}}}); err != ErrNotJoined {
+        t.Errorf("сигнал от отключенного участника: %v", err)
+    }
+}
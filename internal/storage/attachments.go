@@ -0,0 +1,134 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+
+    "Thoth/internal/models"
+)
+
+// ErrAttachmentUnavailable - вложение не найдено, загружено в другую комнату или другим
+// пользователем, либо уже прикреплено к другому сообщению
+var ErrAttachmentUnavailable = errors.New("attachment not found or already used")
+
+// Attachment - загруженный файл. Содержимое лежит в хранилище blob-объектов под ключом BlobKey
+type Attachment struct {
+    ID          string
+    RoomID      string
+    Uploader    string
+    Filename    string
+    ContentType string
+    Size        int64
+    BlobKey     string
+    MessageID   int // 0, пока вложение не прикреплено к сообщению
+
+    // Только для картинок
+    Width         int
+    Height        int
+    ThumbnailKey  string
+    ThumbnailType string
+
+    CreatedAt   time.Time
+}
+
+// Model возвращает вложение в виде, в котором оно уходит клиентам
+func (a Attachment) Model() models.Attachment {
+    m := models.Attachment{
+        ID:          a.ID,
+        Filename:    a.Filename,
+        ContentType: a.ContentType,
+        Size:        a.Size,
+        URL:         models.AttachmentURL(a.ID),
+        Width:       a.Width,
+        Height:      a.Height,
+    }
+    if a.ThumbnailKey != "" {
+        m.ThumbnailURL = models.ThumbnailURL(a.ID)
+    }
+    return m
+}
+
+const attachmentColumns = "id, room_id, uploader, filename, content_type, size, blob_key, COALESCE(message_id, 0), " +
+    "width, height, thumbnail_key, thumbnail_type, created_at"
+
+func scanAttachment(row interface{ Scan(...any) error }) (Attachment, error) {
+    var a Attachment
+    err := row.Scan(&a.ID, &a.RoomID, &a.Uploader, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.MessageID,
+        &a.Width, &a.Height, &a.ThumbnailKey, &a.ThumbnailType, &a.CreatedAt)
+    return a, err
+}
+
+// CreateAttachment сохраняет сведения о загруженном файле
+func (s *Storage) CreateAttachment(ctx context.Context, a Attachment) (Attachment, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO attachments (id, room_id, uploader, filename, content_type, size, blob_key,
+                                  width, height, thumbnail_key, thumbnail_type)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING created_at`,
+        a.ID, a.RoomID, a.Uploader, a.Filename, a.ContentType, a.Size, a.BlobKey,
+        a.Width, a.Height, a.ThumbnailKey, a.ThumbnailType,
+    ).Scan(&a.CreatedAt)
+    return a, err
+}
+
+// GetAttachment возвращает вложение или ErrNotFound
+func (s *Storage) GetAttachment(ctx context.Context, id string) (Attachment, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    a, err := scanAttachment(s.db.QueryRowContext(ctx,
+        "SELECT "+attachmentColumns+" FROM attachments WHERE id = $1", id))
+    if errors.Is(err, sql.ErrNoRows) {
+        return a, ErrNotFound
+    }
+    return a, err
+}
+
+// claimAttachments прикрепляет к только что вставленному сообщению вложения, загруженные
+// его автором в ту же комнату. Возвращает вложения в порядке из msg.Attachments
+func claimAttachments(ctx context.Context, tx *sql.Tx, msg Message) ([]Attachment, error) {
+    ids := make([]string, len(msg.Attachments))
+    for i, a := range msg.Attachments {
+        ids[i] = a.ID
+    }
+
+    rows, err := tx.QueryContext(ctx,
+        `UPDATE attachments SET message_id = $1
+         WHERE id = ANY($2) AND room_id = $3 AND uploader = $4
+           AND message_id IS NULL AND archived_message_id IS NULL
+         RETURNING `+attachmentColumns,
+        msg.ID, pq.Array(ids), msg.RoomID, msg.Username,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    claimed := make(map[string]Attachment, len(ids))
+    for rows.Next() {
+        a, err := scanAttachment(rows)
+        if err != nil {
+            return nil, err
+        }
+        claimed[a.ID] = a
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    result := make([]Attachment, 0, len(ids))
+    for _, id := range ids {
+        a, ok := claimed[id]
+        if !ok {
+            return nil, ErrAttachmentUnavailable
+        }
+        result = append(result, a)
+    }
+    return result, nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+    "context"
+    "time"
+
+    "Thoth/internal/models"
+)
+
+// SaveCallStats сохраняет отчет участника о качестве соединения в звонке
+func (s *Storage) SaveCallStats(ctx context.Context, roomID string, stats models.CallStats) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        `INSERT INTO call_stats (call_id, room_id, username, peer, rtt_ms, packet_loss, jitter_ms,
+            bitrate_in, bitrate_out, candidate_type, reported_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+        stats.CallID, roomID, stats.Username, stats.Peer, stats.RTT, stats.PacketLoss, stats.Jitter,
+        stats.BitrateIn, stats.BitrateOut, stats.CandidateType, stats.ReportedAt,
+    )
+    return err
+}
+
+// ListCallStats возвращает до limit отчетов звонка в порядке поступления
+func (s *Storage) ListCallStats(ctx context.Context, callID string, limit int) ([]models.CallStats, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT call_id, username, peer, rtt_ms, packet_loss, jitter_ms, bitrate_in, bitrate_out, candidate_type, reported_at
+         FROM call_stats WHERE call_id = $1
+         ORDER BY reported_at, id
+         LIMIT $2`,
+        callID, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var reports []models.CallStats
+    for rows.Next() {
+        var r models.CallStats
+        if err := rows.Scan(&r.CallID, &r.Username, &r.Peer, &r.RTT, &r.PacketLoss, &r.Jitter,
+            &r.BitrateIn, &r.BitrateOut, &r.CandidateType, &r.ReportedAt); err != nil {
+            return nil, err
+        }
+        reports = append(reports, r)
+    }
+    return reports, rows.Err()
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+
+    "Thoth/internal/models"
+)
+
+// SaveCall сохраняет завершенный звонок вместе с участниками
+func (s *Storage) SaveCall(ctx context.Context, call models.Call) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var startedAt *time.Time
+    if !call.StartedAt.IsZero() {
+        startedAt = &call.StartedAt
+    }
+    if _, err := tx.ExecContext(ctx,
+        `INSERT INTO calls (id, room_id, initiator, end_reason, created_at, started_at, ended_at, duration_seconds)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+        call.ID, call.RoomID, call.Initiator, call.EndReason, call.CreatedAt, startedAt, call.EndedAt, call.Duration,
+    ); err != nil {
+        return err
+    }
+
+    for _, p := range call.Participants {
+        if _, err := tx.ExecContext(ctx,
+            `INSERT INTO call_participants (call_id, username, joined_at, left_at, duration_seconds)
+             VALUES ($1, $2, $3, $4, $5)`,
+            call.ID, p.Username, p.JoinedAt, p.LeftAt, p.Duration,
+        ); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// ListCalls возвращает до limit звонков комнаты от новых к старым.
+// Ненулевой before - только созданные раньше этого момента
+func (s *Storage) ListCalls(ctx context.Context, roomID string, before time.Time, limit int) ([]models.Call, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    var beforeArg *time.Time
+    if !before.IsZero() {
+        beforeArg = &before
+    }
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT id, room_id, initiator, end_reason, created_at, started_at, ended_at, duration_seconds
+         FROM calls
+         WHERE room_id = $1 AND ($2::timestamptz IS NULL OR created_at < $2::timestamptz)
+         ORDER BY created_at DESC
+         LIMIT $3`,
+        roomID, beforeArg, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var calls []models.Call
+    index := make(map[string]int)
+    for rows.Next() {
+        var call models.Call
+        var startedAt sql.NullTime
+        if err := rows.Scan(&call.ID, &call.RoomID, &call.Initiator, &call.EndReason,
+            &call.CreatedAt, &startedAt, &call.EndedAt, &call.Duration); err != nil {
+            return nil, err
+        }
+        call.State = models.CallEnded
+        call.StartedAt = startedAt.Time
+        call.Participants = []models.CallParticipant{}
+        index[call.ID] = len(calls)
+        calls = append(calls, call)
+    }
+    if err := rows.Err(); err != nil || len(calls) == 0 {
+        return calls, err
+    }
+
+    ids := make([]string, 0, len(calls))
+    for _, c := range calls {
+        ids = append(ids, c.ID)
+    }
+    prows, err := s.db.QueryContext(ctx,
+        `SELECT call_id, username, joined_at, left_at, duration_seconds
+         FROM call_participants WHERE call_id = ANY($1) ORDER BY joined_at`,
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer prows.Close()
+    for prows.Next() {
+        var callID string
+        var p models.CallParticipant
+        if err := prows.Scan(&callID, &p.Username, &p.JoinedAt, &p.LeftAt, &p.Duration); err != nil {
+            return nil, err
+        }
+        i := index[callID]
+        calls[i].Participants = append(calls[i].Participants, p)
+    }
+    return calls, prows.Err()
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "Thoth/internal/models"
+)
+
+// LinkPreview - закешированный результат загрузки превью. OK = false означает,
+// что страница недоступна или без метаданных, и повторять попытку пока не нужно
+type LinkPreview struct {
+    models.LinkPreview
+    OK        bool
+    FetchedAt time.Time
+}
+
+// GetLinkPreview возвращает превью из кеша или ErrNotFound
+func (s *Storage) GetLinkPreview(ctx context.Context, url string) (LinkPreview, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    p := LinkPreview{LinkPreview: models.LinkPreview{URL: url}}
+    err := s.db.QueryRowContext(ctx,
+        "SELECT ok, title, description, image_url, site_name, fetched_at FROM link_previews WHERE url = $1",
+        url,
+    ).Scan(&p.OK, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return p, ErrNotFound
+    }
+    return p, err
+}
+
+// SaveLinkPreview сохраняет или обновляет превью в кеше
+func (s *Storage) SaveLinkPreview(ctx context.Context, p LinkPreview) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        `INSERT INTO link_previews (url, ok, title, description, image_url, site_name, fetched_at)
+         VALUES ($1, $2, $3, $4, $5, $6, now())
+         ON CONFLICT (url) DO UPDATE SET
+            ok = EXCLUDED.ok, title = EXCLUDED.title, description = EXCLUDED.description,
+            image_url = EXCLUDED.image_url, site_name = EXCLUDED.site_name, fetched_at = now()`,
+        p.URL, p.OK, p.Title, p.Description, p.ImageURL, p.SiteName,
+    )
+    return err
+}
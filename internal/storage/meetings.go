@@ -0,0 +1,127 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+
+    "Thoth/internal/models"
+)
+
+const meetingColumns = "id, room_id, title, organizer, starts_at, duration_seconds, invitees, created_at"
+
+func scanMeeting(row interface{ Scan(...interface{}) error }) (models.Meeting, error) {
+    var m models.Meeting
+    err := row.Scan(&m.ID, &m.RoomID, &m.Title, &m.Organizer, &m.StartsAt, &m.Duration,
+        pq.Array(&m.Invitees), &m.CreatedAt)
+    if m.Invitees == nil {
+        m.Invitees = []string{}
+    }
+    return m, err
+}
+
+// CreateMeeting сохраняет встречу и возвращает ее с временем создания
+func (s *Storage) CreateMeeting(ctx context.Context, m models.Meeting) (models.Meeting, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    return scanMeeting(s.db.QueryRowContext(ctx,
+        `INSERT INTO meetings (id, room_id, title, organizer, starts_at, duration_seconds, invitees)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         RETURNING `+meetingColumns,
+        m.ID, m.RoomID, m.Title, m.Organizer, m.StartsAt, m.Duration, pq.Array(m.Invitees),
+    ))
+}
+
+// GetMeeting возвращает встречу или ErrNotFound
+func (s *Storage) GetMeeting(ctx context.Context, id string) (models.Meeting, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    m, err := scanMeeting(s.db.QueryRowContext(ctx,
+        "SELECT "+meetingColumns+" FROM meetings WHERE id = $1", id))
+    if errors.Is(err, sql.ErrNoRows) {
+        return m, ErrNotFound
+    }
+    return m, err
+}
+
+// ListMeetings возвращает до limit встреч комнаты, которые закончатся после after, по времени начала
+func (s *Storage) ListMeetings(ctx context.Context, roomID string, after time.Time, limit int) ([]models.Meeting, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    return s.queryMeetings(ctx,
+        `SELECT `+meetingColumns+` FROM meetings
+         WHERE room_id = $1 AND starts_at + duration_seconds * interval '1 second' > $2
+         ORDER BY starts_at
+         LIMIT $3`,
+        roomID, after, limit,
+    )
+}
+
+// DeleteMeeting отменяет встречу; ссылки на нее перестают работать
+func (s *Storage) DeleteMeeting(ctx context.Context, id string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx, "DELETE FROM meetings WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// DueMeetings возвращает еще не закончившиеся встречи, которые начнутся до before
+// и по которым отправлено меньше sent напоминаний
+func (s *Storage) DueMeetings(ctx context.Context, now, before time.Time, sent int) ([]models.Meeting, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    return s.queryMeetings(ctx,
+        `SELECT `+meetingColumns+` FROM meetings
+         WHERE reminders_sent < $3 AND starts_at <= $2
+           AND starts_at + duration_seconds * interval '1 second' > $1
+         ORDER BY starts_at`,
+        now, before, sent,
+    )
+}
+
+// ClaimMeetingReminder отмечает, что по встрече отправлено sent напоминаний. false - другой
+// экземпляр сервера уже отправил это напоминание, или встречу отменили
+func (s *Storage) ClaimMeetingReminder(ctx context.Context, id string, sent int) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        "UPDATE meetings SET reminders_sent = $2 WHERE id = $1 AND reminders_sent < $2", id, sent)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
+
+func (s *Storage) queryMeetings(ctx context.Context, query string, args ...interface{}) ([]models.Meeting, error) {
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var meetings []models.Meeting
+    for rows.Next() {
+        m, err := scanMeeting(rows)
+        if err != nil {
+            return nil, err
+        }
+        meetings = append(meetings, m)
+    }
+    return meetings, rows.Err()
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+
+    "Thoth/internal/models"
+)
+
+// Mention - упоминание пользователя Username в сообщении MessageID
+type Mention struct {
+    ID        int64
+    MessageID int
+    RoomID    string
+    Username  string
+    Author    string
+    Kind      string // models.MentionUser или models.MentionRoom
+    Content   string // Текст сообщения, заполняется только ListMentions
+    CreatedAt time.Time
+    ReadAt    sql.NullTime
+}
+
+// Model возвращает упоминание в виде, который отдается упомянутому пользователю
+func (m Mention) Model() models.Mention {
+    return models.Mention{
+        ID:        m.ID,
+        MessageID: m.MessageID,
+        RoomID:    m.RoomID,
+        Author:    m.Author,
+        Kind:      m.Kind,
+        Content:   m.Content,
+        Read:      m.ReadAt.Valid,
+        CreatedAt: m.CreatedAt,
+    }
+}
+
+// insertMentions сохраняет упоминания сообщения внутри транзакции InsertMessage.
+// Упомянуть можно только участника комнаты, @room адресуется всем ее участникам;
+// автор сам себя не упоминает
+func insertMentions(ctx context.Context, tx *sql.Tx, msg Message) ([]Mention, error) {
+    rows, err := tx.QueryContext(ctx,
+        `INSERT INTO mentions (message_id, room_id, username, author, kind)
+         SELECT $1, $2, m.username, $3, CASE WHEN m.username = ANY($4) THEN 'user' ELSE 'room' END
+         FROM room_members m
+         WHERE m.room_id = $2 AND m.username <> $3 AND (m.username = ANY($4) OR $5)
+         ON CONFLICT (message_id, username) DO NOTHING
+         RETURNING id, username, kind, created_at`,
+        msg.ID, msg.RoomID, msg.Username, pq.Array(msg.Mentions), msg.MentionRoom,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var mentions []Mention
+    for rows.Next() {
+        m := Mention{MessageID: msg.ID, RoomID: msg.RoomID, Author: msg.Username}
+        if err := rows.Scan(&m.ID, &m.Username, &m.Kind, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        mentions = append(mentions, m)
+    }
+    return mentions, rows.Err()
+}
+
+// ListMentions возвращает упоминания пользователя от новых к старым.
+// beforeID > 0 продолжает список с упоминаний старше указанного
+func (s *Storage) ListMentions(ctx context.Context, username string, unreadOnly bool, beforeID int64, limit int) ([]Mention, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT mn.id, mn.message_id, mn.room_id, mn.username, mn.author, mn.kind, m.content, mn.created_at, mn.read_at
+         FROM mentions mn JOIN messages m ON m.id = mn.message_id
+         WHERE mn.username = $1 AND (NOT $2 OR mn.read_at IS NULL) AND ($3::bigint = 0 OR mn.id < $3)
+         ORDER BY mn.id DESC LIMIT $4`,
+        username, unreadOnly, beforeID, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var mentions []Mention
+    for rows.Next() {
+        var m Mention
+        if err := rows.Scan(&m.ID, &m.MessageID, &m.RoomID, &m.Username, &m.Author, &m.Kind, &m.Content, &m.CreatedAt, &m.ReadAt); err != nil {
+            return nil, err
+        }
+        mentions = append(mentions, m)
+    }
+    return mentions, rows.Err()
+}
+
+// MarkMentionsRead отмечает прочитанными упоминания пользователя с ID не больше upToID
+// (все, если upToID = 0). Возвращает число отмеченных упоминаний
+func (s *Storage) MarkMentionsRead(ctx context.Context, username string, upToID int64) (int64, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        "UPDATE mentions SET read_at = now() WHERE username = $1 AND read_at IS NULL AND ($2::bigint = 0 OR id <= $2)",
+        username, upToID,
+    )
+    if err != nil {
+        return 0, err
+    }
+    return res.RowsAffected()
+}
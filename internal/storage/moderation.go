@@ -0,0 +1,72 @@
+package storage
+
+import (
+    "context"
+    "time"
+)
+
+// ModerationEvent - решение фильтра сообщений (redact, reject, shadow_mute) с исходным текстом
+type ModerationEvent struct {
+    ID        int64
+    RoomID    string
+    Username  string
+    Filter    string
+    Action    string
+    Reason    string
+    Content   string
+    CreatedAt time.Time
+}
+
+// ModerationQuery - выборка журнала. Пустые поля не ограничивают выборку,
+// BeforeID > 0 - только записи старше указанной
+type ModerationQuery struct {
+    RoomID   string
+    Username string
+    Action   string
+    BeforeID int64
+    Limit    int
+}
+
+func (s *Storage) SaveModerationEvent(ctx context.Context, e ModerationEvent) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        `INSERT INTO moderation_events (room_id, username, filter, action, reason, content)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+        e.RoomID, e.Username, e.Filter, e.Action, e.Reason, e.Content,
+    )
+    return err
+}
+
+// ListModerationEvents возвращает записи журнала от новых к старым
+func (s *Storage) ListModerationEvents(ctx context.Context, q ModerationQuery) ([]ModerationEvent, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT id, room_id, username, filter, action, reason, content, created_at
+         FROM moderation_events
+         WHERE ($1 = '' OR room_id = $1)
+           AND ($2 = '' OR username = $2)
+           AND ($3 = '' OR action = $3)
+           AND ($4::bigint = 0 OR id < $4::bigint)
+         ORDER BY id DESC
+         LIMIT $5`,
+        q.RoomID, q.Username, q.Action, q.BeforeID, q.Limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var events []ModerationEvent
+    for rows.Next() {
+        var e ModerationEvent
+        if err := rows.Scan(&e.ID, &e.RoomID, &e.Username, &e.Filter, &e.Action, &e.Reason, &e.Content, &e.CreatedAt); err != nil {
+            return nil, err
+        }
+        events = append(events, e)
+    }
+    return events, rows.Err()
+}
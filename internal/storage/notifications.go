@@ -0,0 +1,181 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// NotificationPreferences - настройки email-уведомлений пользователя.
+// Delay = 0 означает задержку по умолчанию, заданную на сервере.
+// Письма уходят только на адрес, подтвержденный по ссылке (EmailConfirmed)
+type NotificationPreferences struct {
+    Username       string
+    Email          string
+    EmailEnabled   bool
+    EmailConfirmed bool
+    Delay          time.Duration
+    UpdatedAt      time.Time
+}
+
+// GetNotificationPreferences возвращает настройки пользователя или ErrNotFound
+func (s *Storage) GetNotificationPreferences(ctx context.Context, username string) (NotificationPreferences, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    p := NotificationPreferences{Username: username}
+    var delay sql.NullInt64
+    err := s.db.QueryRowContext(ctx,
+        "SELECT email, email_enabled, email_confirmed, delay_seconds, updated_at FROM notification_preferences WHERE username = $1",
+        username,
+    ).Scan(&p.Email, &p.EmailEnabled, &p.EmailConfirmed, &delay, &p.UpdatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return p, ErrNotFound
+    }
+    p.Delay = time.Duration(delay.Int64) * time.Second
+    return p, err
+}
+
+// SaveNotificationPreferences создает или заменяет настройки пользователя. Новый адрес
+// считается неподтвержденным; EmailConfirmed в p игнорируется и возвращается из базы
+func (s *Storage) SaveNotificationPreferences(ctx context.Context, p NotificationPreferences) (NotificationPreferences, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    var delay sql.NullInt64
+    if p.Delay > 0 {
+        delay = sql.NullInt64{Int64: int64(p.Delay / time.Second), Valid: true}
+    }
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO notification_preferences (username, email, email_enabled, delay_seconds)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (username) DO UPDATE
+         SET email = $2, email_enabled = $3, delay_seconds = $4, updated_at = now(),
+             email_confirmed = notification_preferences.email_confirmed AND notification_preferences.email = $2,
+             confirm_sent_at = CASE WHEN notification_preferences.email = $2
+                                    THEN notification_preferences.confirm_sent_at END
+         RETURNING email_confirmed, updated_at`,
+        p.Username, p.Email, p.EmailEnabled, delay,
+    ).Scan(&p.EmailConfirmed, &p.UpdatedAt)
+    return p, err
+}
+
+// ReserveEmailConfirmation отмечает отправку письма с подтверждением адреса. false - письмо
+// уже отправлялось меньше cooldown назад: так сервер нельзя заставить слать письма на чужой адрес потоком
+func (s *Storage) ReserveEmailConfirmation(ctx context.Context, username string, cooldown time.Duration) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        `UPDATE notification_preferences SET confirm_sent_at = now()
+         WHERE username = $1 AND NOT email_confirmed AND email <> ''
+           AND (confirm_sent_at IS NULL OR confirm_sent_at < now() - make_interval(secs => $2))`,
+        username, int64(cooldown/time.Second),
+    )
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
+
+// ConfirmEmail подтверждает адрес email пользователя. ErrNotFound - адрес с тех пор сменился
+func (s *Storage) ConfirmEmail(ctx context.Context, username, email string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        `UPDATE notification_preferences SET email_confirmed = true, updated_at = now()
+         WHERE username = $1 AND email = $2`,
+        username, email,
+    )
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// DisableEmailNotifications выключает письма пользователю (отписка по ссылке из письма)
+func (s *Storage) DisableEmailNotifications(ctx context.Context, username string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        "UPDATE notification_preferences SET email_enabled = false, updated_at = now() WHERE username = $1",
+        username,
+    )
+    return err
+}
+
+// MentionDigest - непрочитанные упоминания одного пользователя, еще не отправленные на почту
+type MentionDigest struct {
+    Username string
+    Email    string
+    Mentions []Mention
+}
+
+// PendingMentionDigests собирает дайджесты для пользователей с включенными письмами на подтвержденный адрес,
+// у которых самое старое неотправленное упоминание ждет дольше их задержки
+// (defaultDelay, если своя не задана). В дайджест попадают все их неотправленные упоминания
+func (s *Storage) PendingMentionDigests(ctx context.Context, defaultDelay time.Duration, limit int) ([]MentionDigest, error) {
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `WITH due AS (
+             SELECT p.username, p.email
+             FROM notification_preferences p
+             WHERE p.email_enabled AND p.email_confirmed AND p.email <> '' AND EXISTS (
+                 SELECT 1 FROM mentions mn
+                 WHERE mn.username = p.username AND mn.notified_at IS NULL AND mn.read_at IS NULL
+                   AND mn.created_at <= now() - make_interval(secs => COALESCE(p.delay_seconds, $1))
+             )
+             ORDER BY p.username
+             LIMIT $2
+         )
+         SELECT due.username, due.email, mn.id, mn.message_id, mn.room_id, mn.author, mn.kind, m.content, mn.created_at
+         FROM due
+         JOIN mentions mn ON mn.username = due.username AND mn.notified_at IS NULL AND mn.read_at IS NULL
+         JOIN messages m ON m.id = mn.message_id
+         ORDER BY due.username, mn.id`,
+        int64(defaultDelay/time.Second), limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var digests []MentionDigest
+    for rows.Next() {
+        var username, email string
+        var m Mention
+        if err := rows.Scan(&username, &email, &m.ID, &m.MessageID, &m.RoomID, &m.Author, &m.Kind, &m.Content, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        m.Username = username
+        if len(digests) == 0 || digests[len(digests)-1].Username != username {
+            digests = append(digests, MentionDigest{Username: username, Email: email})
+        }
+        d := &digests[len(digests)-1]
+        d.Mentions = append(d.Mentions, m)
+    }
+    return digests, rows.Err()
+}
+
+// MarkMentionsNotified отмечает упоминания как обработанные, чтобы они не попали в следующий дайджест
+func (s *Storage) MarkMentionsNotified(ctx context.Context, ids []int64) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        "UPDATE mentions SET notified_at = now() WHERE id = ANY($1)",
+        pq.Array(ids),
+    )
+    return err
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// Статусы доставки исходящего вебхука
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryFailed    = "failed"
+)
+
+// OutgoingWebhook - подписка внешнего сервиса на события комнаты
+type OutgoingWebhook struct {
+    ID        string
+    RoomID    string
+    URL       string
+    Secret    string
+    Events    []string
+    Keywords  []string
+    Active    bool
+    CreatedAt time.Time
+}
+
+// WebhookDelivery - элемент очереди доставки вместе с адресом и секретом вебхука
+type WebhookDelivery struct {
+    ID            int64
+    WebhookID     string
+    EventType     string
+    Payload       []byte
+    Status        string
+    Attempts      int
+    NextAttemptAt time.Time
+    LastError     string
+    CreatedAt     time.Time
+    DeliveredAt   *time.Time
+
+    URL    string
+    Secret string
+}
+
+// DeliveryAttempt - результат одной попытки доставки
+type DeliveryAttempt struct {
+    DeliveryID  int64
+    Attempt     int
+    StatusCode  int
+    Error       string
+    Duration    time.Duration
+    AttemptedAt time.Time
+
+    // Итоговый статус доставки после попытки и время следующей попытки для pending
+    Status        string
+    NextAttemptAt time.Time
+}
+
+func (s *Storage) CreateOutgoingWebhook(ctx context.Context, hook OutgoingWebhook) (OutgoingWebhook, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    if hook.Keywords == nil {
+        hook.Keywords = []string{}
+    }
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO outgoing_webhooks (id, room_id, url, secret, events, keywords)
+         VALUES ($1, $2, $3, $4, $5, $6) RETURNING active, created_at`,
+        hook.ID, hook.RoomID, hook.URL, hook.Secret, pq.Array(hook.Events), pq.Array(hook.Keywords),
+    ).Scan(&hook.Active, &hook.CreatedAt)
+    return hook, err
+}
+
+// ListOutgoingWebhooks возвращает вебхуки комнаты. Если eventType не пустой -
+// только активные вебхуки, подписанные на это событие
+func (s *Storage) ListOutgoingWebhooks(ctx context.Context, roomID, eventType string) ([]OutgoingWebhook, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    query := `SELECT id, room_id, url, secret, events, keywords, active, created_at
+              FROM outgoing_webhooks WHERE room_id = $1`
+    args := []interface{}{roomID}
+    if eventType != "" {
+        query += " AND active AND $2 = ANY(events)"
+        args = append(args, eventType)
+    }
+    query += " ORDER BY created_at"
+
+    rows, err := s.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var hooks []OutgoingWebhook
+    for rows.Next() {
+        var hook OutgoingWebhook
+        if err := rows.Scan(&hook.ID, &hook.RoomID, &hook.URL, &hook.Secret,
+            pq.Array(&hook.Events), pq.Array(&hook.Keywords), &hook.Active, &hook.CreatedAt); err != nil {
+            return nil, err
+        }
+        hooks = append(hooks, hook)
+    }
+    return hooks, rows.Err()
+}
+
+func (s *Storage) DeleteOutgoingWebhook(ctx context.Context, id string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx, "DELETE FROM outgoing_webhooks WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// EnqueueWebhookDelivery ставит событие в очередь доставки вебхука
+func (s *Storage) EnqueueWebhookDelivery(ctx context.Context, webhookID, eventType string, payload []byte) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := s.db.ExecContext(ctx,
+        "INSERT INTO webhook_deliveries (webhook_id, event_type, payload) VALUES ($1, $2, $3)",
+        webhookID, eventType, payload,
+    )
+    return err
+}
+
+// ClaimWebhookDeliveries забирает до limit готовых к отправке доставок и блокирует их на lease.
+// SKIP LOCKED позволяет нескольким экземплярам сервера разбирать очередь параллельно
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `WITH due AS (
+            SELECT id FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt_at <= now()
+              AND (locked_until IS NULL OR locked_until < now())
+            ORDER BY next_attempt_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+         ), claimed AS (
+            UPDATE webhook_deliveries d
+            SET locked_until = now() + make_interval(secs => $2), attempts = d.attempts + 1
+            FROM due WHERE d.id = due.id
+            RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts,
+                      d.next_attempt_at, d.last_error, d.created_at
+         )
+         SELECT c.id, c.webhook_id, c.event_type, c.payload, c.status, c.attempts,
+                c.next_attempt_at, c.last_error, c.created_at, w.url, w.secret
+         FROM claimed c JOIN outgoing_webhooks w ON w.id = c.webhook_id`,
+        limit, lease.Seconds(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var deliveries []WebhookDelivery
+    for rows.Next() {
+        var d WebhookDelivery
+        if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+            &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+            return nil, err
+        }
+        deliveries = append(deliveries, d)
+    }
+    return deliveries, rows.Err()
+}
+
+// RecordDeliveryAttempt записывает попытку в журнал и обновляет состояние доставки
+func (s *Storage) RecordDeliveryAttempt(ctx context.Context, attempt DeliveryAttempt) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+        attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error,
+        attempt.Duration.Milliseconds(), attempt.AttemptedAt,
+    ); err != nil {
+        return err
+    }
+
+    var deliveredAt *time.Time
+    if attempt.Status == DeliveryDelivered {
+        deliveredAt = &attempt.AttemptedAt
+    }
+    if _, err := tx.ExecContext(ctx,
+        `UPDATE webhook_deliveries
+         SET status = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5, locked_until = NULL
+         WHERE id = $1`,
+        attempt.DeliveryID, attempt.Status, attempt.NextAttemptAt, attempt.Error, deliveredAt,
+    ); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// ListWebhookDeliveries возвращает журнал последних доставок вебхука
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDelivery, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+         FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC LIMIT $2`,
+        webhookID, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var deliveries []WebhookDelivery
+    for rows.Next() {
+        var d WebhookDelivery
+        var deliveredAt sql.NullTime
+        if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+            &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+            return nil, err
+        }
+        if deliveredAt.Valid {
+            d.DeliveredAt = &deliveredAt.Time
+        }
+        deliveries = append(deliveries, d)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if len(deliveries) == 0 {
+        var exists bool
+        if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM outgoing_webhooks WHERE id = $1)", webhookID).Scan(&exists); err != nil {
+            return nil, err
+        }
+        if !exists {
+            return nil, ErrNotFound
+        }
+    }
+    return deliveries, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+    "context"
+    "time"
+)
+
+// PushSubscription - подписка браузера пользователя на Web Push
+type PushSubscription struct {
+    ID        int64
+    Username  string
+    Endpoint  string
+    P256dh    string
+    Auth      string
+    CreatedAt time.Time
+}
+
+// SavePushSubscription сохраняет подписку. Endpoint уникален: если браузер
+// переподписался под другим пользователем, подписка переходит к нему
+func (s *Storage) SavePushSubscription(ctx context.Context, sub PushSubscription) (PushSubscription, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO push_subscriptions (username, endpoint, p256dh, auth)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (endpoint) DO UPDATE SET username = $1, p256dh = $3, auth = $4
+         RETURNING id, created_at`,
+        sub.Username, sub.Endpoint, sub.P256dh, sub.Auth,
+    ).Scan(&sub.ID, &sub.CreatedAt)
+    return sub, err
+}
+
+func (s *Storage) ListPushSubscriptions(ctx context.Context, username string) ([]PushSubscription, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        "SELECT id, username, endpoint, p256dh, auth, created_at FROM push_subscriptions WHERE username = $1 ORDER BY id",
+        username,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var subs []PushSubscription
+    for rows.Next() {
+        var sub PushSubscription
+        if err := rows.Scan(&sub.ID, &sub.Username, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.CreatedAt); err != nil {
+            return nil, err
+        }
+        subs = append(subs, sub)
+    }
+    return subs, rows.Err()
+}
+
+// DeletePushSubscription удаляет подписку по endpoint. Пустой username - без проверки владельца
+// (подписку отверг push-сервис). Возвращает ErrNotFound, если удалять нечего
+func (s *Storage) DeletePushSubscription(ctx context.Context, username, endpoint string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        "DELETE FROM push_subscriptions WHERE endpoint = $1 AND ($2 = '' OR username = $2)",
+        endpoint, username,
+    )
+    if err != nil {
+        return err
+    }
+    n, err := res.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
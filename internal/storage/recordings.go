@@ -0,0 +1,123 @@
+package storage
+
+import (
+    "context"
+    "time"
+
+    "github.com/lib/pq"
+
+    "Thoth/internal/models"
+)
+
+// RecordingFile - файл записи звонка: вложение с дорожкой участника Username
+type RecordingFile struct {
+    Attachment
+    Username string
+    Kind     string
+}
+
+// SaveRecording сохраняет завершенную запись вместе с ее файлами. Содержимое файлов
+// к этому моменту уже должно лежать в хранилище blob-объектов
+func (s *Storage) SaveRecording(ctx context.Context, rec models.Recording, files []RecordingFile) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        `INSERT INTO recordings (id, room_id, call_id, started_by, started_at, ended_at)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+        rec.ID, rec.RoomID, rec.CallID, rec.StartedBy, rec.StartedAt, rec.EndedAt,
+    ); err != nil {
+        return err
+    }
+
+    for _, f := range files {
+        if _, err := tx.ExecContext(ctx,
+            `INSERT INTO attachments (id, room_id, uploader, filename, content_type, size, blob_key)
+             VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+            f.ID, f.RoomID, f.Uploader, f.Filename, f.ContentType, f.Size, f.BlobKey,
+        ); err != nil {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx,
+            `INSERT INTO recording_files (recording_id, attachment_id, username, kind) VALUES ($1, $2, $3, $4)`,
+            rec.ID, f.ID, f.Username, f.Kind,
+        ); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// ListRecordings возвращает до limit записей комнаты от новых к старым.
+// Ненулевой before - только начатые раньше этого момента
+func (s *Storage) ListRecordings(ctx context.Context, roomID string, before time.Time, limit int) ([]models.Recording, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    var beforeArg *time.Time
+    if !before.IsZero() {
+        beforeArg = &before
+    }
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT id, room_id, call_id, started_by, started_at, ended_at
+         FROM recordings
+         WHERE room_id = $1 AND ($2::timestamptz IS NULL OR started_at < $2::timestamptz)
+         ORDER BY started_at DESC
+         LIMIT $3`,
+        roomID, beforeArg, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var recordings []models.Recording
+    index := make(map[string]int)
+    for rows.Next() {
+        var rec models.Recording
+        if err := rows.Scan(&rec.ID, &rec.RoomID, &rec.CallID, &rec.StartedBy, &rec.StartedAt, &rec.EndedAt); err != nil {
+            return nil, err
+        }
+        rec.Files = []models.RecordingFile{}
+        index[rec.ID] = len(recordings)
+        recordings = append(recordings, rec)
+    }
+    if err := rows.Err(); err != nil || len(recordings) == 0 {
+        return recordings, err
+    }
+
+    ids := make([]string, 0, len(recordings))
+    for _, rec := range recordings {
+        ids = append(ids, rec.ID)
+    }
+    frows, err := s.db.QueryContext(ctx,
+        `SELECT f.recording_id, f.username, f.kind, `+attachmentColumns+`
+         FROM recording_files f JOIN attachments ON attachments.id = f.attachment_id
+         WHERE f.recording_id = ANY($1) ORDER BY f.username, f.kind, attachments.created_at`,
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer frows.Close()
+    for frows.Next() {
+        var recordingID string
+        var f RecordingFile
+        a := &f.Attachment
+        if err := frows.Scan(&recordingID, &f.Username, &f.Kind,
+            &a.ID, &a.RoomID, &a.Uploader, &a.Filename, &a.ContentType, &a.Size, &a.BlobKey, &a.MessageID,
+            &a.Width, &a.Height, &a.ThumbnailKey, &a.ThumbnailType, &a.CreatedAt); err != nil {
+            return nil, err
+        }
+        i := index[recordingID]
+        recordings[i].Files = append(recordings[i].Files, models.RecordingFile{Username: f.Username, Kind: f.Kind, Attachment: a.Model()})
+    }
+    return recordings, frows.Err()
+}
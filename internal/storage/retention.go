@@ -0,0 +1,156 @@
+package storage
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// GlobalRetentionRoom - ключ глобальной политики хранения, действующей для комнат без своей
+const GlobalRetentionRoom = "*"
+
+// RetentionPolicy ограничивает хранение сообщений комнаты. Нулевые MaxAge и MaxCount - без ограничения
+type RetentionPolicy struct {
+    RoomID    string
+    MaxAge    time.Duration
+    MaxCount  int
+    Archive   bool // Переносить удаляемые сообщения в messages_archive
+    UpdatedAt time.Time
+}
+
+func (s *Storage) UpsertRetentionPolicy(ctx context.Context, p RetentionPolicy) (RetentionPolicy, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    err := s.db.QueryRowContext(ctx,
+        `INSERT INTO retention_policies (room_id, max_age_seconds, max_count, archive)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (room_id) DO UPDATE
+         SET max_age_seconds = EXCLUDED.max_age_seconds, max_count = EXCLUDED.max_count,
+             archive = EXCLUDED.archive, updated_at = now()
+         RETURNING updated_at`,
+        p.RoomID, int64(p.MaxAge.Seconds()), p.MaxCount, p.Archive,
+    ).Scan(&p.UpdatedAt)
+    return p, err
+}
+
+func (s *Storage) ListRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        "SELECT room_id, max_age_seconds, max_count, archive, updated_at FROM retention_policies ORDER BY room_id",
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var policies []RetentionPolicy
+    for rows.Next() {
+        var p RetentionPolicy
+        var maxAge int64
+        if err := rows.Scan(&p.RoomID, &maxAge, &p.MaxCount, &p.Archive, &p.UpdatedAt); err != nil {
+            return nil, err
+        }
+        p.MaxAge = time.Duration(maxAge) * time.Second
+        policies = append(policies, p)
+    }
+    return policies, rows.Err()
+}
+
+func (s *Storage) DeleteRetentionPolicy(ctx context.Context, roomID string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx, "DELETE FROM retention_policies WHERE room_id = $1", roomID)
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
+
+// ListMessageRooms возвращает комнаты, в которых есть сообщения
+func (s *Storage) ListMessageRooms(ctx context.Context) ([]string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT room_id FROM messages ORDER BY room_id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var rooms []string
+    for rows.Next() {
+        var room string
+        if err := rows.Scan(&room); err != nil {
+            return nil, err
+        }
+        rooms = append(rooms, room)
+    }
+    return rooms, rows.Err()
+}
+
+// purgeBatch удаляет (и при archive - архивирует) сообщения, отобранные запросом selectIDs.
+// Вложения удаляемых сообщений удаляются вместе с ними, а вложения архивируемых остаются
+// и получают archived_message_id. Возвращает число сообщений и ключи blob-объектов удаленных
+// вложений: сами файлы удаляет вызывающий. Одна пачка - одна короткая транзакция, поэтому
+// долгих блокировок таблицы нет
+func (s *Storage) purgeBatch(ctx context.Context, selectIDs string, archive bool, args ...interface{}) (int, []string, error) {
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    args = append(args, archive)
+    archiveParam := len(args)
+
+    var n int
+    var blobKeys pq.StringArray
+    err := s.db.QueryRowContext(ctx,
+        `WITH doomed AS (`+selectIDs+`),
+         deleted AS (
+            DELETE FROM messages m USING doomed WHERE m.id = doomed.id RETURNING m.*
+         ),
+         archived AS (
+            INSERT INTO messages_archive (id, room_id, created_at, data)
+            SELECT d.id, d.room_id, d.created_at, to_jsonb(d.*) - 'search_vector'
+            FROM deleted d WHERE $`+strconv.Itoa(archiveParam)+`::boolean
+            ON CONFLICT (id) DO NOTHING
+         ),
+         files AS (
+            DELETE FROM attachments a USING doomed
+            WHERE a.message_id = doomed.id AND NOT $`+strconv.Itoa(archiveParam)+`::boolean
+            RETURNING a.blob_key, a.thumbnail_key
+         ),
+         kept AS (
+            UPDATE attachments a SET archived_message_id = a.message_id FROM doomed
+            WHERE a.message_id = doomed.id AND $`+strconv.Itoa(archiveParam)+`::boolean
+         )
+         SELECT (SELECT count(*) FROM deleted),
+                ARRAY(SELECT blob_key FROM files
+                      UNION ALL SELECT thumbnail_key FROM files WHERE thumbnail_key <> '')`,
+        args...,
+    ).Scan(&n, &blobKeys)
+    return n, blobKeys, err
+}
+
+// PurgeMessagesOlderThan удаляет до batch сообщений комнаты, созданных раньше cutoff
+func (s *Storage) PurgeMessagesOlderThan(ctx context.Context, roomID string, cutoff time.Time, batch int, archive bool) (int, []string, error) {
+    return s.purgeBatch(ctx,
+        `SELECT id FROM messages WHERE room_id = $1 AND created_at < $2 ORDER BY created_at LIMIT $3`,
+        archive, roomID, cutoff, batch,
+    )
+}
+
+// PurgeMessagesOverCount удаляет до batch самых старых сообщений комнаты сверх maxCount последних
+func (s *Storage) PurgeMessagesOverCount(ctx context.Context, roomID string, maxCount, batch int, archive bool) (int, []string, error) {
+    return s.purgeBatch(ctx,
+        `SELECT id FROM messages WHERE room_id = $1 ORDER BY created_at DESC, id DESC OFFSET $2 LIMIT $3`,
+        archive, roomID, maxCount, batch,
+    )
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+
+    "Thoth/internal/models"
+)
+
+// Роли участников комнаты
+const (
+    RoleOwner  = "owner"
+    RoleMember = "member"
+)
+
+// RoomMember - пользователь, хотя бы раз заходивший в комнату
+type RoomMember struct {
+    RoomID     string
+    Username   string
+    Role       string
+    JoinedAt   time.Time
+    LastSeenAt time.Time
+}
+
+// TouchRoomMember отмечает вход пользователя в комнату. Первый участник комнаты становится ее владельцем.
+// created сообщает, что участник добавлен этим вызовом, а не вошел повторно
+func (s *Storage) TouchRoomMember(ctx context.Context, roomID, username string) (m RoomMember, created bool, err error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    m = RoomMember{RoomID: roomID, Username: username}
+    err = s.db.QueryRowContext(ctx,
+        `INSERT INTO room_members (room_id, username, role)
+         VALUES ($1, $2, CASE WHEN EXISTS (SELECT 1 FROM room_members WHERE room_id = $1) THEN 'member' ELSE 'owner' END)
+         ON CONFLICT (room_id, username) DO UPDATE SET last_seen_at = now()
+         RETURNING role, joined_at, last_seen_at, xmax = 0`,
+        roomID, username,
+    ).Scan(&m.Role, &m.JoinedAt, &m.LastSeenAt, &created)
+    return m, created, err
+}
+
+// ClaimUsername занимает имя за пользователем. true - имя было свободно и занято этим вызовом
+func (s *Storage) ClaimUsername(ctx context.Context, username string) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        "INSERT INTO usernames (username) VALUES ($1) ON CONFLICT (username) DO NOTHING", username)
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
+
+// GetRoomMember возвращает участника или ErrNotFound
+func (s *Storage) GetRoomMember(ctx context.Context, roomID, username string) (RoomMember, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    m := RoomMember{RoomID: roomID, Username: username}
+    err := s.db.QueryRowContext(ctx,
+        "SELECT role, joined_at, last_seen_at FROM room_members WHERE room_id = $1 AND username = $2",
+        roomID, username,
+    ).Scan(&m.Role, &m.JoinedAt, &m.LastSeenAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return m, ErrNotFound
+    }
+    return m, err
+}
+
+func (s *Storage) ListRoomMembers(ctx context.Context, roomID string) ([]RoomMember, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        "SELECT room_id, username, role, joined_at, last_seen_at FROM room_members WHERE room_id = $1 ORDER BY joined_at",
+        roomID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var members []RoomMember
+    for rows.Next() {
+        var m RoomMember
+        if err := rows.Scan(&m.RoomID, &m.Username, &m.Role, &m.JoinedAt, &m.LastSeenAt); err != nil {
+            return nil, err
+        }
+        members = append(members, m)
+    }
+    return members, rows.Err()
+}
+
+// ImportRoomMember добавляет участника с сохранением роли и дат. Существующие записи не меняются.
+// Возвращает true, если участник был добавлен
+func (s *Storage) ImportRoomMember(ctx context.Context, m RoomMember) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx,
+        `INSERT INTO room_members (room_id, username, role, joined_at, last_seen_at)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (room_id, username) DO NOTHING`,
+        m.RoomID, m.Username, m.Role, m.JoinedAt, m.LastSeenAt,
+    )
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
+
+// ExportMessages передает в fn все сообщения комнаты в хронологическом порядке.
+// Сообщения читаются страницами, чтобы не держать долгий курсор на большой комнате
+func (s *Storage) ExportMessages(ctx context.Context, roomID string, fn func(Message) error) error {
+    const pageSize = 1000
+
+    lastID := 0
+    for {
+        page, err := s.exportPage(ctx, roomID, lastID, pageSize)
+        if err != nil {
+            return err
+        }
+        for _, m := range page {
+            if err := fn(m); err != nil {
+                return err
+            }
+            lastID = m.ID
+        }
+        if len(page) < pageSize {
+            return nil
+        }
+    }
+}
+
+func (s *Storage) exportPage(ctx context.Context, roomID string, afterID, limit int) ([]Message, error) {
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT id, uid, username, content, format, html, room_id, embeds, created_at
+         FROM messages WHERE room_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+        roomID, afterID, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var page []Message
+    for rows.Next() {
+        var m Message
+        var embeds []byte
+        if err := rows.Scan(&m.ID, &m.UID, &m.Username, &m.Content, &m.Format, &m.HTML, &m.RoomID, &embeds, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        if m.Embeds, err = unmarshalEmbeds(embeds); err != nil {
+            return nil, err
+        }
+        page = append(page, m)
+    }
+    return page, rows.Err()
+}
+
+// ImportMessage вставляет сообщение с его UID и временем создания.
+// Повторный импорт того же сообщения ничего не меняет. Возвращает true, если сообщение было добавлено
+func (s *Storage) ImportMessage(ctx context.Context, msg Message) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    embeds, err := marshalEmbeds(msg.Embeds)
+    if err != nil {
+        return false, err
+    }
+
+    if msg.Format == "" {
+        msg.Format = models.FormatPlain
+    }
+
+    res, err := s.db.ExecContext(ctx,
+        `INSERT INTO messages (uid, username, content, format, html, room_id, embeds, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+         ON CONFLICT (uid) DO NOTHING`,
+        msg.UID, msg.Username, msg.Content, msg.Format, msg.HTML, msg.RoomID, embeds, msg.CreatedAt,
+    )
+    if err != nil {
+        return false, err
+    }
+    n, err := res.RowsAffected()
+    return n > 0, err
+}
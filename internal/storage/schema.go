@@ -0,0 +1,326 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+// migrations - упорядоченный список изменений схемы.
+// Новые изменения добавляются только в конец, уже примененные не редактируются
+var migrations = []string{
+    // 1: базовая таблица сообщений
+    `CREATE TABLE IF NOT EXISTS messages (
+        id         SERIAL PRIMARY KEY,
+        username   TEXT NOT NULL,
+        content    TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`,
+
+    // 2: комната и вложения-карточки у сообщений, входящие вебхуки
+    `ALTER TABLE messages ADD COLUMN IF NOT EXISTS room_id TEXT NOT NULL DEFAULT 'general';
+     ALTER TABLE messages ADD COLUMN IF NOT EXISTS embeds JSONB;
+     CREATE INDEX IF NOT EXISTS messages_room_created_idx ON messages (room_id, created_at);
+     CREATE TABLE IF NOT EXISTS incoming_webhooks (
+        id         TEXT PRIMARY KEY,
+        room_id    TEXT NOT NULL,
+        name       TEXT NOT NULL,
+        token_hash TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+     );
+     CREATE INDEX IF NOT EXISTS incoming_webhooks_room_idx ON incoming_webhooks (room_id)`,
+
+    // 3: исходящие вебхуки, очередь доставки и журнал попыток
+    `CREATE TABLE IF NOT EXISTS outgoing_webhooks (
+        id         TEXT PRIMARY KEY,
+        room_id    TEXT NOT NULL,
+        url        TEXT NOT NULL,
+        secret     TEXT NOT NULL,
+        events     TEXT[] NOT NULL,
+        keywords   TEXT[] NOT NULL DEFAULT '{}',
+        active     BOOLEAN NOT NULL DEFAULT true,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+     );
+     CREATE INDEX IF NOT EXISTS outgoing_webhooks_room_idx ON outgoing_webhooks (room_id);
+     CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id              BIGSERIAL PRIMARY KEY,
+        webhook_id      TEXT NOT NULL REFERENCES outgoing_webhooks (id) ON DELETE CASCADE,
+        event_type      TEXT NOT NULL,
+        payload         JSONB NOT NULL,
+        status          TEXT NOT NULL DEFAULT 'pending',
+        attempts        INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        locked_until    TIMESTAMPTZ,
+        last_error      TEXT NOT NULL DEFAULT '',
+        created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+        delivered_at    TIMESTAMPTZ
+     );
+     CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+     CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at);
+     CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+        id           BIGSERIAL PRIMARY KEY,
+        delivery_id  BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+        attempt      INTEGER NOT NULL,
+        status_code  INTEGER NOT NULL DEFAULT 0,
+        error        TEXT NOT NULL DEFAULT '',
+        duration_ms  INTEGER NOT NULL DEFAULT 0,
+        attempted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+     );
+     CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id)`,
+
+    // 4: полнотекстовый поиск по сообщениям (русская и английская морфология)
+    `ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+        GENERATED ALWAYS AS (to_tsvector('russian', content) || to_tsvector('english', content)) STORED;
+     CREATE INDEX IF NOT EXISTS messages_search_idx ON messages USING GIN (search_vector);
+     CREATE INDEX IF NOT EXISTS messages_username_created_idx ON messages (username, created_at)`,
+
+    // 5: политики хранения и архив удаленных сообщений.
+    // В архиве строка сообщения хранится целиком в JSONB, чтобы не повторять схему messages
+    `CREATE TABLE IF NOT EXISTS retention_policies (
+        room_id         TEXT PRIMARY KEY,
+        max_age_seconds BIGINT NOT NULL DEFAULT 0,
+        max_count       INTEGER NOT NULL DEFAULT 0,
+        archive         BOOLEAN NOT NULL DEFAULT false,
+        updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+     );
+     CREATE TABLE IF NOT EXISTS messages_archive (
+        id          INTEGER PRIMARY KEY,
+        room_id     TEXT NOT NULL,
+        created_at  TIMESTAMPTZ NOT NULL,
+        archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        data        JSONB NOT NULL
+     );
+     CREATE INDEX IF NOT EXISTS messages_archive_room_created_idx ON messages_archive (room_id, created_at)`,
+
+    // 6: участники комнат и стабильный идентификатор сообщения для переноса между базами
+    `CREATE TABLE IF NOT EXISTS room_members (
+        room_id      TEXT NOT NULL,
+        username     TEXT NOT NULL,
+        role         TEXT NOT NULL DEFAULT 'member',
+        joined_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+        last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (room_id, username)
+     );
+     ALTER TABLE messages ADD COLUMN IF NOT EXISTS uid UUID NOT NULL DEFAULT gen_random_uuid();
+     CREATE UNIQUE INDEX IF NOT EXISTS messages_uid_idx ON messages (uid)`,
+
+    // 7: загруженные файлы. message_id заполняется, когда вложение прикрепляют к сообщению
+    `CREATE TABLE IF NOT EXISTS attachments (
+        id           TEXT PRIMARY KEY,
+        room_id      TEXT NOT NULL,
+        uploader     TEXT NOT NULL,
+        filename     TEXT NOT NULL,
+        content_type TEXT NOT NULL,
+        size         BIGINT NOT NULL,
+        blob_key     TEXT NOT NULL,
+        message_id   INTEGER REFERENCES messages (id) ON DELETE SET NULL,
+        created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+     );
+     CREATE INDEX IF NOT EXISTS attachments_message_idx ON attachments (message_id)`,
+
+    // 8: размеры картинок и превью
+    `ALTER TABLE attachments
+        ADD COLUMN IF NOT EXISTS width          INTEGER NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS height         INTEGER NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS thumbnail_key  TEXT NOT NULL DEFAULT '',
+        ADD COLUMN IF NOT EXISTS thumbnail_type TEXT NOT NULL DEFAULT ''`,
+
+    // 9: кеш превью ссылок, включая неудачные попытки
+    `CREATE TABLE IF NOT EXISTS link_previews (
+        url         TEXT PRIMARY KEY,
+        ok          BOOLEAN NOT NULL,
+        title       TEXT NOT NULL DEFAULT '',
+        description TEXT NOT NULL DEFAULT '',
+        image_url   TEXT NOT NULL DEFAULT '',
+        site_name   TEXT NOT NULL DEFAULT '',
+        fetched_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`,
+
+    // 10: формат сообщения и отрисованный HTML
+    `ALTER TABLE messages
+        ADD COLUMN IF NOT EXISTS format TEXT NOT NULL DEFAULT 'plain',
+        ADD COLUMN IF NOT EXISTS html   TEXT NOT NULL DEFAULT ''`,
+
+    // 11: упоминания пользователей в сообщениях
+    `CREATE TABLE IF NOT EXISTS mentions (
+        id         BIGSERIAL PRIMARY KEY,
+        message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+        room_id    TEXT NOT NULL,
+        username   TEXT NOT NULL,
+        author     TEXT NOT NULL,
+        kind       TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        read_at    TIMESTAMPTZ,
+        UNIQUE (message_id, username)
+    );
+    CREATE INDEX IF NOT EXISTS mentions_username_idx ON mentions (username, id DESC)`,
+
+    // 12: настройки email-уведомлений и отметка об отправленных дайджестах
+    `CREATE TABLE IF NOT EXISTS notification_preferences (
+        username      TEXT PRIMARY KEY,
+        email         TEXT NOT NULL DEFAULT '',
+        email_enabled BOOLEAN NOT NULL DEFAULT true,
+        delay_seconds INTEGER,
+        updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    ALTER TABLE mentions ADD COLUMN IF NOT EXISTS notified_at TIMESTAMPTZ;
+    CREATE INDEX IF NOT EXISTS mentions_pending_idx ON mentions (username) WHERE notified_at IS NULL AND read_at IS NULL`,
+
+    // 13: подписки браузеров на Web Push
+    `CREATE TABLE IF NOT EXISTS push_subscriptions (
+        id         BIGSERIAL PRIMARY KEY,
+        username   TEXT NOT NULL,
+        endpoint   TEXT NOT NULL UNIQUE,
+        p256dh     TEXT NOT NULL,
+        auth       TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS push_subscriptions_username_idx ON push_subscriptions (username)`,
+
+    // 14: журнал фильтров сообщений для модераторов
+    `CREATE TABLE IF NOT EXISTS moderation_events (
+        id         BIGSERIAL PRIMARY KEY,
+        room_id    TEXT NOT NULL,
+        username   TEXT NOT NULL,
+        filter     TEXT NOT NULL,
+        action     TEXT NOT NULL,
+        reason     TEXT NOT NULL DEFAULT '',
+        content    TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS moderation_events_room_idx ON moderation_events (room_id, id)`,
+
+    // 15: завершенные звонки и их участники
+    `CREATE TABLE IF NOT EXISTS calls (
+        id               TEXT PRIMARY KEY,
+        room_id          TEXT NOT NULL,
+        initiator        TEXT NOT NULL,
+        end_reason       TEXT NOT NULL,
+        created_at       TIMESTAMPTZ NOT NULL,
+        started_at       TIMESTAMPTZ,
+        ended_at         TIMESTAMPTZ NOT NULL,
+        duration_seconds BIGINT NOT NULL DEFAULT 0
+    );
+    CREATE INDEX IF NOT EXISTS calls_room_idx ON calls (room_id, created_at);
+    CREATE TABLE IF NOT EXISTS call_participants (
+        call_id          TEXT NOT NULL REFERENCES calls(id) ON DELETE CASCADE,
+        username         TEXT NOT NULL,
+        joined_at        TIMESTAMPTZ NOT NULL,
+        left_at          TIMESTAMPTZ NOT NULL,
+        duration_seconds BIGINT NOT NULL DEFAULT 0,
+        PRIMARY KEY (call_id, username)
+    )`,
+
+    // 16: записи звонков. Сами файлы - вложения комнаты, по одному на дорожку участника
+    `CREATE TABLE IF NOT EXISTS recordings (
+        id         TEXT PRIMARY KEY,
+        room_id    TEXT NOT NULL,
+        call_id    TEXT NOT NULL,
+        started_by TEXT NOT NULL,
+        started_at TIMESTAMPTZ NOT NULL,
+        ended_at   TIMESTAMPTZ NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS recordings_room_idx ON recordings (room_id, started_at);
+    CREATE TABLE IF NOT EXISTS recording_files (
+        recording_id  TEXT NOT NULL REFERENCES recordings(id) ON DELETE CASCADE,
+        attachment_id TEXT NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+        username      TEXT NOT NULL,
+        kind          TEXT NOT NULL,
+        PRIMARY KEY (recording_id, attachment_id)
+    )`,
+
+    // 17: отчеты клиентов о качестве соединений в звонках. Звонок попадает в calls
+    // только после завершения, поэтому внешнего ключа нет
+    `CREATE TABLE IF NOT EXISTS call_stats (
+        id             BIGSERIAL PRIMARY KEY,
+        call_id        TEXT NOT NULL,
+        room_id        TEXT NOT NULL,
+        username       TEXT NOT NULL,
+        peer           TEXT NOT NULL,
+        rtt_ms         DOUBLE PRECISION NOT NULL,
+        packet_loss    DOUBLE PRECISION NOT NULL,
+        jitter_ms      DOUBLE PRECISION NOT NULL,
+        bitrate_in     DOUBLE PRECISION NOT NULL,
+        bitrate_out    DOUBLE PRECISION NOT NULL,
+        candidate_type TEXT NOT NULL,
+        reported_at    TIMESTAMPTZ NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS call_stats_call_idx ON call_stats (call_id, reported_at)`,
+
+    // 18: запланированные встречи. reminders_sent - сколько напоминаний уже отправлено в комнату
+    `CREATE TABLE IF NOT EXISTS meetings (
+        id               TEXT PRIMARY KEY,
+        room_id          TEXT NOT NULL,
+        title            TEXT NOT NULL,
+        organizer        TEXT NOT NULL,
+        starts_at        TIMESTAMPTZ NOT NULL,
+        duration_seconds BIGINT NOT NULL,
+        invitees         TEXT[] NOT NULL DEFAULT '{}',
+        reminders_sent   SMALLINT NOT NULL DEFAULT 0,
+        created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS meetings_room_idx ON meetings (room_id, starts_at);
+    CREATE INDEX IF NOT EXISTS meetings_reminder_idx ON meetings (starts_at) WHERE reminders_sent < 2`,
+
+    // 19: занятые имена. Кто первым занял имя, получает ключ пользователя, подтверждающий его
+    `CREATE TABLE IF NOT EXISTS usernames (
+        username   TEXT PRIMARY KEY,
+        claimed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`,
+
+    // 20: подтверждение адреса для писем. Неподтвержденным адресам дайджесты не отправляются
+    `ALTER TABLE notification_preferences
+        ADD COLUMN IF NOT EXISTS email_confirmed BOOLEAN NOT NULL DEFAULT false,
+        ADD COLUMN IF NOT EXISTS confirm_sent_at TIMESTAMPTZ`,
+
+    // 21: вложения архивированных сообщений остаются в хранилище и ссылаются на запись в messages_archive
+    `ALTER TABLE attachments ADD COLUMN IF NOT EXISTS archived_message_id INTEGER;
+     CREATE INDEX IF NOT EXISTS attachments_archived_message_idx ON attachments (archived_message_id)
+        WHERE archived_message_id IS NOT NULL`,
+}
+
+// migrationLockID - ключ advisory lock, чтобы server и chatservice
+// не применяли миграции одновременно
+const migrationLockID = 7_412_001
+
+// Migrate применяет к базе все еще не примененные миграции
+func (s *Storage) Migrate(ctx context.Context) error {
+    ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+    defer cancel()
+
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+        return fmt.Errorf("acquire migration lock: %w", err)
+    }
+
+    if _, err := tx.ExecContext(ctx,
+        `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version    INTEGER PRIMARY KEY,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        )`,
+    ); err != nil {
+        return fmt.Errorf("create schema_migrations: %w", err)
+    }
+
+    var current int
+    if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+        return fmt.Errorf("read schema version: %w", err)
+    }
+
+    for i := current; i < len(migrations); i++ {
+        version := i + 1
+        if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+            return fmt.Errorf("apply migration %d: %w", version, err)
+        }
+        if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+            return fmt.Errorf("record migration %d: %w", version, err)
+        }
+    }
+
+    return tx.Commit()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "html"
+    "strings"
+    "time"
+)
+
+// Ограничения поиска
+const (
+    MaxSearchQueryLength = 200
+    DefaultSearchLimit   = 20
+    MaxSearchLimit       = 100
+)
+
+// Маркеры подсветки, которые ts_headline ставит вокруг найденных слов.
+// Управляющие символы не встречаются в обычном тексте и не требуют экранирования
+const (
+    highlightStart = "\x02"
+    highlightStop  = "\x03"
+)
+
+// SearchQuery - параметры полнотекстового поиска. Пустые поля фильтров не ограничивают выборку
+type SearchQuery struct {
+    Query    string
+    RoomID   string
+    Username string
+    From     time.Time
+    To       time.Time
+    Limit    int
+    Offset   int
+}
+
+// SearchResult - найденное сообщение с фрагментом текста
+type SearchResult struct {
+    Message
+    Rank    float32
+    Snippet string // Фрагмент с маркерами подсветки, см. HighlightHTML
+}
+
+// Validate проверяет запрос и подставляет значения по умолчанию
+func (q *SearchQuery) Validate() error {
+    q.Query = strings.TrimSpace(q.Query)
+    if q.Query == "" {
+        return errors.New("search query cannot be empty")
+    }
+    if len(q.Query) > MaxSearchQueryLength {
+        return fmt.Errorf("search query is too long (max %d characters)", MaxSearchQueryLength)
+    }
+    if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+        return errors.New("from must be before to")
+    }
+    if q.Limit <= 0 {
+        q.Limit = DefaultSearchLimit
+    }
+    if q.Limit > MaxSearchLimit {
+        q.Limit = MaxSearchLimit
+    }
+    if q.Offset < 0 {
+        q.Offset = 0
+    }
+    return nil
+}
+
+// SearchMessages ищет сообщения по тексту. Запрос разбирается websearch_to_tsquery
+// (поддерживает "фразы", OR и -исключения) сразу в русской и английской конфигурациях
+func (s *Storage) SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+    if err := q.Validate(); err != nil {
+        return nil, err
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    var from, to *time.Time
+    if !q.From.IsZero() {
+        from = &q.From
+    }
+    if !q.To.IsZero() {
+        to = &q.To
+    }
+
+    rows, err := s.db.QueryContext(ctx,
+        `WITH q AS (
+            SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS query
+         )
+         SELECT m.id, m.username, m.content, m.room_id, m.created_at,
+                ts_rank(m.search_vector, q.query) AS rank,
+                ts_headline('russian', m.content, q.query,
+                    format('StartSel=%s, StopSel=%s, MaxWords=35, MinWords=15, MaxFragments=2', chr(2), chr(3)))
+         FROM messages m, q
+         WHERE m.search_vector @@ q.query
+           AND ($2 = '' OR m.room_id = $2)
+           AND ($3 = '' OR m.username = $3)
+           AND ($4::timestamptz IS NULL OR m.created_at >= $4)
+           AND ($5::timestamptz IS NULL OR m.created_at < $5)
+         ORDER BY rank DESC, m.created_at DESC
+         LIMIT $6 OFFSET $7`,
+        q.Query, q.RoomID, q.Username, from, to, q.Limit, q.Offset,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var results []SearchResult
+    for rows.Next() {
+        var r SearchResult
+        if err := rows.Scan(&r.ID, &r.Username, &r.Content, &r.RoomID, &r.CreatedAt, &r.Rank, &r.Snippet); err != nil {
+            return nil, err
+        }
+        results = append(results, r)
+    }
+    return results, rows.Err()
+}
+
+// HighlightHTML превращает фрагмент из SearchMessages в безопасный HTML:
+// текст экранируется, найденные слова оборачиваются в <mark>
+func HighlightHTML(snippet string) string {
+    escaped := html.EscapeString(snippet)
+    escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+    return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+    "testing"
+    "time"
+)
+
+func TestHighlightHTML(t *testing.T) {
+    snippet := "ссылка на <script> " + highlightStart + "деплой" + highlightStop + " & отчет"
+    want := "ссылка на &lt;script&gt; <mark>деплой</mark> &amp; отчет"
+    if got := HighlightHTML(snippet); got != want {
+        t.Errorf("Ожидалось: %q, Получено: %q", want, got)
+    }
+}
+
+func TestSearchQueryValidate(t *testing.T) {
+    q := SearchQuery{Query: "  релиз  ", Limit: 1000}
+    if err := q.Validate(); err != nil {
+        t.Fatalf("Неожиданная ошибка: %v", err)
+    }
+    if q.Query != "релиз" || q.Limit != MaxSearchLimit {
+        t.Errorf("Запрос не нормализован: %+v", q)
+    }
+
+    empty := SearchQuery{Query: " "}
+    if err := empty.Validate(); err == nil {
+        t.Error("Пустой запрос должен быть отклонен")
+    }
+
+    now := time.Now()
+    reversed := SearchQuery{Query: "x", From: now, To: now.Add(-time.Hour)}
+    if err := reversed.Validate(); err == nil {
+        t.Error("Интервал с from позже to должен быть отклонен")
+    }
+}
@@ -2,15 +2,27 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	_ "github.com/lib/pq"
 	"time"
 	"context"
+
+	"Thoth/internal/models"
 )
 
 type Message struct {
 	ID			int
+	UID			string
 	Username	string
 	Content		string
+	Format		string // plain или markdown; пустой считается plain
+	HTML		string // Безопасный HTML для Format = markdown
+	RoomID		string
+	Embeds		[]models.Embed
+	Attachments	[]Attachment // При вставке учитываются только ID, остальное заполняет InsertMessage
+	Mentions	[]string  // Упомянутые пользователи (@username) для InsertMessage
+	MentionRoom	bool      // Упоминание всей комнаты (@room)
+	Mentioned	[]Mention // Созданные InsertMessage упоминания - только участники комнаты
 	CreatedAt	time.Time
 }
 
@@ -27,19 +39,63 @@ func NewStorage(connStr string) (*Storage, error) {
 }
 
 func (s *Storage) SaveMessage(ctx context.Context, msg Message) error {
+    _, err := s.InsertMessage(ctx, msg)
+    return err
+}
+
+// InsertMessage сохраняет сообщение и возвращает его с присвоенными ID и временем создания
+func (s *Storage) InsertMessage(ctx context.Context, msg Message) (Message, error) {
     ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
     defer cancel()
-    
-    _, err := s.db.ExecContext(ctx,
-        "INSERT INTO messages (username, content) VALUES ($1, $2)",
-        msg.Username, msg.Content,
-    )
-    return err
+
+    if msg.RoomID == "" {
+        msg.RoomID = "general"
+    }
+
+    embeds, err := marshalEmbeds(msg.Embeds)
+    if err != nil {
+        return msg, err
+    }
+
+    if msg.Format == "" {
+        msg.Format = models.FormatPlain
+    }
+
+    const insert = "INSERT INTO messages (username, content, format, html, room_id, embeds) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, uid, created_at"
+
+    if len(msg.Attachments) == 0 && len(msg.Mentions) == 0 && !msg.MentionRoom {
+        err = s.db.QueryRowContext(ctx, insert, msg.Username, msg.Content, msg.Format, msg.HTML, msg.RoomID, embeds).
+            Scan(&msg.ID, &msg.UID, &msg.CreatedAt)
+        return msg, err
+    }
+
+    // Сообщение, привязка вложений и упоминания сохраняются атомарно
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return msg, err
+    }
+    defer tx.Rollback()
+
+    if err := tx.QueryRowContext(ctx, insert, msg.Username, msg.Content, msg.Format, msg.HTML, msg.RoomID, embeds).
+        Scan(&msg.ID, &msg.UID, &msg.CreatedAt); err != nil {
+        return msg, err
+    }
+    if len(msg.Attachments) > 0 {
+        if msg.Attachments, err = claimAttachments(ctx, tx, msg); err != nil {
+            return msg, err
+        }
+    }
+    if len(msg.Mentions) > 0 || msg.MentionRoom {
+        if msg.Mentioned, err = insertMentions(ctx, tx, msg); err != nil {
+            return msg, err
+        }
+    }
+    return msg, tx.Commit()
 }
 
 func (s *Storage) GetRecentMessages(limit int) ([]Message, error) {
     rows, err := s.db.Query(
-        "SELECT id, username, content, created_at FROM messages ORDER BY created_at DESC LIMIT $1", limit,
+        "SELECT id, username, content, format, html, room_id, embeds, created_at FROM messages ORDER BY created_at DESC LIMIT $1", limit,
     )
     if err != nil {
         return nil, err
@@ -49,12 +105,32 @@ func (s *Storage) GetRecentMessages(limit int) ([]Message, error) {
     var messages []Message
     for rows.Next() {
         var m Message
-        if err := rows.Scan(&m.ID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+        var embeds []byte
+        if err := rows.Scan(&m.ID, &m.Username, &m.Content, &m.Format, &m.HTML, &m.RoomID, &embeds, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        if m.Embeds, err = unmarshalEmbeds(embeds); err != nil {
             return nil, err
         }
         messages = append(messages, m)
     }
-    return messages, nil
+    return messages, rows.Err()
+}
+
+func marshalEmbeds(embeds []models.Embed) ([]byte, error) {
+    if len(embeds) == 0 {
+        return nil, nil
+    }
+    return json.Marshal(embeds)
+}
+
+func unmarshalEmbeds(data []byte) ([]models.Embed, error) {
+    if len(data) == 0 {
+        return nil, nil
+    }
+    var embeds []models.Embed
+    err := json.Unmarshal(data, &embeds)
+    return embeds, err
 }
 
 func (s *Storage) Close() error {
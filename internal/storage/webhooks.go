@@ -0,0 +1,83 @@
+package storage
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "time"
+)
+
+// ErrNotFound возвращается, когда запрошенная запись отсутствует
+var ErrNotFound = errors.New("not found")
+
+// IncomingWebhook - входящий вебхук, через который внешняя система пишет в комнату.
+// Сам секретный токен не хранится, только его SHA-256
+type IncomingWebhook struct {
+    ID        string
+    RoomID    string
+    Name      string
+    TokenHash string
+    CreatedAt time.Time
+}
+
+func (s *Storage) CreateIncomingWebhook(ctx context.Context, hook IncomingWebhook) (IncomingWebhook, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    err := s.db.QueryRowContext(ctx,
+        "INSERT INTO incoming_webhooks (id, room_id, name, token_hash) VALUES ($1, $2, $3, $4) RETURNING created_at",
+        hook.ID, hook.RoomID, hook.Name, hook.TokenHash,
+    ).Scan(&hook.CreatedAt)
+    return hook, err
+}
+
+func (s *Storage) GetIncomingWebhook(ctx context.Context, id string) (IncomingWebhook, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    var hook IncomingWebhook
+    err := s.db.QueryRowContext(ctx,
+        "SELECT id, room_id, name, token_hash, created_at FROM incoming_webhooks WHERE id = $1", id,
+    ).Scan(&hook.ID, &hook.RoomID, &hook.Name, &hook.TokenHash, &hook.CreatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return hook, ErrNotFound
+    }
+    return hook, err
+}
+
+func (s *Storage) ListIncomingWebhooks(ctx context.Context, roomID string) ([]IncomingWebhook, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    rows, err := s.db.QueryContext(ctx,
+        "SELECT id, room_id, name, token_hash, created_at FROM incoming_webhooks WHERE room_id = $1 ORDER BY created_at", roomID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var hooks []IncomingWebhook
+    for rows.Next() {
+        var hook IncomingWebhook
+        if err := rows.Scan(&hook.ID, &hook.RoomID, &hook.Name, &hook.TokenHash, &hook.CreatedAt); err != nil {
+            return nil, err
+        }
+        hooks = append(hooks, hook)
+    }
+    return hooks, rows.Err()
+}
+
+func (s *Storage) DeleteIncomingWebhook(ctx context.Context, id string) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    res, err := s.db.ExecContext(ctx, "DELETE FROM incoming_webhooks WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
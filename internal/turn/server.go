@@ -0,0 +1,192 @@
+package turn
+
+import (
+    "fmt"
+    "log/slog"
+    "net"
+    "strings"
+
+    pionturn "github.com/pion/turn/v4"
+
+    "Thoth/internal/ice"
+    "Thoth/internal/metrics"
+)
+
+var turnLogger = slog.With("component", "turn")
+
+var (
+    allocationsActive = metrics.NewGauge("thoth_turn_allocations",
+        "Active TURN allocations", "protocol")
+    allocationsTotal = metrics.NewCounter("thoth_turn_allocations_total",
+        "Created TURN allocations", "protocol")
+    allocationErrors = metrics.NewCounter("thoth_turn_allocation_errors_total",
+        "TURN allocations that failed while relaying", "protocol")
+    authTotal = metrics.NewCounter("thoth_turn_auth_total",
+        "TURN authentication attempts", "result")
+    peersRejected = metrics.NewCounter("thoth_turn_peers_rejected_total",
+        "TURN permissions refused for loopback, private and other internal peers")
+)
+
+// Server - встроенный STUN/TURN-сервер. Слушает UDP и TCP на одном адресе: TCP нужен
+// в сетях, где UDP наружу закрыт. Учетные данные проверяет тот же ice.Config,
+// что их выдает, поэтому отдельный TURN-сервер не нужен
+type Server struct {
+    Realm   string
+    MinPort uint16 // Диапазон портов для выделений
+    MaxPort uint16
+    // AllowPrivatePeers разрешает ретрансляцию на loopback и внутренние адреса.
+    // Только для тестов и проверки на одной машине: иначе TURN открывает доступ к внутренней сети сервера
+    AllowPrivatePeers bool
+
+    listen  string
+    relayIP net.IP
+    creds   *ice.Config
+
+    server *pionturn.Server
+    udp    net.PacketConn
+    tcp    net.Listener
+}
+
+// NewServer создает сервер на адресе listen. relayIP - адрес, который клиенты видят
+// в выделениях: публичный IP сервера, для проверки на одной машине - 127.0.0.1
+// вместе с AllowPrivatePeers
+func NewServer(listen string, relayIP net.IP, creds *ice.Config) *Server {
+    return &Server{
+        Realm:   "thoth",
+        MinPort: 49152,
+        MaxPort: 65535,
+        listen:  listen,
+        relayIP: relayIP,
+        creds:   creds,
+    }
+}
+
+// Listen открывает сокеты и начинает обслуживать клиентов
+func (s *Server) Listen() error {
+    udp, err := net.ListenPacket("udp", s.listen)
+    if err != nil {
+        return fmt.Errorf("listen udp %s: %w", s.listen, err)
+    }
+    // TCP на том же порту, что достался UDP (важно для ":0")
+    tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+    if err != nil {
+        udp.Close()
+        return fmt.Errorf("listen tcp %s: %w", s.listen, err)
+    }
+
+    relay := func() pionturn.RelayAddressGenerator {
+        return &pionturn.RelayAddressGeneratorPortRange{
+            RelayAddress: s.relayIP,
+            Address:      "0.0.0.0",
+            MinPort:      s.MinPort,
+            MaxPort:      s.MaxPort,
+        }
+    }
+    server, err := pionturn.NewServer(pionturn.ServerConfig{
+        Realm:             s.Realm,
+        AuthHandler:       s.authenticate,
+        EventHandler:      eventHandler(),
+        PacketConnConfigs: []pionturn.PacketConnConfig{{
+            PacketConn:            udp,
+            RelayAddressGenerator: relay(),
+            PermissionHandler:     s.permitPeer,
+        }},
+        ListenerConfigs: []pionturn.ListenerConfig{{
+            Listener:              tcp,
+            RelayAddressGenerator: relay(),
+            PermissionHandler:     s.permitPeer,
+        }},
+    })
+    if err != nil {
+        udp.Close()
+        tcp.Close()
+        return err
+    }
+    s.server, s.udp, s.tcp = server, udp, tcp
+    turnLogger.Info("TURN server is listening", "addr", udp.LocalAddr().String(), "relay_ip", s.relayIP.String(),
+        "ports", fmt.Sprintf("%d-%d", s.MinPort, s.MaxPort))
+    return nil
+}
+
+// Addr - адрес, на котором сервер слушает (UDP и TCP)
+func (s *Server) Addr() net.Addr {
+    return s.udp.LocalAddr()
+}
+
+// URLs - адреса сервера для ICE-конфигурации клиентов
+func (s *Server) URLs() (stun, turn []string) {
+    _, port, _ := net.SplitHostPort(s.Addr().String())
+    host := net.JoinHostPort(s.relayIP.String(), port)
+    return []string{"stun:" + host},
+        []string{"turn:" + host + "?transport=udp", "turn:" + host + "?transport=tcp"}
+}
+
+// AllocationCount - число активных выделений
+func (s *Server) AllocationCount() int {
+    return s.server.AllocationCount()
+}
+
+func (s *Server) Stop() {
+    if s.server == nil {
+        return
+    }
+    if err := s.server.Close(); err != nil {
+        turnLogger.Error("Failed to stop TURN server", "error", err)
+    }
+}
+
+func (s *Server) authenticate(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+    password, ok := s.creds.Password(username)
+    if !ok {
+        authTotal.Inc("invalid")
+        turnLogger.Warn("TURN credentials expired or malformed", "username", username, "remote", srcAddr.String())
+        return nil, false
+    }
+    return pionturn.GenerateAuthKey(username, realm, password), true
+}
+
+// permitPeer решает, можно ли клиенту ретранслировать данные на peerIP (CreatePermission и ChannelBind)
+func (s *Server) permitPeer(clientAddr net.Addr, peerIP net.IP) bool {
+    if s.AllowPrivatePeers || publicPeer(peerIP) {
+        return true
+    }
+    peersRejected.Inc()
+    turnLogger.Warn("TURN peer address rejected", "remote", clientAddr.String(), "peer", peerIP.String())
+    return false
+}
+
+// publicPeer сообщает, что адрес маршрутизируется в интернете, а не ведет в сеть самого сервера
+func publicPeer(ip net.IP) bool {
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+        ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+        ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+func eventHandler() pionturn.EventHandler {
+    return pionturn.EventHandler{
+        // Вызывается, только если имя прошло authenticate: verdict - проверка подписи паролем
+        OnAuth: func(_, _ net.Addr, _, _, _, _ string, verdict bool) {
+            if verdict {
+                authTotal.Inc("ok")
+            } else {
+                authTotal.Inc("bad_password")
+            }
+        },
+        OnAllocationCreated: func(src, _ net.Addr, protocol, username, _ string, relayAddr net.Addr, _ int) {
+            protocol = strings.ToLower(protocol)
+            allocationsTotal.Inc(protocol)
+            allocationsActive.Add(1, protocol)
+            turnLogger.Info("TURN allocation created", "username", username, "remote", src.String(), "relay", relayAddr.String(), "protocol", protocol)
+        },
+        OnAllocationDeleted: func(src, _ net.Addr, protocol, username, _ string) {
+            protocol = strings.ToLower(protocol)
+            allocationsActive.Add(-1, protocol)
+            turnLogger.Info("TURN allocation deleted", "username", username, "remote", src.String(), "protocol", protocol)
+        },
+        OnAllocationError: func(src, _ net.Addr, protocol, message string) {
+            protocol = strings.ToLower(protocol)
+            allocationErrors.Inc(protocol)
+            turnLogger.Warn("TURN allocation error", "remote", src.String(), "protocol", protocol, "error", message)
+        },
+    }
+}
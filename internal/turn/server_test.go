@@ -0,0 +1,174 @@
+package turn
+
+import (
+    "net"
+    "testing"
+    "time"
+
+    pionturn "github.com/pion/turn/v4"
+
+    "Thoth/internal/ice"
+)
+
+// startServer запускает сервер на 127.0.0.1. allowPrivate разрешает собеседников на loopback
+func startServer(t *testing.T, allowPrivate bool) (*Server, *ice.Config) {
+    t.Helper()
+    creds, err := ice.NewConfig(nil, []string{"turn:127.0.0.1"}, "secret")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := NewServer("127.0.0.1:0", net.IPv4(127, 0, 0, 1), creds)
+    s.MinPort, s.MaxPort = 40000, 40999
+    s.AllowPrivatePeers = allowPrivate
+    if err := s.Listen(); err != nil {
+        t.Fatalf("запуск сервера: %v", err)
+    }
+    t.Cleanup(s.Stop)
+    return s, creds
+}
+
+func newClient(t *testing.T, s *Server, username, password string) *pionturn.Client {
+    t.Helper()
+    conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    client, err := pionturn.NewClient(&pionturn.ClientConfig{
+        STUNServerAddr: s.Addr().String(),
+        TURNServerAddr: s.Addr().String(),
+        Username:       username,
+        Password:       password,
+        Realm:          s.Realm,
+        Conn:           conn,
+        RTO:            100 * time.Millisecond,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := client.Listen(); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(client.Close)
+    return client
+}
+
+func TestRelayWithIssuedCredentials(t *testing.T) {
+    s, creds := startServer(t, true)
+    servers, _ := creds.Servers("alice")
+    client := newClient(t, s, servers[0].Username, servers[0].Credential)
+
+    // STUN работает без учетных данных
+    if mapped, err := client.SendBindingRequest(); err != nil {
+        t.Fatalf("STUN binding: %v", err)
+    } else if !mapped.(*net.UDPAddr).IP.IsLoopback() {
+        t.Errorf("внешний адрес: %v", mapped)
+    }
+
+    relayConn, err := client.Allocate()
+    if err != nil {
+        t.Fatalf("выделение: %v", err)
+    }
+    defer relayConn.Close()
+    if s.AllocationCount() != 1 || allocationsActive.Value("udp") < 1 {
+        t.Errorf("выделений %d, в метрике %v", s.AllocationCount(), allocationsActive.Value("udp"))
+    }
+
+    // Данные через ретранслятор доходят до собеседника
+    peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer peer.Close()
+    if _, err := relayConn.WriteTo([]byte("привет"), peer.LocalAddr()); err != nil {
+        t.Fatalf("отправка через ретранслятор: %v", err)
+    }
+    buf := make([]byte, 64)
+    peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+    n, from, err := peer.ReadFrom(buf)
+    if err != nil {
+        t.Fatalf("собеседник не получил данные: %v", err)
+    }
+    if string(buf[:n]) != "привет" || from.String() != relayConn.LocalAddr().String() {
+        t.Errorf("получено %q от %v, ожидалось от %v", buf[:n], from, relayConn.LocalAddr())
+    }
+}
+
+func TestRejectsForeignAndExpiredCredentials(t *testing.T) {
+    s, _ := startServer(t, false)
+
+    expiredUser, expiredPassword := ice.Credentials([]byte("secret"), "alice", time.Now().Add(-time.Minute))
+    foreignUser, foreignPassword := ice.Credentials([]byte("other"), "alice", time.Now().Add(time.Hour))
+    cases := []struct {
+        name, username, password, result string
+    }{
+        {"просроченные", expiredUser, expiredPassword, "invalid"},
+        {"чужой секрет", foreignUser, foreignPassword, "bad_password"},
+        {"не TURN REST", "alice", "password", "invalid"},
+    }
+    for _, c := range cases {
+        before := authTotal.Value(c.result)
+        client := newClient(t, s, c.username, c.password)
+        if conn, err := client.Allocate(); err == nil {
+            conn.Close()
+            t.Errorf("%s: выделение должно быть отклонено", c.name)
+        }
+        if authTotal.Value(c.result) == before {
+            t.Errorf("%s: отказ не учтен в метрике %s", c.name, c.result)
+        }
+    }
+    if s.AllocationCount() != 0 {
+        t.Errorf("осталось выделений: %d", s.AllocationCount())
+    }
+}
+
+func TestRefusesLoopbackPeer(t *testing.T) {
+    s, creds := startServer(t, false)
+    servers, _ := creds.Servers("alice")
+    client := newClient(t, s, servers[0].Username, servers[0].Credential)
+
+    relayConn, err := client.Allocate()
+    if err != nil {
+        t.Fatalf("выделение: %v", err)
+    }
+    defer relayConn.Close()
+
+    // Собеседник на loopback сервера - например, его база данных или метрики
+    peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer peer.Close()
+    before := peersRejected.Value()
+    relayConn.WriteTo([]byte("привет"), peer.LocalAddr())
+
+    peer.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+    if n, _, err := peer.ReadFrom(make([]byte, 64)); err == nil {
+        t.Errorf("данные дошли до loopback-адреса сервера (%d байт)", n)
+    }
+    if peersRejected.Value() == before {
+        t.Error("отказ не учтен в метрике")
+    }
+}
+
+func TestPublicPeer(t *testing.T) {
+    for addr, want := range map[string]bool{
+        "8.8.8.8":         true,
+        "2001:4860::1":    true,
+        "127.0.0.1":       false,
+        "::1":             false,
+        "10.1.2.3":        false,
+        "192.168.0.1":     false,
+        "fd00::1":         false,
+        "169.254.169.254": false,
+        "fe80::1":         false,
+        "224.0.0.1":       false,
+        "ff02::1":         false,
+        "0.0.0.0":         false,
+        "::":              false,
+    } {
+        if got := publicPeer(net.ParseIP(addr)); got != want {
+            t.Errorf("publicPeer(%s) = %v, ожидалось %v", addr, got, want)
+        }
+    }
+}
@@ -0,0 +1,268 @@
+package unfurl
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net"
+    "net/http"
+    "net/netip"
+    "net/url"
+    "regexp"
+    "strings"
+    "syscall"
+    "time"
+    "unicode/utf8"
+
+    "golang.org/x/net/html"
+    "golang.org/x/net/html/charset"
+
+    "Thoth/internal/models"
+)
+
+var (
+    ErrBlocked    = errors.New("destination address is not allowed")
+    ErrNotHTML    = errors.New("response is not an HTML page")
+    ErrNoMetadata = errors.New("page has no title or description")
+)
+
+// Ограничения на размер полей превью
+const (
+    maxTitleLength       = 200
+    maxDescriptionLength = 500
+)
+
+// Fetcher загружает страницы для превью. Адрес проверяется при установке соединения,
+// то есть после разрешения DNS, поэтому подмена DNS-ответа на внутренний адрес не помогает
+type Fetcher struct {
+    client *http.Client
+
+    MaxBodySize int64  // Сколько байт страницы читать в поисках метаданных
+    UserAgent   string
+
+    // allowDial решает, можно ли подключаться к адресу; в тестах подменяется
+    allowDial func(netip.AddrPort) bool
+}
+
+// NewFetcher создает загрузчик с жесткими таймаутами: 3 секунды на соединение
+// и заголовки ответа, 5 секунд на весь запрос вместе с редиректами
+func NewFetcher() *Fetcher {
+    f := &Fetcher{
+        MaxBodySize: 512 << 10,
+        UserAgent:   "ThothBot/1.0 (+link preview)",
+        allowDial:   isPublicAddr,
+    }
+
+    dialer := &net.Dialer{
+        Timeout: 3 * time.Second,
+        Control: func(network, address string, _ syscall.RawConn) error {
+            addr, err := netip.ParseAddrPort(address)
+            if err != nil || !f.allowDial(addr) {
+                return fmt.Errorf("%w: %s", ErrBlocked, address)
+            }
+            return nil
+        },
+    }
+
+    f.client = &http.Client{
+        Timeout: 5 * time.Second,
+        Transport: &http.Transport{
+            Proxy:                 nil, // Прокси обошел бы проверку адреса
+            DialContext:           dialer.DialContext,
+            TLSHandshakeTimeout:   3 * time.Second,
+            ResponseHeaderTimeout: 3 * time.Second,
+            MaxIdleConns:          10,
+            IdleConnTimeout:       30 * time.Second,
+        },
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            if len(via) >= 3 {
+                return errors.New("too many redirects")
+            }
+            if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+                return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+            }
+            return nil
+        },
+    }
+    return f
+}
+
+// blockedPrefixes - служебные диапазоны, которых нет среди проверок netip.Addr
+var blockedPrefixes = []netip.Prefix{
+    netip.MustParsePrefix("0.0.0.0/8"),
+    netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+    netip.MustParsePrefix("192.0.0.0/24"),
+    netip.MustParsePrefix("198.18.0.0/15"),
+    netip.MustParsePrefix("240.0.0.0/4"),
+    netip.MustParsePrefix("64:ff9b::/96"), // NAT64 может вести во внутреннюю сеть
+}
+
+// isPublicAddr разрешает только публичные адреса и стандартные порты HTTP(S)
+func isPublicAddr(ap netip.AddrPort) bool {
+    if ap.Port() != 80 && ap.Port() != 443 {
+        return false
+    }
+    addr := ap.Addr().Unmap()
+    if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+        return false
+    }
+    for _, p := range blockedPrefixes {
+        if p.Contains(addr) {
+            return false
+        }
+    }
+    return true
+}
+
+// Fetch загружает страницу и извлекает из нее OpenGraph-метаданные или <title>
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+    preview := models.LinkPreview{URL: rawURL}
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+    if err != nil {
+        return preview, err
+    }
+    req.Header.Set("User-Agent", f.UserAgent)
+    req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+    resp, err := f.client.Do(req)
+    if err != nil {
+        return preview, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return preview, fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    contentType := resp.Header.Get("Content-Type")
+    if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+        return preview, ErrNotHTML
+    }
+
+    body, err := charset.NewReader(io.LimitReader(resp.Body, f.MaxBodySize), contentType)
+    if err != nil {
+        return preview, err
+    }
+    parseHead(body, resp.Request.URL, &preview)
+
+    if preview.Title == "" && preview.Description == "" {
+        return preview, ErrNoMetadata
+    }
+    return preview, nil
+}
+
+// parseHead читает теги <meta> и <title> до начала <body>
+func parseHead(r io.Reader, base *url.URL, preview *models.LinkPreview) {
+    var title, ogTitle, description, ogDescription string
+
+    z := html.NewTokenizer(r)
+    for {
+        tt := z.Next()
+        if tt == html.ErrorToken {
+            break
+        }
+        name, hasAttr := z.TagName()
+        tag := string(name)
+
+        if tt == html.StartTagToken && tag == "body" {
+            break
+        }
+        if tt == html.StartTagToken && tag == "title" && title == "" {
+            if z.Next() == html.TextToken {
+                title = string(z.Text())
+            }
+            continue
+        }
+        if (tt != html.StartTagToken && tt != html.SelfClosingTagToken) || tag != "meta" || !hasAttr {
+            continue
+        }
+
+        var key, content string
+        for {
+            k, v, more := z.TagAttr()
+            switch string(k) {
+            case "property", "name":
+                if key == "" {
+                    key = strings.ToLower(string(v))
+                }
+            case "content":
+                content = string(v)
+            }
+            if !more {
+                break
+            }
+        }
+
+        switch key {
+        case "og:title":
+            ogTitle = content
+        case "og:description":
+            ogDescription = content
+        case "description":
+            description = content
+        case "og:site_name":
+            preview.SiteName = clean(content, maxTitleLength)
+        case "og:image", "og:image:url":
+            if preview.ImageURL == "" {
+                preview.ImageURL = resolveHTTPURL(base, content)
+            }
+        }
+    }
+
+    preview.Title = clean(firstNonEmpty(ogTitle, title), maxTitleLength)
+    preview.Description = clean(firstNonEmpty(ogDescription, description), maxDescriptionLength)
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if strings.TrimSpace(v) != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// clean схлопывает пробельные символы и обрезает строку до limit символов
+func clean(s string, limit int) string {
+    s = strings.Join(strings.Fields(s), " ")
+    if utf8.RuneCountInString(s) <= limit {
+        return s
+    }
+    runes := []rune(s)
+    return string(runes[:limit-1]) + "…"
+}
+
+// resolveHTTPURL делает ссылку абсолютной и отбрасывает все, кроме http(s)
+func resolveHTTPURL(base *url.URL, ref string) string {
+    u, err := base.Parse(strings.TrimSpace(ref))
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return ""
+    }
+    return u.String()
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// ExtractURLs возвращает до limit уникальных http(s)-ссылок из текста в порядке появления
+func ExtractURLs(text string, limit int) []string {
+    var urls []string
+    seen := make(map[string]bool)
+    for _, match := range urlPattern.FindAllString(text, -1) {
+        match = strings.TrimRight(match, ".,;:!?)]}»")
+        if len(match) > 2048 || seen[match] {
+            continue
+        }
+        u, err := url.Parse(match)
+        if err != nil || u.Host == "" {
+            continue
+        }
+        seen[match] = true
+        urls = append(urls, match)
+        if len(urls) == limit {
+            break
+        }
+    }
+    return urls
+}
@@ -0,0 +1,152 @@
+package unfurl
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/netip"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+func TestExtractURLs(t *testing.T) {
+    got := ExtractURLs("смотри https://example.com/a?b=1, и (https://go.dev/doc). Еще раз https://example.com/a?b=1 и ftp://x", 3)
+    want := []string{"https://example.com/a?b=1", "https://go.dev/doc"}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("ExtractURLs() = %v, ожидалось %v", got, want)
+    }
+}
+
+func TestIsPublicAddr(t *testing.T) {
+    tests := map[string]bool{
+        "93.184.216.34:443":     true,
+        "93.184.216.34:22":      false,
+        "127.0.0.1:80":          false,
+        "10.1.2.3:443":          false,
+        "192.168.0.10:80":       false,
+        "169.254.169.254:80":    false, // метаданные облака
+        "100.64.0.1:80":         false,
+        "0.0.0.0:80":            false,
+        "[::1]:443":             false,
+        "[fd00::1]:443":         false,
+        "[::ffff:10.0.0.1]:443": false,
+        "[2606:4700::1111]:443": true,
+    }
+    for addr, want := range tests {
+        if got := isPublicAddr(netip.MustParseAddrPort(addr)); got != want {
+            t.Errorf("isPublicAddr(%s) = %v, ожидалось %v", addr, got, want)
+        }
+    }
+}
+
+const testPage = `<!DOCTYPE html><html><head>
+<title>Запасной заголовок</title>
+<meta property="og:title" content="  Thoth   релиз ">
+<meta name="description" content="Описание">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Thoth">
+</head><body><meta property="og:title" content="не отсюда"></body></html>`
+
+func TestFetchParsesOpenGraph(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Write([]byte(testPage))
+    }))
+    defer srv.Close()
+
+    f := NewFetcher()
+    f.allowDial = func(netip.AddrPort) bool { return true }
+
+    got, err := f.Fetch(context.Background(), srv.URL+"/post")
+    if err != nil {
+        t.Fatalf("Ошибка загрузки: %v", err)
+    }
+    want := models.LinkPreview{
+        URL:         srv.URL + "/post",
+        Title:       "Thoth релиз",
+        Description: "Описание",
+        ImageURL:    srv.URL + "/cover.png",
+        SiteName:    "Thoth",
+    }
+    if got != want {
+        t.Errorf("Fetch() = %+v, ожидалось %+v", got, want)
+    }
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        t.Error("Запрос не должен был дойти до внутреннего адреса")
+    }))
+    defer srv.Close()
+
+    if _, err := NewFetcher().Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBlocked) {
+        t.Errorf("Ожидалась ErrBlocked, получено %v", err)
+    }
+}
+
+type memoryCache struct {
+    mu       sync.Mutex
+    previews map[string]storage.LinkPreview
+}
+
+func (m *memoryCache) GetLinkPreview(ctx context.Context, url string) (storage.LinkPreview, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.previews[url]
+    if !ok {
+        return p, storage.ErrNotFound
+    }
+    return p, nil
+}
+
+func (m *memoryCache) SaveLinkPreview(ctx context.Context, p storage.LinkPreview) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p.FetchedAt = time.Now()
+    m.previews[p.URL] = p
+    return nil
+}
+
+type recordingPublisher struct {
+    messages []models.Message
+}
+
+func (p *recordingPublisher) SendMessageAsync(message models.Message) {
+    p.messages = append(p.messages, message)
+}
+
+func TestUnfurlerPublishesAndCaches(t *testing.T) {
+    requests := 0
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requests++
+        w.Header().Set("Content-Type", "text/html")
+        w.Write([]byte(testPage))
+    }))
+    defer srv.Close()
+
+    cache := &memoryCache{previews: make(map[string]storage.LinkPreview)}
+    publisher := &recordingPublisher{}
+    u := NewUnfurler(cache, publisher)
+    u.fetcher.allowDial = func(netip.AddrPort) bool { return true }
+
+    msg := &models.Message{ID: 42, RoomID: "general", Content: "глянь " + srv.URL + "/post"}
+    u.process(context.Background(), msg)
+    u.process(context.Background(), msg)
+
+    if requests != 1 {
+        t.Errorf("Страница загружена %d раз, повторная обработка должна брать превью из кеша", requests)
+    }
+    if len(publisher.messages) != 2 {
+        t.Fatalf("Ожидалось 2 кадра message_update, получено %d", len(publisher.messages))
+    }
+    update := publisher.messages[0]
+    if update.Type != models.MessageTypeMessageUpdate || update.ID != 42 || len(update.Previews) != 1 {
+        t.Errorf("Неверный кадр обновления: %+v", update)
+    }
+}
@@ -0,0 +1,174 @@
+package unfurl
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "sync"
+    "time"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var unfurlLogger = slog.With("component", "unfurl")
+
+var (
+    fetchesTotal = metrics.NewCounter("thoth_unfurl_fetches_total",
+        "Link preview page fetches", "result")
+    cacheHits = metrics.NewCounter("thoth_unfurl_cache_hits_total",
+        "Link previews served from the cache")
+)
+
+// Cache - хранилище превью. Реализуется *storage.Storage
+type Cache interface {
+    GetLinkPreview(ctx context.Context, url string) (storage.LinkPreview, error)
+    SaveLinkPreview(ctx context.Context, p storage.LinkPreview) error
+}
+
+// Publisher рассылает кадры в комнату. Реализуется *websocket.Hub
+type Publisher interface {
+    SendMessageAsync(message models.Message)
+}
+
+// Unfurler подписан на события хаба: находит ссылки в новых сообщениях, собирает
+// для них превью и отправляет в комнату message_update с ID исходного сообщения
+type Unfurler struct {
+    fetcher   *Fetcher
+    cache     Cache
+    publisher Publisher
+    events    chan models.Event
+
+    Workers    int           // Сколько страниц загружать одновременно
+    MaxLinks   int           // Сколько ссылок из одного сообщения разворачивать
+    CacheTTL   time.Duration // Сколько хранить удачное превью
+    FailureTTL time.Duration // Через сколько повторять неудачную попытку
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+func NewUnfurler(cache Cache, publisher Publisher) *Unfurler {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &Unfurler{
+        fetcher:    NewFetcher(),
+        cache:      cache,
+        publisher:  publisher,
+        events:     make(chan models.Event, 256),
+        Workers:    4,
+        MaxLinks:   3,
+        CacheTTL:   24 * time.Hour,
+        FailureTTL: time.Hour,
+        ctx:        ctx,
+        cancel:     cancel,
+    }
+}
+
+// HandleEvent принимает событие от хаба. Не блокирует: при переполнении сообщение остается без превью
+func (u *Unfurler) HandleEvent(event models.Event) {
+    if event.Type != models.EventMessage || event.Message == nil || event.Message.ID == 0 {
+        return
+    }
+    if len(ExtractURLs(event.Message.Content, 1)) == 0 {
+        return
+    }
+    select {
+    case u.events <- event:
+    default:
+        unfurlLogger.Warn("Unfurl queue is full, message skipped", "room", event.RoomID, "message_id", event.Message.ID)
+    }
+}
+
+// Run обрабатывает сообщения в Workers горутинах до вызова Stop
+func (u *Unfurler) Run() {
+    unfurlLogger.Info("Link unfurler is running", "workers", u.Workers)
+
+    var wg sync.WaitGroup
+    for i := 0; i < u.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-u.ctx.Done():
+                    return
+                case event := <-u.events:
+                    u.process(u.ctx, event.Message)
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    unfurlLogger.Info("Link unfurler stopped")
+}
+
+func (u *Unfurler) Stop() {
+    u.cancel()
+}
+
+// process собирает превью для ссылок сообщения и рассылает их одним кадром
+func (u *Unfurler) process(ctx context.Context, msg *models.Message) {
+    var previews []models.LinkPreview
+    for _, link := range ExtractURLs(msg.Content, u.MaxLinks) {
+        if p, ok := u.preview(ctx, link); ok {
+            previews = append(previews, p)
+        }
+    }
+    if len(previews) == 0 {
+        return
+    }
+
+    u.publisher.SendMessageAsync(models.Message{
+        Type:      models.MessageTypeMessageUpdate,
+        ID:        msg.ID,
+        Username:  msg.Username,
+        RoomID:    msg.RoomID,
+        Timestamp: time.Now(),
+        Previews:  previews,
+    })
+}
+
+// preview берет превью из кеша или загружает страницу и кеширует результат, в том числе неудачный
+func (u *Unfurler) preview(ctx context.Context, link string) (models.LinkPreview, bool) {
+    cached, err := u.cache.GetLinkPreview(ctx, link)
+    switch {
+    case err == nil:
+        ttl := u.CacheTTL
+        if !cached.OK {
+            ttl = u.FailureTTL
+        }
+        if time.Since(cached.FetchedAt) < ttl {
+            cacheHits.Inc()
+            return cached.LinkPreview, cached.OK
+        }
+    case !errors.Is(err, storage.ErrNotFound):
+        unfurlLogger.Error("Failed to read preview cache", "error", err)
+    }
+
+    fetched, err := u.fetcher.Fetch(ctx, link)
+    if ctx.Err() != nil {
+        return fetched, false
+    }
+    result := "ok"
+    switch {
+    case errors.Is(err, ErrBlocked):
+        result = "blocked"
+    case err != nil:
+        result = "error"
+    }
+    fetchesTotal.Inc(result)
+    if err != nil {
+        unfurlLogger.Info("Link preview unavailable", "url", link, "error", err)
+    }
+
+    entry := storage.LinkPreview{LinkPreview: fetched, OK: err == nil}
+    if !entry.OK {
+        entry.LinkPreview = models.LinkPreview{URL: link}
+    }
+    if err := u.cache.SaveLinkPreview(ctx, entry); err != nil {
+        unfurlLogger.Error("Failed to save preview cache", "error", err)
+    }
+    return entry.LinkPreview, entry.OK
+}
@@ -0,0 +1,284 @@
+package webhooks
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log/slog"
+    "math/rand/v2"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var dispatcherLogger = slog.With("component", "webhook-dispatcher")
+
+// Queue - хранилище подписок и очереди доставки. Реализуется *storage.Storage
+type Queue interface {
+    ListOutgoingWebhooks(ctx context.Context, roomID, eventType string) ([]storage.OutgoingWebhook, error)
+    EnqueueWebhookDelivery(ctx context.Context, webhookID, eventType string, payload []byte) error
+    ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storage.WebhookDelivery, error)
+    RecordDeliveryAttempt(ctx context.Context, attempt storage.DeliveryAttempt) error
+}
+
+// Dispatcher превращает события хаба в записи очереди и доставляет их подписчикам
+// с подписью HMAC и повторными попытками с экспоненциальной задержкой
+type Dispatcher struct {
+    queue  Queue
+    client *http.Client
+    events chan models.Event
+
+    PollInterval time.Duration // Как часто проверять очередь
+    BatchSize    int           // Сколько доставок забирать за один проход
+    MaxAttempts  int           // После стольких неудач доставка помечается failed
+    BaseBackoff  time.Duration // Задержка перед второй попыткой
+    MaxBackoff   time.Duration // Верхняя граница задержки
+
+    ctx    context.Context
+    cancel context.CancelFunc
+    intake sync.WaitGroup // Горутина приема событий
+}
+
+// NewDispatcher создает диспетчер с настройками по умолчанию
+func NewDispatcher(queue Queue) *Dispatcher {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &Dispatcher{
+        queue:        queue,
+        client:       &http.Client{Timeout: 10 * time.Second},
+        events:       make(chan models.Event, 1000),
+        PollInterval: 2 * time.Second,
+        BatchSize:    20,
+        MaxAttempts:  8,
+        BaseBackoff:  10 * time.Second,
+        MaxBackoff:   time.Hour,
+        ctx:          ctx,
+        cancel:       cancel,
+    }
+}
+
+// HandleEvent принимает событие от хаба. Не блокирует: при переполнении событие теряется
+func (d *Dispatcher) HandleEvent(event models.Event) {
+    select {
+    case d.events <- event:
+    default:
+        dispatcherLogger.Error("Event queue is full, event dropped", "event", event.Type, "room", event.RoomID)
+    }
+}
+
+// Run обрабатывает события и очередь доставки до вызова Stop. События принимаются
+// в отдельной горутине, чтобы долгая доставка не переполняла буфер событий
+func (d *Dispatcher) Run() {
+    dispatcherLogger.Info("Webhook dispatcher is running")
+
+    d.intake.Add(1)
+    go d.consume()
+
+    ticker := time.NewTicker(d.PollInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-d.ctx.Done():
+            dispatcherLogger.Info("Webhook dispatcher stopped")
+            return
+
+        case <-ticker.C:
+            // Разбираем очередь, пока в ней есть готовые доставки
+            for {
+                n, err := d.deliverDue(d.ctx)
+                if err != nil {
+                    dispatcherLogger.Error("Failed to process delivery queue", "error", err)
+                    break
+                }
+                if n < d.BatchSize {
+                    break
+                }
+            }
+        }
+    }
+}
+
+// Stop останавливает диспетчер и дописывает в очередь доставки события, оставшиеся в буфере
+func (d *Dispatcher) Stop() {
+    d.cancel()
+    d.intake.Wait()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    for {
+        select {
+        case event := <-d.events:
+            d.enqueue(ctx, event)
+        default:
+            return
+        }
+    }
+}
+
+// consume ставит принятые события в очередь доставки до вызова Stop
+func (d *Dispatcher) consume() {
+    defer d.intake.Done()
+
+    for {
+        select {
+        case <-d.ctx.Done():
+            return
+        case event := <-d.events:
+            d.enqueue(d.ctx, event)
+        }
+    }
+}
+
+// enqueue ставит событие в очередь для каждого подходящего вебхука комнаты
+func (d *Dispatcher) enqueue(ctx context.Context, event models.Event) {
+    hooks, err := d.queue.ListOutgoingWebhooks(ctx, event.RoomID, event.Type)
+    if err != nil {
+        dispatcherLogger.Error("Failed to load outgoing webhooks", "room", event.RoomID, "error", err)
+        return
+    }
+    if len(hooks) == 0 {
+        return
+    }
+
+    payload, err := json.Marshal(event)
+    if err != nil {
+        dispatcherLogger.Error("Failed to serialize event", "event", event.Type, "error", err)
+        return
+    }
+
+    for _, hook := range hooks {
+        if !matchesKeywords(hook.Keywords, event) {
+            continue
+        }
+        if err := d.queue.EnqueueWebhookDelivery(ctx, hook.ID, event.Type, payload); err != nil {
+            dispatcherLogger.Error("Failed to enqueue delivery", "webhook_id", hook.ID, "error", err)
+            continue
+        }
+        dispatcherLogger.Info("Delivery enqueued", "webhook_id", hook.ID, "event", event.Type, "room", event.RoomID)
+    }
+}
+
+// deliverDue выполняет одну попытку для каждой готовой доставки и возвращает их число.
+// Доставки пачки отправляются параллельно, поэтому вся пачка укладывается в аренду
+// одной доставки и другой экземпляр не заберет ее повторно
+func (d *Dispatcher) deliverDue(ctx context.Context) (int, error) {
+    lease := d.client.Timeout + 30*time.Second
+    deliveries, err := d.queue.ClaimWebhookDeliveries(ctx, d.BatchSize, lease)
+    if err != nil {
+        return 0, err
+    }
+
+    var wg sync.WaitGroup
+    for _, delivery := range deliveries {
+        wg.Add(1)
+        go func(delivery storage.WebhookDelivery) {
+            defer wg.Done()
+            attempt := d.attempt(ctx, delivery)
+            if err := d.queue.RecordDeliveryAttempt(ctx, attempt); err != nil {
+                dispatcherLogger.Error("Failed to record delivery attempt", "delivery_id", delivery.ID, "error", err)
+            }
+        }(delivery)
+    }
+    wg.Wait()
+    return len(deliveries), nil
+}
+
+// attempt отправляет одну доставку и решает, что с ней делать дальше
+func (d *Dispatcher) attempt(ctx context.Context, delivery storage.WebhookDelivery) storage.DeliveryAttempt {
+    start := time.Now()
+    result := storage.DeliveryAttempt{
+        DeliveryID:  delivery.ID,
+        Attempt:     delivery.Attempts,
+        AttemptedAt: start,
+    }
+
+    result.StatusCode, result.Error = d.send(ctx, delivery)
+    result.Duration = time.Since(start)
+
+    switch {
+    case result.Error == "":
+        result.Status = storage.DeliveryDelivered
+        result.NextAttemptAt = start
+        dispatcherLogger.Info("Webhook delivered", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID,
+            "status_code", result.StatusCode, "duration", result.Duration)
+    case delivery.Attempts >= d.MaxAttempts:
+        result.Status = storage.DeliveryFailed
+        result.NextAttemptAt = start
+        dispatcherLogger.Error("Webhook delivery failed permanently", "delivery_id", delivery.ID,
+            "webhook_id", delivery.WebhookID, "attempts", delivery.Attempts, "error", result.Error)
+    default:
+        result.Status = storage.DeliveryPending
+        result.NextAttemptAt = start.Add(Backoff(delivery.Attempts, d.BaseBackoff, d.MaxBackoff))
+        dispatcherLogger.Warn("Webhook delivery failed, will retry", "delivery_id", delivery.ID,
+            "webhook_id", delivery.WebhookID, "attempt", delivery.Attempts, "next_attempt_at", result.NextAttemptAt,
+            "error", result.Error)
+    }
+    return result
+}
+
+// send выполняет HTTP запрос. Ошибкой считается все, кроме ответа 2xx
+func (d *Dispatcher) send(ctx context.Context, delivery storage.WebhookDelivery) (int, string) {
+    timestamp := time.Now().Unix()
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+    if err != nil {
+        return 0, err.Error()
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "Thoth-Webhooks/1.0")
+    req.Header.Set(EventHeader, delivery.EventType)
+    req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+    req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+    req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+    resp, err := d.client.Do(req)
+    if err != nil {
+        return 0, err.Error()
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return resp.StatusCode, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+    }
+    return resp.StatusCode, ""
+}
+
+// Backoff возвращает задержку перед следующей попыткой: base * 2^(attempt-1),
+// не больше max, плюс до 10% случайного разброса, чтобы повторы не шли залпом
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+    delay := base
+    for i := 1; i < attempt && delay < max; i++ {
+        delay *= 2
+    }
+    if delay > max {
+        delay = max
+    }
+    return delay + rand.N(delay/10+1)
+}
+
+// matchesKeywords проверяет фильтр по ключевым словам. Фильтр действует только на сообщения,
+// пустой список ключевых слов пропускает все
+func matchesKeywords(keywords []string, event models.Event) bool {
+    if event.Type != models.EventMessage || len(keywords) == 0 {
+        return true
+    }
+    if event.Message == nil {
+        return false
+    }
+    content := strings.ToLower(event.Message.Content)
+    for _, keyword := range keywords {
+        if keyword != "" && strings.Contains(content, strings.ToLower(keyword)) {
+            return true
+        }
+    }
+    return false
+}
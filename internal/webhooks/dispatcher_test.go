@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+// memoryQueue - очередь доставки в памяти вместо Postgres
+type memoryQueue struct {
+    mu         sync.Mutex
+    hooks      []storage.OutgoingWebhook
+    deliveries []*storage.WebhookDelivery
+    attempts   []storage.DeliveryAttempt
+}
+
+func (q *memoryQueue) ListOutgoingWebhooks(ctx context.Context, roomID, eventType string) ([]storage.OutgoingWebhook, error) {
+    var hooks []storage.OutgoingWebhook
+    for _, hook := range q.hooks {
+        for _, e := range hook.Events {
+            if hook.RoomID == roomID && e == eventType {
+                hooks = append(hooks, hook)
+            }
+        }
+    }
+    return hooks, nil
+}
+
+func (q *memoryQueue) EnqueueWebhookDelivery(ctx context.Context, webhookID, eventType string, payload []byte) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    for _, hook := range q.hooks {
+        if hook.ID == webhookID {
+            q.deliveries = append(q.deliveries, &storage.WebhookDelivery{
+                ID: int64(len(q.deliveries) + 1), WebhookID: webhookID, EventType: eventType, Payload: payload,
+                Status: storage.DeliveryPending, URL: hook.URL, Secret: hook.Secret,
+            })
+        }
+    }
+    return nil
+}
+
+func (q *memoryQueue) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storage.WebhookDelivery, error) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    var due []storage.WebhookDelivery
+    for _, d := range q.deliveries {
+        if d.Status == storage.DeliveryPending && !d.NextAttemptAt.After(time.Now()) && len(due) < limit {
+            d.Attempts++
+            due = append(due, *d)
+        }
+    }
+    return due, nil
+}
+
+func (q *memoryQueue) RecordDeliveryAttempt(ctx context.Context, attempt storage.DeliveryAttempt) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.attempts = append(q.attempts, attempt)
+    for _, d := range q.deliveries {
+        if d.ID == attempt.DeliveryID {
+            d.Status = attempt.Status
+            d.NextAttemptAt = attempt.NextAttemptAt
+            d.LastError = attempt.Error
+        }
+    }
+    return nil
+}
+
+func TestDispatcherSignsAndRetries(t *testing.T) {
+    const secret = "test-secret"
+
+    var mu sync.Mutex
+    calls := 0
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        if err := Verify(secret, r.Header, body, time.Minute); err != nil {
+            t.Errorf("Подпись не прошла проверку: %v", err)
+        }
+        if got := r.Header.Get(EventHeader); got != models.EventMessage {
+            t.Errorf("Ожидалось событие %q, получено %q", models.EventMessage, got)
+        }
+        var event models.Event
+        if err := json.Unmarshal(body, &event); err != nil || event.Message == nil || event.Message.Content != "деплой готов" {
+            t.Errorf("Неожиданное тело запроса: %s", body)
+        }
+
+        mu.Lock()
+        defer mu.Unlock()
+        calls++
+        // Первая попытка падает, вторая проходит
+        if calls == 1 {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer server.Close()
+
+    queue := &memoryQueue{hooks: []storage.OutgoingWebhook{{
+        ID: "hook1", RoomID: "ops", URL: server.URL, Secret: secret,
+        Events: []string{models.EventMessage}, Keywords: []string{"деплой"}, Active: true,
+    }}}
+    d := NewDispatcher(queue)
+    d.BaseBackoff = time.Millisecond
+    ctx := context.Background()
+
+    d.enqueue(ctx, models.Event{Type: models.EventMessage, RoomID: "ops", Message: &models.Message{Content: "просто болтаем"}})
+    d.enqueue(ctx, models.Event{Type: models.EventMessage, RoomID: "ops", Message: &models.Message{Content: "деплой готов"}})
+    if len(queue.deliveries) != 1 {
+        t.Fatalf("Ожидалась 1 доставка после фильтра по ключевым словам, получено %d", len(queue.deliveries))
+    }
+
+    if _, err := d.deliverDue(ctx); err != nil {
+        t.Fatalf("Ошибка первого прохода: %v", err)
+    }
+    if got := queue.deliveries[0].Status; got != storage.DeliveryPending {
+        t.Fatalf("После ошибки 503 ожидался статус pending, получен %q", got)
+    }
+
+    time.Sleep(5 * time.Millisecond)
+    if _, err := d.deliverDue(ctx); err != nil {
+        t.Fatalf("Ошибка второго прохода: %v", err)
+    }
+    if got := queue.deliveries[0].Status; got != storage.DeliveryDelivered {
+        t.Fatalf("Ожидался статус delivered, получен %q", got)
+    }
+
+    if len(queue.attempts) != 2 || queue.attempts[0].StatusCode != 503 || queue.attempts[1].StatusCode != 200 {
+        t.Errorf("Неожиданный журнал попыток: %+v", queue.attempts)
+    }
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusInternalServerError)
+    }))
+    defer server.Close()
+
+    queue := &memoryQueue{hooks: []storage.OutgoingWebhook{{
+        ID: "hook1", RoomID: "ops", URL: server.URL, Secret: "s", Events: []string{models.EventUserJoined},
+    }}}
+    d := NewDispatcher(queue)
+    d.BaseBackoff = 0
+    d.MaxAttempts = 3
+    ctx := context.Background()
+
+    d.enqueue(ctx, models.Event{Type: models.EventUserJoined, RoomID: "ops", Username: "alice"})
+    for i := 0; i < 5; i++ {
+        d.deliverDue(ctx)
+    }
+
+    if got := queue.deliveries[0].Status; got != storage.DeliveryFailed {
+        t.Fatalf("Ожидался статус failed, получен %q", got)
+    }
+    if len(queue.attempts) != 3 {
+        t.Errorf("Ожидалось 3 попытки, получено %d", len(queue.attempts))
+    }
+}
+
+func TestDispatcherStopKeepsBufferedEvents(t *testing.T) {
+    queue := &memoryQueue{hooks: []storage.OutgoingWebhook{{
+        ID: "hook1", RoomID: "ops", URL: "http://127.0.0.1:0", Secret: "s", Events: []string{models.EventUserJoined},
+    }}}
+    d := NewDispatcher(queue)
+
+    // Run не запущен: события только копятся в буфере
+    for _, name := range []string{"alice", "bob"} {
+        d.HandleEvent(models.Event{Type: models.EventUserJoined, RoomID: "ops", Username: name})
+    }
+    d.Stop()
+
+    if len(queue.deliveries) != 2 {
+        t.Fatalf("Ожидалось 2 доставки после остановки, получено %d", len(queue.deliveries))
+    }
+}
+
+func TestBackoff(t *testing.T) {
+    base, max := 10*time.Second, time.Minute
+    tests := []struct {
+        attempt int
+        want    time.Duration
+    }{
+        {1, 10 * time.Second},
+        {2, 20 * time.Second},
+        {3, 40 * time.Second},
+        {4, time.Minute},
+        {10, time.Minute},
+    }
+    for _, tt := range tests {
+        got := Backoff(tt.attempt, base, max)
+        if got < tt.want || got > tt.want+tt.want/10 {
+            t.Errorf("Backoff(%d) = %v, ожидалось от %v до %v", tt.attempt, got, tt.want, tt.want+tt.want/10)
+        }
+    }
+}
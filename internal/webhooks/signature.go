@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// Заголовки исходящего запроса вебхука
+const (
+    SignatureHeader = "X-Thoth-Signature"
+    TimestampHeader = "X-Thoth-Timestamp"
+    EventHeader     = "X-Thoth-Event"
+    DeliveryHeader  = "X-Thoth-Delivery"
+)
+
+var (
+    ErrMissingSignature = errors.New("missing webhook signature")
+    ErrBadSignature     = errors.New("webhook signature mismatch")
+    ErrStaleTimestamp   = errors.New("webhook timestamp is outside the tolerance window")
+)
+
+// Sign вычисляет подпись "sha256=<hex>" от HMAC-SHA256(secret, "<timestamp>.<body>").
+// Временная метка входит в подпись, чтобы перехваченный запрос нельзя было повторить позже
+func Sign(secret string, timestamp int64, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+    mac.Write([]byte{'.'})
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись входящего запроса на стороне получателя вебхука
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+    signature := header.Get(SignatureHeader)
+    if signature == "" {
+        return ErrMissingSignature
+    }
+    timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+    if err != nil {
+        return ErrMissingSignature
+    }
+    if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+        return ErrStaleTimestamp
+    }
+    if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+        return ErrBadSignature
+    }
+    return nil
+}
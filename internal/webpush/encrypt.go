@@ -0,0 +1,128 @@
+package webpush
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/ecdh"
+    "crypto/hkdf"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/binary"
+    "errors"
+    "fmt"
+)
+
+// recordSize - размер записи aes128gcm. Все сообщение помещается в одну запись
+const recordSize = 4096
+
+// headerSize - salt (16) + rs (4) + idlen (1) + keyid (65)
+const headerSize = 16 + 4 + 1 + 65
+
+// MaxPayload - наибольший размер полезной нагрузки: push-сервисы принимают тело до 4096 байт,
+// а шифрование добавляет заголовок, разделитель записи и тег GCM
+const MaxPayload = recordSize - headerSize - 1 - 16
+
+var ErrPayloadTooLarge = errors.New("webpush: payload is too large")
+
+// Keys - ключи подписки браузера из PushSubscription.toJSON()
+type Keys struct {
+    P256dh string `json:"p256dh"`
+    Auth   string `json:"auth"`
+}
+
+// Subscription - подписка браузера на push-уведомления
+type Subscription struct {
+    Endpoint string `json:"endpoint"`
+    Keys     Keys   `json:"keys"`
+}
+
+// parseKeys декодирует ключи подписки: открытый ключ P-256 и 16-байтовый секрет
+func parseKeys(keys Keys) (*ecdh.PublicKey, []byte, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(keys.P256dh)
+    if err != nil {
+        return nil, nil, fmt.Errorf("p256dh: %w", err)
+    }
+    pub, err := ecdh.P256().NewPublicKey(raw)
+    if err != nil {
+        return nil, nil, fmt.Errorf("p256dh: %w", err)
+    }
+    secret, err := base64.RawURLEncoding.DecodeString(keys.Auth)
+    if err != nil || len(secret) != 16 {
+        return nil, nil, errors.New("auth must be 16 bytes of base64url")
+    }
+    return pub, secret, nil
+}
+
+// ValidateKeys проверяет ключи подписки до сохранения
+func ValidateKeys(keys Keys) error {
+    _, _, err := parseKeys(keys)
+    return err
+}
+
+// Encrypt шифрует payload для подписки по RFC 8291 (кодирование aes128gcm из RFC 8188)
+func Encrypt(keys Keys, payload []byte) ([]byte, error) {
+    asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    salt := make([]byte, 16)
+    if _, err := rand.Read(salt); err != nil {
+        return nil, err
+    }
+    return encrypt(keys, payload, asKey, salt)
+}
+
+func encrypt(keys Keys, payload []byte, asKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+    if len(payload) > MaxPayload {
+        return nil, ErrPayloadTooLarge
+    }
+    uaPublic, authSecret, err := parseKeys(keys)
+    if err != nil {
+        return nil, err
+    }
+
+    ecdhSecret, err := asKey.ECDH(uaPublic)
+    if err != nil {
+        return nil, err
+    }
+    asPublic := asKey.PublicKey().Bytes()
+
+    // IKM связывает общий секрет ECDH с секретом подписки и ключами обеих сторон
+    keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+    ikm, err := hkdf.Key(sha256.New, ecdhSecret, authSecret, keyInfo, 32)
+    if err != nil {
+        return nil, err
+    }
+    prk, err := hkdf.Extract(sha256.New, ikm, salt)
+    if err != nil {
+        return nil, err
+    }
+    cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+    if err != nil {
+        return nil, err
+    }
+    nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+    if err != nil {
+        return nil, err
+    }
+
+    block, err := aes.NewCipher(cek)
+    if err != nil {
+        return nil, err
+    }
+    gcm, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, err
+    }
+
+    body := make([]byte, headerSize, headerSize+len(payload)+1+gcm.Overhead())
+    copy(body, salt)
+    binary.BigEndian.PutUint32(body[16:], recordSize)
+    body[20] = byte(len(asPublic))
+    copy(body[21:], asPublic)
+
+    // Единственная запись завершается разделителем 0x02 без дополнения
+    record := append(append([]byte{}, payload...), 0x02)
+    return gcm.Seal(body, nonce, record, nil), nil
+}
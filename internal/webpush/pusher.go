@@ -0,0 +1,186 @@
+package webpush
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "log/slog"
+    "strconv"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "Thoth/internal/metrics"
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var pushLogger = slog.With("component", "webpush")
+
+var sendsTotal = metrics.NewCounter("thoth_webpush_sends_total",
+    "Web Push deliveries", "event", "result")
+
+// Store - операции хранилища, которые нужны Pusher. Реализуется *storage.Storage
+type Store interface {
+    ListPushSubscriptions(ctx context.Context, username string) ([]storage.PushSubscription, error)
+    DeletePushSubscription(ctx context.Context, username, endpoint string) error
+}
+
+// Presence сообщает, подключен ли пользователь к чату. Реализуется *websocket.Hub
+type Presence interface {
+    IsOnline(username string) bool
+}
+
+// Notification - содержимое уведомления, которое получает service worker
+type Notification struct {
+    Type   string `json:"type"`
+    Title  string `json:"title"`
+    Body   string `json:"body"`
+    RoomID string `json:"room_id"`
+    Tag    string `json:"tag"` // Уведомления с одинаковым тегом заменяют друг друга
+    URL    string `json:"url"`
+}
+
+// Pusher подписан на события хаба и отправляет упоминания и входящие звонки в браузеры
+// пользователей, которые сейчас не подключены к чату. Личных сообщений в чате пока нет
+type Pusher struct {
+    store    Store
+    sender   *Sender
+    presence Presence
+    events   chan models.Event
+
+    Workers int
+
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+func NewPusher(store Store, sender *Sender, presence Presence) *Pusher {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    return &Pusher{
+        store:    store,
+        sender:   sender,
+        presence: presence,
+        events:   make(chan models.Event, 256),
+        Workers:  4,
+        ctx:      ctx,
+        cancel:   cancel,
+    }
+}
+
+// HandleEvent принимает событие от хаба. Не блокирует: при переполнении уведомление теряется
+func (p *Pusher) HandleEvent(event models.Event) {
+    if (event.Type != models.EventMention && event.Type != models.EventCallOffer) || event.Target == "" {
+        return
+    }
+    select {
+    case p.events <- event:
+    default:
+        pushLogger.Warn("Push queue is full, notification dropped", "event", event.Type, "target", event.Target)
+    }
+}
+
+// Run отправляет уведомления в Workers горутинах до вызова Stop
+func (p *Pusher) Run() {
+    pushLogger.Info("Web Push sender is running", "workers", p.Workers)
+
+    var wg sync.WaitGroup
+    for i := 0; i < p.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-p.ctx.Done():
+                    return
+                case event := <-p.events:
+                    p.process(p.ctx, event)
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    pushLogger.Info("Web Push sender stopped")
+}
+
+func (p *Pusher) Stop() {
+    p.cancel()
+}
+
+func (p *Pusher) process(ctx context.Context, event models.Event) {
+    // Подключенный пользователь уже получил событие через /ws
+    if p.presence != nil && p.presence.IsOnline(event.Target) {
+        return
+    }
+
+    subs, err := p.store.ListPushSubscriptions(ctx, event.Target)
+    if err != nil {
+        pushLogger.Error("Failed to load push subscriptions", "username", event.Target, "error", err)
+        return
+    }
+    if len(subs) == 0 {
+        return
+    }
+
+    n, ttl, urgency := notificationFor(event)
+    payload, err := json.Marshal(n)
+    if err != nil {
+        pushLogger.Error("Failed to encode notification", "error", err)
+        return
+    }
+
+    for _, sub := range subs {
+        err := p.sender.Send(ctx, Subscription{
+            Endpoint: sub.Endpoint,
+            Keys:     Keys{P256dh: sub.P256dh, Auth: sub.Auth},
+        }, payload, ttl, urgency)
+
+        result := "ok"
+        switch {
+        case errors.Is(err, ErrSubscriptionGone):
+            result = "gone"
+            if err := p.store.DeletePushSubscription(ctx, "", sub.Endpoint); err != nil && !errors.Is(err, storage.ErrNotFound) {
+                pushLogger.Error("Failed to delete expired subscription", "error", err)
+            }
+        case err != nil:
+            result = "error"
+            pushLogger.Warn("Push delivery failed", "username", event.Target, "error", err)
+        }
+        sendsTotal.Inc(event.Type, result)
+    }
+}
+
+// maxBodyRunes - сколько символов сообщения показывать в уведомлении
+const maxBodyRunes = 200
+
+// notificationFor строит уведомление, срок его хранения в push-сервисе и приоритет.
+// Звонок без ответа через минуту уже не актуален
+func notificationFor(event models.Event) (Notification, time.Duration, string) {
+    if event.Type == models.EventCallOffer {
+        return Notification{
+            Type:   event.Type,
+            Title:  "Входящий звонок",
+            Body:   event.Username + " звонит вам в комнате " + event.RoomID,
+            RoomID: event.RoomID,
+            Tag:    "call-" + event.RoomID + "-" + event.Username,
+            URL:    "/",
+        }, time.Minute, UrgencyHigh
+    }
+
+    n := Notification{
+        Type:   event.Type,
+        Title:  event.Username + " упомянул вас в " + event.RoomID,
+        RoomID: event.RoomID,
+        Tag:    "mention-" + event.RoomID,
+        URL:    "/",
+    }
+    if event.Message != nil {
+        n.Body = event.Message.Content
+        if utf8.RuneCountInString(n.Body) > maxBodyRunes {
+            n.Body = string([]rune(n.Body)[:maxBodyRunes]) + "…"
+        }
+        n.Tag = "mention-" + strconv.Itoa(event.Message.ID)
+    }
+    return n, 24 * time.Hour, UrgencyNormal
+}
@@ -0,0 +1,114 @@
+package webpush
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ErrSubscriptionGone - push-сервис больше не знает подписку (404/410), ее нужно удалить
+var ErrSubscriptionGone = errors.New("webpush: subscription is gone")
+
+// DefaultPushHosts - push-сервисы браузеров. Сервер отправляет запросы только им:
+// endpoint присылает клиент, и без ограничения им можно было бы адресовать внутренние сервисы
+var DefaultPushHosts = []string{
+    "fcm.googleapis.com",
+    "updates.push.services.mozilla.com",
+    "*.push.apple.com",
+    "*.notify.windows.com",
+}
+
+// AllowedEndpoint сообщает, можно ли отправлять уведомления на endpoint:
+// только https на стандартном порту и только к хостам из hosts ("*.example.com" - любой поддомен)
+func AllowedEndpoint(endpoint string, hosts []string) bool {
+    u, err := url.Parse(endpoint)
+    if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+        return false
+    }
+    host := strings.ToLower(u.Hostname())
+    for _, allowed := range hosts {
+        allowed = strings.ToLower(strings.TrimSpace(allowed))
+        if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+            if strings.HasSuffix(host, "."+suffix) {
+                return true
+            }
+        } else if host == allowed {
+            return true
+        }
+    }
+    return false
+}
+
+// Urgency - приоритет доставки (RFC 8030)
+const (
+    UrgencyNormal = "normal"
+    UrgencyHigh   = "high"
+)
+
+// Sender шифрует уведомления и отправляет их push-сервисам
+type Sender struct {
+    Keys    *VAPIDKeys
+    Subject string // Контакт для push-сервиса: mailto: или https: URL
+    Client  *http.Client
+}
+
+func NewSender(keys *VAPIDKeys, subject string) *Sender {
+    return &Sender{
+        Keys:    keys,
+        Subject: subject,
+        Client: &http.Client{
+            Timeout: 10 * time.Second,
+            // Перенаправления push-сервисам не нужны, а обойти проверку endpoint не должны
+            CheckRedirect: func(req *http.Request, via []*http.Request) error {
+                return http.ErrUseLastResponse
+            },
+        },
+    }
+}
+
+// Send доставляет payload подписке. ttl - сколько push-сервис хранит уведомление,
+// пока браузер не в сети
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration, urgency string) error {
+    body, err := Encrypt(sub.Keys, payload)
+    if err != nil {
+        return err
+    }
+    auth, err := s.Keys.Authorization(sub.Endpoint, s.Subject, time.Now())
+    if err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", auth)
+    req.Header.Set("Content-Encoding", "aes128gcm")
+    req.Header.Set("Content-Type", "application/octet-stream")
+    req.Header.Set("TTL", strconv.Itoa(int(ttl/time.Second)))
+    if urgency != "" {
+        req.Header.Set("Urgency", urgency)
+    }
+
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+    switch {
+    case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+        return ErrSubscriptionGone
+    case resp.StatusCode < 200 || resp.StatusCode > 299:
+        return fmt.Errorf("webpush: push service returned %s", resp.Status)
+    }
+    return nil
+}
@@ -0,0 +1,124 @@
+package webpush
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// VAPIDKeys - ключ сервера приложения (RFC 8292). Открытый ключ браузер получает
+// при подписке, закрытым сервер подписывает каждый запрос к push-сервису
+type VAPIDKeys struct {
+    private *ecdsa.PrivateKey
+}
+
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    return &VAPIDKeys{private: key}, nil
+}
+
+// ParseVAPIDKeys восстанавливает ключи из закрытого ключа P-256 в base64url (32 байта),
+// в том же формате, что выдают распространенные генераторы VAPID-ключей
+func ParseVAPIDKeys(privateKey string) (*VAPIDKeys, error) {
+    d, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(privateKey))
+    if err != nil || len(d) != 32 {
+        return nil, errors.New("webpush: VAPID private key must be 32 bytes of base64url")
+    }
+    curve := elliptic.P256()
+    k := new(big.Int).SetBytes(d)
+    if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+        return nil, errors.New("webpush: invalid VAPID private key")
+    }
+    key := &ecdsa.PrivateKey{D: k}
+    key.PublicKey.Curve = curve
+    key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d)
+    return &VAPIDKeys{private: key}, nil
+}
+
+// LoadOrCreateVAPIDKeys читает ключ из файла, а если файла нет - создает новый ключ и сохраняет его.
+// Ключ должен переживать перезапуски: подписки браузеров привязаны к открытому ключу
+func LoadOrCreateVAPIDKeys(path string) (*VAPIDKeys, error) {
+    data, err := os.ReadFile(path)
+    if err == nil {
+        return ParseVAPIDKeys(string(data))
+    }
+    if !errors.Is(err, os.ErrNotExist) {
+        return nil, err
+    }
+
+    keys, err := GenerateVAPIDKeys()
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+        return nil, err
+    }
+    if err := os.WriteFile(path, []byte(keys.PrivateKeyString()+"\n"), 0o600); err != nil {
+        return nil, err
+    }
+    return keys, nil
+}
+
+// PrivateKeyString возвращает закрытый ключ в base64url
+func (k *VAPIDKeys) PrivateKeyString() string {
+    return base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+}
+
+// PublicKey возвращает открытый ключ (несжатая точка P-256) в base64url -
+// это applicationServerKey для pushManager.subscribe
+func (k *VAPIDKeys) PublicKey() string {
+    pub, err := k.private.PublicKey.ECDH()
+    if err != nil {
+        return ""
+    }
+    return base64.RawURLEncoding.EncodeToString(pub.Bytes())
+}
+
+// vapidTokenTTL - срок действия JWT; RFC 8292 допускает не более суток
+const vapidTokenTTL = 12 * time.Hour
+
+// Authorization строит заголовок Authorization для запроса к endpoint.
+// subject - контакт владельца сервера: mailto: или https: URL
+func (k *VAPIDKeys) Authorization(endpoint, subject string, now time.Time) (string, error) {
+    u, err := url.Parse(endpoint)
+    if err != nil || u.Host == "" {
+        return "", fmt.Errorf("webpush: invalid endpoint %q", endpoint)
+    }
+
+    header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+    claims, err := json.Marshal(struct {
+        Aud string `json:"aud"`
+        Exp int64  `json:"exp"`
+        Sub string `json:"sub"`
+    }{u.Scheme + "://" + u.Host, now.Add(vapidTokenTTL).Unix(), subject})
+    if err != nil {
+        return "", err
+    }
+
+    signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+    digest := sha256.Sum256([]byte(signingInput))
+    r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+    if err != nil {
+        return "", err
+    }
+    sig := make([]byte, 64)
+    r.FillBytes(sig[:32])
+    s.FillBytes(sig[32:])
+
+    jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+    return "vapid t=" + jwt + ", k=" + k.PublicKey(), nil
+}
@@ -0,0 +1,244 @@
+package webpush
+
+import (
+    "bytes"
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/ecdh"
+    "crypto/ecdsa"
+    "crypto/hkdf"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "io"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+func b64(t *testing.T, s string) []byte {
+    t.Helper()
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        t.Fatalf("base64 %q: %v", s, err)
+    }
+    return b
+}
+
+// Пример из RFC 8291, приложение A
+func TestEncryptRFC8291Example(t *testing.T) {
+    asKey, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    keys := Keys{
+        P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+        Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+    }
+    got, err := encrypt(keys, []byte("When I grow up, I want to be a watermelon"), asKey, b64(t, "DGv6ra1nlYgDCS1FRnbzlw"))
+    if err != nil {
+        t.Fatalf("encrypt: %v", err)
+    }
+
+    want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+    if enc := base64.RawURLEncoding.EncodeToString(got); enc != want {
+        t.Errorf("encrypt() = %s\nожидалось %s", enc, want)
+    }
+}
+
+func TestEncryptRejectsBadKeys(t *testing.T) {
+    cases := []Keys{
+        {P256dh: "not-a-key", Auth: "BTBZMqHH6r4Tts7J_aSIgg"},
+        {P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4", Auth: "c2hvcnQ"},
+    }
+    for _, keys := range cases {
+        if _, err := Encrypt(keys, []byte("x")); err == nil {
+            t.Errorf("ключи %+v приняты", keys)
+        }
+    }
+    good := Keys{P256dh: cases[1].P256dh, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+    if _, err := Encrypt(good, bytes.Repeat([]byte("x"), MaxPayload+1)); err != ErrPayloadTooLarge {
+        t.Errorf("слишком большой payload: %v", err)
+    }
+}
+
+func TestVAPIDAuthorization(t *testing.T) {
+    keys, err := GenerateVAPIDKeys()
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseVAPIDKeys(keys.PrivateKeyString())
+    if err != nil || parsed.PublicKey() != keys.PublicKey() {
+        t.Fatalf("ключ не восстанавливается: %v", err)
+    }
+
+    now := time.Unix(1700000000, 0)
+    header, err := keys.Authorization("https://push.example.com/send/abc?x=1", "mailto:admin@example.com", now)
+    if err != nil {
+        t.Fatalf("Authorization: %v", err)
+    }
+    rest, ok := strings.CutPrefix(header, "vapid t=")
+    if !ok {
+        t.Fatalf("неверная схема: %q", header)
+    }
+    jwt, pub, ok := strings.Cut(rest, ", k=")
+    if !ok || pub != keys.PublicKey() {
+        t.Fatalf("нет открытого ключа: %q", header)
+    }
+
+    parts := strings.Split(jwt, ".")
+    if len(parts) != 3 {
+        t.Fatalf("JWT из %d частей", len(parts))
+    }
+    var claims struct {
+        Aud string `json:"aud"`
+        Exp int64  `json:"exp"`
+        Sub string `json:"sub"`
+    }
+    if err := json.Unmarshal(b64(t, parts[1]), &claims); err != nil {
+        t.Fatal(err)
+    }
+    if claims.Aud != "https://push.example.com" || claims.Sub != "mailto:admin@example.com" || claims.Exp != now.Add(12*time.Hour).Unix() {
+        t.Errorf("неверные claims: %+v", claims)
+    }
+
+    sig := b64(t, parts[2])
+    digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+    r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+    if len(sig) != 64 || !ecdsa.Verify(&keys.private.PublicKey, digest[:], r, s) {
+        t.Error("подпись JWT не проверяется")
+    }
+}
+
+func TestAllowedEndpoint(t *testing.T) {
+    hosts := DefaultPushHosts
+    cases := map[string]bool{
+        "https://fcm.googleapis.com/fcm/send/abc":              true,
+        "https://updates.push.services.mozilla.com/wpush/v2/x": true,
+        "https://web.push.apple.com/QGx":                       true,
+        "http://fcm.googleapis.com/fcm/send/abc":               false,
+        "https://evil.com/fcm.googleapis.com":                  false,
+        "https://fcm.googleapis.com.evil.com/x":                false,
+        "https://127.0.0.1/x":                                  false,
+        "https://fcm.googleapis.com:8443/x":                    false,
+    }
+    for endpoint, want := range cases {
+        if got := AllowedEndpoint(endpoint, hosts); got != want {
+            t.Errorf("AllowedEndpoint(%q) = %v, ожидалось %v", endpoint, got, want)
+        }
+    }
+}
+
+// decrypt расшифровывает тело aes128gcm так, как это делает браузер
+func decrypt(t *testing.T, uaKey *ecdh.PrivateKey, authSecret, body []byte) []byte {
+    t.Helper()
+    salt, idlen := body[:16], int(body[20])
+    asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+idlen])
+    if err != nil {
+        t.Fatal(err)
+    }
+    secret, err := uaKey.ECDH(asPublic)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ikm, _ := hkdf.Key(sha256.New, secret, authSecret, "WebPush: info\x00"+string(uaKey.PublicKey().Bytes())+string(asPublic.Bytes()), 32)
+    prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+    cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+    nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+
+    block, _ := aes.NewCipher(cek)
+    gcm, _ := cipher.NewGCM(block)
+    plain, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+    if err != nil {
+        t.Fatalf("не расшифровывается: %v", err)
+    }
+    return bytes.TrimSuffix(plain, []byte{0x02})
+}
+
+type fakeStore struct {
+    mu      sync.Mutex
+    subs    []storage.PushSubscription
+    deleted []string
+}
+
+func (f *fakeStore) ListPushSubscriptions(ctx context.Context, username string) ([]storage.PushSubscription, error) {
+    return f.subs, nil
+}
+
+func (f *fakeStore) DeletePushSubscription(ctx context.Context, username, endpoint string) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.deleted = append(f.deleted, endpoint)
+    return nil
+}
+
+type onlineSet map[string]bool
+
+func (o onlineSet) IsOnline(username string) bool { return o[username] }
+
+func TestPusherDeliversToOfflineUsers(t *testing.T) {
+    uaKey, _ := ecdh.P256().GenerateKey(rand.Reader)
+    authSecret := []byte("0123456789abcdef")
+
+    var mu sync.Mutex
+    var received []Notification
+    var headers []http.Header
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/gone" {
+            w.WriteHeader(http.StatusGone)
+            return
+        }
+        body, _ := io.ReadAll(r.Body)
+        var n Notification
+        if err := json.Unmarshal(decrypt(t, uaKey, authSecret, body), &n); err != nil {
+            t.Errorf("payload: %v", err)
+        }
+        mu.Lock()
+        received = append(received, n)
+        headers = append(headers, r.Header.Clone())
+        mu.Unlock()
+        w.WriteHeader(http.StatusCreated)
+    }))
+    defer srv.Close()
+
+    keys := Keys{
+        P256dh: base64.RawURLEncoding.EncodeToString(uaKey.PublicKey().Bytes()),
+        Auth:   base64.RawURLEncoding.EncodeToString(authSecret),
+    }
+    store := &fakeStore{subs: []storage.PushSubscription{
+        {Username: "bob", Endpoint: srv.URL + "/ok", P256dh: keys.P256dh, Auth: keys.Auth},
+        {Username: "bob", Endpoint: srv.URL + "/gone", P256dh: keys.P256dh, Auth: keys.Auth},
+    }}
+    vapid, _ := GenerateVAPIDKeys()
+    p := NewPusher(store, NewSender(vapid, "mailto:admin@example.com"), onlineSet{"carol": true})
+
+    msg := &models.Message{ID: 42, Content: "@bob глянь"}
+    p.process(context.Background(), models.Event{Type: models.EventMention, RoomID: "general", Username: "alice", Target: "bob", Message: msg})
+    p.process(context.Background(), models.Event{Type: models.EventCallOffer, RoomID: "general", Username: "alice", Target: "bob"})
+    p.process(context.Background(), models.Event{Type: models.EventMention, RoomID: "general", Username: "alice", Target: "carol", Message: msg})
+
+    if len(received) != 2 {
+        t.Fatalf("доставлено %d уведомлений, ожидалось 2 (carol в сети)", len(received))
+    }
+    if received[0].Body != "@bob глянь" || received[0].Tag != "mention-42" {
+        t.Errorf("уведомление об упоминании: %+v", received[0])
+    }
+    if received[1].Type != models.EventCallOffer || headers[1].Get("Urgency") != UrgencyHigh || headers[1].Get("TTL") != "60" {
+        t.Errorf("уведомление о звонке: %+v, заголовки %v", received[1], headers[1])
+    }
+    if got := headers[0].Get("Authorization"); !strings.HasPrefix(got, "vapid t=") || headers[0].Get("Content-Encoding") != "aes128gcm" {
+        t.Errorf("заголовки запроса: %v", headers[0])
+    }
+    if len(store.deleted) != 2 || store.deleted[0] != srv.URL+"/gone" {
+        t.Errorf("удалены подписки %v, ожидалась только /gone (дважды)", store.deleted)
+    }
+}
@@ -0,0 +1,294 @@
+package websocket
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "Thoth/internal/calls"
+    "Thoth/internal/models"
+    "Thoth/internal/sfu"
+)
+
+var (
+    ErrTargetNotInRoom = errors.New("target user is not in this room")
+    ErrStatsPeer       = errors.New("peer is not connected with you in the current call")
+)
+
+// isSignaling - кадры WebRTC, которые пересылаются одному участнику
+func isSignaling(msgType string) bool {
+    return msgType == models.MessageTypeWebRTCOffer ||
+        msgType == models.MessageTypeWebRTCAnswer ||
+        msgType == models.MessageTypeWebRTCCandidate
+}
+
+// isInvitation - кадры приглашения в звонок, которые тоже пересылаются одному участнику
+func isInvitation(msgType string) bool {
+    return msgType == models.MessageTypeCallInvite ||
+        msgType == models.MessageTypeCallAccept ||
+        msgType == models.MessageTypeCallDecline ||
+        msgType == models.MessageTypeCallCancel
+}
+
+// validateSignaling проверяет содержимое кадра сигнализации и то, что адресат подключен
+// к той же комнате. Об ошибках в кандидатах отправителю не сообщается, как и в checkSignaling
+func (c *Client) validateSignaling(msg models.Message) bool {
+    err := models.ValidateSignaling(&msg)
+    if err == nil && msg.TargetUser != sfu.PeerName && !c.Hub.InRoom(c.RoomID, msg.TargetUser) {
+        err = ErrTargetNotInRoom
+    }
+    if err != nil {
+        hubLogger.With("method", "validatesignaling").Warn("Invalid signaling message",
+            "username", c.Username, "type", msg.Type, "target", msg.TargetUser, "error", err)
+        if msg.Type != models.MessageTypeWebRTCCandidate {
+            c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+        }
+        return false
+    }
+    return true
+}
+
+// reportCallStats принимает отчет о качестве соединения: учитывает его в метриках и сохраняет
+// за текущим звонком. Отчет принимается, только если отправитель и собеседник сейчас в звонке
+func (c *Client) reportCallStats(msg models.Message) {
+    err := models.ValidateCallStats(&msg)
+    var call models.Call
+    if err == nil {
+        var ok bool
+        if call, ok = c.Hub.Calls.InCall(c.RoomID, c.Username); !ok {
+            err = calls.ErrNoCall
+        } else if call.Mode == models.CallModeSFU && msg.Stats.Peer != sfu.PeerName {
+            err = ErrStatsPeer
+        } else if call.Mode != models.CallModeSFU {
+            if peerCall, ok := c.Hub.Calls.InCall(c.RoomID, msg.Stats.Peer); !ok || peerCall.ID != call.ID {
+                err = ErrStatsPeer
+            }
+        }
+    }
+    if err != nil {
+        // Отчет мог опоздать к концу звонка - это не повод показывать пользователю ошибку
+        hubLogger.With("method", "reportcallstats").Warn("Call stats rejected", "username", c.Username, "error", err)
+        return
+    }
+
+    stats := *msg.Stats
+    stats.CallID = call.ID
+    stats.Username = c.Username
+    stats.ReportedAt = msg.Timestamp
+    calls.ObserveStats(stats)
+    if c.Store == nil {
+        return
+    }
+    if err := c.Store.SaveCallStats(c.Hub.ctx, c.RoomID, stats); err != nil {
+        hubLogger.With("method", "reportcallstats").Error("Failed to save call stats", "call_id", call.ID, "username", c.Username, "error", err)
+    }
+}
+
+// callLimit проверяет лимит сигнализации пары участников в текущем звонке комнаты.
+// Возвращает уровень сработавшего лимита или пустую строку
+func (c *Client) callLimit(msg models.Message) string {
+    if c.Limits == nil || c.Hub.Calls == nil {
+        return ""
+    }
+    call, ok := c.Hub.Calls.Active(c.RoomID)
+    if !ok {
+        return ""
+    }
+    return c.Limits.AllowCall(rateClass(msg.Type), call.ID+"/"+c.Username+"/"+msg.TargetUser)
+}
+
+// checkSignaling сверяет кадр сигнализации с состоянием звонка комнаты. false - кадр
+// пересылать нельзя; отправителю offer и answer сообщается причина, кандидаты,
+// опоздавшие после завершения звонка, отбрасываются молча
+func (c *Client) checkSignaling(msg models.Message) bool {
+    if c.Hub.Calls == nil {
+        return true
+    }
+    if err := c.Hub.Calls.Signal(c.RoomID, c.Username, msg.TargetUser, msg.Type); err != nil {
+        hubLogger.With("method", "checksignaling").Warn("Signaling rejected",
+            "username", c.Username, "type", msg.Type, "target", msg.TargetUser, "error", err)
+        if msg.Type != models.MessageTypeWebRTCCandidate {
+            c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+        }
+        return false
+    }
+    return true
+}
+
+// handleInvitation применяет кадр приглашения к звонку комнаты и дополняет его для
+// адресата. false - кадр пересылать не нужно
+func (c *Client) handleInvitation(msg *models.Message) bool {
+    if c.Hub.Calls == nil {
+        return true
+    }
+
+    var changed *models.Call // Звонок, который на этом начался или закончился
+    var err error
+    switch msg.Type {
+    case models.MessageTypeCallInvite:
+        var call models.Call
+        call, err = c.Hub.Calls.Invite(c.RoomID, c.Username, msg.TargetUser)
+        if errors.Is(err, calls.ErrBusy) {
+            // Занятость - не ошибка звонящего: отвечаем за адресата отказом
+            c.Hub.SendToClient(c, inviteReply(models.MessageTypeCallDecline, c.RoomID, msg.TargetUser, c.Username, models.InviteBusy))
+            return false
+        }
+        msg.Call = &call
+    case models.MessageTypeCallAccept:
+        changed, err = c.Hub.Calls.Accept(c.RoomID, c.Username, msg.TargetUser)
+    case models.MessageTypeCallDecline:
+        msg.Content = models.InviteDeclined
+        changed, err = c.Hub.Calls.Decline(c.RoomID, c.Username, msg.TargetUser)
+    case models.MessageTypeCallCancel:
+        msg.Content = models.InviteCancelled
+        changed, err = c.Hub.Calls.Cancel(c.RoomID, c.Username, msg.TargetUser)
+    }
+    if err != nil {
+        hubLogger.With("method", "handleinvitation").Warn("Call invitation rejected",
+            "username", c.Username, "type", msg.Type, "target", msg.TargetUser, "error", err)
+        c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+        return false
+    }
+    if changed != nil {
+        c.Hub.publishCall(*changed)
+    }
+    if msg.Type == models.MessageTypeCallAccept {
+        c.Hub.joinSFU(c.RoomID)
+    }
+    return true
+}
+
+// signalSFU передает SFU сигнализацию участника звонка
+func (c *Client) signalSFU(msg models.Message) {
+    var err error = sfu.ErrNotJoined
+    if c.Hub.SFU != nil {
+        err = c.Hub.SFU.HandleSignal(c.RoomID, c.Username, msg)
+    }
+    if err != nil {
+        hubLogger.With("method", "signalsfu").Warn("SFU signaling rejected", "username", c.Username, "type", msg.Type, "error", err)
+        if msg.Type != models.MessageTypeWebRTCCandidate {
+            c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+        }
+    }
+}
+
+// joinSFU подключает к SFU участников звонка комнаты, если звонок переведен на сервер.
+// При переводе комната узнает об этом кадром call_mode, чтобы закрыть попарные соединения
+func (h *Hub) joinSFU(roomID string) {
+    if h.SFU == nil || h.Calls == nil {
+        return
+    }
+    call, ok := h.Calls.Active(roomID)
+    if !ok || call.Mode != models.CallModeSFU {
+        return
+    }
+    if !h.SFU.Serving(roomID) {
+        h.SendMessageAsync(models.Message{
+            Type:      models.MessageTypeCallMode,
+            Username:  "system",
+            RoomID:    roomID,
+            Call:      &call,
+            Timestamp: time.Now(),
+        })
+    }
+    for _, p := range call.Participants {
+        if !p.LeftAt.IsZero() {
+            continue
+        }
+        if err := h.SFU.Join(roomID, p.Username); err != nil {
+            hubLogger.With("method", "joinsfu").Error("Failed to connect participant to SFU", "username", p.Username, "room", roomID, "error", err)
+        }
+    }
+}
+
+// sendSignal передает в Run кадр SFU. Вызывается из очереди участника SFU и блокируется,
+// чтобы кандидаты не обогнали offer
+func (h *Hub) sendSignal(msg models.Message) {
+    select {
+    case h.Broadcast <- msg:
+    case <-h.ctx.Done():
+    }
+}
+
+// inviteReply - ответ на приглашение от имени from для to
+func inviteReply(msgType, roomID, from, to, reason string) models.Message {
+    return models.Message{
+        Type:       msgType,
+        Username:   from,
+        TargetUser: to,
+        RoomID:     roomID,
+        Content:    reason,
+        Timestamp:  time.Now(),
+    }
+}
+
+// leaveCall выводит пользователя из звонка комнаты; тем, кого он приглашал или кто
+// приглашал его, сообщается, что приглашение снято
+func (h *Hub) leaveCall(roomID, username string) {
+    if h.Calls == nil {
+        return
+    }
+    dropped, call := h.Calls.Leave(roomID, username)
+    if h.SFU != nil {
+        // Закрытие соединения ждет его обработчиков - не держим ими Run
+        go h.SFU.Leave(roomID, username)
+    }
+    for _, inv := range dropped {
+        if inv.From == username {
+            h.SendMessageAsync(inviteReply(models.MessageTypeCallCancel, roomID, inv.From, inv.To, models.InviteCancelled))
+        } else {
+            h.SendMessageAsync(inviteReply(models.MessageTypeCallDecline, roomID, inv.To, inv.From, models.InviteDeclined))
+        }
+    }
+    if call != nil {
+        h.publishCall(*call)
+    }
+}
+
+// expireInvitation сообщает обоим участникам приглашения, что никто не ответил
+func (h *Hub) expireInvitation(inv calls.Invitation) {
+    h.SendMessageAsync(inviteReply(models.MessageTypeCallDecline, inv.Call.RoomID, inv.To, inv.From, models.InviteTimeout))
+    h.SendMessageAsync(inviteReply(models.MessageTypeCallCancel, inv.Call.RoomID, inv.From, inv.To, models.InviteTimeout))
+}
+
+// redeliverInvitations повторяет приглашения, которые ждут ответа подключившегося
+// клиента. Вызывается только из Run
+func (h *Hub) redeliverInvitations(client *Client) {
+    if h.Calls == nil {
+        return
+    }
+    for _, inv := range h.Calls.Pending(client.RoomID, client.Username) {
+        h.deliverToClient(client, models.Message{
+            Type:       models.MessageTypeCallInvite,
+            Username:   inv.From,
+            TargetUser: inv.To,
+            RoomID:     client.RoomID,
+            Call:       &inv.Call,
+            Timestamp:  inv.At,
+        })
+    }
+}
+
+// publishCall сообщает комнате и подписчикам, что звонок начался или закончился
+func (h *Hub) publishCall(call models.Call) {
+    msgType, eventType := models.MessageTypeCallStarted, models.EventCallStarted
+    if call.State == models.CallEnded {
+        msgType, eventType = models.MessageTypeCallEnded, models.EventCallEnded
+        if h.Recorder != nil {
+            // Запись звонка заканчивается вместе с ним
+            go h.stopRecording(call.RoomID)
+        }
+        if h.SFU != nil {
+            go h.SFU.Close(call.RoomID)
+        }
+    }
+    now := time.Now()
+    h.SendMessageAsync(models.Message{
+        Type:      msgType,
+        Username:  "system",
+        RoomID:    call.RoomID,
+        Call:      &call,
+        Timestamp: now,
+    })
+    h.emit(models.Event{Type: eventType, RoomID: call.RoomID, Username: call.Initiator, Call: &call, Timestamp: now})
+}
@@ -2,12 +2,18 @@ package websocket
 
 import (
     "encoding/json"
+    "fmt"
     "log/slog"
     "time"
     "context"
     
     "github.com/gorilla/websocket"
+    "Thoth/internal/calls"
     "Thoth/internal/models"
+    "Thoth/internal/moderation"
+    "Thoth/internal/ratelimit"
+    "Thoth/internal/recording"
+    "Thoth/internal/sfu"
     "Thoth/internal/storage"
 )
 
@@ -20,7 +26,16 @@ type Client struct {
     Send     chan models.Message    // Канал для отправки сообщений этому клиенту
     Username string                 // Имя пользователя
     RoomID   string                 // В какой комнате находится
+    Role     string                 // Роль в комнате, подтвержденная токеном участника
     Store    *storage.Storage          // Отправка сообщений в БД
+    Limits   *ratelimit.Conn           // Лимиты частоты сообщений; nil - без ограничений
+    Media    models.MediaState         // Микрофон, камера и показ экрана; меняется только в Run
+}
+
+// EventListener получает события комнат (сообщения, входы и выходы пользователей).
+// HandleEvent вызывается из горутин хаба и не должен блокировать
+type EventListener interface {
+    HandleEvent(event models.Event)
 }
 
 // Hub управляет всеми клиентами и сообщениями
@@ -32,6 +47,26 @@ type Hub struct {
     Broadcast  chan models.Message  // Канал для рассылки сообщений
     Register   chan *Client         // Канал для регистрации новых клиентов  
     Unregister chan *Client         // Канал для отключения клиентов
+    direct     chan clientMessage   // Канал для ответов конкретному подключению
+    notify     chan models.Message  // Уведомления пользователю TargetUser во всех его комнатах
+    state      chan clientMessage   // Кадры media_state: состояние клиента меняется только в Run
+
+    // Подписчики на события; заполняются до запуска Run
+    Listeners []EventListener
+
+    // Фильтры чат-сообщений перед сохранением и рассылкой; nil - без фильтрации
+    Filters *moderation.Chain
+
+    // Звонки комнат: сигнализация WebRTC проверяется по их состоянию; nil - без проверки
+    Calls *calls.Manager
+
+    // SFU для звонков, переведенных на сервер (Calls.SFUThreshold); nil - только попарные соединения
+    SFU *sfu.SFU
+
+    // Запись звонков, идущих через SFU; nil - запись выключена
+    Recorder *recording.Recorder
+
+    presence presence
 
     ctx    context.Context
     cancel context.CancelFunc
@@ -46,6 +81,9 @@ func NewHub() *Hub {
         Broadcast:  make(chan models.Message, 1000), // БУФЕР
         Register:   make(chan *Client),
         Unregister: make(chan *Client),
+        direct:     make(chan clientMessage, 100),
+        notify:     make(chan models.Message, 100),
+        state:      make(chan clientMessage, 100),
         ctx:        ctx,
         cancel:     cancel,
     }
@@ -53,6 +91,13 @@ func NewHub() *Hub {
 
 func (h *Hub) Run() {
     hubLogger.Info("Hub is running and waiting for an event")
+    if h.Calls != nil {
+        go h.Calls.Run(h.expireInvitation, h.publishCall)
+    }
+    if h.SFU != nil {
+        h.SFU.Send = h.sendSignal
+        go h.SFU.Run()
+    }
     for {
         select {
         case <-h.ctx.Done():
@@ -68,6 +113,7 @@ func (h *Hub) Run() {
                 hubLogger.Info("Room created", "room", client.RoomID)
             }
             h.Clients[client.RoomID][client] = true
+            h.presence.add(client.RoomID, client.Username)
             
             clientCount := len(h.Clients[client.RoomID])
             hubLogger.Info("Client connected",
@@ -86,18 +132,21 @@ func (h *Hub) Run() {
             }
             hubLogger.Info("Send joinMessage asynchronously")
             h.SendMessageAsync(joinMessage)
+            h.emit(models.Event{Type: models.EventUserJoined, RoomID: client.RoomID, Username: client.Username, Timestamp: joinMessage.Timestamp})
 
             // АСИНХРОННО отправляем список пользователей
             hubLogger.Info("Sending a list of clients asynchronously")
             h.BroadcastUsersList(client.RoomID)
+            // Если пользователю звонят, пока он подключался, - звоним и сюда
+            h.redeliverInvitations(client)
+            h.redeliverRecording(client)
 
         case client := <-h.Unregister:
             hubLogger.Info("Received a request to disconnect the client", "username", client.Username)
             
             if clients, ok := h.Clients[client.RoomID]; ok {
                 if _, ok := clients[client]; ok {
-                    delete(h.Clients[client.RoomID], client)
-                    close(client.Send)
+                    h.dropClient(client)
                     hubLogger.Info("The client has disconnected from the room", "username", client.Username, "room", client.RoomID)
 
                     leaveMessage := models.Message{
@@ -109,49 +158,66 @@ func (h *Hub) Run() {
                     }
                     h.SendMessageAsync(leaveMessage)
                     h.BroadcastUsersList(client.RoomID)
+                    // Последнее подключение пользователя к комнате - он выходит и из звонка
+                    if h.FindClient(client.RoomID, client.Username) == nil {
+                        h.leaveCall(client.RoomID, client.Username)
+                    }
+                    h.emit(models.Event{Type: models.EventUserLeft, RoomID: client.RoomID, Username: client.Username, Timestamp: leaveMessage.Timestamp})
                 }
             }
 
+        case cm := <-h.direct:
+            h.deliverToClient(cm.client, cm.message)
+
+        case message := <-h.notify:
+            h.deliverToUser(message)
+
+        case cm := <-h.state:
+            h.applyMediaState(cm.client, cm.message)
+
         case message := <-h.Broadcast:
             hubLogger.Info("Received a message for distribution", 
                 "type", message.Type,
                 "username", message.Username,
                 "room", message.RoomID)
                 
-            // WebRTC сообщение?
-            if message.Type == models.MessageTypeWebRTCOffer || 
-               message.Type == models.MessageTypeWebRTCAnswer || 
-               message.Type == models.MessageTypeWebRTCCandidate {
+            // WebRTC сообщение или приглашение в звонок?
+            if isSignaling(message.Type) || isInvitation(message.Type) {
                 
-                // WebRTC сообщения идут конкретному пользователю
+                // WebRTC сообщения и приглашения идут конкретному пользователю
                 hubLogger.Info("WebRTC message for the client", "type", message.Type, "target", message.TargetUser)
                 h.SendToUser(message)
             } else {
                 // Обычные сообщения - всем в комнате
-                if clients, ok := h.Clients[message.RoomID]; ok {
-                        hubLogger.Info("Clients found in the room", "client_count", len(clients), "room", message.RoomID)
-                        sentCount := 0
-                        for client := range clients {
-                            hubLogger.Info("Trying to send a message to the client", "username", client.Username)
-                            select {
-                            case client.Send <- message:
-                                sentCount++
-                                hubLogger.Info("The message has been successfully sent to the client", "username", client.Username)
-                            default:
-                                hubLogger.Error("The client's queue is full, disconnecting the client", "username", client.Username)
-                                close(client.Send)
-                                delete(h.Clients[message.RoomID], client)
-                            }
-                        }
-                        hubLogger.Info("Message sent to clients", "sent_count", sentCount)
-                } else {
-                    hubLogger.Error("Room not found in h.Clients", "room", message.RoomID)
-                }
+                h.broadcastToRoom(message)
             }
         }
     }
 }
 
+// broadcastToRoom отправляет сообщение всем клиентам комнаты. Вызывается только из Run
+func (h *Hub) broadcastToRoom(message models.Message) {
+    clients, ok := h.Clients[message.RoomID]
+    if !ok {
+        hubLogger.Error("Room not found in h.Clients", "room", message.RoomID)
+        return
+    }
+    hubLogger.Info("Clients found in the room", "client_count", len(clients), "room", message.RoomID)
+    sentCount := 0
+    for client := range clients {
+        hubLogger.Info("Trying to send a message to the client", "username", client.Username)
+        select {
+        case client.Send <- message:
+            sentCount++
+            hubLogger.Info("The message has been successfully sent to the client", "username", client.Username)
+        default:
+            hubLogger.Error("The client's queue is full, disconnecting the client", "username", client.Username)
+            h.dropClient(client)
+        }
+    }
+    hubLogger.Info("Message sent to clients", "sent_count", sentCount)
+}
+
 // ReadPump читает сообщения от браузера и отправляет в Hub
 func (c *Client) ReadPump() {
     defer func() {
@@ -170,11 +236,19 @@ func (c *Client) ReadPump() {
         return nil
     })
 
+    // Отказ сообщаем не чаще раза в секунду, чтобы не отвечать флудом на флуд
+    var lastLimitNotice time.Time
+    rateLimited := func(msgType, scope string) {
+        if time.Since(lastLimitNotice) > time.Second {
+            lastLimitNotice = time.Now()
+            hubLogger.With("method", "readpump").Warn("Client rate limited", "username", c.Username, "type", msgType, "scope", scope)
+            c.Hub.SendToClient(c, rateLimitedMessage(c.RoomID, msgType))
+        }
+    }
+
     for {
-        var msg models.Message
-        
-        // Читаем JSON сообщение от браузера
-        err := c.Conn.ReadJSON(&msg)
+        // Сначала кадр целиком, потом JSON: ошибка разбора не путается с ошибкой соединения
+        _, data, err := c.Conn.ReadMessage()
         if err != nil {
             if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
                 hubLogger.With("method", "readpump").Error("WebSocket error for the client", "username", c.Username, "error", err)
@@ -184,26 +258,104 @@ func (c *Client) ReadPump() {
             break
         }
 
+        var msg models.Message
+        if err := json.Unmarshal(data, &msg); err != nil {
+            // Кадр прочитан целиком, соединение цело: отвечаем ошибкой и ждем следующий.
+            // Ответ тоже ограничен лимитом, иначе поток битых кадров превратится в поток ответов
+            if c.Limits != nil {
+                if scope := c.Limits.Allow(ratelimit.ClassOther); scope != "" {
+                    rateLimited("", scope)
+                    continue
+                }
+            }
+            hubLogger.With("method", "readpump").Warn("Malformed message from the client", "username", c.Username, "error", err)
+            c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+            continue
+        }
+
         // Заполняем метаданные сообщения
         msg.Username = c.Username
         msg.RoomID = c.RoomID
         msg.Timestamp = time.Now()
-
-        if msg.Type == models.MessageTypeChat && c.Store != nil {
-            err := c.Store.SaveMessage(c.Hub.ctx, storage.Message{
-                Username: msg.Username,
-                Content:  msg.Content,
-            })
-            if err != nil {
-                hubLogger.With("method", "readpump").Error("Error saving message to database", "error", err)
-            }
-        }
+        msg.Token = "" // Токены выдает только сервер
+        msg.OwnerKey = ""
+        msg.UserKey = ""
 
         // Если без типа - обычный чат
         if msg.Type == "" {
             msg.Type = models.MessageTypeChat
         }
 
+        // Лимиты проверяются до Broadcast: иначе один клиент может заполнить его буфер
+        if c.Limits != nil {
+            if scope := c.Limits.Allow(rateClass(msg.Type)); scope != "" {
+                rateLimited(msg.Type, scope)
+                continue
+            }
+        }
+
+        // Чат-сообщения идут через общий путь: валидация, сохранение, рассылка
+        if msg.Type == models.MessageTypeChat {
+            // Карточки-вложения и подпись могут присылать только вебхуки
+            msg.Embeds = nil
+            msg.DisplayName = ""
+            if _, err := c.Hub.PostMessage(c.Hub.ctx, c.Store, msg); err != nil {
+                hubLogger.With("method", "readpump").Warn("Message rejected", "username", c.Username, "error", err)
+                c.Hub.SendToClient(c, errorMessage(c.RoomID, err))
+            }
+            continue
+        }
+
+        // Остальные кадры формирует только сервер, подделывать их клиентам нельзя
+        if !clientMessageType(msg.Type) {
+            hubLogger.With("method", "readpump").Warn("Rejected message type", "username", c.Username, "type", msg.Type)
+            c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: unknown message type %q", ErrInvalidMessage, msg.Type)))
+            continue
+        }
+
+        if msg.Type == models.MessageTypeCallHangup {
+            c.Hub.leaveCall(c.RoomID, c.Username)
+            continue
+        }
+        if msg.Type == models.MessageTypeMediaState {
+            c.setMediaState(msg)
+            continue
+        }
+        if msg.Type == models.MessageTypeCallStats {
+            if c.Hub.Calls != nil {
+                c.reportCallStats(msg)
+            }
+            continue
+        }
+        if msg.Type == models.MessageTypeRecordingStart || msg.Type == models.MessageTypeRecordingStop {
+            c.handleRecording(msg)
+            continue
+        }
+        // Приглашения и сигнализация пересылаются мимо PostMessage, но текст в них проверяется так же
+        if (isInvitation(msg.Type) || isSignaling(msg.Type)) && !c.checkText(&msg) {
+            continue
+        }
+        if isInvitation(msg.Type) && !c.handleInvitation(&msg) {
+            continue
+        }
+        if isSignaling(msg.Type) {
+            if !c.validateSignaling(msg) {
+                continue
+            }
+            // Поток кандидатов одному собеседнику ограничен отдельно от общих лимитов подключения
+            if scope := c.callLimit(msg); scope != "" {
+                rateLimited(msg.Type, scope)
+                continue
+            }
+            if msg.TargetUser == sfu.PeerName {
+                c.signalSFU(msg)
+                continue
+            }
+            if !c.checkSignaling(msg) {
+                continue
+            }
+        }
+
         // ЛОГИРУЕМ WEBRTC СООБЩЕНИЯ ОТДЕЛЬНО
         if msg.Type == models.MessageTypeWebRTCOffer || 
            msg.Type == models.MessageTypeWebRTCAnswer || 
@@ -213,10 +365,10 @@ func (c *Client) ReadPump() {
                 "type", msg.Type,
                 "target", msg.TargetUser)
         } else {
-            hubLogger.With("method", "readpump").Info("Recieved gRPC message from", 
+            hubLogger.With("method", "readpump").Info("Received call invitation message from",
                 "username", c.Username,
                 "type", msg.Type,
-                "content", msg.Content)
+                "target", msg.TargetUser)
         }
 
         // Отправляем в Hub для рассылки
@@ -294,6 +446,10 @@ func (h *Hub) SendToUser(message models.Message) {
     targetClient := h.FindClient(message.RoomID, message.TargetUser)
     if targetClient == nil {
         hubLogger.With("method", "sendtouser").Error("The client was not found in the room", "target", message.TargetUser, "room", message.RoomID)
+        // О звонке можно сообщить и тому, кто не подключен (например, через Web Push)
+        if message.Type == models.MessageTypeCallInvite {
+            h.emit(models.Event{Type: models.EventCallOffer, RoomID: message.RoomID, Username: message.Username, Target: message.TargetUser, Timestamp: time.Now()})
+        }
         return
     }
     
@@ -302,8 +458,7 @@ func (h *Hub) SendToUser(message models.Message) {
         hubLogger.With("method", "sendtouser").Info("Send WebRTC message to the cient", "type", message.Type, "target", message.TargetUser)
     default:
         hubLogger.With("method", "sendtouser").Error("The client queue is full, disconnect client", "target", message.TargetUser)
-        close(targetClient.Send)
-        delete(h.Clients[message.RoomID], targetClient)
+        h.dropClient(targetClient)
     }
 }
 
@@ -317,9 +472,13 @@ func (h *Hub) GetRoomUsers(roomID string) []string {
     return users
 }
 
-// Отправляет список пользователей всем в комнате
+// Отправляет список пользователей и их MediaState всем в комнате. Вызывается только из Run
 func (h *Hub) BroadcastUsersList(roomID string) {
     users := h.GetRoomUsers(roomID)
+    states := make([]models.UserState, 0, len(users))
+    for client := range h.Clients[roomID] {
+        states = append(states, models.UserState{Username: client.Username, MediaState: client.Media})
+    }
     
     // Преобразуем список пользователей в JSON строку
     usersJSON, err := json.Marshal(users)
@@ -332,6 +491,7 @@ func (h *Hub) BroadcastUsersList(roomID string) {
     usersMessage := models.Message{
         Type:      models.MessageTypeUsersList,
         Content:   string(usersJSON), // JSON строка со списком пользователей
+        Users:     states,
         RoomID:    roomID,
         Timestamp: time.Now(),
         Username:  "system",
@@ -360,6 +520,13 @@ func (h *Hub) SendMessageAsync(message models.Message) {
     }()
 }
 
+// emit передает событие всем подписчикам
+func (h *Hub) emit(event models.Event) {
+    for _, listener := range h.Listeners {
+        listener.HandleEvent(event)
+    }
+}
+
 func (h *Hub) Stop() {
     hubLogger.With("method", "stop").Info("Shutting down via context")
     h.cancel()
@@ -367,6 +534,12 @@ func (h *Hub) Stop() {
 
 func (h *Hub) shutdown() {
     hubLogger.With("method", "shutdown").Info("Completing the connections")
+    if h.Calls != nil {
+        h.Calls.Stop()
+    }
+    if h.SFU != nil {
+        h.SFU.Stop()
+    }
     for _, clients := range h.Clients {
         for client := range clients {
             close(client.Send)
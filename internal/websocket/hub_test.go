@@ -0,0 +1,92 @@
+package websocket
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+    "Thoth/internal/models"
+)
+
+// dialTestHub запускает Hub и сервер, который подключает каждого клиента к комнате general
+func dialTestHub(t *testing.T) *websocket.Conn {
+    t.Helper()
+    hub := NewHub()
+    go hub.Run()
+    t.Cleanup(hub.Stop)
+
+    upgrader := websocket.Upgrader{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        client := &Client{Hub: hub, Conn: conn, Send: make(chan models.Message, 16), Username: "alice", RoomID: "general"}
+        hub.Register <- client
+        go client.WritePump()
+        go client.ReadPump()
+    }))
+    t.Cleanup(srv.Close)
+
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+    if err != nil {
+        t.Fatalf("Ошибка подключения: %v", err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    return conn
+}
+
+// readUntil читает кадры, пропуская остальные, пока не придет кадр типа msgType
+func readUntil(t *testing.T, conn *websocket.Conn, msgType string) models.Message {
+    t.Helper()
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    for {
+        var msg models.Message
+        if err := conn.ReadJSON(&msg); err != nil {
+            t.Fatalf("Ожидался кадр %s, соединение: %v", msgType, err)
+        }
+        if msg.Type == msgType {
+            return msg
+        }
+    }
+}
+
+func TestReadPumpKeepsConnectionOnBrokenFrames(t *testing.T) {
+    conn := dialTestHub(t)
+
+    frames := map[string]string{
+        "обрезанный кадр": `{"type":`,
+        "пустой кадр":     ``,
+        "неверный тип":    `{"type":"chat","content":42}`,
+    }
+    for name, frame := range frames {
+        if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+            t.Fatalf("%s: ошибка отправки: %v", name, err)
+        }
+        if msg := readUntil(t, conn, models.MessageTypeError); !strings.Contains(msg.Content, "invalid message") {
+            t.Errorf("%s: неожиданный текст ошибки %q", name, msg.Content)
+        }
+    }
+
+    // После ошибок соединение живо: сообщение доходит до комнаты
+    if err := conn.WriteJSON(models.Message{Type: models.MessageTypeChat, Content: "все еще здесь"}); err != nil {
+        t.Fatalf("Ошибка отправки: %v", err)
+    }
+    if msg := readUntil(t, conn, models.MessageTypeChat); msg.Content != "все еще здесь" {
+        t.Errorf("Получено сообщение %q", msg.Content)
+    }
+}
+
+func TestReadPumpRejectsServerMessageTypes(t *testing.T) {
+    conn := dialTestHub(t)
+
+    if err := conn.WriteJSON(models.Message{Type: models.MessageTypeRateLimited, Content: "поддельный"}); err != nil {
+        t.Fatalf("Ошибка отправки: %v", err)
+    }
+    if msg := readUntil(t, conn, models.MessageTypeError); !strings.Contains(msg.Content, "unknown message type") {
+        t.Errorf("Неожиданный текст ошибки %q", msg.Content)
+    }
+}
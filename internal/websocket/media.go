@@ -0,0 +1,41 @@
+package websocket
+
+import (
+    "errors"
+    "fmt"
+
+    "Thoth/internal/models"
+)
+
+var ErrNoMediaState = errors.New("media is required")
+
+// setMediaState передает в Run новое состояние микрофона, камеры и показа экрана клиента
+func (c *Client) setMediaState(msg models.Message) {
+    if msg.Media == nil {
+        c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, ErrNoMediaState)))
+        return
+    }
+    // Комнате уходит только состояние, остальные поля кадра клиента не пересылаются
+    state := models.Message{
+        Type:      models.MessageTypeMediaState,
+        Username:  c.Username,
+        RoomID:    c.RoomID,
+        Timestamp: msg.Timestamp,
+        Media:     msg.Media,
+    }
+    select {
+    case c.Hub.state <- clientMessage{client: c, message: state}:
+    default:
+        hubLogger.With("method", "setmediastate").Error("State queue is full, media state lost", "username", c.Username)
+    }
+}
+
+// applyMediaState запоминает состояние клиента и сообщает его комнате. Вызывается только из Run,
+// поэтому состояние в users_list и порядок кадров media_state одного клиента согласованы
+func (h *Hub) applyMediaState(client *Client, msg models.Message) {
+    if !h.Clients[client.RoomID][client] {
+        return // Клиент уже отключился
+    }
+    client.Media = *msg.Media
+    h.broadcastToRoom(msg)
+}
@@ -0,0 +1,268 @@
+package websocket
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "Thoth/internal/markdown"
+    "Thoth/internal/models"
+    "Thoth/internal/moderation"
+    "Thoth/internal/ratelimit"
+    "Thoth/internal/storage"
+)
+
+// ErrInvalidMessage оборачивает ошибки валидации - такие сообщения не сохраняются и не рассылаются
+var ErrInvalidMessage = errors.New("invalid message")
+
+// clientMessage адресует сообщение конкретному подключению, а не пользователю по имени
+type clientMessage struct {
+    client  *Client
+    message models.Message
+}
+
+// PostMessage - единый путь для чат-сообщений из любого источника (WebSocket, вебхуки):
+// валидация, фильтры Filters, сохранение в БД (если store не nil) и рассылка через Broadcast.
+// Упомянутые участники комнаты получают уведомление mention, где бы они ни были подключены.
+// Возвращает сообщение с присвоенными ID и временем
+func (h *Hub) PostMessage(ctx context.Context, store *storage.Storage, msg models.Message) (models.Message, error) {
+    msg.Type = models.MessageTypeChat
+    if msg.RoomID == "" {
+        msg.RoomID = "general"
+    }
+    if msg.Timestamp.IsZero() {
+        msg.Timestamp = time.Now()
+    }
+
+    if err := models.ValidateChatMessage(&msg); err != nil {
+        return msg, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+    }
+
+    verdict := moderation.Allow
+    if h.Filters != nil {
+        verdict = h.Filters.Check(ctx, moderation.Message{Username: msg.Username, RoomID: msg.RoomID, Content: msg.Content})
+        switch verdict.Action {
+        case moderation.ActionReject:
+            return msg, fmt.Errorf("%w: %s", ErrInvalidMessage, verdict.Reason)
+        case moderation.ActionRedact:
+            msg.Content = verdict.Content
+        }
+    }
+
+    // HTML всегда строит сервер, присланный клиентом игнорируется
+    msg.HTML = ""
+    if msg.Format == models.FormatMarkdown {
+        msg.HTML = markdown.Render(msg.Content)
+    }
+
+    // Автор под shadow_mute видит сообщение как обычно, остальные его не получают
+    if verdict.Action == moderation.ActionShadowMute {
+        muted := msg
+        muted.TargetUser = msg.Username
+        h.Notify(muted)
+        return msg, nil
+    }
+
+    if store == nil && len(msg.Attachments) > 0 {
+        return msg, fmt.Errorf("%w: file attachments are not available", ErrInvalidMessage)
+    }
+
+    var mentioned []storage.Mention
+    if store != nil {
+        refs := make([]storage.Attachment, len(msg.Attachments))
+        for i, a := range msg.Attachments {
+            refs[i] = storage.Attachment{ID: a.ID}
+        }
+
+        users, room := markdown.ExtractMentions(msg.Content, models.MaxMentions)
+        saved, err := store.InsertMessage(ctx, storage.Message{
+            Username:    msg.Username,
+            Content:     msg.Content,
+            Format:      msg.Format,
+            HTML:        msg.HTML,
+            RoomID:      msg.RoomID,
+            Embeds:      msg.Embeds,
+            Attachments: refs,
+            Mentions:    users,
+            MentionRoom: room,
+        })
+        if errors.Is(err, storage.ErrAttachmentUnavailable) {
+            return msg, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+        }
+        if err != nil {
+            hubLogger.With("method", "postmessage").Error("Error saving message to database", "error", err, "room", msg.RoomID)
+            return msg, fmt.Errorf("save message: %w", err)
+        }
+        msg.ID = saved.ID
+        msg.Timestamp = saved.CreatedAt
+        msg.Attachments = toModelAttachments(saved.Attachments)
+        mentioned = saved.Mentioned
+    }
+
+    select {
+    case h.Broadcast <- msg:
+        // Сообщение отправлено в Hub
+    default:
+        hubLogger.With("method", "postmessage").Error("Broadcast is full! Message lost", "username", msg.Username, "room", msg.RoomID)
+    }
+
+    posted := msg
+    h.emit(models.Event{Type: models.EventMessage, RoomID: msg.RoomID, Username: msg.Username, Message: &posted, Timestamp: msg.Timestamp})
+
+    for _, m := range mentioned {
+        h.Notify(models.Message{
+            Type:       models.MessageTypeMention,
+            ID:         msg.ID,
+            Username:   msg.Username,
+            Content:    msg.Content,
+            RoomID:     msg.RoomID,
+            TargetUser: m.Username,
+            Timestamp:  msg.Timestamp,
+        })
+        h.emit(models.Event{Type: models.EventMention, RoomID: msg.RoomID, Username: msg.Username, Target: m.Username, Message: &posted, Timestamp: msg.Timestamp})
+    }
+
+    return msg, nil
+}
+
+// checkText проверяет текст кадра, который пересылается адресату без PostMessage
+// (приглашения, сигнализация): та же длина, что у чат-сообщений, и те же фильтры Filters.
+// false - кадр пересылать не нужно
+func (c *Client) checkText(msg *models.Message) bool {
+    if msg.Content == "" {
+        return true
+    }
+    var err error
+    if len(msg.Content) > models.MaxContentLength {
+        err = fmt.Errorf("%w: %w", ErrInvalidMessage, models.ErrContentTooLong)
+    } else if c.Hub.Filters != nil {
+        verdict := c.Hub.Filters.Check(c.Hub.ctx, moderation.Message{Username: c.Username, RoomID: c.RoomID, Content: msg.Content})
+        switch verdict.Action {
+        case moderation.ActionReject:
+            err = fmt.Errorf("%w: %s", ErrInvalidMessage, verdict.Reason)
+        case moderation.ActionRedact:
+            msg.Content = verdict.Content
+        case moderation.ActionShadowMute:
+            // Адресат кадр не получает, автору об этом не сообщается
+            return false
+        }
+    }
+    if err != nil {
+        hubLogger.With("method", "checktext").Warn("Message rejected", "username", c.Username, "type", msg.Type, "error", err)
+        c.Hub.SendToClient(c, errorMessage(c.RoomID, err))
+        return false
+    }
+    return true
+}
+
+// SendToClient отправляет сообщение одному подключению через цикл Run,
+// поэтому безопасен для вызова из ReadPump
+func (h *Hub) SendToClient(client *Client, message models.Message) {
+    select {
+    case h.direct <- clientMessage{client: client, message: message}:
+    default:
+        hubLogger.With("method", "sendtoclient").Error("Direct queue is full, message dropped", "username", client.Username)
+    }
+}
+
+// Notify доставляет уведомление пользователю message.TargetUser во все комнаты,
+// где он сейчас подключен, а не только в комнату message.RoomID
+func (h *Hub) Notify(message models.Message) {
+    select {
+    case h.notify <- message:
+    default:
+        hubLogger.With("method", "notify").Error("Notify queue is full, notification dropped", "target", message.TargetUser)
+    }
+}
+
+// deliverToUser вызывается только из Run. Чат-сообщения доставляются только
+// в комнату message.RoomID
+func (h *Hub) deliverToUser(message models.Message) {
+    for roomID, clients := range h.Clients {
+        if message.Type == models.MessageTypeChat && roomID != message.RoomID {
+            continue
+        }
+        for client := range clients {
+            if client.Username == message.TargetUser {
+                h.deliverToClient(client, message)
+            }
+        }
+    }
+}
+
+// deliverToClient вызывается только из Run
+func (h *Hub) deliverToClient(client *Client, message models.Message) {
+    if _, ok := h.Clients[client.RoomID][client]; !ok {
+        return
+    }
+    select {
+    case client.Send <- message:
+    default:
+        hubLogger.With("method", "delivertoclient").Error("The client queue is full, disconnect client", "username", client.Username)
+        h.dropClient(client)
+    }
+}
+
+// errorMessage строит кадр ошибки для клиента. Внутренние ошибки наружу не раскрываются
+func errorMessage(roomID string, err error) models.Message {
+    text := "failed to deliver message"
+    if errors.Is(err, ErrInvalidMessage) {
+        text = err.Error()
+    }
+    return models.Message{
+        Type:      models.MessageTypeError,
+        Content:   text,
+        RoomID:    roomID,
+        Timestamp: time.Now(),
+        Username:  "system",
+    }
+}
+
+// rateLimitedMessage сообщает клиенту, что сообщение типа msgType отброшено из-за лимита
+func rateLimitedMessage(roomID, msgType string) models.Message {
+    return models.Message{
+        Type:      models.MessageTypeRateLimited,
+        Content:   "rate limit exceeded for " + msgType + " messages, slow down",
+        RoomID:    roomID,
+        Timestamp: time.Now(),
+        Username:  "system",
+    }
+}
+
+// clientMessageType - типы кадров, которые может присылать клиент. Остальные
+// (ошибки, входы и выходы, списки пользователей, события звонков) формирует только сервер
+func clientMessageType(msgType string) bool {
+    switch msgType {
+    case models.MessageTypeChat, models.MessageTypeCallHangup, models.MessageTypeMediaState, models.MessageTypeCallStats,
+        models.MessageTypeRecordingStart, models.MessageTypeRecordingStop:
+        return true
+    }
+    return isInvitation(msgType) || isSignaling(msgType)
+}
+
+// rateClass относит тип сообщения к классу лимитов
+func rateClass(msgType string) string {
+    switch msgType {
+    case models.MessageTypeChat:
+        return ratelimit.ClassChat
+    case models.MessageTypeWebRTCOffer, models.MessageTypeWebRTCAnswer,
+        models.MessageTypeCallInvite, models.MessageTypeCallAccept, models.MessageTypeCallDecline, models.MessageTypeCallCancel,
+        models.MessageTypeRecordingStart, models.MessageTypeRecordingStop, models.MessageTypeMediaState:
+        return ratelimit.ClassSignaling
+    case models.MessageTypeWebRTCCandidate:
+        return ratelimit.ClassCandidate
+    }
+    return ratelimit.ClassOther
+}
+
+func toModelAttachments(attachments []storage.Attachment) []models.Attachment {
+    if len(attachments) == 0 {
+        return nil
+    }
+    result := make([]models.Attachment, len(attachments))
+    for i, a := range attachments {
+        result[i] = a.Model()
+    }
+    return result
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import "sync"
+
+// presence считает подключения каждого пользователя. Clients доступен только из Run,
+// а проверять присутствие нужно из других горутин - например, перед отправкой уведомлений
+type presence struct {
+    mu     sync.RWMutex
+    online map[string]int
+    rooms  map[roomUser]int
+}
+
+type roomUser struct {
+    roomID   string
+    username string
+}
+
+func (p *presence) add(roomID, username string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.online == nil {
+        p.online = make(map[string]int)
+        p.rooms = make(map[roomUser]int)
+    }
+    p.online[username]++
+    p.rooms[roomUser{roomID, username}]++
+}
+
+func (p *presence) remove(roomID, username string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.online[username] <= 1 {
+        delete(p.online, username)
+    } else {
+        p.online[username]--
+    }
+    key := roomUser{roomID, username}
+    if p.rooms[key] <= 1 {
+        delete(p.rooms, key)
+    } else {
+        p.rooms[key]--
+    }
+}
+
+// IsOnline сообщает, подключен ли пользователь хотя бы к одной комнате
+func (h *Hub) IsOnline(username string) bool {
+    h.presence.mu.RLock()
+    defer h.presence.mu.RUnlock()
+    return h.presence.online[username] > 0
+}
+
+// InRoom сообщает, подключен ли пользователь к комнате
+func (h *Hub) InRoom(roomID, username string) bool {
+    h.presence.mu.RLock()
+    defer h.presence.mu.RUnlock()
+    return h.presence.rooms[roomUser{roomID, username}] > 0
+}
+
+// dropClient отключает клиента: убирает из комнаты и закрывает очередь отправки.
+// Вызывается только из Run
+func (h *Hub) dropClient(client *Client) {
+    delete(h.Clients[client.RoomID], client)
+    close(client.Send)
+    h.presence.remove(client.RoomID, client.Username)
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "Thoth/internal/models"
+    "Thoth/internal/storage"
+)
+
+var (
+    ErrRecordingDisabled = errors.New("call recording is disabled")
+    ErrNotRoomOwner      = errors.New("only room owners can control recording")
+)
+
+// handleRecording включает и выключает запись звонка комнаты по кадрам recording_start
+// и recording_stop. Управлять записью могут только владельцы комнаты: роль берется
+// из подключения, а не из таблицы участников, где ее может занять любой под тем же именем
+func (c *Client) handleRecording(msg models.Message) {
+    if err := c.controlRecording(msg.Type); err != nil {
+        hubLogger.With("method", "handlerecording").Warn("Recording request rejected",
+            "username", c.Username, "room", c.RoomID, "type", msg.Type, "error", err)
+        c.Hub.SendToClient(c, errorMessage(c.RoomID, fmt.Errorf("%w: %w", ErrInvalidMessage, err)))
+    }
+}
+
+func (c *Client) controlRecording(msgType string) error {
+    h := c.Hub
+    if h.Recorder == nil || h.SFU == nil || h.Calls == nil || c.Store == nil {
+        return ErrRecordingDisabled
+    }
+    if c.Role != storage.RoleOwner {
+        return ErrNotRoomOwner
+    }
+
+    if msgType == models.MessageTypeRecordingStop {
+        return h.stopRecording(c.RoomID)
+    }
+
+    // Пишет SFU, поэтому попарный звонок сначала переводится на сервер
+    call, err := h.Calls.UseSFU(c.RoomID)
+    if err != nil {
+        return err
+    }
+    rec, err := h.Recorder.Start(c.RoomID, call.ID, c.Username)
+    if err != nil {
+        return err
+    }
+    h.joinSFU(c.RoomID)
+    if err := h.SFU.Record(c.RoomID, h.Recorder.Sink(c.RoomID)); err != nil {
+        h.Recorder.Finish(c.RoomID)
+        return err
+    }
+    h.SendMessageAsync(recordingMessage(models.MessageTypeRecordingStarted, rec))
+    return nil
+}
+
+// stopRecording останавливает запись комнаты и сообщает об этом участникам.
+// Файлы сохраняются в фоне и появляются в списке записей комнаты
+func (h *Hub) stopRecording(roomID string) error {
+    if h.Recorder == nil {
+        return ErrRecordingDisabled
+    }
+    if h.SFU != nil {
+        h.SFU.StopRecording(roomID)
+    }
+    rec, err := h.Recorder.Finish(roomID)
+    if err != nil {
+        return err
+    }
+    h.SendMessageAsync(recordingMessage(models.MessageTypeRecordingStopped, rec))
+    return nil
+}
+
+// redeliverRecording сообщает подключившемуся клиенту, что звонок комнаты записывается.
+// Вызывается только из Run
+func (h *Hub) redeliverRecording(client *Client) {
+    if h.Recorder == nil {
+        return
+    }
+    if rec, ok := h.Recorder.Active(client.RoomID); ok {
+        h.deliverToClient(client, recordingMessage(models.MessageTypeRecordingStarted, rec))
+    }
+}
+
+func recordingMessage(msgType string, rec models.Recording) models.Message {
+    return models.Message{
+        Type:      msgType,
+        Username:  "system",
+        RoomID:    rec.RoomID,
+        Recording: &rec,
+        Timestamp: time.Now(),
+    }
+}
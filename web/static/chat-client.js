@@ -6,43 +6,59 @@ class ThothChatClient {
         this.isConnected = false;
         this.localStream = null;
         this.peerConnections = new Map(); // username -> RTCPeerConnection
+        this.pendingInvites = new Set(); // кого мы пригласили в звонок и ждем ответа
+        this.incomingInvites = new Map(); // username -> элемент с кнопками ответа на приглашение
+        this.callMode = 'mesh'; // 'sfu' - одно соединение с сервером (пользователь 'sfu') вместо попарных
+        this.recording = null; // идущая запись звонка комнаты
         this.onlineUsers = new Set();
         this.broadcastingUsers = new Set(); // пользователи с включенным видео
+        this.mediaState = { audio: false, video: false, screen: false, hand: false }; // что мы передаем в звонок
+        this.userStates = new Map(); // username -> состояние из media_state и users_list
+        this.statsBaseline = new Map(); // username -> счетчики getStats прошлого отчета о качестве
+        this.statsTimer = null;
+        this.sessionToken = ''; // токен участника комнаты для загрузки и скачивания файлов
+        this.pendingAttachments = []; // загруженные, но еще не отправленные файлы
+        // Ссылка на встречу: комнату, а для персональной ссылки и имя, задает сервер
+        this.meetingToken = new URLSearchParams(location.search).get('meeting') || '';
         
-        // Замените в chat-client.js конфигурацию ICE серверов
-        this.rtcConfig = {
-            iceServers: [
-                // Google STUN серверы
-                { urls: 'stun:stun.l.google.com:19302' },
-                { urls: 'stun:stun1.l.google.com:19302' },
-                { urls: 'stun:stun2.l.google.com:19302' },
-                
-                // Cloudflare STUN
-                { urls: 'stun:stun.cloudflare.com:3478' },
-                
-                // Публичные TURN серверы
-                {
-                    urls: 'turn:openrelay.metered.ca:80',
-                    username: 'openrelayproject',
-                    credential: 'openrelayproject'
-                },
-                {
-                    urls: 'turn:openrelay.metered.ca:443',
-                    username: 'openrelayproject',
-                    credential: 'openrelayproject'
-                },
-                {
-                    urls: 'turn:openrelay.metered.ca:80?transport=tcp',
-                    username: 'openrelayproject',
-                    credential: 'openrelayproject'
-                }
-            ]
-        };
+        // ICE серверы с временными учетными данными TURN выдает сервер (loadIceServers)
+        this.rtcConfig = { iceServers: [] };
         
         this.initElements();
         this.bindEvents();
+        this.importKeys();
     }
     
+    // Ключ localStorage для токена участника комнаты под текущим именем
+    memberTokenKey() {
+        return `thoth-member:${this.room}:${this.username}`;
+    }
+
+    // Ключ localStorage для ключа владельца комнаты под текущим именем
+    ownerKeyKey() {
+        return `thoth-owner:${this.room}:${this.username}`;
+    }
+
+    // Ключ localStorage для ключа пользователя: он подтверждает имя во всех комнатах
+    userKeyKey() {
+        return `thoth-user:${this.username}`;
+    }
+
+    // Ссылка из keysLink (#user_key=...&owner_key=...&room=...&username=...) переносит ключи в этот браузер
+    importKeys() {
+        const params = new URLSearchParams(location.hash.slice(1));
+        if (!params.get('user_key') && !params.get('owner_key')) return;
+        if (params.get('user_key')) {
+            localStorage.setItem(`thoth-user:${params.get('username')}`, params.get('user_key'));
+        }
+        if (params.get('owner_key')) {
+            localStorage.setItem(`thoth-owner:${params.get('room')}:${params.get('username')}`, params.get('owner_key'));
+        }
+        this.roomInput.value = params.get('room');
+        this.usernameInput.value = params.get('username');
+        history.replaceState(null, '', location.pathname + location.search);
+    }
+
     initElements() {
         this.messagesContainer = document.getElementById('messages');
         this.messageInput = document.getElementById('messageInput');
@@ -57,8 +73,17 @@ class ThothChatClient {
         this.usersCount = document.getElementById('users-count');
         this.videoToggle = document.getElementById('videoToggle');
         this.audioToggle = document.getElementById('audioToggle');
+        this.handToggle = document.getElementById('handToggle');
         this.videoArea = document.getElementById('videoArea');
         this.localVideo = document.getElementById('localVideo');
+        this.attachBtn = document.getElementById('attachBtn');
+        this.emailNotifyBtn = document.getElementById('emailNotifyBtn');
+        this.pushNotifyBtn = document.getElementById('pushNotifyBtn');
+        this.recordBtn = document.getElementById('recordBtn');
+        this.recordingsBtn = document.getElementById('recordingsBtn');
+        this.meetingsBtn = document.getElementById('meetingsBtn');
+        this.fileInput = document.getElementById('fileInput');
+        this.pendingContainer = document.getElementById('pendingAttachments');
     }
     
     bindEvents() {
@@ -69,9 +94,24 @@ class ThothChatClient {
         });
         this.videoToggle.addEventListener('click', () => this.toggleVideo());
         this.audioToggle.addEventListener('click', () => this.toggleAudio());
+        this.handToggle.addEventListener('click', () => this.toggleHand());
+        this.attachBtn.addEventListener('click', () => this.fileInput.click());
+        this.emailNotifyBtn.addEventListener('click', () => this.configureEmailNotifications());
+        this.pushNotifyBtn.addEventListener('click', () => this.enablePushNotifications());
+        this.recordBtn.addEventListener('click', () => this.toggleRecording());
+        this.recordingsBtn.addEventListener('click', () => this.showRecordings());
+        this.meetingsBtn.addEventListener('click', () => this.showMeetings());
+        if (this.meetingToken) {
+            this.roomInput.disabled = true;
+            this.roomInput.placeholder = 'Комната встречи из ссылки';
+        }
+        this.fileInput.addEventListener('change', () => {
+            Array.from(this.fileInput.files).forEach(file => this.uploadFile(file));
+            this.fileInput.value = '';
+        });
     }
     
-    connect() {
+    async connect() {
         this.connectBtn.classList.add('connecting');
         this.connectBtn.textContent = 'Подключаемся...';
         this.connectBtn.disabled = true;
@@ -88,11 +128,45 @@ class ThothChatClient {
         this.username = this.usernameInput.value.trim() || 'Аноним';
         this.room = this.roomInput.value.trim() || 'general';
         
+        // Токен подключения: без него сервер не примет WebSocket
+        let csrf;
+        try {
+            const response = await fetch('/api/ws-token', { method: 'POST' });
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            csrf = (await response.json()).token;
+        } catch (error) {
+            console.error('❌ Не удалось получить токен подключения:', error);
+            this.addSystemMessage('Не удалось подключиться к серверу');
+            this.resetConnectButton();
+            return;
+        }
+
         // Используем текущий хост
         const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${location.host}/ws?username=${encodeURIComponent(this.username)}&room=${encodeURIComponent(this.room)}`;
+        let wsUrl = `${protocol}//${location.host}/ws?username=${encodeURIComponent(this.username)}&room=${encodeURIComponent(this.room)}&csrf=${encodeURIComponent(csrf)}`;
+        if (this.meetingToken) {
+            wsUrl += `&meeting=${encodeURIComponent(this.meetingToken)}`;
+        }
+        // Прошлый токен участника подтверждает роль в комнате (владельцу - управление записью)
+        const memberToken = localStorage.getItem(this.memberTokenKey());
+        if (memberToken) {
+            wsUrl += `&token=${encodeURIComponent(memberToken)}`;
+        }
+        // Ключ владельца живет дольше токена участника и возвращает роль владельца
+        const ownerKey = localStorage.getItem(this.ownerKeyKey());
+        if (ownerKey) {
+            wsUrl += `&owner_key=${encodeURIComponent(ownerKey)}`;
+        }
 
-        console.log('🔗 Подключаемся к:', wsUrl);
+        // Ключ пользователя подтверждает имя: без него имя может набрать кто угодно
+        const userKey = localStorage.getItem(this.userKeyKey());
+        if (userKey) {
+            wsUrl += `&user_key=${encodeURIComponent(userKey)}`;
+        }
+
+        console.log('🔗 Подключаемся к:', wsUrl.replace(/&(token|owner_key|user_key)=[^&]*/g, '&$1=…'));
         
         try {
             this.ws = new WebSocket(wsUrl);
@@ -141,6 +215,10 @@ class ThothChatClient {
         this.addSystemMessage(`Подключились к комнате "${this.room}"`);
         this.addUser(this.username);
         this.resetConnectButton();
+        
+        // Раз в 10 секунд сообщаем серверу качество соединений звонка
+        clearInterval(this.statsTimer);
+        this.statsTimer = setInterval(() => this.reportCallStats(), 10000);
     }
     
     onDisconnected() {
@@ -148,10 +226,25 @@ class ThothChatClient {
         this.ws = null;
         this.messageInput.disabled = true;
         this.sendBtn.disabled = true;
+        this.attachBtn.disabled = true;
+        this.emailNotifyBtn.disabled = true;
+        this.pushNotifyBtn.disabled = true;
+        this.recordBtn.disabled = true;
+        this.recordingsBtn.disabled = true;
+        this.meetingsBtn.disabled = true;
+        this.handToggle.disabled = true;
+        this.sessionToken = '';
+        this.setRecording(null);
+        clearInterval(this.statsTimer);
+        this.statsTimer = null;
+        // После переподключения сервер знает нас с пустым состоянием - рука опущена
+        this.mediaState.hand = false;
+        this.handToggle.classList.remove('active');
         
         this.addSystemMessage('Соединение потеряно');
         this.onlineUsers.clear();
         this.broadcastingUsers.clear();
+        this.userStates.clear();
         this.updateUsersList();
         this.resetConnectButton();
         
@@ -161,6 +254,7 @@ class ThothChatClient {
             pc.close();
         });
         this.peerConnections.clear();
+        this.statsBaseline.clear();
     }
     
     handleMessage(data) {
@@ -168,6 +262,50 @@ class ThothChatClient {
         
         if (data.type === 'chat') {
             this.displayMessage(data);
+        } else if (data.type === 'message_update') {
+            this.updateMessage(data);
+        } else if (data.type === 'mention') {
+            this.handleMention(data);
+        } else if (data.type === 'session') {
+            this.sessionToken = data.token;
+            if (this.meetingToken && (data.room_id !== this.room || data.username !== this.username)) {
+                // По ссылке на встречу сервер сам выбрал комнату и, возможно, имя
+                this.onlineUsers.delete(this.username);
+                this.room = data.room_id;
+                this.username = data.username;
+                this.roomDisplay.textContent = this.room;
+                this.usernameDisplay.textContent = this.username;
+                this.addUser(this.username);
+                this.addSystemMessage(`📅 Вы подключились к встрече в комнате "${this.room}" как ${this.username}`);
+            }
+            this.loadIceServers();
+            this.attachBtn.disabled = false;
+            this.emailNotifyBtn.disabled = false;
+            this.pushNotifyBtn.disabled = !('serviceWorker' in navigator && 'PushManager' in window);
+            this.recordBtn.disabled = false;
+            this.recordingsBtn.disabled = false;
+            this.meetingsBtn.disabled = false;
+            this.handToggle.disabled = false;
+            if (this.localStream) this.sendMediaState(); // переподключились во время звонка
+            localStorage.setItem(this.memberTokenKey(), data.token);
+            // Новые ключи сохраняем и показываем ссылку, чтобы перенести их в другой браузер
+            const isNew = (data.user_key && !localStorage.getItem(this.userKeyKey())) ||
+                (data.owner_key && !localStorage.getItem(this.ownerKeyKey()));
+            if (data.user_key) localStorage.setItem(this.userKeyKey(), data.user_key);
+            if (data.owner_key) localStorage.setItem(this.ownerKeyKey(), data.owner_key);
+            if (isNew) {
+                const keys = { room: this.room, username: this.username };
+                if (data.user_key) keys.user_key = data.user_key;
+                if (data.owner_key) keys.owner_key = data.owner_key;
+                const link = `${location.origin}${location.pathname}#` + new URLSearchParams(keys);
+                this.addSystemMessage(data.owner_key
+                    ? `🔑 Вы владелец комнаты. Чтобы управлять ею из другого браузера, откройте там ссылку (никому ее не передавайте): ${link}`
+                    : `🔑 Имя ${this.username} закреплено за вами. Чтобы войти под ним из другого браузера, откройте там ссылку (никому ее не передавайте): ${link}`);
+            }
+        } else if (data.type === 'rate_limited') {
+            this.addSystemMessage('⏳ Слишком много сообщений, подождите немного');
+        } else if (data.type === 'error') {
+            this.addSystemMessage(`Ошибка: ${data.content}`);
         } else if (data.type === 'user_joined') {
             this.addUser(data.username);
             this.addSystemMessage(`${data.username} присоединился к чату`);
@@ -189,23 +327,39 @@ class ThothChatClient {
                 const users = JSON.parse(data.content);
                 this.onlineUsers.clear();
                 users.forEach(username => this.onlineUsers.add(username));
+                this.userStates = new Map((data.users || []).map(user => [user.username, user]));
                 this.updateUsersList();
-                
-                // Если у нас есть видео, звоним всем пользователям
-                if (this.localStream) {
-                    users.forEach(username => {
-                        if (username !== this.username && !this.peerConnections.has(username)) {
-                            setTimeout(() => {
-                                console.log('🎥 Автоматически звоним пользователю из списка:', username);
-                                this.startVideoCall(username);
-                            }, Math.random() * 2000 + 500);
-                        }
-                    });
-                }
-                
             } catch (error) {
                 console.error('Ошибка парсинга списка пользователей:', error);
             }
+        } else if (data.type === 'call_invite') {
+            this.handleCallInvite(data);
+        } else if (data.type === 'call_accept') {
+            this.handleCallAccept(data);
+        } else if (data.type === 'call_decline') {
+            this.handleCallDecline(data);
+        } else if (data.type === 'call_cancel') {
+            this.handleCallCancel(data);
+        } else if (data.type === 'call_mode') {
+            this.handleCallMode(data.call);
+        } else if (data.type === 'call_started') {
+            this.callMode = data.call.mode || 'mesh';
+            this.addSystemMessage(`📞 Звонок начался: ${data.call.participants.map(p => p.username).join(', ')}`);
+        } else if (data.type === 'call_ended') {
+            if (this.callMode === 'sfu') {
+                this.closePeerConnection('sfu');
+                this.removeRemoteVideos();
+            }
+            this.callMode = 'mesh';
+            this.handleCallEnded(data.call);
+        } else if (data.type === 'recording_started') {
+            this.setRecording(data.recording);
+            this.addSystemMessage(`🔴 Звонок записывается (запись включена пользователем ${data.recording.started_by})`);
+        } else if (data.type === 'recording_stopped') {
+            this.setRecording(null);
+            this.addSystemMessage('⏹ Запись звонка остановлена, файлы появятся в списке записей');
+        } else if (data.type === 'media_state') {
+            this.handleMediaState(data);
         } else if (data.type === 'webrtc_offer') {
             console.log('📞 Получен WebRTC offer от', data.username);
             this.handleWebRTCOffer(data);
@@ -218,18 +372,467 @@ class ThothChatClient {
         }
     }
     
+    async loadIceServers() {
+        try {
+            const response = await fetch('/api/ice-servers', {
+                headers: { 'X-Thoth-Token': this.sessionToken }
+            });
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            const { ice_servers: iceServers, expires_at: expiresAt } = await response.json();
+            this.rtcConfig = { iceServers };
+            console.log('🧊 Получены ICE серверы:', iceServers.length);
+            
+            // Учетные данные TURN временные - обновляем их за пять минут до истечения
+            clearTimeout(this.iceRefreshTimer);
+            const refreshIn = new Date(expiresAt) - Date.now() - 5 * 60 * 1000;
+            if (refreshIn > 0) {
+                this.iceRefreshTimer = setTimeout(() => this.loadIceServers(), refreshIn);
+            }
+        } catch (error) {
+            console.error('❌ Не удалось получить ICE серверы:', error);
+        }
+    }
+    
+    sendCallMessage(type, targetUser) {
+        if (!this.isConnected) return;
+        this.ws.send(JSON.stringify({
+            type: type,
+            target_user: targetUser,
+            timestamp: new Date().toISOString()
+        }));
+    }
+    
+    handleCallInvite(data) {
+        if (this.incomingInvites.has(data.username)) return;
+        if (data.call) this.callMode = data.call.mode || 'mesh';
+        
+        const inviteEl = document.createElement('div');
+        inviteEl.className = 'system-message call-invite';
+        inviteEl.textContent = `📞 ${data.username} звонит вам `;
+        
+        const answer = (type) => {
+            this.sendCallMessage(type, data.username);
+            this.dismissCallInvite(data.username);
+        };
+        const acceptBtn = document.createElement('button');
+        acceptBtn.textContent = 'Принять';
+        acceptBtn.addEventListener('click', () => answer('call_accept'));
+        const declineBtn = document.createElement('button');
+        declineBtn.textContent = 'Отклонить';
+        declineBtn.addEventListener('click', () => answer('call_decline'));
+        inviteEl.append(acceptBtn, declineBtn);
+        
+        this.incomingInvites.set(data.username, inviteEl);
+        this.messagesContainer.appendChild(inviteEl);
+        this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
+    }
+    
+    dismissCallInvite(username) {
+        const inviteEl = this.incomingInvites.get(username);
+        if (inviteEl) {
+            inviteEl.querySelectorAll('button').forEach(btn => btn.remove());
+            this.incomingInvites.delete(username);
+        }
+    }
+    
+    handleCallAccept(data) {
+        if (!this.pendingInvites.delete(data.username)) return;
+        this.addSystemMessage(`📞 ${data.username} принял звонок`);
+        // Через SFU offer присылает сервер
+        if (this.callMode !== 'sfu') {
+            this.sendOffer(data.username);
+        }
+    }
+    
+    handleCallMode(call) {
+        this.callMode = call.mode;
+        if (call.mode !== 'sfu') return;
+        
+        // Сервер пришлет свой offer, попарные соединения больше не нужны
+        Array.from(this.peerConnections.keys())
+            .filter(username => username !== 'sfu')
+            .forEach(username => this.closePeerConnection(username));
+        this.addSystemMessage('📞 Звонок переведен на сервер');
+    }
+    
+    removeRemoteVideos() {
+        this.videoArea.querySelectorAll('[id^="video-"]:not([id="localVideo"])').forEach(video => video.remove());
+    }
+    
+    handleCallDecline(data) {
+        this.pendingInvites.delete(data.username);
+        const reasons = {
+            busy: 'занят',
+            timeout: 'не отвечает',
+            declined: 'отклонил звонок',
+        };
+        this.addSystemMessage(`📞 ${data.username} ${reasons[data.content] || reasons.declined}`);
+    }
+    
+    handleCallCancel(data) {
+        if (!this.incomingInvites.has(data.username)) return;
+        this.dismissCallInvite(data.username);
+        this.addSystemMessage(data.content === 'timeout'
+            ? `📞 Пропущенный звонок от ${data.username}`
+            : `📞 ${data.username} отменил звонок`);
+    }
+    
+    handleCallEnded(call) {
+        const reasons = {
+            completed: 'Звонок завершен',
+            missed: 'Пропущенный звонок',
+            cancelled: 'Звонок отменен',
+            declined: 'Звонок отклонен',
+        };
+        let text = `📞 ${reasons[call.end_reason] || 'Звонок завершен'} (${call.initiator})`;
+        if (call.duration_seconds > 0) {
+            const minutes = Math.floor(call.duration_seconds / 60);
+            const seconds = String(call.duration_seconds % 60).padStart(2, '0');
+            text += `, ${minutes}:${seconds}`;
+        }
+        this.addSystemMessage(text);
+    }
+    
     sendMessage() {
-        if (!this.isConnected || !this.messageInput.value.trim()) return;
+        if (!this.isConnected) return;
+        if (!this.messageInput.value.trim() && this.pendingAttachments.length === 0) return;
         
         const message = {
             type: 'chat',
             content: this.messageInput.value.trim(),
+            format: 'markdown',
             timestamp: new Date().toISOString()
         };
+        if (this.pendingAttachments.length) {
+            message.attachments = this.pendingAttachments.map(a => ({ id: a.id }));
+        }
         
         console.log('📤 Отправляем сообщение:', message);
         this.ws.send(JSON.stringify(message));
         this.messageInput.value = '';
+        this.pendingAttachments = [];
+        this.renderPendingAttachments();
+    }
+    
+    // Запись звонков: включают и выключают владельцы комнаты, сервер проверяет права сам
+    
+    toggleRecording() {
+        if (!this.isConnected) return;
+        this.ws.send(JSON.stringify({
+            type: this.recording ? 'recording_stop' : 'recording_start',
+            timestamp: new Date().toISOString()
+        }));
+    }
+    
+    setRecording(recording) {
+        this.recording = recording;
+        this.recordBtn.textContent = recording ? '⏹ Остановить запись' : '⏺ Запись';
+        this.recordBtn.classList.toggle('active', !!recording);
+    }
+    
+    async showRecordings() {
+        let recordings;
+        try {
+            const response = await fetch(`/api/rooms/${encodeURIComponent(this.room)}/recordings`, {
+                headers: { 'X-Thoth-Token': this.sessionToken }
+            });
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            recordings = (await response.json()).recordings;
+        } catch (error) {
+            console.error('❌ Не удалось получить записи:', error);
+            this.addSystemMessage('Не удалось получить список записей');
+            return;
+        }
+        if (recordings.length === 0) {
+            this.addSystemMessage('📼 В этой комнате еще нет записей звонков');
+            return;
+        }
+        
+        const listEl = document.createElement('div');
+        listEl.className = 'system-message recordings';
+        listEl.textContent = '📼 Записи звонков:';
+        recordings.forEach(recording => {
+            const itemEl = document.createElement('div');
+            itemEl.textContent = `${new Date(recording.started_at).toLocaleString()} (${recording.started_by}): `;
+            recording.files.forEach(file => {
+                const link = document.createElement('a');
+                link.href = this.attachmentHref(file);
+                link.textContent = `${file.username} ${file.kind === 'video' ? '🎥' : '🎤'}`;
+                link.download = file.filename;
+                itemEl.append(link, ' ');
+            });
+            listEl.appendChild(itemEl);
+        });
+        this.messagesContainer.appendChild(listEl);
+        this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
+    }
+    
+    // Запланированные встречи комнаты: ссылки на подключение, .ics для календаря, отмена и новая встреча
+    async showMeetings() {
+        let meetings;
+        try {
+            const response = await fetch(`/api/rooms/${encodeURIComponent(this.room)}/meetings`, {
+                headers: { 'X-Thoth-Token': this.sessionToken }
+            });
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            meetings = (await response.json()).meetings;
+        } catch (error) {
+            console.error('❌ Не удалось получить встречи:', error);
+            this.addSystemMessage('Не удалось получить список встреч');
+            return;
+        }
+        
+        const listEl = document.createElement('div');
+        listEl.className = 'system-message meetings';
+        listEl.textContent = meetings.length ? '📅 Встречи:' : '📅 В этой комнате нет запланированных встреч';
+        meetings.forEach(meeting => listEl.appendChild(this.meetingItem(meeting)));
+        
+        const scheduleBtn = document.createElement('button');
+        scheduleBtn.textContent = 'Запланировать';
+        scheduleBtn.addEventListener('click', () => this.scheduleMeeting());
+        listEl.append(' ', scheduleBtn);
+        
+        this.messagesContainer.appendChild(listEl);
+        this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
+    }
+    
+    meetingItem(meeting) {
+        const itemEl = document.createElement('div');
+        const minutes = Math.round(meeting.duration_seconds / 60);
+        itemEl.textContent = `${new Date(meeting.starts_at).toLocaleString()} «${meeting.title}», ${minutes} мин. (${meeting.organizer}): `;
+        
+        const links = meeting.invite_links || {};
+        const join = document.createElement('a');
+        join.href = links[this.username] || meeting.join_url;
+        join.textContent = 'ссылка';
+        join.title = 'Ссылка на подключение';
+        const ics = document.createElement('a');
+        ics.href = meeting.ics_url;
+        ics.textContent = '.ics';
+        ics.download = `meeting-${meeting.id}.ics`;
+        itemEl.append(join, ' ', ics);
+        
+        // Организатор получает персональные ссылки всех приглашенных и может отменить встречу
+        if (meeting.organizer === this.username) {
+            Object.entries(links)
+                .filter(([username]) => username !== this.username)
+                .forEach(([username, href]) => {
+                    const link = document.createElement('a');
+                    link.href = href;
+                    link.textContent = username;
+                    link.title = `Персональная ссылка для ${username}`;
+                    itemEl.append(' ', link);
+                });
+            const cancelBtn = document.createElement('button');
+            cancelBtn.textContent = 'Отменить';
+            cancelBtn.addEventListener('click', () => this.cancelMeeting(meeting, itemEl));
+            itemEl.append(' ', cancelBtn);
+        }
+        return itemEl;
+    }
+    
+    async scheduleMeeting() {
+        const title = prompt('Название встречи:');
+        if (!title) return;
+        const start = prompt('Начало (ГГГГ-ММ-ДД ЧЧ:ММ, местное время):');
+        if (!start) return;
+        const startsAt = new Date(start.trim().replace(' ', 'T'));
+        if (isNaN(startsAt)) {
+            this.addSystemMessage('Не удалось разобрать время начала встречи');
+            return;
+        }
+        const duration = parseInt(prompt('Длительность, минут:', '60'), 10) || 60;
+        const invitees = (prompt('Кого пригласить (имена через запятую):', '') || '')
+            .split(',').map(name => name.trim()).filter(Boolean);
+        
+        try {
+            const response = await fetch(`/api/rooms/${encodeURIComponent(this.room)}/meetings`, {
+                method: 'POST',
+                headers: { 'X-Thoth-Token': this.sessionToken, 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    title: title,
+                    starts_at: startsAt.toISOString(),
+                    duration_minutes: duration,
+                    invitees: invitees
+                })
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || response.statusText);
+            
+            const doneEl = document.createElement('div');
+            doneEl.className = 'system-message meetings';
+            doneEl.textContent = '📅 Встреча запланирована: ';
+            doneEl.appendChild(this.meetingItem(data));
+            this.messagesContainer.appendChild(doneEl);
+            this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
+        } catch (error) {
+            this.addSystemMessage(`Не удалось запланировать встречу: ${error.message}`);
+        }
+    }
+    
+    async cancelMeeting(meeting, itemEl) {
+        if (!confirm(`Отменить встречу «${meeting.title}»? Ссылки на нее перестанут работать.`)) return;
+        try {
+            const response = await fetch(`/api/meetings/${encodeURIComponent(meeting.id)}`, {
+                method: 'DELETE',
+                headers: { 'X-Thoth-Token': this.sessionToken }
+            });
+            if (!response.ok) throw new Error((await response.json()).error || response.statusText);
+            itemEl.remove();
+            this.addSystemMessage(`📅 Встреча «${meeting.title}» отменена`);
+        } catch (error) {
+            this.addSystemMessage(`Не удалось отменить встречу: ${error.message}`);
+        }
+    }
+    
+    // Письма о пропущенных упоминаниях
+    
+    async configureEmailNotifications() {
+        const headers = { 'X-Thoth-Token': this.sessionToken };
+        try {
+            const currentResponse = await fetch('/api/notifications/preferences', { headers });
+            const current = await currentResponse.json();
+            if (!currentResponse.ok) {
+                throw new Error(current.error || currentResponse.statusText);
+            }
+            const email = prompt('Email для писем о пропущенных упоминаниях (пусто - не присылать):', current.email || '');
+            if (email === null) {
+                return;
+            }
+            const response = await fetch('/api/notifications/preferences', {
+                method: 'PUT',
+                headers: { ...headers, 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    email: email.trim(),
+                    email_enabled: email.trim() !== '',
+                    delay_minutes: current.delay_minutes || 0
+                })
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.error || response.statusText);
+            }
+            if (!data.email_enabled) {
+                this.addSystemMessage('Письма о пропущенных упоминаниях отключены');
+            } else if (data.email_confirmed) {
+                this.addSystemMessage(`Письма о пропущенных упоминаниях будут приходить на ${data.email}`);
+            } else {
+                this.addSystemMessage(`На ${data.email} отправлена ссылка для подтверждения адреса; письма начнут приходить после перехода по ней`);
+            }
+        } catch (error) {
+            this.addSystemMessage(`Не удалось сохранить настройки уведомлений: ${error.message}`);
+        }
+    }
+    
+    // Web Push: уведомления об упоминаниях и звонках, пока вкладка закрыта
+    
+    async enablePushNotifications() {
+        try {
+            if (await Notification.requestPermission() !== 'granted') {
+                throw new Error('браузер не разрешил уведомления');
+            }
+            const registration = await navigator.serviceWorker.register('/static/sw.js');
+            let subscription = await registration.pushManager.getSubscription();
+            if (!subscription) {
+                const { public_key: publicKey } = await (await fetch('/api/push/vapid-public-key')).json();
+                subscription = await registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: this.base64UrlToBytes(publicKey)
+                });
+            }
+            const response = await fetch('/api/push/subscriptions', {
+                method: 'POST',
+                headers: { 'X-Thoth-Token': this.sessionToken, 'Content-Type': 'application/json' },
+                body: JSON.stringify(subscription.toJSON())
+            });
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error || response.statusText);
+            }
+            this.addSystemMessage('Уведомления браузера включены');
+        } catch (error) {
+            this.addSystemMessage(`Не удалось включить уведомления браузера: ${error.message}`);
+        }
+    }
+    
+    base64UrlToBytes(value) {
+        const base64 = (value + '='.repeat((4 - value.length % 4) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+        return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+    }
+    
+    // Файлы
+    
+    async uploadFile(file) {
+        const form = new FormData();
+        form.append('file', file);
+        
+        try {
+            const response = await fetch(`/api/rooms/${encodeURIComponent(this.room)}/attachments`, {
+                method: 'POST',
+                headers: { 'X-Thoth-Token': this.sessionToken },
+                body: form
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.error || response.statusText);
+            }
+            this.pendingAttachments.push(data);
+            this.renderPendingAttachments();
+        } catch (error) {
+            this.addSystemMessage(`Не удалось загрузить ${file.name}: ${error.message}`);
+        }
+    }
+    
+    renderPendingAttachments() {
+        this.pendingContainer.replaceChildren();
+        this.pendingAttachments.forEach((attachment, index) => {
+            const chip = document.createElement('span');
+            chip.className = 'pending-attachment';
+            chip.textContent = `📎 ${attachment.filename}`;
+            const remove = document.createElement('button');
+            remove.textContent = '✕';
+            remove.addEventListener('click', () => {
+                this.pendingAttachments.splice(index, 1);
+                this.renderPendingAttachments();
+            });
+            chip.appendChild(remove);
+            this.pendingContainer.appendChild(chip);
+        });
+    }
+    
+    attachmentHref(attachment, url = attachment.url) {
+        return `${url || attachment.url}?token=${encodeURIComponent(this.sessionToken)}`;
+    }
+    
+    renderAttachment(attachment) {
+        const el = document.createElement('div');
+        el.className = 'message-attachment';
+        
+        if (attachment.content_type && attachment.content_type.startsWith('image/')) {
+            const img = document.createElement('img');
+            img.src = this.attachmentHref(attachment, attachment.thumbnail_url);
+            img.alt = attachment.filename;
+            img.loading = 'lazy';
+            if (attachment.width && attachment.height) {
+                img.width = attachment.width;
+                img.height = attachment.height;
+            }
+            el.appendChild(img);
+        }
+        
+        const link = document.createElement('a');
+        link.href = this.attachmentHref(attachment);
+        link.target = '_blank';
+        link.rel = 'noopener noreferrer';
+        link.textContent = `📎 ${attachment.filename} (${this.formatSize(attachment.size)})`;
+        el.appendChild(link);
+        return el;
+    }
+    
+    formatSize(bytes) {
+        if (bytes < 1024) return `${bytes} Б`;
+        if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} КБ`;
+        return `${(bytes / 1024 / 1024).toFixed(1)} МБ`;
     }
     
     // WebRTC методы
@@ -248,10 +851,21 @@ class ThothChatClient {
         
         // Обработчик для получения удаленного потока
         pc.ontrack = (event) => {
-            console.log('🎬 Получен удаленный поток от', username, 'треков:', event.streams[0].getTracks().length);
-            this.displayRemoteVideo(username, event.streams[0]);
-            this.broadcastingUsers.add(username);
+            // Через SFU потоки всех участников приходят по одному соединению, id потока - имя владельца
+            const stream = event.streams[0];
+            const owner = username === 'sfu' ? stream.id : username;
+            console.log('🎬 Получен удаленный поток от', owner, 'треков:', stream.getTracks().length);
+            this.displayRemoteVideo(owner, stream);
+            this.broadcastingUsers.add(owner);
             this.updateUsersList();
+            
+            stream.onremovetrack = () => {
+                if (stream.getTracks().length === 0) {
+                    document.getElementById(`video-${owner}`)?.remove();
+                    this.broadcastingUsers.delete(owner);
+                    this.updateUsersList();
+                }
+            };
         };
         
         // Обработчик ICE candidates
@@ -314,8 +928,8 @@ class ThothChatClient {
     async handleWebRTCOffer(data) {
         console.log('📞 Обрабатываем WebRTC offer от', data.username);
         
-        // Создаем peer connection (даже если у нас нет своего видео)
-        const pc = this.createPeerConnection(data.username);
+        // Повторный offer (новые треки) приходит в уже открытое соединение
+        const pc = this.peerConnections.get(data.username) || this.createPeerConnection(data.username);
         
         try {
             console.log('🔄 Устанавливаем remote description...');
@@ -381,12 +995,20 @@ class ThothChatClient {
             return;
         }
         
-        // Проверяем, есть ли уже соединение
-        if (this.peerConnections.has(targetUsername)) {
+        // Проверяем, есть ли уже соединение или приглашение
+        if (this.peerConnections.has(targetUsername) || this.pendingInvites.has(targetUsername)) {
             console.log('ℹ️ Соединение с', targetUsername, 'уже существует');
             return;
         }
         
+        // SDP сервер пропустит только после того, как приглашение примут
+        console.log('📞 Приглашаем в видео-звонок', targetUsername);
+        this.pendingInvites.add(targetUsername);
+        this.sendCallMessage('call_invite', targetUsername);
+        this.addSystemMessage(`📞 Звоним ${targetUsername}...`);
+    }
+    
+    async sendOffer(targetUsername) {
         console.log('📞 Начинаем видео-звонок с', targetUsername);
         const pc = this.createPeerConnection(targetUsername);
         
@@ -407,12 +1029,79 @@ class ThothChatClient {
         }
     }
     
+    // reportCallStats отправляет серверу сводку getStats каждого установленного соединения
+    // за время с прошлого отчета: RTT, потери, jitter, битрейт и тип кандидата
+    async reportCallStats() {
+        for (const [username, pc] of this.peerConnections) {
+            if (pc.connectionState !== 'connected' || !this.isConnected) continue;
+            try {
+                const stats = await this.collectStats(username, pc);
+                if (!stats) continue;
+                this.ws.send(JSON.stringify({
+                    type: 'call_stats',
+                    stats: stats,
+                    timestamp: new Date().toISOString()
+                }));
+            } catch (error) {
+                console.error('❌ Не удалось собрать статистику соединения с', username, error);
+            }
+        }
+    }
+    
+    async collectStats(username, pc) {
+        const report = await pc.getStats();
+        let pair = null;
+        report.forEach(s => {
+            if (s.type === 'transport' && s.selectedCandidatePairId) pair = report.get(s.selectedCandidatePairId);
+        });
+        if (!pair) {
+            // Firefox не отдает transport - ищем выбранную пару напрямую
+            report.forEach(s => {
+                if (s.type === 'candidate-pair' && s.nominated && s.state === 'succeeded') pair = s;
+            });
+        }
+        if (!pair) return null;
+        
+        const local = report.get(pair.localCandidateId);
+        let lost = 0, received = 0, jitter = 0;
+        report.forEach(s => {
+            if (s.type !== 'inbound-rtp') return;
+            lost += s.packetsLost || 0;
+            received += s.packetsReceived || 0;
+            jitter = Math.max(jitter, s.jitter || 0);
+        });
+        
+        const now = {
+            at: pair.timestamp,
+            lost, received,
+            bytesIn: pair.bytesReceived || 0,
+            bytesOut: pair.bytesSent || 0
+        };
+        const prev = this.statsBaseline.get(username);
+        this.statsBaseline.set(username, now);
+        if (!prev || now.at <= prev.at) return null; // первый замер - только база для следующего
+        
+        const seconds = (now.at - prev.at) / 1000;
+        const lostDelta = Math.max(0, now.lost - prev.lost);
+        const receivedDelta = Math.max(0, now.received - prev.received);
+        return {
+            peer: username,
+            rtt_ms: (pair.currentRoundTripTime || 0) * 1000,
+            packet_loss: lostDelta + receivedDelta > 0 ? lostDelta / (lostDelta + receivedDelta) : 0,
+            jitter_ms: jitter * 1000,
+            bitrate_in: Math.max(0, now.bytesIn - prev.bytesIn) * 8 / seconds,
+            bitrate_out: Math.max(0, now.bytesOut - prev.bytesOut) * 8 / seconds,
+            candidate_type: (local && local.candidateType) || 'host'
+        };
+    }
+    
     closePeerConnection(username) {
         const pc = this.peerConnections.get(username);
         if (pc) {
             console.log('🔌 Закрываем peer connection с', username);
             pc.close();
             this.peerConnections.delete(username);
+            this.statsBaseline.delete(username);
             
             // Удаляем видео элемент
             const videoElement = document.getElementById(`video-${username}`);
@@ -629,6 +1318,9 @@ class ThothChatClient {
     displayMessage(message) {
         const messageEl = document.createElement('div');
         messageEl.className = `message ${message.username === this.username ? 'own' : ''}`;
+        if (message.id) {
+            messageEl.dataset.messageId = message.id;
+        }
         
         const time = new Date(message.timestamp).toLocaleTimeString('ru-RU', {
             hour: '2-digit',
@@ -638,17 +1330,123 @@ class ThothChatClient {
         messageEl.innerHTML = `
             <div class="message-bubble">
                 <div class="message-header">
-                    <span>${message.username}</span>
+                    <span>${this.escapeHtml(message.display_name ? `${message.display_name} (${message.username})` : message.username)}</span>
                     <span>${time}</span>
                 </div>
-                <div class="message-content">${this.escapeHtml(message.content)}</div>
+                <div class="message-content"></div>
             </div>
         `;
         
+        // Markdown отрисован и очищен на сервере, поэтому HTML вставляется как есть
+        const content = messageEl.querySelector('.message-content');
+        if (message.format === 'markdown' && message.html) {
+            content.classList.add('markdown');
+            content.innerHTML = message.html;
+        } else {
+            content.textContent = message.content;
+        }
+        content.querySelectorAll('.mention').forEach(el => {
+            if (el.dataset.mention === this.username || el.dataset.mention === 'room') {
+                el.classList.add('mention-me');
+            }
+        });
+        
+        if (message.embeds && message.embeds.length) {
+            const bubble = messageEl.querySelector('.message-bubble');
+            message.embeds.forEach(embed => bubble.appendChild(this.renderEmbed(embed)));
+        }
+        
+        if (message.attachments && message.attachments.length) {
+            const bubble = messageEl.querySelector('.message-bubble');
+            message.attachments.forEach(attachment => bubble.appendChild(this.renderAttachment(attachment)));
+        }
+        
         this.messagesContainer.appendChild(messageEl);
         this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
     }
     
+    // Упоминание в текущей комнате видно в самом сообщении, из других комнат показываем уведомление
+    handleMention(data) {
+        if (data.room_id === this.room) {
+            return;
+        }
+        let text = data.content || '';
+        if (text.length > 120) {
+            text = text.slice(0, 120) + '…';
+        }
+        this.addSystemMessage(`🔔 ${data.username} упомянул вас в комнате "${data.room_id}": ${text}`);
+    }
+    
+    // Дополнение уже показанного сообщения, например превью ссылок
+    updateMessage(update) {
+        const messageEl = this.messagesContainer.querySelector(`[data-message-id="${Number(update.id)}"]`);
+        if (!messageEl || !update.previews) return;
+        
+        const bubble = messageEl.querySelector('.message-bubble');
+        bubble.querySelectorAll('.message-preview').forEach(el => el.remove());
+        update.previews.forEach(preview => bubble.appendChild(this.renderPreview(preview)));
+    }
+    
+    renderPreview(preview) {
+        const el = document.createElement('a');
+        el.className = 'message-preview';
+        el.href = preview.url;
+        el.target = '_blank';
+        el.rel = 'noopener noreferrer';
+        
+        if (preview.image_url) {
+            const img = document.createElement('img');
+            img.src = preview.image_url;
+            img.alt = '';
+            img.loading = 'lazy';
+            img.referrerPolicy = 'no-referrer';
+            img.addEventListener('error', () => img.remove());
+            el.appendChild(img);
+        }
+        [['site_name', 'message-preview-site'], ['title', 'message-preview-title'], ['description', 'message-preview-text']]
+            .forEach(([field, className]) => {
+                if (!preview[field]) return;
+                const div = document.createElement('div');
+                div.className = className;
+                div.textContent = preview[field];
+                el.appendChild(div);
+            });
+        return el;
+    }
+    
+    // Карточка-вложение от вебхука
+    renderEmbed(embed) {
+        const colors = { good: '#2eb886', warning: '#daa038', danger: '#a30200' };
+        const el = document.createElement('div');
+        el.className = 'message-embed';
+        el.style.borderLeftColor = colors[embed.color] || embed.color || '';
+        
+        if (embed.title) {
+            const title = document.createElement(embed.title_link ? 'a' : 'div');
+            title.className = 'message-embed-title';
+            title.textContent = embed.title;
+            if (embed.title_link) {
+                title.href = embed.title_link;
+                title.target = '_blank';
+                title.rel = 'noopener noreferrer';
+            }
+            el.appendChild(title);
+        }
+        if (embed.text) {
+            const text = document.createElement('div');
+            text.className = 'message-embed-text';
+            text.textContent = embed.text;
+            el.appendChild(text);
+        }
+        if (embed.footer) {
+            const footer = document.createElement('div');
+            footer.className = 'message-embed-footer';
+            footer.textContent = embed.footer;
+            el.appendChild(footer);
+        }
+        return el;
+    }
+    
     addSystemMessage(text) {
         const messageEl = document.createElement('div');
         messageEl.className = 'system-message';
@@ -666,6 +1464,7 @@ class ThothChatClient {
     removeUser(username) {
         this.onlineUsers.delete(username);
         this.broadcastingUsers.delete(username);
+        this.userStates.delete(username);
         this.updateUsersList();
     }
     
@@ -694,6 +1493,7 @@ class ThothChatClient {
             userEl.innerHTML = `
                 <div class="user-avatar">${initial}</div>
                 <span>${username}</span>
+                <span class="user-media">${this.mediaIcons(this.userStates.get(username))}</span>
                 <div class="user-status ${statusClass}"></div>
             `;
             
@@ -754,6 +1554,9 @@ class ThothChatClient {
             this.videoArea.classList.add('active');
             this.videoToggle.classList.add('active');
             this.videoToggle.textContent = '🖥️ Остановить экран';
+            this.audioToggle.classList.add('active');
+            this.audioToggle.textContent = '🎤 Выключить микрофон';
+            this.sendMediaState();
             
             // Обновляем статус пользователя
             this.broadcastingUsers.add(this.username);
@@ -853,6 +1656,9 @@ class ThothChatClient {
         this.videoArea.classList.remove('active');
         this.videoToggle.classList.remove('active');
         this.videoToggle.textContent = '🖥️ Экран';
+        this.audioToggle.classList.remove('active');
+        this.audioToggle.textContent = '🎤 Микрофон';
+        this.sendMediaState();
         
         // Обновляем статус пользователя
         this.broadcastingUsers.delete(this.username);
@@ -864,6 +1670,11 @@ class ThothChatClient {
             pc.close();
         });
         this.peerConnections.clear();
+        this.statsBaseline.clear();
+        this.pendingInvites.clear();
+        if (this.isConnected) {
+            this.ws.send(JSON.stringify({ type: 'call_hangup' }));
+        }
         
         // Удаляем все удаленные видео
         const remoteVideos = this.videoArea.querySelectorAll('[id^="video-"]:not([id="localVideo"])');
@@ -883,10 +1694,55 @@ class ThothChatClient {
                 this.audioToggle.classList.toggle('active', audioTrack.enabled);
                 this.audioToggle.textContent = audioTrack.enabled ? '🎤 Выключить микрофон' : '🎤 Включить микрофон';
                 console.log('🎤 Аудио:', audioTrack.enabled ? 'включено' : 'выключено');
+                this.sendMediaState();
             }
         }
     }
     
+    toggleHand() {
+        this.mediaState.hand = !this.mediaState.hand;
+        this.handToggle.classList.toggle('active', this.mediaState.hand);
+        this.handToggle.textContent = this.mediaState.hand ? '✋ Опустить руку' : '✋ Рука';
+        this.sendMediaState();
+    }
+    
+    // sendMediaState сообщает комнате, что мы сейчас передаем. Демонстрация экрана - это
+    // видеодорожка экрана, камеры клиент не включает
+    sendMediaState() {
+        const audioTrack = this.localStream && this.localStream.getAudioTracks()[0];
+        const screenTrack = this.localStream && this.localStream.getVideoTracks()[0];
+        this.mediaState.audio = !!(audioTrack && audioTrack.enabled);
+        this.mediaState.screen = !!(screenTrack && screenTrack.readyState === 'live');
+        this.mediaState.video = false;
+        
+        if (!this.isConnected) return;
+        this.ws.send(JSON.stringify({
+            type: 'media_state',
+            media: this.mediaState,
+            timestamp: new Date().toISOString()
+        }));
+    }
+    
+    handleMediaState(data) {
+        const previous = this.userStates.get(data.username);
+        this.userStates.set(data.username, { username: data.username, ...data.media });
+        if (data.media.hand && !(previous && previous.hand) && data.username !== this.username) {
+            this.addSystemMessage(`✋ ${data.username}: поднята рука`);
+        }
+        this.updateUsersList();
+    }
+    
+    mediaIcons(state) {
+        if (!state) return '';
+        const icons = [];
+        if (state.hand) icons.push('✋');
+        if (state.screen) icons.push('🖥️');
+        if (state.video) icons.push('📹');
+        if (state.audio) icons.push('🎤');
+        else if (state.screen || state.video) icons.push('🔇');
+        return icons.join(' ');
+    }
+    
     escapeHtml(text) {
         const div = document.createElement('div');
         div.textContent = text;
@@ -0,0 +1,35 @@
+// Service worker показывает Web Push уведомления, пока вкладка чата закрыта
+
+self.addEventListener('push', (event) => {
+    if (!event.data) {
+        return;
+    }
+    let data;
+    try {
+        data = event.data.json();
+    } catch (e) {
+        data = { title: 'Thoth', body: event.data.text() };
+    }
+
+    event.waitUntil(self.registration.showNotification(data.title || 'Thoth', {
+        body: data.body || '',
+        tag: data.tag,
+        renotify: data.type === 'call_offer',
+        requireInteraction: data.type === 'call_offer',
+        data: { url: data.url || '/' }
+    }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    const url = new URL(event.notification.data.url, self.location.origin).href;
+
+    event.waitUntil((async () => {
+        const windows = await clients.matchAll({ type: 'window', includeUncontrolled: true });
+        const existing = windows.find(w => w.url.startsWith(self.location.origin));
+        if (existing) {
+            return existing.focus();
+        }
+        return clients.openWindow(url);
+    })());
+});